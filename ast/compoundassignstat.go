@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"github.com/arnodel/golua/ops"
+)
+
+// CompoundAssignStat represents a compound assignment Dest op= Value, e.g.
+// "x += 1".  It has the same effect as "Dest = Dest op Value", except that the
+// collection and index of Dest are only evaluated once.  It is a syntax
+// extension (see scanner.CompoundAssignment).
+type CompoundAssignStat struct {
+	Location
+	Dest  Var
+	Op    ops.Op
+	Value ExpNode
+}
+
+var _ Stat = CompoundAssignStat{}
+
+// NewCompoundAssignStat makes a new CompoundAssignStat.
+func NewCompoundAssignStat(dst Var, op ops.Op, val ExpNode) CompoundAssignStat {
+	return CompoundAssignStat{
+		Location: MergeLocations(dst, val),
+		Dest:     dst,
+		Op:       op,
+		Value:    val,
+	}
+}
+
+// Operation returns the expression assigned to Dest, i.e. "Dest op Value".
+func (s CompoundAssignStat) Operation() *BinOp {
+	return &BinOp{
+		Location: s.Location,
+		Left:     s.Dest,
+		OpType:   s.Op.Type(),
+		Right:    []Operation{{s.Op, s.Value}},
+	}
+}
+
+// HWrite prints the AST in tree form.
+func (s CompoundAssignStat) HWrite(w HWriter) {
+	w.Writef("compound assign: %s", s.Op)
+	w.Indent()
+	w.Next()
+	w.Writef("dst: ")
+	s.Dest.HWrite(w)
+	w.Next()
+	w.Writef("src: ")
+	s.Value.HWrite(w)
+	w.Dedent()
+}
+
+// ProcessStat uses the given StatProcessor to process the receiver.
+func (s CompoundAssignStat) ProcessStat(p StatProcessor) {
+	p.ProcessCompoundAssignStat(s)
+}
@@ -0,0 +1,30 @@
+package ast
+
+import (
+	"github.com/arnodel/golua/token"
+)
+
+// ContinueStat is a statement node representing the "continue" statement,
+// which skips to the next iteration of the enclosing loop.  It is a syntax
+// extension (see scanner.Continue).
+type ContinueStat struct {
+	Location
+}
+
+var _ Stat = ContinueStat{}
+
+// NewContinueStat returns a ContinueStat instance (the token is needed to
+// record the location of the statement).
+func NewContinueStat(tok *token.Token) ContinueStat {
+	return ContinueStat{Location: LocFromToken(tok)}
+}
+
+// HWrite prints a tree representation of the node.
+func (s ContinueStat) HWrite(w HWriter) {
+	w.Writef("continue")
+}
+
+// ProcessStat uses the given StatProcessor to process the receiver.
+func (s ContinueStat) ProcessStat(p StatProcessor) {
+	p.ProcessContinueStat(s)
+}
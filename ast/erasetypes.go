@@ -0,0 +1,39 @@
+package ast
+
+// EraseTypes returns a copy of chunk without type annotations: type alias
+// statements are removed and the type annotations of local variables and
+// functions are cleared.  If chunk has no type annotations, it is returned
+// unchanged.
+func EraseTypes(chunk BlockStat) BlockStat {
+	if !hasTypes(chunk) {
+		return chunk
+	}
+	return Rewrite(chunk, func(node Node) Node {
+		switch n := node.(type) {
+		case TypeAliasStat:
+			return nil
+		case LocalStat:
+			// Rewrite has already copied the NameAttribs slice.
+			for i := range n.NameAttribs {
+				n.NameAttribs[i].Type = nil
+			}
+			return n
+		case Function:
+			n.Signature = nil
+			return n
+		}
+		return node
+	}).(BlockStat)
+}
+
+func hasTypes(node Node) bool {
+	found := false
+	Inspect(node, func(n Node) bool {
+		switch n.(type) {
+		case TypeAliasStat, TypeExp:
+			found = true
+		}
+		return !found
+	})
+	return found
+}
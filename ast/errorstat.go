@@ -0,0 +1,31 @@
+package ast
+
+import (
+	"github.com/arnodel/golua/token"
+)
+
+// ErrorStat is a statement node standing in for a statement that could not be
+// parsed.  It is only produced by the parser in error recovery mode, and it
+// cannot be compiled.
+type ErrorStat struct {
+	Location
+	Message string // Description of the syntax error
+}
+
+var _ Stat = ErrorStat{}
+
+// NewErrorStat returns an ErrorStat instance spanning from the start token to
+// the end token.
+func NewErrorStat(start, end *token.Token, msg string) ErrorStat {
+	return ErrorStat{Location: LocFromTokens(start, end), Message: msg}
+}
+
+// ProcessStat uses the given StatProcessor to process the receiver.
+func (s ErrorStat) ProcessStat(p StatProcessor) {
+	p.ProcessErrorStat(s)
+}
+
+// HWrite prints a tree representation of the node.
+func (s ErrorStat) HWrite(w HWriter) {
+	w.Writef("error stat: %s", s.Message)
+}
@@ -11,6 +11,10 @@ type Function struct {
 	ParList
 	Body BlockStat
 	Name string
+
+	// The type annotations of the parameters and return values, or nil if
+	// there are none (see scanner.TypeAnnotations).
+	Signature *FunctionType
 }
 
 var _ ExpNode = Function{}
@@ -46,6 +50,9 @@ func (f Function) HWrite(w HWriter) {
 		w.Writef("...")
 	}
 	w.Writef(")")
+	if f.Signature != nil {
+		w.Writef(" %s", Sprint(*f.Signature))
+	}
 	w.Indent()
 	w.Next()
 	f.Body.HWrite(w)
@@ -6,7 +6,7 @@ package ast
 func NewFunctionStat(fName Var, method Name, fx Function) AssignStat {
 	// TODO: include the "function" keywork in the location calculation
 	if method.Val != "" {
-		loc := fx.Locate()
+		loc, sig := fx.Locate(), fx.Signature
 		fx = NewFunction(
 			nil, nil,
 			ParList{append([]Name{{Val: "self"}}, fx.Params...), fx.HasDots},
@@ -14,6 +14,11 @@ func NewFunctionStat(fName Var, method Name, fx Function) AssignStat {
 		)
 		fx.Location = loc
 		fx.Name = method.FunctionName()
+		if sig != nil {
+			methodSig := *sig
+			methodSig.Params = append([]TypeExp{nil}, sig.Params...)
+			fx.Signature = &methodSig
+		}
 		fName = NewIndexExp(fName, method.AstString())
 	} else {
 		fx.Name = fName.FunctionName()
@@ -0,0 +1,77 @@
+package ast
+
+import (
+	"github.com/arnodel/golua/token"
+)
+
+// GlobalStat is a statement node representing a global declaration (Lua 5.5),
+// either of a list of names, optionally with values, or of all names ("global
+// *").
+type GlobalStat struct {
+	Location
+	NameAttribs []NameAttrib // Empty for "global *"
+	Values      []ExpNode
+
+	// For "global *", All is true and Attrib is the attribute that applies to
+	// all names.
+	All    bool
+	Attrib LocalAttrib
+}
+
+var _ Stat = GlobalStat{}
+
+// NewGlobalStat returns a GlobalStat instance declaring the given names with the
+// given values.  It assumes that globalTok is the "global" token.
+func NewGlobalStat(globalTok *token.Token, nameAttribs []NameAttrib, values []ExpNode) GlobalStat {
+	loc := MergeLocations(LocFromToken(globalTok), nameAttribs[len(nameAttribs)-1])
+	if len(values) > 0 {
+		loc = MergeLocations(loc, values[len(values)-1])
+	}
+	// Give a name to functions defined here if possible
+	for i, v := range values {
+		if i >= len(nameAttribs) {
+			break
+		}
+		f, ok := v.(Function)
+		if ok && f.Name == "" {
+			f.Name = nameAttribs[i].Name.Val
+			values[i] = f
+		}
+	}
+	return GlobalStat{Location: loc, NameAttribs: nameAttribs, Values: values}
+}
+
+// NewGlobalAllStat returns a GlobalStat instance for "global <attrib> *".  It
+// assumes that globalTok is the "global" token and starTok the "*" token.
+func NewGlobalAllStat(globalTok, starTok *token.Token, attrib LocalAttrib) GlobalStat {
+	return GlobalStat{
+		Location: LocFromTokens(globalTok, starTok),
+		All:      true,
+		Attrib:   attrib,
+	}
+}
+
+// ProcessStat uses the given StatProcessor to process the receiver.
+func (s GlobalStat) ProcessStat(p StatProcessor) {
+	p.ProcessGlobalStat(s)
+}
+
+// HWrite prints a tree representation of the node.
+func (s GlobalStat) HWrite(w HWriter) {
+	if s.All {
+		w.Writef("global * %d", s.Attrib)
+		return
+	}
+	w.Writef("global")
+	w.Indent()
+	for i, nameAttrib := range s.NameAttribs {
+		w.Next()
+		w.Writef("name_%d: %s", i, nameAttrib)
+	}
+	for i, val := range s.Values {
+		w.Next()
+		w.Writef("val_%d: ", i)
+		val.HWrite(w)
+	}
+	w.Dedent()
+}
@@ -1,10 +1,14 @@
 package ast
 
 // An IndexExp is an expression node representing indexing, i.e. "Coll[Index]".
+// If Safe is true, it represents "Coll?[Index]" which evaluates to nil if Coll
+// is nil (a syntax extension, see scanner.SafeNavigation).  Safe indexing
+// cannot be assigned to.
 type IndexExp struct {
 	Location
 	Coll ExpNode
 	Idx  ExpNode
+	Safe bool
 }
 
 var _ Var = IndexExp{}
@@ -18,6 +22,14 @@ func NewIndexExp(coll ExpNode, idx ExpNode) IndexExp {
 	}
 }
 
+// NewSafeIndexExp returns an IndexExp instance for the given collection and
+// index, with safe navigation.
+func NewSafeIndexExp(coll ExpNode, idx ExpNode) IndexExp {
+	e := NewIndexExp(coll, idx)
+	e.Safe = true
+	return e
+}
+
 // ProcessExp uses the given ExpProcessor to process the receiver.
 func (e IndexExp) ProcessExp(p ExpProcessor) {
 	p.ProcessIndexExp(e)
@@ -40,7 +52,11 @@ func (e IndexExp) FunctionName() string {
 
 // HWrite prints a tree representation of the node.
 func (e IndexExp) HWrite(w HWriter) {
-	w.Writef("idx")
+	if e.Safe {
+		w.Writef("safe idx")
+	} else {
+		w.Writef("idx")
+	}
 	w.Indent()
 	w.Next()
 	w.Writef("coll: ")
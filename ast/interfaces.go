@@ -49,10 +49,15 @@ type StatProcessor interface {
 	ProcessAssignStat(AssignStat)
 	ProcessBlockStat(BlockStat)
 	ProcessBreakStat(BreakStat)
+	ProcessCompoundAssignStat(CompoundAssignStat)
+	ProcessContinueStat(ContinueStat)
 	ProcessEmptyStat(EmptyStat)
+	ProcessErrorStat(ErrorStat)
 	ProcessForInStat(ForInStat)
 	ProcessForStat(ForStat)
 	ProcessFunctionCallStat(FunctionCall)
+	ProcessGlobalFunctionStat(GlobalFunctionStat)
+	ProcessGlobalStat(GlobalStat)
 	ProcessGotoStat(GotoStat)
 	ProcessIfStat(IfStat)
 	ProcessLabelStat(LabelStat)
@@ -63,11 +63,13 @@ const (
 )
 
 // A NameAttrib is a name introduce by a local definition, together with an
-// optional attribute (in Lua 5.4 that is 'close' or 'const').
+// optional attribute (in Lua 5.4 that is 'close' or 'const') and an optional
+// type annotation (see scanner.TypeAnnotations).
 type NameAttrib struct {
 	Location
 	Name   Name
 	Attrib LocalAttrib
+	Type   TypeExp
 }
 
 // NewNameAttrib returns a new NameAttribe for the given name and attrib.
@@ -0,0 +1,832 @@
+package ast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/arnodel/golua/ops"
+)
+
+// Fprint writes Lua source code for the node to w.  A BlockStat is printed as a
+// chunk (i.e. a list of statements with no enclosing "do ... end").
+//
+// Parsing the output gives back the same tree, except for source locations and
+// for trees that were not produced by the parser (e.g. a BinOp that has a
+// BinOp of the same type as left operand is flattened, and a ";" is inserted
+// between statements when the second one starts with a bracket and would
+// otherwise continue the first one).  Comments and the
+// original formatting are not preserved.  An ErrorStat is printed as a
+// comment.
+func Fprint(w io.Writer, node Node) error {
+	bw := bufio.NewWriter(w)
+	p := &printer{w: bw}
+	if b, ok := node.(BlockStat); ok {
+		p.stats(b, false)
+	} else if s, ok := node.(Stat); ok {
+		p.stat(s)
+	} else if e, ok := node.(ExpNode); ok {
+		p.exp(e)
+	} else if t, ok := node.(TypeExp); ok {
+		p.typ(t)
+	} else {
+		p.unknown(node)
+	}
+	return bw.Flush()
+}
+
+// Sprint returns Lua source code for the node, as written by Fprint.
+func Sprint(node Node) string {
+	var b strings.Builder
+	_ = Fprint(&b, node)
+	return b.String()
+}
+
+type printer struct {
+	w     *bufio.Writer
+	depth int
+}
+
+const indentUnit = "    "
+
+func (p *printer) print(args ...interface{}) {
+	for _, arg := range args {
+		switch x := arg.(type) {
+		case string:
+			p.w.WriteString(x)
+		case ExpNode:
+			p.exp(x)
+		}
+	}
+}
+
+// unknown writes a comment in place of a node that can't be written as Lua
+// source.
+func (p *printer) unknown(node Node) {
+	p.print(fmt.Sprintf("--[[ %T ]]", node))
+}
+
+func (p *printer) newline() {
+	p.w.WriteByte('\n')
+	for i := 0; i < p.depth; i++ {
+		p.w.WriteString(indentUnit)
+	}
+}
+
+//
+// Statements
+//
+
+// stats writes the statements in a block, each one on its own line.  For a
+// function body, an empty return statement at the end is omitted as it is
+// implicit.
+func (p *printer) stats(b BlockStat, isFuncBody bool) {
+	first := true
+	next := func() {
+		if !first {
+			p.newline()
+		}
+		first = false
+	}
+	var prev Stat
+	for _, s := range b.Stats {
+		next()
+		if prev != nil && endsWithExp(prev) && startsWithBracket(s) {
+			// Otherwise it would be parsed as a call to the expression at the
+			// end of the previous statement.
+			p.print(";")
+		}
+		p.stat(s)
+		prev = s
+	}
+	if b.Return != nil && !(isFuncBody && len(b.Return) == 0) {
+		next()
+		p.print("return")
+		if len(b.Return) > 0 {
+			p.print(" ")
+			p.expList(b.Return)
+		}
+	}
+}
+
+// body writes a block indented on the lines following the current one, then
+// moves to the line after it.
+func (p *printer) body(b BlockStat, isFuncBody bool) {
+	p.depth++
+	if len(b.Stats) > 0 || b.Return != nil && !(isFuncBody && len(b.Return) == 0) {
+		p.newline()
+		p.stats(b, isFuncBody)
+	}
+	p.depth--
+	p.newline()
+}
+
+func (p *printer) stat(s Stat) {
+	switch n := s.(type) {
+	case AssignStat:
+		if p.functionStat(n) {
+			return
+		}
+		for i, dst := range n.Dest {
+			if i > 0 {
+				p.print(", ")
+			}
+			p.exp(dst)
+		}
+		p.print(" = ")
+		p.expList(n.Src)
+	case BlockStat:
+		p.print("do")
+		p.body(n, false)
+		p.print("end")
+	case BreakStat:
+		p.print("break")
+	case CompoundAssignStat:
+		p.print(n.Dest, " ", opStrings[n.Op], "= ", n.Value)
+	case ContinueStat:
+		p.print("continue")
+	case EmptyStat:
+		p.print(";")
+	case ErrorStat:
+		p.print("-- error: ", strings.ReplaceAll(n.Message, "\n", " "))
+	case ForInStat:
+		p.forInStat(n)
+	case *ForInStat:
+		p.forInStat(*n)
+	case ForStat:
+		p.forStat(n)
+	case *ForStat:
+		p.forStat(*n)
+	case FunctionCall:
+		p.call(*n.BFunctionCall)
+	case GotoStat:
+		p.print("goto ", n.Label.Val)
+	case IfStat:
+		p.print("if ", n.If.Cond, " then")
+		p.body(n.If.Body, false)
+		for _, s := range n.ElseIfs {
+			p.print("elseif ", s.Cond, " then")
+			p.body(s.Body, false)
+		}
+		if n.Else != nil {
+			p.print("else")
+			p.body(*n.Else, false)
+		}
+		p.print("end")
+	case LabelStat:
+		p.print("::", n.Name.Val, "::")
+	case LocalFunctionStat:
+		p.print("local function ", n.Name.Val)
+		p.funcBody(n.Function, false)
+	case LocalStat:
+		p.print("local ")
+		p.nameAttribs(n.NameAttribs)
+		if len(n.Values) > 0 {
+			p.print(" = ")
+			p.expList(n.Values)
+		}
+	case GlobalFunctionStat:
+		p.print("global function ", n.Name.Val)
+		p.funcBody(n.Function, false)
+	case GlobalStat:
+		p.print("global ")
+		if n.All {
+			if n.Attrib != NoAttrib {
+				p.attrib(n.Attrib)
+				p.print(" ")
+			}
+			p.print("*")
+			break
+		}
+		p.nameAttribs(n.NameAttribs)
+		if len(n.Values) > 0 {
+			p.print(" = ")
+			p.expList(n.Values)
+		}
+	case TypeAliasStat:
+		p.print("type ", n.Name.Val, " = ")
+		p.typ(n.Type)
+	case RepeatStat:
+		p.print("repeat")
+		p.body(n.Body, false)
+		p.print("until ", n.Cond)
+	case WhileStat:
+		p.print("while ", n.Cond, " do")
+		p.body(n.Body, false)
+		p.print("end")
+	default:
+		p.unknown(s)
+	}
+}
+
+// functionStat writes s as a function statement (e.g. "function a.b:c() ...
+// end") if it has the right shape and returns true, otherwise it returns false.
+func (p *printer) functionStat(s AssignStat) bool {
+	if len(s.Dest) != 1 || len(s.Src) != 1 || !isFuncName(s.Dest[0]) {
+		return false
+	}
+	f, ok := s.Src[0].(Function)
+	if !ok {
+		return false
+	}
+	p.print("function ")
+	idx, ok := s.Dest[0].(IndexExp)
+	method := ok && isMethod(f)
+	if method {
+		// The implicit "self" parameter is added by the parser to methods and
+		// has no location.
+		p.print(idx.Coll, ":", string(idx.Idx.(String).Val))
+	} else {
+		p.exp(s.Dest[0])
+	}
+	p.funcBody(f, method)
+	return true
+}
+
+func (p *printer) forStat(s ForStat) {
+	p.print("for ", s.Var.Val, " = ", s.Start, ", ", s.Stop)
+	if !isDefaultStep(s.Step) {
+		p.print(", ", s.Step)
+	}
+	p.print(" do")
+	p.body(s.Body, false)
+	p.print("end")
+}
+
+func (p *printer) forInStat(s ForInStat) {
+	p.print("for ")
+	for i, name := range s.Vars {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.print(name.Val)
+	}
+	p.print(" in ")
+	p.expList(s.Params)
+	p.print(" do")
+	p.body(s.Body, false)
+	p.print("end")
+}
+
+//
+// Expressions
+//
+
+func (p *printer) expList(exps []ExpNode) {
+	for i, e := range exps {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.exp(e)
+	}
+}
+
+func (p *printer) exp(e ExpNode) {
+	switch n := e.(type) {
+	case BFunctionCall:
+		p.print("(")
+		p.call(n)
+		p.print(")")
+	case *BFunctionCall:
+		p.print("(")
+		p.call(*n)
+		p.print(")")
+	case FunctionCall:
+		p.call(*n.BFunctionCall)
+	case BinOp:
+		p.binOp(n)
+	case *BinOp:
+		p.binOp(*n)
+	case Bool:
+		p.print(strconv.FormatBool(n.Val))
+	case Etc:
+		p.print("...")
+	case Float:
+		p.print(formatFloat(n.Val))
+	case Function:
+		p.print("function")
+		p.funcBody(n, false)
+	case IndexExp:
+		p.prefixExp(n.Coll)
+		if n.Safe {
+			p.print("?")
+		}
+		if s, ok := n.Idx.(String); ok && isName(string(s.Val)) {
+			p.print(".", string(s.Val))
+		} else {
+			p.print("[", n.Idx, "]")
+		}
+	case Int:
+		if n.Val > math.MaxInt64 {
+			// In decimal it would be parsed as a float.
+			p.print("0x", strconv.FormatUint(n.Val, 16))
+		} else {
+			p.print(strconv.FormatUint(n.Val, 10))
+		}
+	case Name:
+		p.print(n.Val)
+	case Nil:
+		p.print("nil")
+	case String:
+		p.print(quoteString(n.Val))
+	case TableConstructor:
+		p.print("{")
+		for i, f := range n.Fields {
+			if i > 0 {
+				p.print(", ")
+			}
+			if _, ok := f.Key.(NoTableKey); !ok {
+				if s, ok := f.Key.(String); ok && isName(string(s.Val)) {
+					p.print(string(s.Val))
+				} else {
+					p.print("[", f.Key, "]")
+				}
+				p.print(" = ")
+			}
+			p.exp(f.Value)
+		}
+		p.print("}")
+	case UnOp:
+		p.unOp(n)
+	case *UnOp:
+		p.unOp(*n)
+	default:
+		p.unknown(e)
+	}
+}
+
+func (p *printer) call(c BFunctionCall) {
+	p.prefixExp(c.Target)
+	if c.Method.Val != "" {
+		p.print(":", c.Method.Val)
+	}
+	p.print("(")
+	p.expList(c.Args)
+	p.print(")")
+}
+
+// prefixExp writes e, in brackets if it cannot be indexed or called as it is.
+func (p *printer) prefixExp(e ExpNode) {
+	if isPrefixExp(e) {
+		p.exp(e)
+	} else {
+		p.print("(", e, ")")
+	}
+}
+
+// funcBody writes the parameters and body of f.  If skipSelf is true, the
+// first parameter is omitted (it is the implicit "self" parameter of a
+// method).
+func (p *printer) funcBody(f Function, skipSelf bool) {
+	var (
+		params     = f.Params
+		paramTypes []TypeExp
+		sig        = f.Signature
+	)
+	if sig != nil {
+		paramTypes = sig.Params
+	}
+	if skipSelf {
+		params = params[1:]
+		if paramTypes != nil {
+			paramTypes = paramTypes[1:]
+		}
+	}
+	p.print("(")
+	for i, param := range params {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.print(param.Val)
+		if i < len(paramTypes) && paramTypes[i] != nil {
+			p.print(": ")
+			p.typ(paramTypes[i])
+		}
+	}
+	if f.HasDots {
+		if len(params) > 0 {
+			p.print(", ")
+		}
+		p.print("...")
+		if sig != nil && sig.Varargs != nil {
+			p.print(": ")
+			p.typ(sig.Varargs)
+		}
+	}
+	p.print(")")
+	if sig != nil {
+		p.returnTypes(*sig)
+	}
+	p.body(f.Body, true)
+	p.print("end")
+}
+
+//
+// Type annotations
+//
+
+func (p *printer) typ(t TypeExp) {
+	switch n := t.(type) {
+	case NamedType:
+		p.print(n.Name)
+	case OptionalType:
+		p.bracketedType(n.Type)
+		p.print("?")
+	case UnionType:
+		for i, t := range n.Types {
+			if i > 0 {
+				p.print(" | ")
+			}
+			p.bracketedType(t)
+		}
+	case TableType:
+		p.print("{")
+		sep := ""
+		if n.Elem != nil {
+			p.typ(n.Elem)
+			sep = ", "
+		}
+		if n.Key != nil {
+			p.print(sep, "[")
+			p.typ(n.Key)
+			p.print("]: ")
+			p.typ(n.Value)
+			sep = ", "
+		}
+		for _, f := range n.Fields {
+			p.print(sep, f.Name.Val, ": ")
+			p.typ(f.Type)
+			sep = ", "
+		}
+		p.print("}")
+	case FunctionType:
+		p.print("function(")
+		for i, t := range n.Params {
+			if i > 0 {
+				p.print(", ")
+			}
+			if t == nil {
+				t = NamedType{Name: "any"}
+			}
+			p.typ(t)
+		}
+		if n.HasDots {
+			if len(n.Params) > 0 {
+				p.print(", ")
+			}
+			p.print("...")
+			if n.Varargs != nil {
+				p.print(": ")
+				p.typ(n.Varargs)
+			}
+		}
+		p.print(")")
+		p.returnTypes(n)
+	default:
+		p.unknown(t)
+	}
+}
+
+// bracketedType writes t, in brackets if it is a union or a function type
+// with return types (otherwise a following "?" or "|" would apply to a part
+// of it).
+func (p *printer) bracketedType(t TypeExp) {
+	switch n := t.(type) {
+	case UnionType:
+	case FunctionType:
+		if !n.HasReturns {
+			p.typ(t)
+			return
+		}
+	default:
+		p.typ(t)
+		return
+	}
+	p.print("(")
+	p.typ(t)
+	p.print(")")
+}
+
+// returnTypes writes the return types of f if they are given, e.g. ": string"
+// or ": (number, string)".
+func (p *printer) returnTypes(f FunctionType) {
+	if !f.HasReturns {
+		return
+	}
+	p.print(": ")
+	if len(f.Returns) == 1 {
+		p.typ(f.Returns[0])
+		return
+	}
+	p.print("(")
+	for i, t := range f.Returns {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.typ(t)
+	}
+	p.print(")")
+}
+
+// binOp writes b without brackets around it.  Operands are bracketed when
+// required by operator precedence.
+func (p *printer) binOp(b BinOp) {
+	rightAssoc := isRightAssoc(b.OpType)
+	if rightAssoc {
+		// The operations in b are applied left to right, which must be made
+		// explicit for right associative operators.
+		p.print(strings.Repeat("(", len(b.Right)-1))
+	}
+	p.operand(b.Left, needsBracketsOnLeft(b.Left, b.OpType))
+	for i, r := range b.Right {
+		p.print(" ", opStrings[r.Op], " ")
+		p.operand(r.Operand, needsBracketsOnRight(r.Operand, b.OpType))
+		if rightAssoc && i < len(b.Right)-1 {
+			p.print(")")
+		}
+	}
+}
+
+func (p *printer) unOp(u UnOp) {
+	if u.Op == ops.OpId {
+		p.exp(u.Operand)
+		return
+	}
+	p.print(opStrings[u.Op])
+	if u.Op == ops.OpNot {
+		p.print(" ")
+	} else if op, _ := unOpType(u.Operand); u.Op == ops.OpNeg && op == ops.OpNeg {
+		// Avoid "--", which starts a comment.
+		p.print(" ")
+	}
+	op, ok := binOpType(u.Operand)
+	p.operand(u.Operand, ok && op != ops.OpPow)
+}
+
+func (p *printer) operand(e ExpNode, brackets bool) {
+	if brackets {
+		p.print("(", e, ")")
+	} else {
+		p.exp(e)
+	}
+}
+
+//
+// Helpers
+//
+
+var opStrings = map[ops.Op]string{
+	ops.OpOr:       "or",
+	ops.OpAnd:      "and",
+	ops.OpLt:       "<",
+	ops.OpLeq:      "<=",
+	ops.OpGt:       ">",
+	ops.OpGeq:      ">=",
+	ops.OpEq:       "==",
+	ops.OpNeq:      "~=",
+	ops.OpBitOr:    "|",
+	ops.OpBitXor:   "~",
+	ops.OpBitAnd:   "&",
+	ops.OpShiftL:   "<<",
+	ops.OpShiftR:   ">>",
+	ops.OpConcat:   "..",
+	ops.OpAdd:      "+",
+	ops.OpSub:      "-",
+	ops.OpMul:      "*",
+	ops.OpDiv:      "/",
+	ops.OpFloorDiv: "//",
+	ops.OpMod:      "%",
+	ops.OpPow:      "^",
+	ops.OpNeg:      "-",
+	ops.OpNot:      "not",
+	ops.OpLen:      "#",
+	ops.OpBitNot:   "~",
+}
+
+func isRightAssoc(opType ops.Op) bool {
+	return opType == ops.OpConcat || opType == ops.OpPow
+}
+
+func binOpType(e ExpNode) (ops.Op, bool) {
+	switch n := e.(type) {
+	case BinOp:
+		return n.OpType, true
+	case *BinOp:
+		return n.OpType, true
+	}
+	return 0, false
+}
+
+func unOpType(e ExpNode) (ops.Op, bool) {
+	switch n := e.(type) {
+	case UnOp:
+		return n.Op, true
+	case *UnOp:
+		return n.Op, true
+	}
+	return 0, false
+}
+
+func needsBracketsOnLeft(e ExpNode, opType ops.Op) bool {
+	if t, ok := binOpType(e); ok {
+		pdiff := t.Precedence() - opType.Precedence()
+		return pdiff < 0 || pdiff == 0 && isRightAssoc(opType)
+	}
+	// Unary operators bind more tightly than any binary operator except "^".
+	_, ok := unOpType(e)
+	return ok && opType == ops.OpPow
+}
+
+func needsBracketsOnRight(e ExpNode, opType ops.Op) bool {
+	if t, ok := binOpType(e); ok {
+		pdiff := t.Precedence() - opType.Precedence()
+		return pdiff < 0 || pdiff == 0 && !isRightAssoc(opType)
+	}
+	return false
+}
+
+// isPrefixExp returns true if e can be called or indexed without brackets.
+func isPrefixExp(e ExpNode) bool {
+	switch e.(type) {
+	case Name, IndexExp, FunctionCall, BFunctionCall, *BFunctionCall:
+		return true
+	}
+	return false
+}
+
+func (p *printer) nameAttribs(nameAttribs []NameAttrib) {
+	for i, na := range nameAttribs {
+		if i > 0 {
+			p.print(", ")
+		}
+		p.print(na.Name.Val)
+		if na.Attrib != NoAttrib {
+			p.print(" ")
+			p.attrib(na.Attrib)
+		}
+		if na.Type != nil {
+			p.print(": ")
+			p.typ(na.Type)
+		}
+	}
+}
+
+func (p *printer) attrib(attrib LocalAttrib) {
+	switch attrib {
+	case ConstAttrib:
+		p.print("<const>")
+	case CloseAttrib:
+		p.print("<close>")
+	}
+}
+
+// endsWithExp returns true if the Lua source for s ends with an expression.
+func endsWithExp(s Stat) bool {
+	switch n := s.(type) {
+	case AssignStat:
+		if len(n.Dest) == 1 && len(n.Src) == 1 && isFuncName(n.Dest[0]) {
+			_, ok := n.Src[0].(Function)
+			return !ok
+		}
+		return true
+	case LocalStat:
+		return len(n.Values) > 0
+	case GlobalStat:
+		return len(n.Values) > 0
+	case CompoundAssignStat, FunctionCall, RepeatStat:
+		return true
+	}
+	return false
+}
+
+// startsWithBracket returns true if the Lua source for s starts with "(".
+func startsWithBracket(s Stat) bool {
+	var e ExpNode
+	switch n := s.(type) {
+	case FunctionCall:
+		e = n
+	case AssignStat:
+		if len(n.Dest) == 1 && len(n.Src) == 1 && isFuncName(n.Dest[0]) {
+			if _, ok := n.Src[0].(Function); ok {
+				return false
+			}
+		}
+		e = n.Dest[0]
+	case CompoundAssignStat:
+		e = n.Dest
+	default:
+		return false
+	}
+	for {
+		switch n := e.(type) {
+		case FunctionCall:
+			e = n.Target
+		case IndexExp:
+			e = n.Coll
+		case Name:
+			return false
+		default:
+			return true
+		}
+	}
+}
+
+// isFuncName returns true if v can be the name in a function statement, e.g.
+// "a.b.c".
+func isFuncName(v ExpNode) bool {
+	switch n := v.(type) {
+	case Name:
+		return true
+	case IndexExp:
+		s, ok := n.Idx.(String)
+		return ok && !n.Safe && isName(string(s.Val)) && isFuncName(n.Coll)
+	}
+	return false
+}
+
+func isMethod(f Function) bool {
+	return len(f.Params) > 0 && f.Params[0].Val == "self" && f.Params[0].StartPos() == nil
+}
+
+func isDefaultStep(e ExpNode) bool {
+	n, ok := e.(Int)
+	return e == nil || ok && n.Val == 1 && n.StartPos() == nil
+}
+
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true,
+	"end": true, "false": true, "for": true, "function": true, "goto": true,
+	"if": true, "in": true, "local": true, "nil": true, "not": true, "or": true,
+	"repeat": true, "return": true, "then": true, "true": true, "until": true,
+	"while": true,
+}
+
+// isName returns true if s is a valid Lua identifier.
+func isName(s string) bool {
+	if s == "" || luaKeywords[s] {
+		return false
+	}
+	for i, c := range []byte(s) {
+		switch {
+		case c == '_', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case '0' <= c && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// quoteString returns a Lua string literal with value s.  Bytes that are not
+// printable ASCII are escaped, except for bytes >= 0x80 which are written as
+// is so that UTF-8 text stays readable.
+func quoteString(s []byte) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c < 0x20 || c == 0x7f:
+			// Use 3 digits so that a following digit is not part of the escape
+			// sequence.
+			b.WriteByte('\\')
+			b.WriteString(strconv.FormatInt(int64(c)+1000, 10)[1:])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// formatFloat returns a Lua expression for the float x which is parsed as a
+// float (e.g. "1.0" rather than "1").
+func formatFloat(x float64) string {
+	switch {
+	case math.IsInf(x, 1):
+		return "1e9999"
+	case math.IsInf(x, -1):
+		return "(-1e9999)"
+	case math.IsNaN(x):
+		return "(0/0)"
+	}
+	s := strconv.FormatFloat(x, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	if x < 0 || x == 0 && math.Signbit(x) {
+		s = "(" + s + ")"
+	}
+	return s
+}
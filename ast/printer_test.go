@@ -0,0 +1,246 @@
+package ast_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/arnodel/golua/ast"
+	"github.com/arnodel/golua/luaversion"
+	"github.com/arnodel/golua/ops"
+	"github.com/arnodel/golua/parsing"
+	"github.com/arnodel/golua/scanner"
+)
+
+func parse(t *testing.T, src string) ast.BlockStat {
+	t.Helper()
+	chunk, err := parsing.ParseChunk(scanner.New("test", []byte(src)))
+	if err != nil {
+		t.Fatalf("error parsing %q: %s", src, err)
+	}
+	return chunk
+}
+
+// Some nodes include their location in their tree representation.
+var treePos = regexp.MustCompile(`&\{\d+ \d+ \d+\}`)
+
+// tree returns the tree representation of node, without source locations.
+func tree(node ast.Node) string {
+	var b bytes.Buffer
+	node.HWrite(ast.NewIndentWriter(&b))
+	return treePos.ReplaceAllString(b.String(), "&{}")
+}
+
+func TestSprint(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"x = 1", "x = 1"},
+		{"x, y.z = 1.5, 'hi\\n'", `x, y.z = 1.5, "hi\n"`},
+		{"local a <const>, b <close> = ...", "local a <const>, b <close> = ..."},
+		{"f 'x' ; a.b:c{1, x=2, ['y z']=3}", `f("x")
+;
+a.b:c({1, x = 2, ["y z"] = 3})`},
+		{"return (f())", "return (f())"},
+		{"x = (1 + 2) * 3 - -4 ^ 2", "x = (1 + 2) * 3 - -4 ^ 2"},
+		{"x = (a - b) - (c - d)", "x = a - b - (c - d)"},
+		{"x = (a .. b) .. c .. d", "x = (a .. b) .. c .. d"},
+		{"x = 2 ^ 3 ^ 4, (2 ^ 3) ^ 4, (-2) ^ 2", "x = 2 ^ 3 ^ 4, (2 ^ 3) ^ 4, (-2) ^ 2"},
+		{"x = not (a and b) or - -c", "x = not (a and b) or - -c"},
+		{"x = ('a'):rep(3)[1]", `x = ("a"):rep(3)[1]`},
+		{"x = 0xffffffffffffffff, 1e100, 3.0", "x = 0xffffffffffffffff, 1e+100, 3.0"},
+		{"a = b; ('x'):f()", "a = b\n;\n(\"x\"):f()"},
+		{"do end ('x'):f()", "do\nend\n(\"x\"):f()"},
+		{
+			"function a.b:c(x, ...) return self end local function f() end",
+			"function a.b:c(x, ...)\n    return self\nend\nlocal function f()\nend",
+		},
+		{
+			"for i = 1, 10 do if i > 5 then break elseif i then goto x else end end ::x::",
+			`for i = 1, 10 do
+    if i > 5 then
+        break
+    elseif i then
+        goto x
+    else
+    end
+end
+::x::`,
+		},
+		{
+			"for k, v in pairs(t) do while k do repeat local z until z end end for i=1,2,-1 do end",
+			`for k, v in pairs(t) do
+    while k do
+        repeat
+            local z
+        until z
+    end
+end
+for i = 1, 2, -1 do
+end`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			got := ast.Sprint(parse(t, test.src))
+			if got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSprint_extensions(t *testing.T) {
+	src := "x += 1 t[k] ..= 'a' while a?.b?[c] != nil do continue end"
+	want := `x += 1
+t[k] ..= "a"
+while a?.b?[c] ~= nil do
+    continue
+end`
+	chunk, err := parsing.ParseChunk(scanner.New("test", []byte(src), scanner.WithExtensions(scanner.AllExtensions)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ast.Sprint(chunk); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSprint_types(t *testing.T) {
+	src := `type Point = {x: number, y: number}
+type Tree = {value: any, children: {Tree}, [string]: boolean}
+local p: Point?, n: integer | string = nil, 1
+local function f(a: number, b, ...: string): (boolean, Point?)
+    return true
+end
+function p:move(dx: number): nil
+end
+local g: (function(number): number)? = function(x) return x end
+local h: function(...): (string | nil) = f`
+	want := `type Point = {x: number, y: number}
+type Tree = {[string]: boolean, value: any, children: {Tree}}
+local p: Point?, n: integer | string = nil, 1
+local function f(a: number, b, ...: string): (boolean, Point?)
+    return true
+end
+function p:move(dx: number): nil
+end
+local g: (function(number): number)? = function(x)
+    return x
+end
+local h: function(...): string | nil = f`
+	chunk, err := parsing.ParseChunk(scanner.New("test", []byte(src), scanner.WithExtensions(scanner.TypeAnnotations)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ast.Sprint(chunk); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	wantErased := `local p, n = nil, 1
+local function f(a, b, ...)
+    return true
+end
+function p:move(dx)
+end
+local g = function(x)
+    return x
+end
+local h = f`
+	if got := ast.Sprint(ast.EraseTypes(chunk)); got != wantErased {
+		t.Errorf("erased got:\n%s\nwant:\n%s", got, wantErased)
+	}
+}
+
+func TestSprint_lua55(t *testing.T) {
+	src := `global print, x <const> = f() global <const> *
+global function g() end local <const> a, b <close> = 1, 2`
+	want := `global print, x <const> = f()
+global <const> *
+global function g()
+end
+local a <const>, b <close> = 1, 2`
+	chunk, err := parsing.ParseChunk(scanner.New("test", []byte(src), scanner.WithVersion(luaversion.Lua55)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ast.Sprint(chunk); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSprint_handBuilt(t *testing.T) {
+	// (1 - 2) - 3 as built by hand rather than by the parser.
+	sub := &ast.BinOp{
+		Left:   ast.NewInt(1),
+		OpType: ops.OpSub,
+		Right:  []ast.Operation{{Op: ops.OpSub, Operand: ast.NewInt(2)}},
+	}
+	exp := ast.BinOp{
+		Left:   sub,
+		OpType: ops.OpSub,
+		Right:  []ast.Operation{{Op: ops.OpSub, Operand: ast.NewInt(3)}},
+	}
+	if got := ast.Sprint(exp); got != "1 - 2 - 3" {
+		t.Errorf("got %q", got)
+	}
+	if got := ast.Sprint(ast.String{Val: []byte("a\\b\"\x001\xff")}); got != `"a\\b\"\0001`+"\xff\"" {
+		t.Errorf("got %q", got)
+	}
+	if got := ast.Sprint(ast.NewFloat(-2)); got != "(-2.0)" {
+		t.Errorf("got %q", got)
+	}
+	block := ast.NewBlockStat([]ast.Stat{
+		ast.NewAssignStat([]ast.Var{ast.Name{Val: "a"}}, []ast.ExpNode{ast.Name{Val: "b"}}),
+		ast.NewFunctionCall(ast.String{Val: []byte("x")}, ast.Name{Val: "f"}, []ast.ExpNode{}),
+	}, nil)
+	if got := ast.Sprint(block); got != "a = b\n;(\"x\"):f()" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// TestSprint_roundTrip checks that printing the AST of each Lua test file in
+// the repository and parsing it again gives the same AST.
+func TestSprint_roundTrip(t *testing.T) {
+	files, err := filepath.Glob("../*/lua/*.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	libFiles, err := filepath.Glob("../lib/*/lua/*.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, libFiles...)
+	if len(files) == 0 {
+		t.Fatal("no Lua files found")
+	}
+	for _, path := range files {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		version := scanner.WithVersion(luaversion.Default)
+		if strings.HasSuffix(path, ".lua55.lua") {
+			version = scanner.WithVersion(luaversion.Lua55)
+		}
+		chunk, err := parsing.ParseChunk(scanner.New(path, src, version))
+		if err != nil {
+			// Some test files contain syntax errors on purpose.
+			continue
+		}
+		printed := ast.Sprint(chunk)
+		chunk2, err := parsing.ParseChunk(scanner.New(path, []byte(printed), version))
+		if err != nil {
+			t.Errorf("%s: error parsing printed source: %s", path, err)
+			continue
+		}
+		if tree(chunk) != tree(chunk2) {
+			t.Errorf("%s: printed source does not round-trip", path)
+		}
+		if printed2 := ast.Sprint(chunk2); printed2 != printed {
+			t.Errorf("%s: printing is not idempotent", path)
+		}
+	}
+}
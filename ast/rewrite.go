@@ -0,0 +1,375 @@
+package ast
+
+import "fmt"
+
+// Rewrite returns a copy of the AST rooted at node where each node n has been
+// replaced with f(n).  The tree is rewritten bottom up: the children of a node
+// are rewritten before f is called on a copy of the node containing the
+// rewritten children.  The children are the same as the ones visited by Walk.
+// The original tree is not modified.
+//
+// The replacement must be allowed at the position of the node it replaces,
+// e.g. an expression can be replaced with any expression but the target of an
+// assignment can only be replaced with a Var and a function parameter with a
+// Name.  If that is not the case, Rewrite panics.  The one exception is that f
+// may return nil for a statement in a block, which removes the statement from
+// the block.
+//
+// To leave a node unchanged, f should return its argument.  Nodes are
+// rewritten to the same form as the original, so e.g. a *BinOp is rewritten as
+// a *BinOp.
+func Rewrite(node Node, f func(Node) Node) Node {
+	return rewriter(f).node(node)
+}
+
+type rewriter func(Node) Node
+
+func (r rewriter) node(node Node) Node {
+	switch n := node.(type) {
+
+	// Statements
+
+	case AssignStat:
+		dest := make([]Var, len(n.Dest))
+		for i, dst := range n.Dest {
+			dest[i] = r.vr(dst)
+		}
+		n.Dest = dest
+		n.Src = r.expList(n.Src)
+		node = n
+	case BlockStat:
+		node = r.blockContents(n)
+	case BreakStat, ContinueStat, EmptyStat, ErrorStat:
+		// No children
+	case CompoundAssignStat:
+		n.Dest = r.vr(n.Dest)
+		n.Value = r.exp(n.Value)
+		node = n
+	case ForInStat:
+		node = r.forInStat(n)
+	case *ForInStat:
+		s := r.forInStat(*n)
+		node = &s
+	case ForStat:
+		node = r.forStat(n)
+	case *ForStat:
+		s := r.forStat(*n)
+		node = &s
+	case GotoStat:
+		n.Label = r.name(n.Label)
+		node = n
+	case IfStat:
+		n.If = r.condStat(n.If)
+		if n.ElseIfs != nil {
+			elseIfs := make([]CondStat, len(n.ElseIfs))
+			for i, s := range n.ElseIfs {
+				elseIfs[i] = r.condStat(s)
+			}
+			n.ElseIfs = elseIfs
+		}
+		if n.Else != nil {
+			elseBody := r.block(*n.Else)
+			n.Else = &elseBody
+		}
+		node = n
+	case LabelStat:
+		n.Name = r.name(n.Name)
+		node = n
+	case LocalFunctionStat:
+		n.Name = r.name(n.Name)
+		n.Function = r.function(n.Function)
+		node = n
+	case LocalStat:
+		nameAttribs := make([]NameAttrib, len(n.NameAttribs))
+		for i, na := range n.NameAttribs {
+			na.Name = r.name(na.Name)
+			na.Type = r.typ(na.Type)
+			nameAttribs[i] = na
+		}
+		n.NameAttribs = nameAttribs
+		n.Values = r.expList(n.Values)
+		node = n
+	case GlobalFunctionStat:
+		n.Name = r.name(n.Name)
+		n.Function = r.function(n.Function)
+		node = n
+	case GlobalStat:
+		nameAttribs := append([]NameAttrib(nil), n.NameAttribs...)
+		for i, na := range nameAttribs {
+			nameAttribs[i].Name = r.name(na.Name)
+		}
+		n.NameAttribs = nameAttribs
+		n.Values = r.expList(n.Values)
+		node = n
+	case TypeAliasStat:
+		n.Name = r.name(n.Name)
+		n.Type = r.typ(n.Type)
+		node = n
+	case RepeatStat:
+		n.Body = r.block(n.Body)
+		n.Cond = r.exp(n.Cond)
+		node = n
+	case WhileStat:
+		n.CondStat = r.condStat(n.CondStat)
+		node = n
+
+	// Expressions (FunctionCall is also a statement)
+
+	case BFunctionCall:
+		node = r.call(n)
+	case *BFunctionCall:
+		c := r.call(*n)
+		node = &c
+	case FunctionCall:
+		c := r.call(*n.BFunctionCall)
+		node = FunctionCall{&c}
+	case BinOp:
+		node = r.binOp(n)
+	case *BinOp:
+		b := r.binOp(*n)
+		node = &b
+	case Bool, Etc, Float, Int, Name, Nil, NoTableKey, String:
+		// No children
+	case Function:
+		node = r.functionContents(n)
+	case IndexExp:
+		n.Coll = r.exp(n.Coll)
+		n.Idx = r.exp(n.Idx)
+		node = n
+	case TableConstructor:
+		fields := make([]TableField, len(n.Fields))
+		for i, fld := range n.Fields {
+			if _, ok := fld.Key.(NoTableKey); !ok {
+				fld.Key = r.exp(fld.Key)
+			}
+			fld.Value = r.exp(fld.Value)
+			fields[i] = fld
+		}
+		n.Fields = fields
+		node = n
+	case UnOp:
+		n.Operand = r.exp(n.Operand)
+		node = n
+	case *UnOp:
+		u := *n
+		u.Operand = r.exp(u.Operand)
+		node = &u
+
+	// Type annotations
+
+	case NamedType:
+		// No children
+	case OptionalType:
+		n.Type = r.typ(n.Type)
+		node = n
+	case UnionType:
+		n.Types = r.typList(n.Types)
+		node = n
+	case TableType:
+		if n.Fields != nil {
+			fields := make([]FieldType, len(n.Fields))
+			for i, f := range n.Fields {
+				f.Type = r.typ(f.Type)
+				fields[i] = f
+			}
+			n.Fields = fields
+		}
+		n.Elem = r.typ(n.Elem)
+		n.Key = r.typ(n.Key)
+		n.Value = r.typ(n.Value)
+		node = n
+	case FunctionType:
+		n.Params = r.typList(n.Params)
+		n.Varargs = r.typ(n.Varargs)
+		n.Returns = r.typList(n.Returns)
+		node = n
+
+	default:
+		panic(fmt.Sprintf("ast.Rewrite: unexpected node type %T", n))
+	}
+	return r(node)
+}
+
+func (r rewriter) stat(s Stat) Stat {
+	node := r.node(s)
+	if node == nil {
+		return nil
+	}
+	res, ok := node.(Stat)
+	if !ok {
+		panic(rewriteError("Stat", s, node))
+	}
+	return res
+}
+
+func (r rewriter) exp(e ExpNode) ExpNode {
+	node := r.node(e)
+	res, ok := node.(ExpNode)
+	if !ok {
+		panic(rewriteError("ExpNode", e, node))
+	}
+	return res
+}
+
+func (r rewriter) vr(v Var) Var {
+	node := r.node(v)
+	res, ok := node.(Var)
+	if !ok {
+		panic(rewriteError("Var", v, node))
+	}
+	return res
+}
+
+func (r rewriter) name(n Name) Name {
+	node := r.node(n)
+	res, ok := node.(Name)
+	if !ok {
+		panic(rewriteError("Name", n, node))
+	}
+	return res
+}
+
+func (r rewriter) block(b BlockStat) BlockStat {
+	node := r.node(b)
+	res, ok := node.(BlockStat)
+	if !ok {
+		panic(rewriteError("BlockStat", b, node))
+	}
+	return res
+}
+
+func (r rewriter) function(f Function) Function {
+	node := r.node(f)
+	res, ok := node.(Function)
+	if !ok {
+		panic(rewriteError("Function", f, node))
+	}
+	return res
+}
+
+// typ rewrites t, which may be nil (e.g. the type of a parameter with no type
+// annotation).
+func (r rewriter) typ(t TypeExp) TypeExp {
+	if t == nil {
+		return nil
+	}
+	node := r.node(t)
+	res, ok := node.(TypeExp)
+	if !ok {
+		panic(rewriteError("TypeExp", t, node))
+	}
+	return res
+}
+
+func (r rewriter) typList(ts []TypeExp) []TypeExp {
+	if ts == nil {
+		return nil
+	}
+	res := make([]TypeExp, len(ts))
+	for i, t := range ts {
+		res[i] = r.typ(t)
+	}
+	return res
+}
+
+func (r rewriter) expList(exps []ExpNode) []ExpNode {
+	if exps == nil {
+		return nil
+	}
+	res := make([]ExpNode, len(exps))
+	for i, e := range exps {
+		res[i] = r.exp(e)
+	}
+	return res
+}
+
+func (r rewriter) blockContents(b BlockStat) BlockStat {
+	var stats []Stat
+	if b.Stats != nil {
+		stats = make([]Stat, 0, len(b.Stats))
+	}
+	for _, s := range b.Stats {
+		if s = r.stat(s); s != nil {
+			stats = append(stats, s)
+		}
+	}
+	b.Stats = stats
+	b.Return = r.expList(b.Return)
+	return b
+}
+
+func (r rewriter) condStat(s CondStat) CondStat {
+	s.Cond = r.exp(s.Cond)
+	s.Body = r.block(s.Body)
+	return s
+}
+
+func (r rewriter) forStat(s ForStat) ForStat {
+	s.Var = r.name(s.Var)
+	if s.Start != nil {
+		s.Start = r.exp(s.Start)
+	}
+	if s.Stop != nil {
+		s.Stop = r.exp(s.Stop)
+	}
+	if s.Step != nil {
+		s.Step = r.exp(s.Step)
+	}
+	s.Body = r.block(s.Body)
+	return s
+}
+
+func (r rewriter) forInStat(s ForInStat) ForInStat {
+	vars := make([]Name, len(s.Vars))
+	for i, name := range s.Vars {
+		vars[i] = r.name(name)
+	}
+	s.Vars = vars
+	s.Params = r.expList(s.Params)
+	s.Body = r.block(s.Body)
+	return s
+}
+
+func (r rewriter) call(c BFunctionCall) BFunctionCall {
+	c.Target = r.exp(c.Target)
+	if c.Method.Val != "" {
+		c.Method = r.name(c.Method)
+	}
+	c.Args = r.expList(c.Args)
+	return c
+}
+
+func (r rewriter) binOp(b BinOp) BinOp {
+	b.Left = r.exp(b.Left)
+	right := make([]Operation, len(b.Right))
+	for i, op := range b.Right {
+		op.Operand = r.exp(op.Operand)
+		right[i] = op
+	}
+	b.Right = right
+	return b
+}
+
+func (r rewriter) functionContents(f Function) Function {
+	if f.Params != nil {
+		params := make([]Name, len(f.Params))
+		for i, param := range f.Params {
+			params[i] = r.name(param)
+		}
+		f.Params = params
+	}
+	if f.Signature != nil {
+		node := r.node(*f.Signature)
+		sig, ok := node.(FunctionType)
+		if !ok {
+			panic(rewriteError("FunctionType", *f.Signature, node))
+		}
+		f.Signature = &sig
+	}
+	f.Body = r.block(f.Body)
+	return f
+}
+
+func rewriteError(expected string, old, repl Node) string {
+	return fmt.Sprintf("ast.Rewrite: %T replaced with %T, which is not a %s", old, repl, expected)
+}
@@ -0,0 +1,37 @@
+package ast
+
+import (
+	"github.com/arnodel/golua/token"
+)
+
+// TypeAliasStat is a statement node representing the declaration of a type
+// alias, i.e. "type Name = Type".  It is part of the type annotations syntax
+// extension (see scanner.TypeAnnotations).  As it has no effect at run time,
+// it is processed as an empty statement.
+type TypeAliasStat struct {
+	Location
+	Name Name
+	Type TypeExp
+}
+
+var _ Stat = TypeAliasStat{}
+
+// NewTypeAliasStat returns a TypeAliasStat instance (typeTok is the "type"
+// token).
+func NewTypeAliasStat(typeTok *token.Token, name Name, t TypeExp) TypeAliasStat {
+	return TypeAliasStat{
+		Location: MergeLocations(LocFromToken(typeTok), t),
+		Name:     name,
+		Type:     t,
+	}
+}
+
+// ProcessStat uses the given StatProcessor to process the receiver.
+func (s TypeAliasStat) ProcessStat(p StatProcessor) {
+	p.ProcessEmptyStat(EmptyStat{Location: s.Location})
+}
+
+// HWrite prints a tree representation of the node.
+func (s TypeAliasStat) HWrite(w HWriter) {
+	w.Writef("type alias %s = %s", s.Name.Val, Sprint(s.Type))
+}
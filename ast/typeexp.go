@@ -0,0 +1,112 @@
+package ast
+
+// A TypeExp is a type annotation.  Type annotations are a syntax extension (see
+// scanner.TypeAnnotations): they are checked by the typecheck package and
+// erased before compilation (see EraseTypes), so they have no effect at run
+// time.
+type TypeExp interface {
+	Node
+	typeExp()
+}
+
+// NamedType is a type annotation given by a name, e.g. "number", "nil" or the
+// name of a type alias.
+type NamedType struct {
+	Location
+	Name string
+}
+
+var _ TypeExp = NamedType{}
+
+// NewNamedType returns a NamedType for the given name (which may be "nil" or
+// "function", which are not names in Lua code).
+func NewNamedType(name Name) NamedType {
+	return NamedType{Location: name.Location, Name: name.Val}
+}
+
+// HWrite prints a tree representation of the node.
+func (t NamedType) HWrite(w HWriter) {
+	w.Writef("type %s", t.Name)
+}
+
+func (t NamedType) typeExp() {}
+
+// OptionalType is the type annotation "T?", which is T or nil.
+type OptionalType struct {
+	Location
+	Type TypeExp
+}
+
+var _ TypeExp = OptionalType{}
+
+// HWrite prints a tree representation of the node.
+func (t OptionalType) HWrite(w HWriter) {
+	w.Writef("type %s", Sprint(t))
+}
+
+func (t OptionalType) typeExp() {}
+
+// UnionType is the type annotation "T1 | T2 | ...".
+type UnionType struct {
+	Location
+	Types []TypeExp
+}
+
+var _ TypeExp = UnionType{}
+
+// HWrite prints a tree representation of the node.
+func (t UnionType) HWrite(w HWriter) {
+	w.Writef("type %s", Sprint(t))
+}
+
+func (t UnionType) typeExp() {}
+
+// TableType is the type annotation for a table with a known shape.  It can
+// have named fields, e.g. "{x: number, y: number}", an array part, e.g.
+// "{string}", and a map part, e.g. "{[string]: boolean}" (all three can be
+// combined).
+type TableType struct {
+	Location
+	Fields     []FieldType
+	Elem       TypeExp // The type of the items in the array part, or nil
+	Key, Value TypeExp // The types of the keys and values in the map part, or nil
+}
+
+var _ TypeExp = TableType{}
+
+// HWrite prints a tree representation of the node.
+func (t TableType) HWrite(w HWriter) {
+	w.Writef("type %s", Sprint(t))
+}
+
+func (t TableType) typeExp() {}
+
+// A FieldType is a named field in a TableType (it is not a node).
+type FieldType struct {
+	Name Name
+	Type TypeExp
+}
+
+// FunctionType is the type annotation for a function with a known signature,
+// e.g. "function(number, ...: string): (boolean, string)".
+//
+// It also holds the type annotations of a Function, in which case Params has
+// one item per parameter of the function and the type of a parameter which
+// is not annotated is nil.
+type FunctionType struct {
+	Location
+	Params     []TypeExp
+	HasDots    bool
+	Varargs    TypeExp   // The type of the "..." arguments, or nil
+	Returns    []TypeExp // The types of the return values
+	HasReturns bool      // False if the return types are not given
+}
+
+var _ TypeExp = FunctionType{}
+
+// HWrite prints a tree representation of the node.
+func (t FunctionType) HWrite(w HWriter) {
+	w.Writef("type %s", Sprint(t))
+}
+
+func (t FunctionType) typeExp() {}
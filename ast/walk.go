@@ -0,0 +1,233 @@
+package ast
+
+import "fmt"
+
+// A Visitor's Visit method is invoked for each node encountered by Walk.  If
+// the result visitor w is not nil, Walk visits each of the children of node
+// with the visitor w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses an AST in depth-first order: it starts by calling
+// v.Visit(node); node must not be nil.  If the visitor w returned by
+// v.Visit(node) is not nil, Walk is invoked recursively with visitor w for each
+// of the non-nil children of node, in source order, followed by a call of
+// w.Visit(nil).
+//
+// The children of a node are the statements, expressions and names it is made
+// of.  That includes the names introduced by local and global declarations, for
+// loops, function parameters and labels, and type annotations (see TypeExp).
+// The keys of table fields without a key (NoTableKey) are not visited.  A
+// method definition "function a:f() end" is a function with an implicit "self"
+// parameter (with no location).
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	switch n := node.(type) {
+
+	// Statements
+
+	case AssignStat:
+		for _, dst := range n.Dest {
+			Walk(v, dst)
+		}
+		walkExpList(v, n.Src)
+	case BlockStat:
+		walkBlock(v, n)
+	case BreakStat, ContinueStat, EmptyStat, ErrorStat:
+		// Nothing to do
+	case CompoundAssignStat:
+		Walk(v, n.Dest)
+		Walk(v, n.Value)
+	case ForInStat:
+		walkForInStat(v, n)
+	case *ForInStat:
+		walkForInStat(v, *n)
+	case ForStat:
+		walkForStat(v, n)
+	case *ForStat:
+		walkForStat(v, *n)
+	case GotoStat:
+		Walk(v, n.Label)
+	case IfStat:
+		walkCondStat(v, n.If)
+		for _, s := range n.ElseIfs {
+			walkCondStat(v, s)
+		}
+		if n.Else != nil {
+			Walk(v, *n.Else)
+		}
+	case LabelStat:
+		Walk(v, n.Name)
+	case LocalFunctionStat:
+		Walk(v, n.Name)
+		Walk(v, n.Function)
+	case LocalStat:
+		for _, na := range n.NameAttribs {
+			Walk(v, na.Name)
+			if na.Type != nil {
+				Walk(v, na.Type)
+			}
+		}
+		walkExpList(v, n.Values)
+	case GlobalFunctionStat:
+		Walk(v, n.Name)
+		Walk(v, n.Function)
+	case GlobalStat:
+		for _, na := range n.NameAttribs {
+			Walk(v, na.Name)
+		}
+		walkExpList(v, n.Values)
+	case TypeAliasStat:
+		Walk(v, n.Name)
+		Walk(v, n.Type)
+	case RepeatStat:
+		Walk(v, n.Body)
+		Walk(v, n.Cond)
+	case WhileStat:
+		walkCondStat(v, n.CondStat)
+
+	// Expressions (FunctionCall is also a statement)
+
+	case BFunctionCall:
+		walkCall(v, n)
+	case *BFunctionCall:
+		walkCall(v, *n)
+	case FunctionCall:
+		walkCall(v, *n.BFunctionCall)
+	case BinOp:
+		walkBinOp(v, n)
+	case *BinOp:
+		walkBinOp(v, *n)
+	case Bool, Etc, Float, Int, Name, Nil, NoTableKey, String:
+		// Nothing to do
+	case Function:
+		for _, param := range n.Params {
+			Walk(v, param)
+		}
+		if n.Signature != nil {
+			Walk(v, *n.Signature)
+		}
+		Walk(v, n.Body)
+	case IndexExp:
+		Walk(v, n.Coll)
+		Walk(v, n.Idx)
+	case TableConstructor:
+		for _, f := range n.Fields {
+			if _, ok := f.Key.(NoTableKey); !ok {
+				Walk(v, f.Key)
+			}
+			Walk(v, f.Value)
+		}
+	case UnOp:
+		Walk(v, n.Operand)
+	case *UnOp:
+		Walk(v, n.Operand)
+
+	// Type annotations
+
+	case NamedType:
+		// Nothing to do
+	case OptionalType:
+		Walk(v, n.Type)
+	case UnionType:
+		for _, t := range n.Types {
+			Walk(v, t)
+		}
+	case TableType:
+		for _, t := range []TypeExp{n.Elem, n.Key, n.Value} {
+			if t != nil {
+				Walk(v, t)
+			}
+		}
+		for _, f := range n.Fields {
+			Walk(v, f.Type)
+		}
+	case FunctionType:
+		for _, t := range n.Params {
+			if t != nil {
+				Walk(v, t)
+			}
+		}
+		if n.Varargs != nil {
+			Walk(v, n.Varargs)
+		}
+		for _, t := range n.Returns {
+			Walk(v, t)
+		}
+
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+	v.Visit(nil)
+}
+
+func walkExpList(v Visitor, exps []ExpNode) {
+	for _, e := range exps {
+		Walk(v, e)
+	}
+}
+
+func walkBlock(v Visitor, b BlockStat) {
+	for _, s := range b.Stats {
+		Walk(v, s)
+	}
+	walkExpList(v, b.Return)
+}
+
+func walkCondStat(v Visitor, s CondStat) {
+	Walk(v, s.Cond)
+	Walk(v, s.Body)
+}
+
+func walkForStat(v Visitor, s ForStat) {
+	Walk(v, s.Var)
+	for _, e := range []ExpNode{s.Start, s.Stop, s.Step} {
+		if e != nil {
+			Walk(v, e)
+		}
+	}
+	Walk(v, s.Body)
+}
+
+func walkForInStat(v Visitor, s ForInStat) {
+	for _, name := range s.Vars {
+		Walk(v, name)
+	}
+	walkExpList(v, s.Params)
+	Walk(v, s.Body)
+}
+
+func walkCall(v Visitor, c BFunctionCall) {
+	Walk(v, c.Target)
+	if c.Method.Val != "" {
+		Walk(v, c.Method)
+	}
+	walkExpList(v, c.Args)
+}
+
+func walkBinOp(v Visitor, b BinOp) {
+	Walk(v, b.Left)
+	for _, r := range b.Right {
+		Walk(v, r.Operand)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses an AST in depth-first order: it starts by calling
+// f(node); node must not be nil.  If f returns true, Inspect invokes f
+// recursively for each of the non-nil children of node, followed by a call of
+// f(nil).
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,140 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/arnodel/golua/ast"
+)
+
+func TestInspect(t *testing.T) {
+	chunk := parse(t, `
+local x <const> = {1, y = f(2)}
+for i = 1, 2 do
+    x = x + -i
+end
+function x:m(a) return a.b end
+::l::
+`)
+	var names []string
+	var counts = map[string]int{}
+	ast.Inspect(chunk, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		counts[fmt.Sprintf("%T", n)]++
+		if name, ok := n.(ast.Name); ok {
+			names = append(names, name.Val)
+		}
+		return true
+	})
+	if got, want := strings.Join(names, " "), "x f i x x i x self a a l"; got != want {
+		t.Errorf("names: got %q, want %q", got, want)
+	}
+	want := map[string]int{
+		"ast.BlockStat":        3,
+		"ast.LocalStat":        1,
+		"ast.TableConstructor": 1,
+		"ast.FunctionCall":     1,
+		"*ast.ForStat":         1,
+		"ast.AssignStat":       2,
+		"*ast.BinOp":           1,
+		"*ast.UnOp":            1,
+		"ast.Function":         1,
+		"ast.IndexExp":         2,
+		"ast.LabelStat":        1,
+		"ast.Int":              5, // Including the default for loop step
+		"ast.String":           3,
+		"ast.Name":             11,
+	}
+	for tp, n := range want {
+		if counts[tp] != n {
+			t.Errorf("%s: got %d nodes, want %d", tp, counts[tp], n)
+		}
+	}
+}
+
+type depthVisitor struct {
+	depth, max *int
+}
+
+func (v depthVisitor) Visit(n ast.Node) ast.Visitor {
+	if n == nil {
+		*v.depth--
+		return nil
+	}
+	*v.depth++
+	if *v.depth > *v.max {
+		*v.max = *v.depth
+	}
+	return v
+}
+
+func TestWalk(t *testing.T) {
+	var depth, max int
+	ast.Walk(depthVisitor{&depth, &max}, parse(t, "return f(a[1])"))
+	if depth != 0 {
+		t.Errorf("Visit(nil) not called after each node, depth=%d", depth)
+	}
+	// block > call > index > int
+	if max != 4 {
+		t.Errorf("got max depth %d, want 4", max)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	src := `local a = 1
+print(a + 2 * b)
+;
+if a then
+    print(b)
+end`
+	chunk := parse(t, src)
+	res := ast.Rewrite(chunk, func(n ast.Node) ast.Node {
+		switch x := n.(type) {
+		case ast.Name:
+			if x.Val == "b" {
+				x.Val = "c"
+			}
+			return x
+		case ast.Int:
+			return ast.NewInt(x.Val * 10)
+		case ast.EmptyStat:
+			return nil
+		case ast.FunctionCall:
+			// Instrument calls to print.
+			if name, ok := x.Target.(ast.Name); ok && name.Val == "print" {
+				args := append([]ast.ExpNode{ast.String{Val: []byte("log:")}}, x.Args...)
+				return ast.NewFunctionCall(x.Target, x.Method, args)
+			}
+		}
+		return n
+	})
+	want := `local a = 10
+print("log:", a + 20 * c)
+if a then
+    print("log:", c)
+end`
+	if got := ast.Sprint(res); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if got := ast.Sprint(chunk); got != src {
+		t.Errorf("original tree was modified:\n%s", got)
+	}
+}
+
+func TestRewrite_badReplacement(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil || !strings.Contains(fmt.Sprint(r), "ast.Name replaced with ast.Int, which is not a Name") {
+			t.Errorf("unexpected panic value: %v", r)
+		}
+	}()
+	ast.Rewrite(parse(t, "local x = 1"), func(n ast.Node) ast.Node {
+		if _, ok := n.(ast.Name); ok {
+			return ast.NewInt(1)
+		}
+		return n
+	})
+}
@@ -5,11 +5,24 @@ import (
 
 	"github.com/arnodel/golua/ast"
 	"github.com/arnodel/golua/ir"
+	"github.com/arnodel/golua/luaversion"
 )
 
+// An Option configures how CompileLuaChunk compiles a chunk.
+type Option func(*compiler)
+
+// WithVersion sets the version of the Lua language to compile (the default is
+// luaversion.Default).  It should be the version the chunk was parsed with.
+func WithVersion(v luaversion.Version) Option {
+	return func(c *compiler) {
+		c.version = v
+	}
+}
+
 // CompileLuaChunk compiles the given block statement to IR code and returns a
-// slice or ir.Contant values and the index to the main code constant.
-func CompileLuaChunk(source string, s ast.BlockStat) (kidx uint, consts []ir.Constant, err error) {
+// slice or ir.Contant values and the index to the main code constant.  Type
+// annotations are ignored (see ast.EraseTypes).
+func CompileLuaChunk(source string, s ast.BlockStat, opts ...Option) (kidx uint, consts []ir.Constant, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			compErr, ok := r.(Error)
@@ -19,11 +32,15 @@ func CompileLuaChunk(source string, s ast.BlockStat) (kidx uint, consts []ir.Con
 			err = compErr
 		}
 	}()
+	s = ast.EraseTypes(s)
 	kp := ir.NewConstantPool()
 	rootIrC := ir.NewCodeBuilder("<global chunk>", kp)
 	rootIrC.DeclareLocal("_ENV", rootIrC.GetFreeRegister())
 	irC := rootIrC.NewChild("<main chunk>")
-	c := &compiler{CodeBuilder: irC}
+	c := &compiler{CodeBuilder: irC, version: luaversion.Default}
+	for _, opt := range opts {
+		opt(c)
+	}
 	c.compileFunctionBody(ast.Function{
 		ParList: ast.ParList{HasDots: true},
 		Body:    s,
@@ -34,22 +51,27 @@ func CompileLuaChunk(source string, s ast.BlockStat) (kidx uint, consts []ir.Con
 
 type compiler struct {
 	*ir.CodeBuilder
+	version luaversion.Version
 }
 
 func (c *compiler) NewChild(name string) *compiler {
 	return &compiler{
 		CodeBuilder: c.CodeBuilder.NewChild(name),
+		version:     c.version,
 	}
 }
 
 // Names of various labels and registers used during compilation.
 const (
-	breakLblName    = ir.Name("<break>")
-	ellipsisRegName = ir.Name("...")
-	callerRegName   = ir.Name("<caller>")
-	loopFRegName    = ir.Name("<f>")
-	loopSRegName    = ir.Name("<s>")
-	loopVarRegName  = ir.Name("<var>")
+	breakLblName     = ir.Name("<break>")
+	continueLblName  = ir.Name("<continue>")
+	compoundTRegName = ir.Name("<t>")
+	compoundKRegName = ir.Name("<k>")
+	ellipsisRegName  = ir.Name("...")
+	callerRegName    = ir.Name("<caller>")
+	loopFRegName     = ir.Name("<f>")
+	loopSRegName     = ir.Name("<s>")
+	loopVarRegName   = ir.Name("<var>")
 )
 
 // Error that results from a valid AST which does not form a valid program.
@@ -33,19 +33,26 @@ func (c *expCompiler) ProcessBinOpExp(b ast.BinOp) {
 		c.compileLogicalOp(b, false)
 		return
 	}
-	lsrc := c.compileExpNoDestHint(b.Left)
+	var lsrc binOpArg
+	if k, ok := numConstant(b.Left); ok {
+		lsrc.k = k
+	} else {
+		lsrc.reg = c.compileExpNoDestHint(b.Left)
+	}
 	for _, r := range b.Right {
-		c.TakeRegister(lsrc)
-		rsrc := c.compileExpNoDestHint(r.Operand)
+		var rsrc binOpArg
+		if lsrc.k == nil {
+			c.TakeRegister(lsrc.reg)
+		}
+		if k, ok := numConstant(r.Operand); ok && lsrc.k == nil {
+			rsrc.k = k
+		} else {
+			rsrc.reg = c.compileExpNoDestHint(r.Operand)
+		}
 		switch r.Op {
 		case ops.OpNeq:
 			// x ~= y ==> ~(x = y)
-			c.emitInstr(b, ir.Combine{
-				Op:   ops.OpEq,
-				Dst:  c.dst,
-				Lsrc: lsrc,
-				Rsrc: rsrc,
-			})
+			c.emitCombine(b, ops.OpEq, lsrc, rsrc)
 			c.emitInstr(b, ir.Transform{
 				Op:  ops.OpNot,
 				Dst: c.dst,
@@ -53,30 +60,64 @@ func (c *expCompiler) ProcessBinOpExp(b ast.BinOp) {
 			})
 		case ops.OpGt:
 			// x > y ==> y < x
-			c.emitInstr(b, ir.Combine{
-				Op:   ops.OpLt,
-				Dst:  c.dst,
-				Lsrc: rsrc,
-				Rsrc: lsrc,
-			})
+			c.emitCombine(b, ops.OpLt, rsrc, lsrc)
 		case ops.OpGeq:
 			// x >= y ==> y <= x
-			c.emitInstr(b, ir.Combine{
-				Op:   ops.OpLeq,
-				Dst:  c.dst,
-				Lsrc: rsrc,
-				Rsrc: lsrc,
-			})
+			c.emitCombine(b, ops.OpLeq, rsrc, lsrc)
 		default:
-			c.emitInstr(b, ir.Combine{
-				Op:   r.Op,
-				Dst:  c.dst,
-				Lsrc: lsrc,
-				Rsrc: rsrc,
-			})
+			c.emitCombine(b, r.Op, lsrc, rsrc)
+		}
+		if lsrc.k == nil {
+			c.ReleaseRegister(lsrc.reg)
 		}
-		c.ReleaseRegister(lsrc)
-		lsrc = c.dst
+		lsrc = binOpArg{reg: c.dst}
+	}
+}
+
+// A binOpArg is an operand of a binary operator.  It is either a register or a
+// numeric constant (if k is not nil).
+type binOpArg struct {
+	reg ir.Register
+	k   ir.Constant
+}
+
+// numConstant returns the constant value of e if it is a number literal.
+func numConstant(e ast.ExpNode) (ir.Constant, bool) {
+	switch n := e.(type) {
+	case ast.Int:
+		return ir.Int(n.Val), true
+	case ast.Float:
+		return ir.Float(n.Val), true
+	}
+	return nil, false
+}
+
+// emitCombine emits dst <- op(x, y).  At most one of x and y can be a numeric
+// constant, which allows emitting specialised code.
+func (c *expCompiler) emitCombine(l ast.Locator, op ops.Op, x, y binOpArg) {
+	switch {
+	case x.k != nil:
+		c.emitInstr(l, ir.CombineK{
+			Op:      op,
+			Dst:     c.dst,
+			Src:     y.reg,
+			Kidx:    c.GetConstantIndex(x.k),
+			Reverse: true,
+		})
+	case y.k != nil:
+		c.emitInstr(l, ir.CombineK{
+			Op:   op,
+			Dst:  c.dst,
+			Src:  x.reg,
+			Kidx: c.GetConstantIndex(y.k),
+		})
+	default:
+		c.emitInstr(l, ir.Combine{
+			Op:   op,
+			Dst:  c.dst,
+			Lsrc: x.reg,
+			Rsrc: y.reg,
+		})
 	}
 }
 
@@ -126,12 +167,33 @@ func (c *expCompiler) ProcessFunctionCallExp(f ast.FunctionCall) {
 func (c *expCompiler) ProcessIndexExp(e ast.IndexExp) {
 	tReg := c.compileExpNoDestHint(e.Coll)
 	c.TakeRegister(tReg)
+	var nilLbl, doneLbl ir.Label
+	if e.Safe {
+		// If the collection is nil, the result is nil and the index is not
+		// evaluated.
+		nilLbl, doneLbl = c.GetNewLabel(), c.GetNewLabel()
+		testReg := c.GetFreeRegister()
+		c.emitLoadConst(e, ir.NilType{}, testReg)
+		c.emitInstr(e, ir.Combine{
+			Op:   ops.OpEq,
+			Dst:  testReg,
+			Lsrc: tReg,
+			Rsrc: testReg,
+		})
+		c.emitInstr(e, ir.JumpIf{Cond: testReg, Label: nilLbl})
+	}
 	iReg := c.compileExpNoDestHint(e.Idx)
 	c.emitInstr(e, ir.Lookup{
 		Dst:   c.dst,
 		Table: tReg,
 		Index: iReg,
 	})
+	if e.Safe {
+		c.emitInstr(e, ir.Jump{Label: doneLbl})
+		must(c.EmitLabelNoLine(nilLbl))
+		c.emitLoadConst(e, ir.NilType{}, c.dst)
+		must(c.EmitLabelNoLine(doneLbl))
+	}
 	c.ReleaseRegister(tReg)
 }
 
@@ -144,7 +206,7 @@ func (c *expCompiler) ProcessNameExp(n ast.Name) {
 		return
 	}
 	// If not, try _ENV.
-	c.CompileExp(globalVar(n))
+	c.CompileExp(c.globalVar(n, false))
 }
 
 // ProcessNilExp compiles a NilExp.
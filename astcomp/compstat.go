@@ -3,6 +3,7 @@ package astcomp
 import (
 	"github.com/arnodel/golua/ast"
 	"github.com/arnodel/golua/ir"
+	"github.com/arnodel/golua/luaversion"
 	"github.com/arnodel/golua/ops"
 )
 
@@ -36,11 +37,70 @@ func (c *compiler) ProcessBreakStat(s ast.BreakStat) {
 	c.emitJump(s, breakLblName)
 }
 
+// ProcessCompoundAssignStat compiles a CompoundAssignStat.
+func (c *compiler) ProcessCompoundAssignStat(s ast.CompoundAssignStat) {
+	dest := s.Dest
+	if n, ok := dest.(ast.Name); ok {
+		if _, ok := c.GetRegister(ir.Name(n.Val)); !ok {
+			dest = c.globalVar(n, true)
+		}
+	}
+	idx, ok := dest.(ast.IndexExp)
+	if !ok {
+		// A local variable, so "x op= v" is simply "x = x op v"
+		c.ProcessAssignStat(ast.AssignStat{
+			Location: s.Location,
+			Dest:     []ast.Var{s.Dest},
+			Src:      []ast.ExpNode{s.Operation()},
+		})
+		return
+	}
+	// "t[k] op= v" is compiled as "local <t>, <k> = t, k; <t>[<k>] = <t>[<k>] op
+	// v" so that t and k are evaluated only once.
+	regs := make([]ir.Register, 2)
+	c.compileExpList([]ast.ExpNode{idx.Coll, idx.Idx}, regs)
+	c.PushContext()
+	for i, name := range []ir.Name{compoundTRegName, compoundKRegName} {
+		c.ReleaseRegister(regs[i])
+		c.DeclareLocal(name, regs[i])
+	}
+	s.Dest = ast.IndexExp{
+		Location: idx.Location,
+		Coll:     ast.Name{Location: idx.Coll.Locate(), Val: string(compoundTRegName)},
+		Idx:      ast.Name{Location: idx.Idx.Locate(), Val: string(compoundKRegName)},
+	}
+	c.ProcessAssignStat(ast.AssignStat{
+		Location: s.Location,
+		Dest:     []ast.Var{s.Dest},
+		Src:      []ast.ExpNode{s.Operation()},
+	})
+	c.PopContext()
+}
+
+// ProcessContinueStat compiles a ContinueStat.
+func (c *compiler) ProcessContinueStat(s ast.ContinueStat) {
+	if !c.CodeBuilder.EmitJump(continueLblName, getLine(s)) {
+		panic(Error{
+			Where:   s,
+			Message: "'continue' outside a loop, or skipping a local declaration in a repeat-until loop",
+		})
+	}
+}
+
 // ProcessEmptyStat compiles a EmptyStat.
 func (c *compiler) ProcessEmptyStat(s ast.EmptyStat) {
 	// Nothing to compile!
 }
 
+// ProcessErrorStat fails to compile an ErrorStat, as it stands for a syntax
+// error.
+func (c *compiler) ProcessErrorStat(s ast.ErrorStat) {
+	panic(Error{
+		Where:   s,
+		Message: s.Message,
+	})
+}
+
 // ProcessForInStat compiles a ForInStat.
 func (c *compiler) ProcessForInStat(s ast.ForInStat) {
 	initRegs := make([]ir.Register, 4)
@@ -63,6 +123,10 @@ func (c *compiler) ProcessForInStat(s ast.ForInStat) {
 	for i, name := range s.Vars {
 		nameAttribs[i] = ast.NewNameAttrib(name, nil, ast.NoAttrib)
 	}
+	if c.version >= luaversion.Lua55 {
+		// The control variable is read-only in Lua 5.5
+		nameAttribs[0].Attrib = ast.ConstAttrib
+	}
 	c.CompileStat(ast.LocalStat{
 		NameAttribs: nameAttribs,
 		Values: []ast.ExpNode{ast.FunctionCall{BFunctionCall: &ast.BFunctionCall{
@@ -87,7 +151,9 @@ func (c *compiler) ProcessForInStat(s ast.ForInStat) {
 	endLbl := c.DeclareGotoLabelNoLine(breakLblName)
 	c.emitInstr(s, ir.JumpIf{Cond: testReg, Label: endLbl})
 	c.emitInstr(s, ir.Transform{Dst: varReg, Op: ops.OpId, Src: var1})
+	c.DeclareGotoLabelNoLine(continueLblName)
 	c.compileBlock(s.Body)
+	must(c.EmitGotoLabel(continueLblName))
 
 	c.emitInstr(s, ir.Jump{Label: loopLbl})
 
@@ -143,7 +209,13 @@ func (c *compiler) ProcessForStat(s ast.ForStat) {
 	// iter <- start
 	ir.EmitMoveNoLine(c.CodeBuilder, iterReg, startReg)
 	c.DeclareLocal(ir.Name(s.Var.Val), iterReg)
+	if c.version >= luaversion.Lua55 {
+		// The loop variable is read-only in Lua 5.5
+		c.MarkConstantReg(iterReg)
+	}
+	c.DeclareGotoLabelNoLine(continueLblName)
 	c.compileBlock(s.Body)
+	must(c.EmitGotoLabel(continueLblName))
 	c.PopContext()
 
 	//Advance the for loop
@@ -151,6 +223,7 @@ func (c *compiler) ProcessForStat(s ast.ForStat) {
 		Start: startReg,
 		Stop:  stopReg,
 		Step:  stepReg,
+		Int:   isIntLiteral(s.Start) && isIntLiteral(s.Step),
 	})
 	// If startReg is not nil, it means the loop continues
 	c.EmitNoLine(ir.JumpIf{
@@ -167,12 +240,67 @@ func (c *compiler) ProcessForStat(s ast.ForStat) {
 	c.ReleaseRegister(stepReg)
 }
 
+// isIntLiteral returns true if e is an integer literal, possibly negated.
+func isIntLiteral(e ast.ExpNode) bool {
+	switch n := e.(type) {
+	case ast.Int:
+		return true
+	case *ast.UnOp:
+		return n.Op == ops.OpNeg && isIntLiteral(n.Operand)
+	}
+	return false
+}
+
 // ProcessFunctionCallStat compiles a FunctionCallStat.
 func (c *compiler) ProcessFunctionCallStat(f ast.FunctionCall) {
 	c.compileCall(*f.BFunctionCall, false)
 	c.emitInstr(f, ir.Receive{})
 }
 
+// ProcessGlobalFunctionStat compiles a GlobalFunctionStat.
+func (c *compiler) ProcessGlobalFunctionStat(s ast.GlobalFunctionStat) {
+	// The function can refer to itself, so declare it first.
+	c.declareGlobal(s.Name, ast.NoAttrib)
+	c.ProcessAssignStat(ast.AssignStat{
+		Location: s.Location,
+		Dest:     []ast.Var{globalVar(s.Name)},
+		Src:      []ast.ExpNode{s.Function},
+	})
+}
+
+// ProcessGlobalStat compiles a GlobalStat.
+func (c *compiler) ProcessGlobalStat(s ast.GlobalStat) {
+	if s.All {
+		c.DeclareGlobal("", s.Attrib == ast.ConstAttrib)
+		return
+	}
+	if len(s.Values) > 0 {
+		dest := make([]ast.Var, len(s.NameAttribs))
+		for i, na := range s.NameAttribs {
+			dest[i] = globalVar(na.Name)
+		}
+		c.ProcessAssignStat(ast.AssignStat{
+			Location: s.Location,
+			Dest:     dest,
+			Src:      s.Values,
+		})
+	}
+	for _, na := range s.NameAttribs {
+		c.declareGlobal(na.Name, na.Attrib)
+	}
+}
+
+func (c *compiler) declareGlobal(name ast.Name, attrib ast.LocalAttrib) {
+	if name.Val == "_ENV" {
+		// Global variables are accessed via _ENV
+		panic(Error{
+			Where:   name,
+			Message: "cannot declare _ENV as a global variable",
+		})
+	}
+	c.DeclareGlobal(ir.Name(name.Val), attrib == ast.ConstAttrib)
+}
+
 // ProcessGotoStat compiles a GotoStat.
 func (c *compiler) ProcessGotoStat(s ast.GotoStat) {
 	c.emitJump(s, ir.Name(s.Label.Val))
@@ -245,6 +373,10 @@ func (c *compiler) ProcessLocalStat(s ast.LocalStat) {
 
 // ProcessRepeatStat compiles a RepeatStat.
 func (c *compiler) ProcessRepeatStat(s ast.RepeatStat) {
+	if hasContinue(s.Body) {
+		c.compileRepeatWithContinue(s)
+		return
+	}
 	c.PushContext()
 	c.DeclareGotoLabelNoLine(breakLblName)
 
@@ -268,15 +400,58 @@ func (c *compiler) ProcessRepeatStat(s ast.RepeatStat) {
 	c.PopContext()
 }
 
+// compileRepeatWithContinue compiles a RepeatStat whose body contains a
+// "continue" statement.  The continue label must be in the scope of the locals
+// in the body, as they are visible in the condition, so the loop is compiled
+// as
+//
+//	while true do <body> ::<continue>:: if <cond> then break end end
+//
+// A "continue" statement that comes before a local declaration in the body
+// cannot see the label, like a goto cannot jump into the scope of a local.
+func (c *compiler) compileRepeatWithContinue(s ast.RepeatStat) {
+	if s.Body.Return != nil {
+		panic(Error{
+			Where:   s,
+			Message: "'continue' in a repeat-until loop ending with a return statement",
+		})
+	}
+	condLoc := s.Cond.Locate()
+	stats := make([]ast.Stat, len(s.Body.Stats), len(s.Body.Stats)+2)
+	copy(stats, s.Body.Stats)
+	stats = append(stats,
+		ast.LabelStat{Location: condLoc, Name: ast.Name{Location: condLoc, Val: string(continueLblName)}},
+		ast.IfStat{
+			Location: condLoc,
+			If: ast.CondStat{
+				Cond: s.Cond,
+				Body: ast.BlockStat{Location: condLoc, Stats: []ast.Stat{ast.BreakStat{Location: condLoc}}},
+			},
+		},
+	)
+	c.PushContext()
+	c.DeclareGotoLabelNoLine(breakLblName)
+
+	loopLbl := c.GetNewLabel()
+	must(c.EmitLabelNoLine(loopLbl))
+	c.compileBlock(ast.BlockStat{Location: s.Body.Location, Stats: stats})
+	c.emitInstr(s, ir.Jump{Label: loopLbl})
+
+	must(c.EmitGotoLabel(breakLblName))
+	c.PopContext()
+}
+
 // ProcessWhileStat compiles a WhileStat.
 func (c *compiler) ProcessWhileStat(s ast.WhileStat) {
 	c.PushContext()
 	stopLbl := c.DeclareGotoLabelNoLine(breakLblName)
+	c.DeclareGotoLabelNoLine(continueLblName)
 
 	loopLbl := c.GetNewLabel()
 	must(c.EmitLabelNoLine(loopLbl))
 
 	c.compileCond(s.CondStat, stopLbl)
+	must(c.EmitGotoLabel(continueLblName))
 
 	c.emitInstr(s, ir.Jump{Label: loopLbl}) // TODO: better location
 
@@ -305,7 +480,7 @@ func (c *compiler) compileBlockNoPop(s ast.BlockStat, complete bool) func() {
 	}
 	for i, stat := range s.Stats {
 		switch stat.(type) {
-		case ast.LocalStat, ast.LocalFunctionStat:
+		case ast.LocalStat, ast.LocalFunctionStat, ast.GlobalStat, ast.GlobalFunctionStat:
 			totalDepth++
 			c.PushContext()
 			getLabels(c.CodeBuilder, s.Stats[i+1:truncLen])
@@ -336,26 +511,54 @@ func (c *compiler) compileBlockNoPop(s ast.BlockStat, complete bool) func() {
 }
 
 // Declares goto labels for the statements in order, stopping when encountering
-// a local variable declaration.  Return true if the whole slice was processed
+// a local or global variable declaration.  Return true if the whole slice was processed
 // (so no need to get back labels)
 func getLabels(c *ir.CodeBuilder, statements []ast.Stat) bool {
 	for _, stat := range statements {
 		switch s := stat.(type) {
 		case ast.LabelStat:
-			_, err := c.DeclareUniqueGotoLabel(ir.Name(s.Name.Val), s.Name.StartPos().Line)
-			if err != nil {
-				panic(Error{
-					Where:   s.Name,
-					Message: err.Error(),
-				})
-			}
-		case ast.LocalStat, ast.LocalFunctionStat:
+			declareLabel(c, s)
+		case ast.LocalStat, ast.LocalFunctionStat, ast.GlobalStat, ast.GlobalFunctionStat:
 			return false
 		}
 	}
 	return true
 }
 
+func declareLabel(c *ir.CodeBuilder, s ast.LabelStat) {
+	name := ir.Name(s.Name.Val)
+	if name == continueLblName {
+		// The label added to a repeat-until loop body for "continue" may shadow
+		// the one of an enclosing loop.
+		c.DeclareGotoLabel(name, getLine(s.Name))
+		return
+	}
+	_, err := c.DeclareUniqueGotoLabel(name, getLine(s.Name))
+	if err != nil {
+		panic(Error{
+			Where:   s.Name,
+			Message: err.Error(),
+		})
+	}
+}
+
+// hasContinue returns true if the loop body contains a "continue" statement for
+// that loop (i.e. not in a nested loop or function).
+func hasContinue(body ast.BlockStat) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case ast.ContinueStat:
+			found = true
+		case ast.Function, ast.WhileStat, ast.RepeatStat,
+			ast.ForStat, *ast.ForStat, ast.ForInStat, *ast.ForInStat:
+			return false
+		}
+		return !found && n != nil
+	})
+	return found
+}
+
 // Process the statements in reverse order to declare "back labels".  Return the
 // number of statements processed.
 func getBackLabels(c *ir.CodeBuilder, statements []ast.Stat) int {
@@ -365,13 +568,7 @@ func getBackLabels(c *ir.CodeBuilder, statements []ast.Stat) int {
 		case ast.EmptyStat:
 			// That doesn't count
 		case ast.LabelStat:
-			_, err := c.DeclareUniqueGotoLabel(ir.Name(s.Name.Val), s.Name.StartPos().Line)
-			if err != nil {
-				panic(Error{
-					Where:   s.Name,
-					Message: err.Error(),
-				})
-			}
+			declareLabel(c, s)
 		default:
 			return count
 		}
@@ -49,7 +49,7 @@ func (c *assignCompiler) ProcessNameVar(n ast.Name) {
 			c.emitMove(n, reg, src)
 		})
 	} else {
-		c.ProcessIndexExpVar(globalVar(n))
+		c.ProcessIndexExpVar(c.globalVar(n, true))
 	}
 }
 
@@ -65,3 +65,24 @@ func (c *compiler) compileAssignments(lvals []ast.Var, dsts []ir.Register) {
 		ac.assigns[i](reg)
 	}
 }
+
+// globalVar returns the expression _ENV.n for the global variable n, after
+// checking that n is declared as a global variable if there are global
+// declarations in scope (Lua 5.5).  If assign is true, it also checks that n is
+// not a constant.
+func (c *compiler) globalVar(n ast.Name, assign bool) ast.IndexExp {
+	declared, constant := c.GlobalDeclaration(ir.Name(n.Val))
+	if !declared {
+		panic(Error{
+			Where:   n,
+			Message: fmt.Sprintf("variable '%s' is not declared", n.Val),
+		})
+	}
+	if assign && constant {
+		panic(Error{
+			Where:   n,
+			Message: fmt.Sprintf("attempt to reassign constant variable '%s'", n.Val),
+		})
+	}
+	return globalVar(n)
+}
@@ -11,7 +11,7 @@ import (
 // number when emitting instructions.
 
 func (c *compiler) emitInstr(l ast.Locator, instr ir.Instruction) {
-	c.CodeBuilder.Emit(instr, getLine(l))
+	c.CodeBuilder.EmitWithColumns(instr, getLine(l), getColumns(l))
 }
 
 func (c *compiler) emitJump(l ast.Locator, lbl ir.Name) {
@@ -31,6 +31,24 @@ func (c *compiler) emitMove(l ast.Locator, dst, src ir.Register) {
 	ir.EmitMove(c.CodeBuilder, dst, src, getLine(l))
 }
 
+// getColumns returns the columns spanned by l on its first line.
+func getColumns(l ast.Locator) ir.ColumnSpan {
+	var cols ir.ColumnSpan
+	if l == nil {
+		return cols
+	}
+	loc := l.Locate()
+	start, end := loc.StartPos(), loc.EndPos()
+	if start == nil {
+		return cols
+	}
+	cols.Start = start.Column
+	if end != nil && end.Line == start.Line {
+		cols.End = end.Column
+	}
+	return cols
+}
+
 func getLine(l ast.Locator) int {
 	if l != nil {
 		locStart := l.Locate().StartPos()
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/arnodel/golua/luaversion"
+	"github.com/arnodel/golua/parsing"
+	"github.com/arnodel/golua/scanner"
+	"github.com/arnodel/golua/typecheck"
+)
+
+// runCheck type checks the Lua files given as arguments, for "golua check".
+// Type annotations are always enabled.  It returns 1 if any file has a syntax
+// or type error.
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: golua check [-syntax extensions] [-lang version] file.lua...\n")
+		flags.PrintDefaults()
+	}
+	syntax := flags.String("syntax", "", "other syntax extensions enabled (e.g. compound+continue)")
+	lang := flags.String("lang", luaversion.Default.String(), "version of the Lua language (5.4 or 5.5)")
+	_ = flags.Parse(args)
+	exts, err := scanner.ParseExtensions(*syntax)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "golua check: %s\n", err)
+		return 2
+	}
+	version, err := luaversion.Parse(*lang)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "golua check: %s\n", err)
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+	exts |= scanner.TypeAnnotations
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "golua check: %s\n", err)
+			status = 1
+			continue
+		}
+		chunk, err := parsing.ParseChunk(scanner.New(path, src, scanner.WithExtensions(exts), scanner.WithVersion(version)))
+		if err != nil {
+			fmt.Printf("%s:%s\n", path, err)
+			status = 1
+			continue
+		}
+		for _, err := range typecheck.Check(chunk) {
+			fmt.Printf("%s:%s\n", path, err)
+			status = 1
+		}
+	}
+	return status
+}
@@ -11,10 +11,11 @@ import (
 	"strings"
 
 	"github.com/arnodel/golua/ast"
+	"github.com/arnodel/golua/diagnostics"
 	"github.com/arnodel/golua/lib"
 	"github.com/arnodel/golua/lib/base"
-	"github.com/arnodel/golua/lib/debuglib"
-	"github.com/arnodel/golua/lib/iolib"
+	"github.com/arnodel/golua/lib/compatlib"
+	"github.com/arnodel/golua/luaversion"
 	rt "github.com/arnodel/golua/runtime"
 )
 
@@ -22,19 +23,28 @@ type luaCmd struct {
 	disFlag        bool
 	astFlag        bool
 	unbufferedFlag bool
+	compatFlag     bool
 	cpuLimit       uint64
 	memLimit       uint64
 	flags          string
+	syntax         string
+	lang           string
 	exec           execFlags
 
 	complianceFlags rt.ComplianceFlags
+
+	// Source code of the chunks run by the command, to show in error messages.
+	sources map[string][]byte
 }
 
 func (c *luaCmd) setFlags() {
 	flag.BoolVar(&c.disFlag, "dis", false, "Disassemble source instead of running it")
 	flag.BoolVar(&c.astFlag, "ast", false, "Print AST instead of running code")
 	flag.BoolVar(&c.unbufferedFlag, "u", false, "Force unbuffered output")
+	flag.BoolVar(&c.compatFlag, "compat", false, "Load the Lua 5.1 compatibility library")
 	flag.Var(&c.exec, "e", "statement to execute")
+	flag.StringVar(&c.syntax, "syntax", "", "syntax extensions enabled in the main chunk (e.g. compound+continue)")
+	flag.StringVar(&c.lang, "lang", luaversion.Default.String(), "version of the Lua language (5.4 or 5.5)")
 
 	if rt.QuotasAvailable {
 		flag.Uint64Var(&c.cpuLimit, "cpulimit", 0, "CPU limit")
@@ -57,7 +67,6 @@ func (c *luaCmd) run() (retcode int) {
 	if c.unbufferedFlag {
 		buffered = false
 	}
-	iolib.BufferedStdFiles = buffered
 
 	if c.flags != "" {
 		for _, name := range strings.Split(c.flags, ",") {
@@ -69,12 +78,20 @@ func (c *luaCmd) run() (retcode int) {
 		}
 	}
 
+	version, err := luaversion.Parse(c.lang)
+	if err != nil {
+		return fatal("Invalid -lang: %s", err)
+	}
+
 	// Get a Lua runtime
-	r := rt.New(nil)
+	r := rt.New(nil, rt.WithLanguageVersion(version), rt.WithBufferedStdFiles(buffered))
 	c.pushContext(r)
 
 	cleanup := lib.LoadAll(r)
 	defer cleanup()
+	if c.compatFlag {
+		defer lib.LoadLibs(r, compatlib.LibLoader)()
+	}
 
 	// Run finalizers before we exit
 	defer r.Close(nil)
@@ -106,14 +123,18 @@ func (c *luaCmd) run() (retcode int) {
 	}
 
 	for _, src := range c.exec {
+		c.addSource("<exec>", []byte(src))
 		unit, _, err := r.CompileLuaChunk("<exec>", []byte(src))
 		if err != nil {
-			return fatal("Error parsing %q: %s", src, err)
+			return c.fatalError("Error parsing %q: ", src, err)
 		}
 		clos := r.LoadLuaUnit(unit, rt.TableValue(r.GlobalEnv()))
 		cerr := rt.Call(r.MainThread(), rt.FunctionValue(clos), argVals, rt.NewTerminationWith(nil, 0, false))
+		if exitErr, ok := cerr.(*rt.ExitError); ok {
+			return exitErr.Code
+		}
 		if cerr != nil {
-			return fatal("!!! %s", cerr.Error())
+			return c.fatalError("!!! ", cerr)
 		}
 	}
 
@@ -127,10 +148,12 @@ func (c *luaCmd) run() (retcode int) {
 		}
 	}
 
+	c.addSource(chunkName, chunk)
+
 	if c.astFlag {
 		stat, _, err := r.ParseLuaChunk(chunkName, chunk)
 		if err != nil {
-			return fatal("Error parsing %s: %s", chunkName, err)
+			return c.fatalError("Error parsing %s: ", chunkName, err)
 		}
 		w := ast.NewIndentWriter(os.Stdout)
 		stat.HWrite(w)
@@ -140,7 +163,7 @@ func (c *luaCmd) run() (retcode int) {
 	if c.disFlag {
 		unit, _, err := r.CompileLuaChunk(chunkName, chunk)
 		if err != nil {
-			return fatal("Error parsing %s: %s", chunkName, err)
+			return c.fatalError("Error parsing %s: ", chunkName, err)
 		}
 		unit.Disassemble(os.Stdout)
 		return 0
@@ -157,13 +180,20 @@ func (c *luaCmd) run() (retcode int) {
 		}
 	}()
 
-	clos, err := r.LoadFromSourceOrCode(chunkName, chunk, "bt", rt.TableValue(r.GlobalEnv()), true)
+	mode := "bt"
+	if c.syntax != "" {
+		mode += "+" + c.syntax
+	}
+	clos, err := r.LoadFromSourceOrCode(chunkName, chunk, mode, rt.TableValue(r.GlobalEnv()), true)
 	if err != nil {
-		return fatal("Error loading %s: %s", chunkName, err)
+		return c.fatalError("Error loading %s: ", chunkName, err)
 	}
 	cerr := rt.Call(r.MainThread(), rt.FunctionValue(clos), argVals, rt.NewTerminationWith(nil, 0, false))
+	if exitErr, ok := cerr.(*rt.ExitError); ok {
+		return exitErr.Code
+	}
 	if cerr != nil {
-		return fatal("!!! %s", cerr.Error())
+		return c.fatalError("!!! ", cerr)
 	}
 	return 0
 }
@@ -173,6 +203,31 @@ func fatal(tpl string, args ...interface{}) int {
 	return 1
 }
 
+// fatalError prints err with a source excerpt and traceback if available,
+// prefixed with the formatted args.  The last arg must be the error.
+func (c *luaCmd) fatalError(tpl string, args ...interface{}) int {
+	err := args[len(args)-1].(error)
+	f := diagnostics.Formatter{Source: c.source, Traceback: true}
+	fmt.Fprintf(os.Stderr, tpl, args[:len(args)-1]...)
+	fmt.Fprint(os.Stderr, f.Format(err))
+	return 1
+}
+
+func (c *luaCmd) addSource(name string, src []byte) {
+	if c.sources == nil {
+		c.sources = map[string][]byte{}
+	}
+	c.sources[name] = src
+}
+
+// source returns the source code of a chunk, for error messages.
+func (c *luaCmd) source(name string) ([]byte, bool) {
+	if src, ok := c.sources[name]; ok {
+		return src, true
+	}
+	return diagnostics.FileSource(name)
+}
+
 func isaTTY(f *os.File) bool {
 	fi, _ := f.Stat()
 	return fi.Mode()&os.ModeCharDevice != 0
@@ -201,8 +256,13 @@ func (c *luaCmd) repl(r *rt.Runtime) int {
 		more, err := c.runChunk(r, w.Bytes())
 		if !more {
 			w = new(bytes.Buffer)
+			if exitErr, ok := err.(*rt.ExitError); ok {
+				return exitErr.Code
+			}
 			if err != nil {
-				fmt.Printf("!!! %s\n", err)
+				// Chunks in the REPL all have the same name so do not show
+				// source excerpts, which could be from the wrong chunk.
+				fmt.Print("!!! " + diagnostics.Formatter{Traceback: true}.Format(err))
 				if _, ok := err.(rt.ContextTerminationError); ok {
 					fmt.Print("Reset limits and continue? [yN] ")
 					line, err := reader.ReadString('\n')
@@ -253,8 +313,7 @@ func (c *luaCmd) pushContext(r *rt.Runtime) {
 			Cpu:    c.cpuLimit,
 			Memory: c.memLimit,
 		},
-		RequiredFlags:  c.complianceFlags,
-		MessageHandler: debuglib.Traceback,
+		RequiredFlags: c.complianceFlags,
 	})
 }
 
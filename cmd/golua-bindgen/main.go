@@ -0,0 +1,54 @@
+// Command golua-bindgen generates static bindings for Go packages, so that Lua
+// code can import them with golib.import without building plugins at runtime
+// (which requires the go toolchain and is not supported on all platforms).
+//
+// It is meant to be used with go generate, e.g.
+//
+//	//go:generate go run github.com/arnodel/golua/cmd/golua-bindgen -o golua_bindings.go strings fmt
+//
+// The generated file registers the bindings with golib.RegisterPackage when the
+// program is initialised.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/arnodel/golua/lib/golib/goimports"
+)
+
+func main() {
+	flag.Usage = usage
+	var output, pkgName string
+	flag.StringVar(&output, "o", "golua_bindings.go", "Output file (- for stdout)")
+	flag.StringVar(&pkgName, "package", os.Getenv("GOPACKAGE"), "Package of the generated file (defaults to $GOPACKAGE)")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if pkgName == "" {
+		pkgName = "main"
+	}
+	var buf bytes.Buffer
+	if err := goimports.GenerateBindings(&buf, pkgName, flag.Args()...); err != nil {
+		log.Fatal(err)
+	}
+	if output == "-" {
+		os.Stdout.Write(buf.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] package...\n", os.Args[0])
+	flag.PrintDefaults()
+}
@@ -232,3 +232,27 @@ func PrepForLoop(rStart, rStop, rStep Reg) Opcode {
 func AdvForLoop(rStart, rStop, rStep Reg) Opcode {
 	return mkType7(On, rStart, rStop, rStep)
 }
+
+// CombineI encodes r1 <- op(r2, n) where n is a small integer literal.
+//
+// r1 and r2 must be value registers and op must have an immediate operand.
+func CombineI(op NumOp, r1, r2 Reg, n Int8) Opcode {
+	return mkType8(op, r1, r2, n.encodeC())
+}
+
+// CombineK encodes r1 <- op(r2, Ki)
+//
+// r1 and r2 must be value registers, op must have a constant operand and i must
+// fit in 8 bits.
+func CombineK(op NumOp, r1, r2 Reg, i KIndex) Opcode {
+	return mkType8(op, r1, r2, 0).SetK8(i)
+}
+
+// AdvForIntLoop is like AdvForLoop but it is only valid when rStart and rStep
+// are known to contain integers.  It can only use value registers.
+func AdvForIntLoop(rStart, rStop, rStep Reg) Opcode {
+	if rStep.IsCell() {
+		panic("Type8 opcodes only operate on value registers")
+	}
+	return mkType8(OpAdvForInt, rStart, rStop, Opcode(rStep.Idx()))
+}
@@ -9,11 +9,10 @@ import (
 // Opcode is the type of opcodes
 type Opcode uint32
 
-// There are 7 types of opcodes (Typ0 - Type7).  The type of opcode is defined
+// There are 9 types of opcodes (Typ0 - Type8).  The type of opcode is defined
 // by the most significant 4 bits of the opcode.
 
-// Prefixes for the different types of opcodes.  Note: there is an unused prefix
-// (0001).
+// Prefixes for the different types of opcodes.
 const (
 	Type1Pfx Opcode = 1 << 31 // 1......
 	Type2Pfx Opcode = 7 << 28 // 0111...
@@ -22,6 +21,7 @@ const (
 	Type5Pfx Opcode = 4 << 28 // 0100...
 	Type6Pfx Opcode = 3 << 28 // 0011...
 	Type7Pfx Opcode = 2 << 28 // 0010...
+	Type8Pfx Opcode = 1 << 28 // 0001...
 	Type0Pfx Opcode = 0 << 28 // 0000...
 
 	type4aFlag Opcode = 1 << 24
@@ -431,6 +431,123 @@ func mkType7(f Flag, rA, rB, rC Reg) Opcode {
 	return Type7Pfx | f.encodeF() | rA.toA() | rB.toB() | rC.toC()
 }
 
+// ==================================================================
+// Type8:  0001XXXX AAAAAAAA BBBBBBBB CCCCCCCC
+//
+// Specialised numeric opcodes.  They only operate on value registers (not
+// cells), so the a, b, c bits are used to encode the operator.
+// - XXXX encodes the operator op
+// - AAAAAAAA encodes the destination value register rA
+// - BBBBBBBB encodes the left operand value register rB
+// - CCCCCCCC encodes the right operand, which depends on op: a signed 8 bit
+//   integer n, the index of a constant Kc or a value register rC.
+//
+// All these opcodes have a fast path for when the operands are numbers and
+// fall back to the generic implementation of the operator otherwise, so they
+// behave exactly like the Type1 opcode they replace.
+
+// NumOp is the type of operators available in Type8 opcodes.
+type NumOp uint8
+
+// Here is the list of available numeric operators.
+const (
+	OpAddI      NumOp = iota // rA <- rB + n
+	OpSubI                   // rA <- rB - n
+	OpMulI                   // rA <- rB * n
+	OpDivI                   // rA <- rB / n
+	OpFloorDivI              // rA <- rB // n
+	OpModI                   // rA <- rB % n
+	OpEqI                    // rA <- rB == n
+	OpLtI                    // rA <- rB < n
+	OpLeqI                   // rA <- rB <= n
+	OpGtI                    // rA <- n < rB
+	OpGeqI                   // rA <- n <= rB
+	OpAddK                   // rA <- rB + Kc
+	OpSubK                   // rA <- rB - Kc
+	OpMulK                   // rA <- rB * Kc
+	OpDivK                   // rA <- rB / Kc
+	OpAdvForInt              // advfor rA, rB, rC with rA and rC integers
+)
+
+// encodeX encodes a NumOp into an opcode.
+func (op NumOp) encodeX() Opcode {
+	return Opcode(op) << 24
+}
+
+// GetNumOp decodes the NumOp from this opcode.
+func (c Opcode) GetNumOp() NumOp {
+	return NumOp((c >> 24) & 0xf)
+}
+
+// HasImmediate returns true if the right operand of op is a signed 8 bit
+// integer.
+func (op NumOp) HasImmediate() bool {
+	return op <= OpGeqI
+}
+
+// HasK returns true if the right operand of op is a constant index.
+func (op NumOp) HasK() bool {
+	return op >= OpAddK && op <= OpDivK
+}
+
+// Int8 is a signed 8 bit integer literal.
+type Int8 int8
+
+func (n Int8) encodeC() Opcode {
+	return Opcode(uint8(n))
+}
+
+// Int8FromInt returns the Int8 encoding n and true if n fits in 8 bits.
+func Int8FromInt(n int64) (Int8, bool) {
+	if n < math.MinInt8 || n > math.MaxInt8 {
+		return 0, false
+	}
+	return Int8(n), true
+}
+
+// GetInt8 decodes the signed 8 bit integer at position C of the opcode.
+func (c Opcode) GetInt8() Int8 {
+	return Int8(int8(uint8(c)))
+}
+
+// GetK8 decodes the constant index at position C of the opcode.
+func (c Opcode) GetK8() KIndex {
+	return KIndex(uint8(c))
+}
+
+// SetK8 returns a copy of the opcode with a new constant index at position C,
+// which must fit in 8 bits.
+func (c Opcode) SetK8(i KIndex) Opcode {
+	if i > math.MaxUint8 {
+		panic("constant index out of range")
+	}
+	return c&0xffffff00 | Opcode(i)
+}
+
+// GetValueA returns the value register rA encoded in a Type8 opcode.
+func (c Opcode) GetValueA() Reg {
+	return ValueReg(uint8(c >> 16))
+}
+
+// GetValueB returns the value register rB encoded in a Type8 opcode.
+func (c Opcode) GetValueB() Reg {
+	return ValueReg(uint8(c >> 8))
+}
+
+// GetValueC returns the value register rC encoded in a Type8 opcode.
+func (c Opcode) GetValueC() Reg {
+	return ValueReg(uint8(c))
+}
+
+// Build a Type8 opcode from its constituents.  rA and rB must be value
+// registers.
+func mkType8(op NumOp, rA, rB Reg, c Opcode) Opcode {
+	if rA.IsCell() || rB.IsCell() {
+		panic("Type8 opcodes only operate on value registers")
+	}
+	return Type8Pfx | op.encodeX() | Opcode(rA.Idx())<<16 | Opcode(rB.Idx())<<8 | c
+}
+
 // ==================================================================
 // Type0:  0000Fabc AAAAAAAA BBBBBBBB CCCCCCCC
 //
@@ -685,6 +802,45 @@ func (c Opcode) Disassemble(d OpcodeDisassembler, i int) string {
 			action = "adv"
 		}
 		return fmt.Sprintf("%sfor %s, %s, %s", action, rStart, rStop, rStep)
+	case Type8Pfx:
+		rA, rB := c.GetValueA(), c.GetValueB()
+		op := c.GetNumOp()
+		var y string
+		switch {
+		case op.HasImmediate():
+			y = fmt.Sprint(c.GetInt8())
+		case op.HasK():
+			k := c.GetK8()
+			y = fmt.Sprintf("K%d (%s)", k, d.ShortKString(k))
+		}
+		tpl := "???"
+		switch op {
+		case OpAddI, OpAddK:
+			tpl = "%s + %s"
+		case OpSubI, OpSubK:
+			tpl = "%s - %s"
+		case OpMulI, OpMulK:
+			tpl = "%s * %s"
+		case OpDivI, OpDivK:
+			tpl = "%s / %s"
+		case OpFloorDivI:
+			tpl = "%s floor/ %s"
+		case OpModI:
+			tpl = "%s mod %s"
+		case OpEqI:
+			tpl = "%s == %s"
+		case OpLtI:
+			tpl = "%s < %s"
+		case OpLeqI:
+			tpl = "%s <= %s"
+		case OpGtI:
+			return fmt.Sprintf("%s <- %s < %s", rA, y, rB)
+		case OpGeqI:
+			return fmt.Sprintf("%s <- %s <= %s", rA, y, rB)
+		case OpAdvForInt:
+			return fmt.Sprintf("advforint %s, %s, %s", rA, rB, c.GetValueC())
+		}
+		return fmt.Sprintf("%s <- "+tpl, rA, rB, y)
 	default:
 		return "???"
 	}
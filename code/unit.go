@@ -9,8 +9,17 @@ import (
 type Unit struct {
 	Source    string     // Shows were the unit comes from (e.g. a filename) - only for information.
 	Code      []Opcode   // The code
-	Lines     []int32    // Optional: source code line for the corresponding opcode
-	Constants []Constant // All the constants required for running the code
+	Lines     []int32      // Optional: source code line for the corresponding opcode
+	Columns   []ColumnSpan // Optional: source code columns for the corresponding opcode
+	Constants []Constant   // All the constants required for running the code
+}
+
+// A ColumnSpan gives the columns of the source code an opcode was compiled
+// from, on the line of the opcode.  Columns start at 1.  Start is 0 if it is
+// unknown.  End is the column of the start of the last token in the span, or 0
+// if the span ends on another line.
+type ColumnSpan struct {
+	Start, End int32
 }
 
 // Disassemble outputs the disassembly of the unit code into the given
@@ -8,6 +8,7 @@ type Label uint
 type Builder struct {
 	source    string          // identifies the source of the code
 	lines     []int32         // lines in the source code corresponding to the opcodes
+	columns   []ColumnSpan    // columns in the source code corresponding to the opcodes
 	code      []Opcode        // opcodes emitted
 	jumpTo    map[Label]int   // destination locations for the labels
 	jumpFrom  map[Label][]int // lists of locations for opcode that jump to a given label
@@ -25,14 +26,27 @@ func NewBuilder(source string) *Builder {
 
 // Emit adds an opcode (associating it with a source code line).
 func (c *Builder) Emit(opcode Opcode, line int) {
+	c.EmitWithColumns(opcode, line, ColumnSpan{})
+}
+
+// EmitWithColumns adds an opcode, associating it with a source code line and
+// columns.
+func (c *Builder) EmitWithColumns(opcode Opcode, line int, cols ColumnSpan) {
 	c.code = append(c.code, opcode)
 	c.lines = append(c.lines, int32(line))
+	c.columns = append(c.columns, cols)
 }
 
 // EmitJump adds a jump opcode, jumping to the given label.  The offset part of
 // the opcode must be left as 0, it will be filled by the builder when the
 // location of the label is known.
 func (c *Builder) EmitJump(opcode Opcode, lbl Label, line int) {
+	c.EmitJumpWithColumns(opcode, lbl, line, ColumnSpan{})
+}
+
+// EmitJumpWithColumns is like EmitJump but also associates the opcode with
+// source code columns.
+func (c *Builder) EmitJumpWithColumns(opcode Opcode, lbl Label, line int, cols ColumnSpan) {
 	jumpToAddr, ok := c.jumpTo[lbl]
 	addr := len(c.code)
 	if ok {
@@ -40,7 +54,7 @@ func (c *Builder) EmitJump(opcode Opcode, lbl Label, line int) {
 	} else {
 		c.jumpFrom[lbl] = append(c.jumpFrom[lbl], addr)
 	}
-	c.Emit(opcode, line)
+	c.EmitWithColumns(opcode, line, cols)
 }
 
 // EmitLabel adds a label for the current location.  It panics if called twice
@@ -78,6 +92,7 @@ func (c *Builder) GetUnit() *Unit {
 		Source:    c.source,
 		Code:      c.code,
 		Lines:     c.lines,
+		Columns:   c.columns,
 		Constants: c.constants,
 	}
 }
@@ -0,0 +1,240 @@
+// Package diagnostics formats the errors produced by compiling or running Lua
+// code for humans.  When the source code is available, the line where the
+// error happened is printed with the faulty code underlined, e.g.
+//
+//	test.lua:3:11: attempt to index a nil value
+//	  |
+//	3 | local x = a.b.c
+//	  |           ^^^^^
+//
+// It is used by the golua command and can be used by programs embedding golua,
+// e.g.
+//
+//	f := diagnostics.Formatter{Source: diagnostics.FileSource, Traceback: true}
+//	if err := rt.Call(t, fn, args, next); err != nil {
+//		fmt.Fprint(os.Stderr, f.Format(err))
+//	}
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/arnodel/golua/astcomp"
+	rt "github.com/arnodel/golua/runtime"
+	"github.com/arnodel/golua/token"
+)
+
+// A Formatter formats errors.  The zero value is ready to use but does not
+// print source excerpts.
+type Formatter struct {
+	// Source returns the source code of the chunk with the given name (the
+	// name given when compiling it, usually a file path).  If it is nil or
+	// returns false, no source excerpt is printed.
+	Source func(name string) ([]byte, bool)
+
+	// If Traceback is true, the call stack of runtime errors is printed after
+	// the source excerpt.
+	Traceback bool
+}
+
+// FileSource reads the source code of a chunk whose name is a file path.  It
+// can be used as the Source field of a Formatter.
+func FileSource(name string) ([]byte, bool) {
+	src, err := os.ReadFile(name)
+	return src, err == nil
+}
+
+// Format returns a description of err, ending with a new line.  Syntax errors,
+// compilation errors and runtime errors are given a location with a column
+// number and a source excerpt when available.  Other errors are formatted with
+// their Error method.
+func (f Formatter) Format(err error) string {
+	var b strings.Builder
+	var (
+		syntaxErr *rt.SyntaxError
+		compErr   astcomp.Error
+		rtErr     *rt.Error
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		b.WriteString(syntaxErr.Error())
+		b.WriteByte('\n')
+		got := syntaxErr.Err.Got
+		f.writeExcerpt(&b, syntaxErr.File, span{
+			line:  got.Line,
+			start: got.Column,
+			end:   got.Column + firstLineWidth(got.Lit) - 1,
+		})
+	case errors.As(err, &compErr):
+		b.WriteString(err.Error())
+		b.WriteByte('\n')
+		name := strings.TrimSuffix(err.Error(), ":"+compErr.Error())
+		loc := compErr.Where.Locate()
+		f.writeExcerpt(&b, name, locationSpan(loc.StartPos(), loc.EndPos()))
+	case errors.As(err, &rtErr):
+		f.formatRuntimeError(&b, rtErr)
+	default:
+		b.WriteString(err.Error())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (f Formatter) formatRuntimeError(b *strings.Builder, err *rt.Error) {
+	msg, ok := err.Value().ToString()
+	if !ok {
+		msg = strings.TrimPrefix(err.Error(), "error: ")
+	}
+	source, line, cols := err.Location()
+	if line > 0 && cols.Start > 0 {
+		pfx := fmt.Sprintf("%s:%d: ", source, line)
+		if strings.HasPrefix(msg, pfx) {
+			msg = fmt.Sprintf("%s:%d:%d: %s", source, line, cols.Start, msg[len(pfx):])
+		}
+	}
+	b.WriteString(msg)
+	b.WriteByte('\n')
+	if line > 0 && cols.Start > 0 {
+		sp := span{line: line, start: int(cols.Start), end: int(cols.End)}
+		if sp.end != 0 {
+			sp.endsWithToken = true
+		}
+		f.writeExcerpt(b, source, sp)
+	}
+	if f.Traceback && len(err.Frames()) > 0 {
+		b.WriteString("stack traceback:\n")
+		for _, frame := range err.Frames() {
+			loc := frame.Source
+			if frame.CurrentLine > 0 {
+				loc = fmt.Sprintf("%s:%d", loc, frame.CurrentLine)
+				if col := frame.CurrentColumns.Start; col > 0 {
+					loc = fmt.Sprintf("%s:%d", loc, col)
+				}
+			}
+			fmt.Fprintf(b, "\tin function %s (file %s)\n", frame.Name, loc)
+		}
+	}
+}
+
+// A span is a range of columns on a line of source code.  Columns start at 1
+// and count runes.  If end is 0, the span extends to the end of the line.
+type span struct {
+	line, start, end int
+
+	// If true, end is the start of a token which is part of the span.
+	endsWithToken bool
+}
+
+func locationSpan(start, end *token.Pos) span {
+	if start == nil {
+		return span{}
+	}
+	sp := span{line: start.Line, start: start.Column}
+	if end != nil && end.Line == start.Line {
+		sp.end = end.Column
+		sp.endsWithToken = true
+	}
+	return sp
+}
+
+func (f Formatter) writeExcerpt(b *strings.Builder, name string, sp span) {
+	if f.Source == nil || sp.line <= 0 || sp.start <= 0 {
+		return
+	}
+	src, ok := f.Source(name)
+	if !ok {
+		return
+	}
+	lines := strings.Split(string(src), "\n")
+	if sp.line > len(lines) {
+		return
+	}
+	line := []rune(strings.TrimRight(lines[sp.line-1], "\r"))
+	if sp.start > len(line)+1 {
+		return
+	}
+	end := sp.end
+	switch {
+	case end == 0 || end > len(line):
+		end = len(line)
+	case sp.endsWithToken:
+		end += tokenWidth(line[end-1:]) - 1
+	}
+	if end < sp.start {
+		end = sp.start
+	}
+
+	lineNo := fmt.Sprint(sp.line)
+	gutter := strings.Repeat(" ", len(lineNo))
+	fmt.Fprintf(b, "%s |\n", gutter)
+	fmt.Fprintf(b, "%s | %s\n", lineNo, string(line))
+	fmt.Fprintf(b, "%s | ", gutter)
+	for _, r := range line[:sp.start-1] {
+		// Keep tabs so that the carets are aligned with the code.
+		if r == '\t' {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString(strings.Repeat("^", end-sp.start+1))
+	b.WriteByte('\n')
+}
+
+// tokenWidth returns the number of runes in the token which starts s (or 1 if
+// it cannot tell).
+func tokenWidth(s []rune) int {
+	if len(s) == 0 {
+		return 1
+	}
+	switch c := s[0]; {
+	case isNameRune(c):
+		n := 1
+		for n < len(s) && isNameRune(s[n]) {
+			n++
+		}
+		return n
+	case c == '"' || c == '\'':
+		for n := 1; n < len(s); n++ {
+			switch s[n] {
+			case '\\':
+				n++
+			case c:
+				return n + 1
+			}
+		}
+		return len(s)
+	case strings.ContainsRune(operatorRunes, c):
+		n := 1
+		for n < len(s) && strings.ContainsRune(operatorRunes, s[n]) {
+			n++
+		}
+		return n
+	default:
+		return 1
+	}
+}
+
+const operatorRunes = "+-*/%^#&~|<>=.:"
+
+func isNameRune(r rune) bool {
+	return r == '_' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// firstLineWidth returns the number of runes in the first line of lit, with a
+// minimum of 1.
+func firstLineWidth(lit []byte) int {
+	s := string(lit)
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		s = s[:i]
+	}
+	if n := utf8.RuneCountInString(s); n > 0 {
+		return n
+	}
+	return 1
+}
@@ -0,0 +1,125 @@
+package diagnostics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/arnodel/golua/lib/base"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func run(name, src string) error {
+	r := rt.New(nil)
+	base.Load(r)
+	clos, err := r.LoadFromSourceOrCode(name, []byte(src), "t", rt.TableValue(r.GlobalEnv()), true)
+	if err != nil {
+		return err
+	}
+	return rt.Call(r.MainThread(), rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false))
+}
+
+func TestFormat(t *testing.T) {
+	sources := map[string]string{
+		"index.lua":  "local a = {b = {}}\nlocal x = a.b.c.d\n",
+		"call.lua":   "local t = {}\n\tlocal y = 1 + t.f('arg')\n",
+		"arith.lua":  "local s = {}\nreturn s .. \"x\"\n",
+		"syntax.lua": "local x = 1\nlocal y = = 2\n",
+		"goto.lua":   "do\n  goto nowhere\nend\n",
+		"table.lua":  "error({code = 'E42', message = 'bad thing'})\n",
+	}
+	f := Formatter{
+		Source: func(name string) ([]byte, bool) {
+			src, ok := sources[name]
+			return []byte(src), ok
+		},
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{
+			name: "index.lua",
+			want: `index.lua:2:11: attempt to index a nil value
+  |
+2 | local x = a.b.c.d
+  |           ^^^^^^^
+`,
+		},
+		{
+			name: "call.lua",
+			want: `call.lua:2:16: attempt to call a nil value
+  |
+2 | 	local y = 1 + t.f('arg')
+  | 	              ^^^^^^^^^
+`,
+		},
+		{
+			name: "arith.lua",
+			want: `arith.lua:2:10: attempt to concatenate a table value with a string value
+  |
+2 | return s .. "x"
+  |          ^^
+`,
+		},
+		{
+			name: "syntax.lua",
+			want: `syntax.lua:2:11: unexpected symbol near '='
+  |
+2 | local y = = 2
+  |           ^
+`,
+		},
+		{
+			name: "goto.lua",
+			want: `goto.lua:2:3: no visible label 'nowhere'
+  |
+2 |   goto nowhere
+  |   ^^^^^^^^^^^^
+`,
+		},
+		{
+			name: "table.lua",
+			want: `table.lua:1:1: bad thing (E42)
+  |
+1 | error({code = 'E42', message = 'bad thing'})
+  | ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := run(test.name, sources[test.name])
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := f.Format(err); got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFormatWithoutSource(t *testing.T) {
+	var f Formatter
+	err := run("test", "local x\nx()")
+	if got, want := f.Format(err), "test:2:1: attempt to call a nil value\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got, want := f.Format(errors.New("hello")), "hello\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFormatTraceback(t *testing.T) {
+	f := Formatter{Traceback: true}
+	err := run("test", "local function f()\n  error('oops')\nend\nf()")
+	want := `test:2:3: oops
+stack traceback:
+	in function error (file [Go])
+	in function f (file test:2:3)
+	in function <main chunk> (file test:4:1)
+`
+	if got := f.Format(err); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
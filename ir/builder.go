@@ -26,6 +26,7 @@ type CodeBuilder struct {
 	upnames      []string
 	code         []Instruction
 	lines        []int
+	columns      []ColumnSpan
 	labels       []bool
 	constantPool *ConstantPool
 }
@@ -120,8 +121,8 @@ func (c *CodeBuilder) GetRegister(name Name) (Register, bool) {
 }
 
 func (c *CodeBuilder) getRegister(name Name, tags uint) (reg Register, ok bool) {
-	reg, ok = c.context.getRegister(name, tags)
-	if ok || c.parent == nil {
+	reg, ok, isGlobal := c.context.getRegister(name, tags)
+	if ok || isGlobal || c.parent == nil {
 		return
 	}
 	reg, ok = c.parent.getRegister(name, regHasUpvalue)
@@ -229,6 +230,50 @@ func (c *CodeBuilder) DeclareLocal(name Name, reg Register) {
 	c.context.addToTop(name, reg)
 }
 
+// DeclareGlobal declares name as a global variable in the current lexical
+// scope, as with "global name" in Lua 5.5.  If name is empty, it declares all
+// names not bound to local variables as global ("global *").  If constant is
+// true, the global variables cannot be assigned to.
+//
+// A name declared global is not resolved to a local variable of an enclosing
+// scope by GetRegister.
+func (c *CodeBuilder) DeclareGlobal(name Name, constant bool) {
+	c.context.addGlobal(name, constant)
+}
+
+// GlobalDeclaration tells how a name not bound to a local variable resolves,
+// according to the global declarations in scope.  The name is declared if
+//   - it was declared global in an enclosing scope;
+//   - or "global *" is in scope and no other global declaration is nearer;
+//   - or no global declaration is in scope (this is the Lua 5.4 behaviour).
+//
+// If the name is declared, constant tells whether it can be assigned to.
+func (c *CodeBuilder) GlobalDeclaration(name Name) (declared, constant bool) {
+	const (
+		implicit = iota
+		collective
+		undeclared
+	)
+	state := implicit
+	for b := c; b != nil; b = b.parent {
+		for i := len(b.context) - 1; i >= 0; i-- {
+			globals := b.context[i].globals
+			if isConst, ok := globals[name]; ok {
+				return true, isConst
+			}
+			if len(globals) == 0 || state != implicit {
+				continue
+			}
+			if isConst, ok := globals[""]; ok {
+				state, constant = collective, isConst
+			} else {
+				state = undeclared
+			}
+		}
+	}
+	return state != undeclared, constant
+}
+
 func (c *CodeBuilder) MarkConstantReg(reg Register) {
 	c.registers[reg].IsConstant = true
 }
@@ -242,15 +287,25 @@ func (c *CodeBuilder) EmitNoLine(instr Instruction) {
 }
 
 func (c *CodeBuilder) Emit(instr Instruction, line int) {
+	c.EmitWithColumns(instr, line, ColumnSpan{})
+}
+
+// EmitWithColumns is like Emit but also records the columns of the source code
+// the instruction comes from.  This is useful for instructions which can fail
+// at runtime, so that errors can point at the faulty expression.
+func (c *CodeBuilder) EmitWithColumns(instr Instruction, line int, cols ColumnSpan) {
 	c.code = append(c.code, instr)
 	c.lines = append(c.lines, line)
+	c.columns = append(c.columns, cols)
 }
 
 func (c *CodeBuilder) Close() (uint, []Register) {
-	return c.getConstantIndex(c.getCode()), c.upvalues
+	return c.GetConstantIndex(c.getCode()), c.upvalues
 }
 
-func (c *CodeBuilder) getConstantIndex(k Constant) uint {
+// GetConstantIndex returns the index of the constant k in the constant pool,
+// adding it if needed.
+func (c *CodeBuilder) GetConstantIndex(k Constant) uint {
 	return c.constantPool.GetConstantIndex(k)
 }
 
@@ -258,6 +313,7 @@ func (c *CodeBuilder) getCode() *Code {
 	return &Code{
 		Instructions: c.code,
 		Lines:        c.lines,
+		Columns:      c.columns,
 		Constants:    c.constantPool.Constants(),
 		Registers:    c.registers,
 		UpvalueDests: c.upvalueDests,
@@ -267,7 +323,7 @@ func (c *CodeBuilder) getCode() *Code {
 }
 
 func EmitConstant(c *CodeBuilder, k Constant, reg Register, line int) {
-	c.Emit(LoadConst{Dst: reg, Kidx: c.getConstantIndex(k)}, line)
+	c.Emit(LoadConst{Dst: reg, Kidx: c.GetConstantIndex(k)}, line)
 }
 
 func EmitMoveNoLine(c *CodeBuilder, dst Register, src Register) {
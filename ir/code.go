@@ -57,10 +57,17 @@ func (n NilType) ProcessConstant(p ConstantProcessor) {
 	p.ProcessNil(n)
 }
 
+// A ColumnSpan gives the columns of the source code an instruction was
+// compiled from (see code.ColumnSpan).
+type ColumnSpan struct {
+	Start, End int
+}
+
 // Code is the type of code literals (i.e. function definitions).
 type Code struct {
 	Instructions []Instruction
 	Lines        []int
+	Columns      []ColumnSpan
 	Constants    []Constant
 	UpvalueDests []Register
 	Registers    []RegData
@@ -6,6 +6,10 @@ type lexicalScope struct {
 	reg    map[Name]taggedReg     // maps variable names to registers
 	label  map[Name]labelWithLine // maps label names to labels
 	height int                    // This is the height of the close stack in this scope
+
+	// Global declarations (Lua 5.5) in this scope, mapping names to whether
+	// they are constant.  The empty name stands for "global *".
+	globals map[Name]bool
 }
 
 func (s lexicalScope) getLabel(name Name) (label Label, line int, ok bool) {
@@ -34,8 +38,9 @@ type lexicalContext []lexicalScope
 
 // getRegister returns the register associated with the given name if it exists
 // in one of the accessible lexical scopes.  Otherwise it sets ok to false.
+// If a global declaration for the name is found first, isGlobal is true.
 // TODO: explain tags.
-func (c lexicalContext) getRegister(name Name, tags uint) (reg Register, ok bool) {
+func (c lexicalContext) getRegister(name Name, tags uint) (reg Register, ok bool, isGlobal bool) {
 	for i := len(c) - 1; i >= 0; i-- {
 		var tr taggedReg
 		tr, ok = c[i].reg[name]
@@ -47,6 +52,9 @@ func (c lexicalContext) getRegister(name Name, tags uint) (reg Register, ok bool
 			}
 			break
 		}
+		if _, isGlobal = c[i].globals[name]; isGlobal {
+			break
+		}
 	}
 	return
 }
@@ -83,6 +91,20 @@ func (c lexicalContext) addToTop(name Name, reg Register) (ok bool) {
 	return
 }
 
+// addGlobal adds a global declaration to the topmost lexical scope in this
+// context.
+func (c lexicalContext) addGlobal(name Name, constant bool) (ok bool) {
+	ok = len(c) > 0
+	if ok {
+		top := &c[len(c)-1]
+		if top.globals == nil {
+			top.globals = make(map[Name]bool)
+		}
+		top.globals[name] = constant
+	}
+	return
+}
+
 // addLabel adds a name => label mapping to the topmost lexical scope in this
 // context.
 func (c lexicalContext) addLabel(name Name, label Label, line int) (ok bool) {
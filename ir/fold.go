@@ -27,37 +27,41 @@ func FoldCode(c Code, f FoldFunc) Code {
 	}
 	var s foldStack
 	var i1 Instruction
-	var l1 int
+	var p1 srcPos
 	for i, i2 := range c.Instructions {
-		l2 := c.Lines[i]
+		p2 := srcPos{line: c.Lines[i]}
+		if c.Columns != nil {
+			p2.cols = c.Columns[i]
+		}
 		if i1 != nil {
 			i1, i2 = f(i1, i2, c.Registers)
 			switch {
 			case i1 == nil && i2 == nil:
 				// Folded to nothing, pop from the stack to be able to fold the
 				// next instruction.
-				l2, i2 = s.pop()
+				p2, i2 = s.pop()
 			case i1 == nil:
 				// Folded to i2
-				l2 = mergeLines(l1, l2)
+				p2 = mergePos(p1, p2)
 			case i2 == nil:
 				// Folded to i1
 				i1, i2 = nil, i1
-				l2 = mergeLines(l1, l2)
+				p2 = mergePos(p1, p2)
 			default:
 				// Not folded
 			}
 		}
 		if i1 != nil {
-			s.push(l1, i1)
+			s.push(p1, i1)
 		}
 		i1 = i2
-		l1 = l2
+		p1 = p2
 	}
 	if i1 != nil {
-		s.push(l1, i1)
+		s.push(p1, i1)
 	}
 	c.Lines = s.lines
+	c.Columns = s.columns
 	c.Instructions = s.instructions
 	return c
 }
@@ -125,11 +129,19 @@ func ComposeFolds(fs ...FoldFunc) FoldFunc {
 
 type foldStack struct {
 	lines        []int
+	columns      []ColumnSpan
 	instructions []Instruction
 }
 
-func (s *foldStack) push(l int, i Instruction) {
-	s.lines = append(s.lines, l)
+// srcPos is the position in the source code of an instruction.
+type srcPos struct {
+	line int
+	cols ColumnSpan
+}
+
+func (s *foldStack) push(p srcPos, i Instruction) {
+	s.lines = append(s.lines, p.line)
+	s.columns = append(s.columns, p.cols)
 	s.instructions = append(s.instructions, i)
 }
 
@@ -137,21 +149,22 @@ func (s *foldStack) empty() bool {
 	return len(s.instructions) == 0
 }
 
-func (s *foldStack) pop() (l int, i Instruction) {
+func (s *foldStack) pop() (p srcPos, i Instruction) {
 	last := len(s.instructions) - 1
 	if last < 0 {
 		return
 	}
-	l = s.lines[last]
+	p = srcPos{line: s.lines[last], cols: s.columns[last]}
 	i = s.instructions[last]
 	s.lines = s.lines[:last]
+	s.columns = s.columns[:last]
 	s.instructions = s.instructions[:last]
 	return
 }
 
-func mergeLines(l1, l2 int) int {
-	if l1 != 0 {
-		return l1
+func mergePos(p1, p2 srcPos) srcPos {
+	if p1.line != 0 {
+		return p1
 	}
-	return l2
+	return p2
 }
@@ -25,6 +25,7 @@ type InstrProcessor interface {
 
 	// Real instructions
 	ProcessCombineInstr(Combine)
+	ProcessCombineKInstr(CombineK)
 	ProcessTransformInstr(Transform)
 	ProcessLoadConstInstr(LoadConst)
 	ProcessPushInstr(Push)
@@ -98,6 +99,41 @@ func (c Combine) String() string {
 	return fmt.Sprintf("%s := %s(%s, %s)", c.Dst, c.Op, c.Lsrc, c.Rsrc)
 }
 
+// CombineK applies the binary operator Op to Src and a numeric constant and
+// stores the result in Dst.  It is equivalent to loading the constant into a
+// register and emitting a Combine instruction, but allows the compiler to emit
+// specialised code.
+type CombineK struct {
+	Op      ops.Op   // Operator to apply to Src and the constant
+	Dst     Register // Destination register
+	Src     Register // Operand register
+	Kidx    uint     // Index of the constant operand
+	Reverse bool     // If true, the constant is the left operand
+}
+
+// DestReg returns the destination register of this instruction.
+func (c CombineK) DestReg() Register {
+	return c.Dst
+}
+
+// WithDestReg returns the same isntruction with a new destination register.
+func (c CombineK) WithDestReg(r Register) Instruction {
+	c.Dst = r
+	return c
+}
+
+// ProcessInstr makes the InstrProcessor process this instruction.
+func (c CombineK) ProcessInstr(p InstrProcessor) {
+	p.ProcessCombineKInstr(c)
+}
+
+func (c CombineK) String() string {
+	if c.Reverse {
+		return fmt.Sprintf("%s := %s(k%d, %s)", c.Dst, c.Op, c.Kidx, c.Src)
+	}
+	return fmt.Sprintf("%s := %s(%s, k%d)", c.Dst, c.Op, c.Src, c.Kidx)
+}
+
 // Transform applies a unary operator Op to Src and stores the result in Dst.
 type Transform struct {
 	Op  ops.Op   // Operator to apply to Src
@@ -519,9 +555,13 @@ func (i PrepForLoop) ProcessInstr(p InstrProcessor) {
 
 type AdvForLoop struct {
 	Start, Stop, Step Register
+	Int               bool // True if Start and Step are known to be integers
 }
 
 func (i AdvForLoop) String() string {
+	if i.Int {
+		return fmt.Sprintf("advforint %s, %s, %s", i.Start, i.Stop, i.Step)
+	}
 	return fmt.Sprintf("advfor %s, %s, %s", i.Start, i.Stop, i.Step)
 }
 
@@ -12,17 +12,18 @@ import (
 type instrCompiler struct {
 	*ConstantCompiler
 	*regAllocator
-	line int
+	line    int
+	columns code.ColumnSpan
 }
 
 var _ ir.InstrProcessor = instrCompiler{}
 
 func (ic instrCompiler) Emit(opcode code.Opcode) {
-	ic.builder.Emit(opcode, ic.line)
+	ic.builder.EmitWithColumns(opcode, ic.line, ic.columns)
 }
 
 func (ic instrCompiler) EmitJump(opcode code.Opcode, lbl code.Label) {
-	ic.builder.EmitJump(opcode, lbl, ic.line)
+	ic.builder.EmitJumpWithColumns(opcode, lbl, ic.line, ic.columns)
 }
 
 // ProcessCombineInstr compiles a Combine instruction.
@@ -54,6 +55,93 @@ var codeBinOp = map[ops.Op]code.BinOp{
 	ops.OpPow:      code.OpPow,
 }
 
+// ProcessCombineKInstr compiles a CombineK instruction.  If possible it is
+// compiled to a single specialised numeric opcode.  Otherwise the constant is
+// loaded into a scratch register and combined with a generic opcode.
+func (ic instrCompiler) ProcessCombineKInstr(c ir.CombineK) {
+	codeOp, ok := codeBinOp[c.Op]
+	if !ok {
+		panic(fmt.Sprintf("Cannot compile %v: invalid op", c))
+	}
+	dst, src := ic.codeReg(c.Dst), ic.codeReg(c.Src)
+	if !dst.IsCell() && !src.IsCell() {
+		if opcode, ok := ic.numOpcode(c, dst, src); ok {
+			ic.Emit(opcode)
+			return
+		}
+	}
+	// The scratch register must not be the same as src, but it can be the
+	// same as dst as the constant is only needed for the last opcode.
+	ic.takeRegister(c.Src)
+	var i uint8
+	ic.regs, i = allocReg(ic.regs)
+	ic.releaseRegister(c.Src)
+	k := code.ValueReg(i)
+	ic.Emit(ic.loadConst(k, c.Kidx))
+	if c.Reverse {
+		ic.Emit(code.Combine(codeOp, dst, k, src))
+	} else {
+		ic.Emit(code.Combine(codeOp, dst, src, k))
+	}
+}
+
+// numOpcode returns a Type8 opcode for c if there is one.
+func (ic instrCompiler) numOpcode(c ir.CombineK, dst, src code.Reg) (code.Opcode, bool) {
+	switch k := ic.GetConstant(c.Kidx).(type) {
+	case ir.Int:
+		if n, ok := code.Int8FromInt(int64(k)); ok {
+			numOps := codeNumOpI
+			if c.Reverse {
+				numOps = codeNumOpIRev
+			}
+			if op, ok := numOps[c.Op]; ok {
+				return code.CombineI(op, dst, src, n), true
+			}
+			return 0, false
+		}
+	case ir.Float:
+	default:
+		return 0, false
+	}
+	op, ok := codeNumOpK[c.Op]
+	if !ok || c.Reverse {
+		return 0, false
+	}
+	ckidx := ic.QueueConstant(c.Kidx)
+	if ckidx > math.MaxUint8 {
+		return 0, false
+	}
+	return code.CombineK(op, dst, src, code.KIndex(ckidx)), true
+}
+
+// Numeric operators with an integer literal right operand.
+var codeNumOpI = map[ops.Op]code.NumOp{
+	ops.OpAdd:      code.OpAddI,
+	ops.OpSub:      code.OpSubI,
+	ops.OpMul:      code.OpMulI,
+	ops.OpDiv:      code.OpDivI,
+	ops.OpFloorDiv: code.OpFloorDivI,
+	ops.OpMod:      code.OpModI,
+	ops.OpEq:       code.OpEqI,
+	ops.OpLt:       code.OpLtI,
+	ops.OpLeq:      code.OpLeqI,
+}
+
+// Numeric operators with an integer literal left operand.
+var codeNumOpIRev = map[ops.Op]code.NumOp{
+	ops.OpEq:  code.OpEqI,
+	ops.OpLt:  code.OpGtI,
+	ops.OpLeq: code.OpGeqI,
+}
+
+// Numeric operators with a constant right operand.
+var codeNumOpK = map[ops.Op]code.NumOp{
+	ops.OpAdd: code.OpAddK,
+	ops.OpSub: code.OpSubK,
+	ops.OpMul: code.OpMulK,
+	ops.OpDiv: code.OpDivK,
+}
+
 // ProcessTransformInstr compiles a Transform instruction.
 func (ic instrCompiler) ProcessTransformInstr(t ir.Transform) {
 	codeOp, ok := codeUnOp[t.Op]
@@ -75,8 +163,11 @@ var codeUnOp = map[ops.Op]code.UnOp{
 
 // ProcessLoadConstInstr compiles a LoadConst instruction.
 func (ic instrCompiler) ProcessLoadConstInstr(l ir.LoadConst) {
-	k := ic.GetConstant(l.Kidx)
-	dst := ic.codeReg(l.Dst)
+	ic.Emit(ic.loadConst(ic.codeReg(l.Dst), l.Kidx))
+}
+
+func (ic instrCompiler) loadConst(dst code.Reg, kidx uint) code.Opcode {
+	k := ic.GetConstant(kidx)
 	var opcode code.Opcode
 	var inlined bool
 	// Short strings and small integers are inlined.
@@ -91,10 +182,10 @@ func (ic instrCompiler) ProcessLoadConstInstr(l ir.LoadConst) {
 		opcode, inlined = code.LoadNil(dst), true
 	}
 	if !inlined {
-		ckidx := ic.QueueConstant(l.Kidx)
+		ckidx := ic.QueueConstant(kidx)
 		opcode = code.LoadConst(dst, code.KIndexFromInt(ckidx))
 	}
-	ic.Emit(opcode)
+	return opcode
 }
 
 // ProcessPushInstr compiles a Push instruction.
@@ -233,7 +324,12 @@ func (ic instrCompiler) ProcessPrepForLoopInstr(i ir.PrepForLoop) {
 
 // ProcessAdvForLoopInstr compiles an AdvForLoop instruction.
 func (ic instrCompiler) ProcessAdvForLoopInstr(i ir.AdvForLoop) {
-	ic.Emit(code.AdvForLoop(ic.codeReg(i.Start), ic.codeReg(i.Stop), ic.codeReg(i.Step)))
+	start, stop, step := ic.codeReg(i.Start), ic.codeReg(i.Stop), ic.codeReg(i.Step)
+	if i.Int && !start.IsCell() && !stop.IsCell() && !step.IsCell() {
+		ic.Emit(code.AdvForIntLoop(start, stop, step))
+		return
+	}
+	ic.Emit(code.AdvForLoop(start, stop, step))
 }
 
 func (ic instrCompiler) ProcessTakeRegisterInstr(t ir.TakeRegister) {
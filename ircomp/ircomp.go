@@ -67,6 +67,10 @@ func (kc *ConstantCompiler) ProcessCode(c ir.Code) {
 	}
 	for i, instr := range c.Instructions {
 		ic.line = c.Lines[i]
+		if c.Columns != nil {
+			cols := c.Columns[i]
+			ic.columns = code.ColumnSpan{Start: int32(cols.Start), End: int32(cols.End)}
+		}
 		instr.ProcessInstr(ic)
 	}
 	end := kc.builder.Offset()
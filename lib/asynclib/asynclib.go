@@ -0,0 +1,305 @@
+// Package asynclib implements the "async" library, an event loop which allows
+// Lua code to wait for Go work (e.g. RPCs or database queries) without blocking
+// the whole runtime.
+//
+// Go functions start work with Go (or create a Future and complete it
+// themselves) and either return the future to Lua with NewFutureValue or wait
+// for it with Await.  When a task of the event loop waits for a future, its
+// coroutine yields to the loop, which resumes it when the future is done.
+// Other tasks can run in the meantime.  Outside of the event loop, waiting for
+// a future simply blocks.
+//
+// Waiting never goes past the time limit of the current runtime context, and
+// when the event loop stops (including when its context is terminated), all
+// the Go work started with Go and After is cancelled.
+package asynclib
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/arnodel/golua/lib/packagelib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// LibLoader can load the async lib.
+var LibLoader = packagelib.Loader{
+	Load: load,
+	Name: "async",
+}
+
+type futureKeyType struct{}
+
+var futureKey = rt.AsValue(futureKeyType{})
+
+func load(r *rt.Runtime) (rt.Value, func()) {
+	meta := rt.NewTable()
+	r.SetEnv(meta, "__name", rt.StringValue("future"))
+
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(meta, "__index", future__index, 2, false),
+		r.SetEnvGoFunc(meta, "__tostring", future__tostring, 1, false),
+	)
+	r.SetRegistry(futureKey, rt.TableValue(meta))
+
+	pkg := rt.NewTable()
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(pkg, "run", run, 1, true),
+		r.SetEnvGoFunc(pkg, "spawn", spawn, 1, true),
+		r.SetEnvGoFunc(pkg, "await", awaitf, 1, false),
+		r.SetEnvGoFunc(pkg, "await_all", awaitAll, 0, true),
+		r.SetEnvGoFunc(pkg, "await_any", awaitAny, 1, true),
+		r.SetEnvGoFunc(pkg, "sleep", sleep, 1, false),
+		r.SetEnvGoFunc(pkg, "after", after, 2, true),
+	)
+	return rt.TableValue(pkg), nil
+}
+
+// NewFutureValue returns a Lua value for f, which Lua code can wait for with
+// async.await or its await method.
+func NewFutureValue(r *rt.Runtime, f *Future) rt.Value {
+	return r.NewUserDataValue(f, r.Registry(futureKey).AsTable())
+}
+
+// ValueToFuture turns a Lua value to a future if possible.
+func ValueToFuture(v rt.Value) (*Future, bool) {
+	u, ok := v.TryUserData()
+	if !ok {
+		return nil, false
+	}
+	f, ok := u.Value().(*Future)
+	return f, ok
+}
+
+// Await waits for f to be done and pushes its values to the next continuation
+// of c.  It is meant to be called by Go functions in tail position, e.g.
+//
+//	return asynclib.Await(t, c, asynclib.Go(t.Runtime, work))
+//
+// If f is rejected, the error is returned.
+func Await(t *rt.Thread, c *rt.GoCont, f *Future) (rt.Cont, error) {
+	values, err := await(t, f)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext(t.Runtime, values...), nil
+}
+
+func futureArg(c *rt.GoCont, n int) (*Future, error) {
+	f, ok := ValueToFuture(c.Arg(n))
+	if ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("#%d must be a future", n+1)
+}
+
+func durationArg(c *rt.GoCont, n int) (time.Duration, error) {
+	secs, err := c.FloatArg(n)
+	if err != nil {
+		return 0, err
+	}
+	if secs < 0 {
+		return 0, nil
+	}
+	return time.Duration(float64(secs) * float64(time.Second)), nil
+}
+
+func runningLoop(r *rt.Runtime) (*loop, error) {
+	l := getLoop(r)
+	if l == nil {
+		return nil, errors.New("no running event loop")
+	}
+	return l, nil
+}
+
+func run(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	f, err := c.CallableArg(0)
+	if err != nil {
+		return nil, err
+	}
+	if getLoop(t.Runtime) != nil {
+		return nil, errors.New("event loop already running")
+	}
+	l := newLoop()
+	setLoop(t.Runtime, l)
+	values, err := l.run(t, l.spawn(t.Runtime, f, c.Etc(), nil))
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext(t.Runtime, values...), nil
+}
+
+func spawn(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	f, err := c.CallableArg(0)
+	if err != nil {
+		return nil, err
+	}
+	l, err := runningLoop(t.Runtime)
+	if err != nil {
+		return nil, err
+	}
+	tk := l.spawn(t.Runtime, f, c.Etc(), nil)
+	return c.PushingNext1(t.Runtime, NewFutureValue(t.Runtime, tk.future)), nil
+}
+
+func after(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	var (
+		d time.Duration
+		f rt.Callable
+	)
+	err := c.CheckNArgs(2)
+	if err == nil {
+		d, err = durationArg(c, 0)
+	}
+	if err == nil {
+		f, err = c.CallableArg(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l, err := runningLoop(t.Runtime)
+	if err != nil {
+		return nil, err
+	}
+	tk := l.spawn(t.Runtime, f, c.Etc(), After(t.Runtime, d))
+	return c.PushingNext1(t.Runtime, NewFutureValue(t.Runtime, tk.future)), nil
+}
+
+func sleep(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	d, err := durationArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := await(t, After(t.Runtime, d)); err != nil {
+		return nil, err
+	}
+	return c.Next(), nil
+}
+
+func awaitf(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	f, err := futureArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	return Await(t, c, f)
+}
+
+func futureArgs(c *rt.GoCont) ([]*Future, error) {
+	args := append(append([]rt.Value(nil), c.Args()...), c.Etc()...)
+	futures := make([]*Future, len(args))
+	for i, v := range args {
+		f, ok := ValueToFuture(v)
+		if !ok {
+			return nil, fmt.Errorf("#%d must be a future", i+1)
+		}
+		futures[i] = f
+	}
+	return futures, nil
+}
+
+func awaitAll(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	futures, err := futureArgs(c)
+	if err != nil {
+		return nil, err
+	}
+	return Await(t, c, All(futures...))
+}
+
+func awaitAny(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	futures, err := futureArgs(c)
+	if err != nil {
+		return nil, err
+	}
+	return Await(t, c, Any(futures...))
+}
+
+func future__index(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.CheckNArgs(2); err != nil {
+		return nil, err
+	}
+	key, err := c.StringArg(1)
+	if err != nil {
+		return nil, err
+	}
+	var val rt.Value
+	switch key {
+	case "await":
+		val = rt.FunctionValue(awaitGoF)
+	case "done":
+		val = rt.FunctionValue(doneGoF)
+	case "cancel":
+		val = rt.FunctionValue(cancelGoF)
+	}
+	return c.PushingNext1(t.Runtime, val), nil
+}
+
+func future__tostring(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	f, err := futureArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	status := "pending"
+	if f.IsDone() {
+		status = "done"
+	}
+	return c.PushingNext1(t.Runtime, rt.StringValue(fmt.Sprintf("future (%s)", status))), nil
+}
+
+func done(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	f, err := futureArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, rt.BoolValue(f.IsDone())), nil
+}
+
+func cancel(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	f, err := futureArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	f.Cancel()
+	return c.Next(), nil
+}
+
+var (
+	awaitGoF  = rt.NewGoFunction(awaitf, "await", 1, false)
+	doneGoF   = rt.NewGoFunction(done, "done", 1, false)
+	cancelGoF = rt.NewGoFunction(cancel, "cancel", 1, false)
+)
+
+func init() {
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+		awaitGoF, doneGoF, cancelGoF,
+	)
+}
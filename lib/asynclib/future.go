@@ -0,0 +1,199 @@
+package asynclib
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// ErrCancelled is the error a future is rejected with when it is cancelled.
+var ErrCancelled = errors.New("cancelled")
+
+// A Future represents the result of some work which may not have completed
+// yet.  It is either pending or done, in which case it was resolved with some
+// values or rejected with an error.  A Future can be completed from any
+// goroutine, and only the first completion counts.
+type Future struct {
+	mux       sync.Mutex
+	done      bool
+	values    []rt.Value
+	err       error
+	doneCh    chan struct{}
+	callbacks []func()
+	cancel    func()
+	task      *task // Set if the future is the result of a task
+}
+
+// NewFuture returns a new pending future.
+func NewFuture() *Future {
+	return &Future{doneCh: make(chan struct{})}
+}
+
+// Resolve completes f with the given values, unless it is already done.
+func (f *Future) Resolve(values ...rt.Value) {
+	f.complete(values, nil)
+}
+
+// Reject completes f with the given error, unless it is already done.
+func (f *Future) Reject(err error) {
+	f.complete(nil, err)
+}
+
+// Cancel rejects f with ErrCancelled and stops the work it represents, unless
+// it is already done.
+func (f *Future) Cancel() {
+	if f.complete(nil, ErrCancelled) && f.cancel != nil {
+		f.cancel()
+	}
+}
+
+// Done returns a channel which is closed when f is done.
+func (f *Future) Done() <-chan struct{} {
+	return f.doneCh
+}
+
+// IsDone returns true if f is done.
+func (f *Future) IsDone() bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.done
+}
+
+// Result returns the values or error f was completed with.  It should only be
+// called when f is done.
+func (f *Future) Result() ([]rt.Value, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return f.values, f.err
+}
+
+// OnDone arranges for fn to be called when f is done.  If f is already done,
+// fn is called immediately.  Otherwise it is called by the goroutine that
+// completes f.
+func (f *Future) OnDone(fn func()) {
+	f.mux.Lock()
+	if !f.done {
+		f.callbacks = append(f.callbacks, fn)
+		f.mux.Unlock()
+		return
+	}
+	f.mux.Unlock()
+	fn()
+}
+
+func (f *Future) complete(values []rt.Value, err error) bool {
+	f.mux.Lock()
+	if f.done {
+		f.mux.Unlock()
+		return false
+	}
+	f.done = true
+	f.values = values
+	f.err = err
+	callbacks := f.callbacks
+	f.callbacks = nil
+	close(f.doneCh)
+	f.mux.Unlock()
+	for _, fn := range callbacks {
+		fn()
+	}
+	return true
+}
+
+// Go runs work in a new goroutine and returns a future which is completed with
+// its result.  The context passed to work is cancelled when the future is
+// cancelled, or when the event loop running in r (if any) stops, so that
+// pending work does not outlive the Lua code waiting for it.
+func Go(r *rt.Runtime, work func(ctx context.Context) ([]rt.Value, error)) *Future {
+	ctx, cancel := context.WithCancel(loopContext(r))
+	f := NewFuture()
+	f.cancel = cancel
+	go func() {
+		defer cancel()
+		values, err := work(ctx)
+		if err == nil {
+			f.Resolve(values...)
+		} else {
+			f.Reject(err)
+		}
+	}()
+	return f
+}
+
+// After returns a future which is resolved with no values after duration d.
+// Like the futures returned by Go, it is cancelled when the event loop running
+// in r stops.
+func After(r *rt.Runtime, d time.Duration) *Future {
+	return Go(r, func(ctx context.Context) ([]rt.Value, error) {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return nil, nil
+		case <-ctx.Done():
+			return nil, ErrCancelled
+		}
+	})
+}
+
+// All returns a future which is resolved when all the given futures are
+// resolved, with the first value of each of them.  It is rejected as soon as
+// one of them is rejected, with the same error.
+func All(futures ...*Future) *Future {
+	all := NewFuture()
+	n := len(futures)
+	if n == 0 {
+		all.Resolve()
+		return all
+	}
+	var (
+		mux     sync.Mutex
+		pending = n
+	)
+	for _, f := range futures {
+		f := f
+		f.OnDone(func() {
+			values, err := f.Result()
+			if err != nil {
+				all.Reject(err)
+				return
+			}
+			mux.Lock()
+			pending--
+			last := pending == 0
+			mux.Unlock()
+			if last {
+				firstValues := make([]rt.Value, n)
+				for i, f := range futures {
+					if values, _ = f.Result(); len(values) > 0 {
+						firstValues[i] = values[0]
+					}
+				}
+				all.Resolve(firstValues...)
+			}
+		})
+	}
+	return all
+}
+
+// Any returns a future which is completed as soon as one of the given futures
+// is.  If it is resolved, its values are the (1-based) index of that future
+// followed by its values.  If it is rejected, it is with the same error.
+func Any(futures ...*Future) *Future {
+	any := NewFuture()
+	for i, f := range futures {
+		i, f := i, f
+		f.OnDone(func() {
+			values, err := f.Result()
+			if err != nil {
+				any.Reject(err)
+				return
+			}
+			any.Resolve(append([]rt.Value{rt.IntValue(int64(i + 1))}, values...)...)
+		})
+	}
+	return any
+}
@@ -0,0 +1,131 @@
+package asynclib_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/arnodel/golua/lib"
+	"github.com/arnodel/golua/lib/asynclib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// A Go function which takes some time to return its argument.
+func slowEcho(started chan<- struct{}, cancelled chan<- struct{}) rt.GoFunctionFunc {
+	return func(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+		if err := c.Check1Arg(); err != nil {
+			return nil, err
+		}
+		arg := c.Arg(0)
+		f := asynclib.Go(t.Runtime, func(ctx context.Context) ([]rt.Value, error) {
+			if started != nil {
+				started <- struct{}{}
+			}
+			select {
+			case <-time.After(50 * time.Millisecond):
+				return []rt.Value{arg}, nil
+			case <-ctx.Done():
+				if cancelled != nil {
+					close(cancelled)
+				}
+				return nil, ctx.Err()
+			}
+		})
+		return asynclib.Await(t, c, f)
+	}
+}
+
+func runLua(t *testing.T, r *rt.Runtime, source string) error {
+	clos, err := r.CompileAndLoadLuaChunk("test", []byte(source), rt.TableValue(r.GlobalEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt.Call(r.MainThread(), rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false))
+}
+
+func TestGoWorkRunsConcurrently(t *testing.T) {
+	out := new(bytes.Buffer)
+	r := rt.New(out)
+	defer lib.LoadAll(r)()
+	r.SetEnvGoFunc(r.GlobalEnv(), "echo", slowEcho(nil, nil), 1, false)
+
+	start := time.Now()
+	err := runLua(t, r, `
+async.run(function()
+	local tasks = {}
+	for i = 1, 10 do
+		tasks[i] = async.spawn(echo, i)
+	end
+	print(async.await_all(table.unpack(tasks)))
+end)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "1\t2\t3\t4\t5\t6\t7\t8\t9\t10\n"; got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("tasks did not run concurrently: took %s", d)
+	}
+}
+
+func TestGoWorkCancelledWhenContextKilled(t *testing.T) {
+	if !rt.QuotasAvailable {
+		t.Skip("quotas not available")
+	}
+	out := new(bytes.Buffer)
+	r := rt.New(out)
+	defer lib.LoadAll(r)()
+	started := make(chan struct{}, 1)
+	cancelled := make(chan struct{})
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+		r.SetEnvGoFunc(r.GlobalEnv(), "echo", slowEcho(started, cancelled), 1, false),
+	)
+
+	err := runLua(t, r, `
+print(runtime.callcontext({kill={cpu=100000}}, async.run, function()
+	async.spawn(echo, 1)
+	async.sleep(0)
+	while true do end
+end))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "killed\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("work not started")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("work not cancelled")
+	}
+}
+
+func TestFutureReturnedToLua(t *testing.T) {
+	out := new(bytes.Buffer)
+	r := rt.New(out)
+	defer lib.LoadAll(r)()
+	f := asynclib.NewFuture()
+	r.SetEnv(r.GlobalEnv(), "f", asynclib.NewFutureValue(r, f))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Resolve(rt.StringValue("hello"), rt.IntValue(42))
+	}()
+	err := runLua(t, r, `
+print(f, f:done())
+print(async.run(function() return f:await() end))
+print(f, f:done())`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "future (pending)\tfalse\nhello\t42\nfuture (done)\ttrue\n"; got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+}
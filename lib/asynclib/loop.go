@@ -0,0 +1,265 @@
+package asynclib
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// A task is a Lua function running in its own coroutine, scheduled by the
+// event loop.
+type task struct {
+	id      int
+	thread  *rt.Thread
+	args    []rt.Value // Arguments to resume the coroutine with the first time
+	future  *Future    // Completed with the return values of the function
+	waiting *Future    // The future the task is waiting for, if any
+}
+
+// A loop is the event loop of a runtime.  There can be only one loop running
+// in a runtime at any time, and it is stored in the registry.
+//
+// All fields apart from mux, woken and wakeCh are only accessed from the
+// thread running the loop.
+type loop struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	ready  []*task
+	tasks  map[*rt.Thread]*task
+	nextID int
+
+	mux    sync.Mutex
+	woken  []*task       // Tasks woken by futures completed in other goroutines
+	wakeCh chan struct{} // Signals that woken is not empty
+}
+
+type loopKeyType struct{}
+
+var loopKey = rt.AsValue(loopKeyType{})
+
+func newLoop() *loop {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &loop{
+		ctx:    ctx,
+		cancel: cancel,
+		tasks:  map[*rt.Thread]*task{},
+		wakeCh: make(chan struct{}, 1),
+	}
+}
+
+func getLoop(r *rt.Runtime) *loop {
+	l, _ := r.Registry(loopKey).Interface().(*loop)
+	return l
+}
+
+func setLoop(r *rt.Runtime, l *loop) {
+	if l == nil {
+		r.SetRegistry(loopKey, rt.NilValue)
+		return
+	}
+	r.SetRegistry(loopKey, rt.AsValue(l))
+}
+
+// loopContext returns the context of the loop running in r, or the background
+// context if there is no such loop.
+func loopContext(r *rt.Runtime) context.Context {
+	if l := getLoop(r); l != nil {
+		return l.ctx
+	}
+	return context.Background()
+}
+
+// spawn creates a new task running f with the given arguments.  It will start
+// running when the loop gets to it, or when delay is done if it is not nil.
+func (l *loop) spawn(r *rt.Runtime, f rt.Callable, args []rt.Value, delay *Future) *task {
+	thread := rt.NewThread(r)
+	thread.Start(f)
+	tk := &task{
+		id:     l.nextID,
+		thread: thread,
+		args:   args,
+		future: NewFuture(),
+	}
+	l.nextID++
+	tk.future.task = tk
+	tk.future.cancel = func() { l.wake(tk) }
+	l.tasks[thread] = tk
+	if delay == nil {
+		l.ready = append(l.ready, tk)
+	} else {
+		l.wait(tk, delay)
+	}
+	return tk
+}
+
+// wait arranges for tk to be woken when f is done.
+func (l *loop) wait(tk *task, f *Future) {
+	tk.waiting = f
+	f.OnDone(func() { l.wake(tk) })
+}
+
+// wake makes tk ready to run again.  It is safe to call from any goroutine.
+func (l *loop) wake(tk *task) {
+	l.mux.Lock()
+	l.woken = append(l.woken, tk)
+	l.mux.Unlock()
+	select {
+	case l.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// run runs the loop in thread t until the main task is done, and returns its
+// result.  If the main task completes, remaining tasks are cancelled and their
+// coroutines closed.  Whatever happens (including the runtime context being
+// terminated), pending Go work is cancelled.
+func (l *loop) run(t *rt.Thread, main *task) ([]rt.Value, error) {
+	completed := false
+	defer func() {
+		l.cancel()
+		setLoop(t.Runtime, nil)
+		if completed {
+			l.closeTasks(t)
+		}
+	}()
+	for !main.future.IsDone() {
+		l.step(t, l.next(t))
+	}
+	completed = true
+	return main.future.Result()
+}
+
+// next returns the next task ready to run, waiting for one if necessary.
+func (l *loop) next(t *rt.Thread) *task {
+	for {
+		l.mux.Lock()
+		l.ready = append(l.ready, l.woken...)
+		l.woken = nil
+		l.mux.Unlock()
+		if len(l.ready) > 0 {
+			tk := l.ready[0]
+			l.ready = l.ready[1:]
+			return tk
+		}
+		wait(t, l.wakeCh)
+	}
+}
+
+// step resumes tk until it yields or finishes.
+func (l *loop) step(t *rt.Thread, tk *task) {
+	if l.tasks[tk.thread] != tk {
+		// The task was already dropped
+		return
+	}
+	if tk.future.IsDone() {
+		// The task was cancelled
+		l.drop(t, tk)
+		return
+	}
+	if tk.waiting != nil && !tk.waiting.IsDone() {
+		return
+	}
+	args := tk.args
+	tk.args = nil
+	tk.waiting = nil
+	values, err := tk.thread.Resume(t, args)
+	switch {
+	case err != nil:
+		delete(l.tasks, tk.thread)
+		tk.future.Reject(err)
+	case tk.thread.Status() == rt.ThreadDead:
+		delete(l.tasks, tk.thread)
+		tk.future.Resolve(values...)
+	case tk.future.IsDone():
+		// The task cancelled itself
+		l.drop(t, tk)
+	case tk.waiting != nil:
+		l.wait(tk, tk.waiting)
+	default:
+		// The task yielded without waiting for anything
+		l.ready = append(l.ready, tk)
+	}
+}
+
+// drop removes tk from the loop and closes its coroutine.
+func (l *loop) drop(t *rt.Thread, tk *task) {
+	delete(l.tasks, tk.thread)
+	tk.future.Reject(ErrCancelled)
+	_, err := tk.thread.Close(t)
+	if err != nil {
+		t.Warn(err.Error())
+	}
+}
+
+// closeTasks drops all the remaining tasks, in the order they were created.
+func (l *loop) closeTasks(t *rt.Thread) {
+	tasks := make([]*task, 0, len(l.tasks))
+	for _, tk := range l.tasks {
+		tasks = append(tasks, tk)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].id < tasks[j].id
+	})
+	for _, tk := range tasks {
+		l.drop(t, tk)
+	}
+}
+
+// await waits until f is done and returns its result.  If t is running a task
+// of the event loop, the task yields to the loop until f is done.  Otherwise t
+// blocks until f is done.
+func await(t *rt.Thread, f *Future) ([]rt.Value, error) {
+	if !f.IsDone() {
+		var tk *task
+		if l := getLoop(t.Runtime); l != nil {
+			tk = l.tasks[t]
+		}
+		switch {
+		case tk != nil:
+			tk.waiting = f
+			if _, err := t.Yield(nil); err != nil {
+				return nil, err
+			}
+		case f.task != nil:
+			return nil, errors.New("cannot await a task outside of the event loop")
+		default:
+			waitFuture(t, f)
+		}
+	}
+	return f.Result()
+}
+
+// waitFuture blocks until f is done.  If the runtime context is terminated in
+// the meantime, f is cancelled.
+func waitFuture(t *rt.Thread, f *Future) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.Cancel()
+			panic(r)
+		}
+	}()
+	wait(t, f.Done())
+}
+
+// wait blocks until ch is ready, but not beyond the time limit of the current
+// runtime context (which is then terminated).
+func wait(t *rt.Thread, ch <-chan struct{}) {
+	for {
+		left, limited := t.TimeLeft()
+		if !limited {
+			<-ch
+			return
+		}
+		timer := time.NewTimer(left)
+		select {
+		case <-ch:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
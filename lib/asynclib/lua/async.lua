@@ -0,0 +1,108 @@
+-- Tasks run concurrently when they wait
+print(async.run(function(x)
+    local t1 = async.spawn(function()
+        async.sleep(0.02)
+        print("t1")
+        return 1
+    end)
+    local t2 = async.spawn(function()
+        async.sleep(0.01)
+        print("t2")
+        return 2
+    end)
+    print(t1:done(), t2:done())
+    print(async.await_all(t1, t2))
+    return x, "done"
+end, "arg"))
+--> =false	false
+--> =t2
+--> =t1
+--> =1	2
+--> =arg	done
+
+-- await_any returns the index of the first future and its values
+async.run(function()
+    local slow = async.after(0.05, function() return "slow" end)
+    local fast = async.after(0.01, function(a, b) return a + b end, 1, 2)
+    print(async.await_any(slow, fast))
+    print(slow:done(), fast:done())
+end)
+--> =2	3
+--> =false	true
+
+-- Errors propagate through await
+print(pcall(async.run, function()
+    local t = async.spawn(function() error("boom") end)
+    return async.await(t)
+end))
+--> ~false\t.*boom
+
+print(pcall(async.run, function()
+    local ok = async.spawn(function() async.sleep(0.01) return 1 end)
+    local bad = async.spawn(function() error("bad") end)
+    return async.await_all(ok, bad)
+end))
+--> ~false\t.*bad
+
+-- Cancelled tasks are closed
+async.run(function()
+    local t = async.spawn(function()
+        local x <close> = setmetatable({}, {__close=function() print("closed") end})
+        async.sleep(10)
+        print("not reached")
+    end)
+    async.sleep(0)
+    t:cancel()
+    print(t:done(), pcall(t.await, t))
+    async.sleep(0)
+end)
+--> ~true	false	.*cancelled
+--> =closed
+
+-- Tasks still running when the main task returns are cancelled
+async.run(function()
+    async.spawn(function()
+        local x <close> = setmetatable({}, {__close=function() print("closed at end") end})
+        async.sleep(10)
+    end)
+    async.sleep(0)
+end)
+--> =closed at end
+
+-- Tasks can yield to let other tasks run
+async.run(function()
+    local t = async.spawn(function()
+        for i = 1, 3 do
+            print("t", i)
+            coroutine.yield()
+        end
+    end)
+    for i = 1, 3 do
+        print("main", i)
+        coroutine.yield()
+    end
+    t:await()
+end)
+--> =main	1
+--> =t	1
+--> =main	2
+--> =t	2
+--> =main	3
+--> =t	3
+
+-- Outside of the event loop, waiting blocks
+async.sleep(0.01)
+print(tostring(async.after ~= nil))
+--> =true
+
+print(pcall(async.spawn, print))
+--> ~false\t.*no running event loop
+
+print(pcall(async.run, function() async.run(print) end))
+--> ~false\t.*event loop already running
+
+print(pcall(async.await, 1))
+--> ~false\t.*#1 must be a future
+
+print(pcall(async.await_any))
+--> ~false\t.*value needed
@@ -0,0 +1,15 @@
+-- Waiting does not go beyond the time limit of the context
+print(runtime.callcontext({kill={millis=50}}, async.run, function()
+    async.sleep(10)
+end))
+--> =killed
+
+print(runtime.callcontext({kill={millis=50}}, async.sleep, 10))
+--> =killed
+
+-- Waiting inside a time limited context is allowed
+print(runtime.callcontext({kill={millis=1000}}, async.run, function()
+    async.sleep(0.01)
+    return "ok"
+end))
+--> =done	ok
@@ -18,7 +18,7 @@ var LibLoader = packagelib.Loader{
 func Load(r *rt.Runtime) (rt.Value, func()) {
 	env := r.GlobalEnv()
 	r.SetEnv(env, "_G", rt.TableValue(env))
-	r.SetEnv(env, "_VERSION", rt.StringValue("Golua 5.4"))
+	r.SetEnv(env, "_VERSION", rt.StringValue("Golua "+r.LanguageVersion().String()))
 	r.SetEnv(env, "next", rt.FunctionValue(nextGoFunc))
 
 	rt.SolemnlyDeclareCompliance(
@@ -91,7 +91,7 @@ func loadChunk(t *rt.Thread, args []rt.Value) (chunk []byte, chunkName string, e
 	var reader io.Reader
 	if len(args) == 0 {
 		chunkName = "stdin"
-		reader = os.Stdin
+		reader = t.Stdin()
 	} else {
 		var ok bool
 		chunkName, ok = args[0].TryString()
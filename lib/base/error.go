@@ -10,9 +10,9 @@ func errorF(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 		level int64 = 1
 	)
 	if c.NArgs() == 0 {
-		err = rt.NewError(rt.NilValue)
+		err = t.RaiseError(rt.NilValue)
 	} else {
-		err = rt.NewError(c.Arg(0))
+		err = t.RaiseError(c.Arg(0))
 	}
 	if c.NArgs() >= 2 {
 		var argErr error
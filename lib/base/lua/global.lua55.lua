@@ -0,0 +1,103 @@
+-- Lua 5.5 global declarations.  Tests in a .lua55.lua file run with the 5.5
+-- version of the language.
+
+print(_VERSION)
+--> =Golua 5.5
+
+-- Without any global declaration, globals are used as in Lua 5.4.
+x = 1
+print(x)
+--> =1
+
+-- A named declaration makes it an error to use undeclared globals.
+print(load("global print; print(1); y = 2"))
+--> ~nil\t.*variable 'y' is not declared
+
+print(load("global print; print(z)"))
+--> ~nil\t.*variable 'z' is not declared
+
+-- Declared globals are still globals.
+do
+    global print
+    global a, b = 10, 20
+    print(a + b, _ENV.a)
+end
+--> =30	10
+
+-- The declaration is lexically scoped.
+do
+    global print
+end
+w = 3
+print(w)
+--> =3
+
+-- "global *" declares all globals again.
+print(load("global print; global *; y = 2; return y")())
+--> =2
+
+-- A global declaration shadows outer locals.
+local v = "local"
+do
+    global v
+    v = "global"
+end
+print(v, _ENV.v)
+--> =local	global
+
+-- Constant globals cannot be assigned to.
+print(load("global k <const> = 1; k = 2"))
+--> ~nil\t.*attempt to reassign constant variable 'k'
+
+print(load("global <const> *; print = nil"))
+--> ~nil\t.*attempt to reassign constant variable 'print'
+
+print(load("global <close> x"))
+--> ~nil\t.*
+
+print(load("global _ENV"))
+--> ~nil\t.*
+
+-- Global functions
+
+do
+    global print
+    global function double(n) return n * 2 end
+    print(double(21))
+end
+--> =42
+
+do
+    global print
+    global function fact(n)
+        if n == 0 then return 1 end
+        return n * fact(n - 1)
+    end
+    print(fact(5))
+end
+--> =120
+
+-- "global" is still a name when it is not followed by a declaration.
+global = 5
+print(global)
+--> =5
+
+-- Attributes can prefix a list of local variables.
+do
+    local <const> c1, c2 = 1, 2
+    print(c1 + c2)
+end
+--> =3
+
+print(load("local <const> c1, c2 = 1, 2; c2 = 3"))
+--> ~nil\t.*attempt to reassign constant variable 'c2'
+
+-- Control variables of for loops are read-only.
+print(load("for i = 1, 2 do i = 3 end"))
+--> ~nil\t.*attempt to reassign constant variable 'i'
+
+print(load("for k, v in pairs({}) do k = 3 end"))
+--> ~nil\t.*attempt to reassign constant variable 'k'
+
+print(load("for k, v in pairs({}) do v = 3 end") ~= nil)
+--> =true
@@ -0,0 +1,215 @@
+-- Syntax extensions are enabled per chunk via the mode argument of load.
+
+local function run(mode, src, ...)
+    local f, err = load(src, "ext", mode)
+    if not f then
+        return err
+    end
+    return f(...)
+end
+
+-- Compound assignment
+
+print(run("t+compound", [[
+local x = 10
+x += 5
+x -= 3
+x *= 2
+x /= 8
+return x, math.type(x)
+]]))
+--> =3	float
+
+print(run("t+compound", [[
+local x = 17
+x //= 3
+x %= 4
+x ^= 2
+local s = "a"
+s ..= "b"
+s ..= x
+return s
+]]))
+--> =ab1
+
+print(run("t+compound", [[
+g = 1
+g += 41
+return g
+]]))
+--> =42
+
+print(run("t+compound", [[
+local n = 0
+local t = {a = {1, 2}}
+local function k() n = n + 1 return 2 end
+t.a[k()] += 10
+return t.a[2], n
+]]))
+--> =12	1
+
+print(run("t+compound", [[
+local t = setmetatable({}, {__index = function() return 5 end})
+t.x += 1
+return rawget(t, "x")
+]]))
+--> =6
+
+print(run("t", "local x = 1 x += 1"))
+--> ~ext:1:.*
+
+print(run("t+compound", "f() += 1"))
+--> ~ext:1:.*
+
+-- continue
+
+print(run("t+continue", [[
+local s = ""
+for i = 1, 6 do
+    if i % 2 == 0 then continue end
+    s = s .. i
+end
+return s
+]]))
+--> =135
+
+print(run("t+continue", [[
+local s = ""
+for k, v in ipairs{"a", "b", "c"} do
+    if v == "b" then continue end
+    s = s .. v
+end
+return s
+]]))
+--> =ac
+
+print(run("t+continue", [[
+local s, i = "", 0
+while i < 5 do
+    i = i + 1
+    if i == 3 then continue end
+    s = s .. i
+end
+return s
+]]))
+--> =1245
+
+print(run("t+continue", [[
+local s, i = "", 0
+repeat
+    i = i + 1
+    if i == 2 then continue end
+    s = s .. i
+until i >= 4
+return s
+]]))
+--> =134
+
+print(run("t+continue", [[
+local s = ""
+for i = 1, 3 do
+    for j = 1, 3 do
+        if j == i then continue end
+        s = s .. i .. j
+    end
+    if i == 2 then continue end
+    s = s .. ";"
+end
+return s
+]]))
+--> =1213;21233132;
+
+print(run("t+continue", [[
+local fs = {}
+for i = 1, 3 do
+    local x <close> = nil
+    local j = i
+    fs[i] = function() return j end
+    if i == 2 then continue end
+end
+return fs[1](), fs[2](), fs[3]()
+]]))
+--> =1	2	3
+
+print(run("t+continue", [[
+local i = 0
+repeat
+    i = i + 1
+    if i < 3 then continue end
+    local done = true
+until done
+]]))
+--> ~ext:.*continue.*
+
+print(run("t+continue", "continue"))
+--> ~ext:1:.*continue.*
+
+-- Without the extension, continue is an ordinary name
+print(run("t", "local continue = 1 return continue"))
+--> =1
+
+-- Safe navigation
+
+print(run("t+safenav", [[
+local t = {a = {b = {c = 1}}}
+local u = nil
+return t?.a?.b?.c, u?.a, t?.x?.y, t?["a"]?.b.c, u?[1]
+]]))
+--> =1	nil	nil	1	nil
+
+print(run("t+safenav", [[
+local t = {f = function() return 42 end}
+return t?.f(), (nil)?.x
+]]))
+--> =42	nil
+
+print(pcall(run, "t+safenav", "local x = false return x?.y"))
+--> ~false\t.*attempt to index.*
+
+print(run("t", "return a?.b"))
+--> ~ext:1:.*
+
+-- !=
+
+print(run("t+notequal", "return 1 != 2, 1 != 1"))
+--> =true	false
+
+print(run("t", "return 1 != 2"))
+--> ~ext:1:.*
+
+-- type annotations (checked by "golua check", ignored when running)
+
+print(run("t+types", [[
+type Point = {x: number, y: number}
+local function norm1(p: Point): number
+    return math.abs(p.x) + math.abs(p.y)
+end
+local p: Point = {x = 3, y = -4}
+local type = type
+return norm1(p), type(p)
+]]))
+--> =7	table
+
+print(run("t+types", "local x: string = 42 return x"))
+--> =42
+
+print(run("t", "local x: number = 1"))
+--> ~ext:1:.*
+
+-- Several extensions and "all"
+
+print(run("t+compound+continue", [[
+local s = 0
+for i = 1, 5 do
+    if i == 3 then continue end
+    s += i
+end
+return s
+]]))
+--> =12
+
+print(run("t+all", "local t = {} t.x = 1 t.x += 1 return t?.x != 1"))
+--> =true
+
+print(load("return 1", "ext", "t+foo"))
+--> =nil	unknown syntax extension 'foo'
@@ -16,7 +16,7 @@ func pcall(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	})
 	if err != nil {
 		t.Push1(next, rt.BoolValue(false))
-		t.Push1(next, rt.ErrorValue(err))
+		t.Push1(next, t.CatchError(err))
 	} else {
 		t.Push1(next, rt.BoolValue(true))
 		t.Push(next, res.Etc()...)
@@ -46,7 +46,7 @@ func xpcall(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	})
 	if err != nil {
 		t.Push1(next, rt.BoolValue(false))
-		t.Push1(next, rt.ErrorValue(err))
+		t.Push1(next, t.CatchError(err))
 	} else {
 		t.Push1(next, rt.BoolValue(true))
 		t.Push(next, res.Etc()...)
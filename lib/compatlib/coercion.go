@@ -0,0 +1,102 @@
+package compatlib
+
+import (
+	"errors"
+	"fmt"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// Arithmetic on strings is implemented by the metamethods of the string
+// metatable.
+var arithMetamethods = []string{
+	"__add", "__sub", "__mul", "__div", "__idiv", "__mod", "__pow", "__unm",
+}
+
+// Key in the registry where the original string metamethods are kept while
+// coercion warnings are on.
+type coercionKeyType struct{}
+
+var coercionKey = rt.AsValue(coercionKeyType{})
+
+func warncoercion(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	SetCoercionWarnings(t.Runtime, rt.Truth(c.Arg(0)))
+	return c.Next(), nil
+}
+
+// SetCoercionWarnings turns on or off warnings when a string is converted to a
+// number by an arithmetic operation, like "10" + 1.  Lua 5.1 scripts often
+// rely on this conversion unknowingly, and it does not always give the same
+// result in Lua 5.4, where strings may be converted to integers rather than
+// floats (e.g. "9007199254740993" + 0 is 9007199254740993 in Lua 5.4 but
+// 9.007199254741e+15 in Lua 5.1).
+// The warnings are emitted with the runtime's warner (see Runtime.Warn).
+//
+// It works by wrapping the arithmetic metamethods of the string metatable, so
+// the string library must be loaded.
+func SetCoercionWarnings(r *rt.Runtime, on bool) {
+	meta := r.RawMetatable(rt.StringValue(""))
+	if meta == nil {
+		return
+	}
+	saved, isOn := r.Registry(coercionKey).TryTable()
+	if on == isOn {
+		return
+	}
+	if !on {
+		for _, name := range arithMetamethods {
+			r.SetEnv(meta, name, saved.Get(rt.StringValue(name)))
+		}
+		r.SetRegistry(coercionKey, rt.NilValue)
+		return
+	}
+	saved = rt.NewTable()
+	for _, name := range arithMetamethods {
+		orig := meta.Get(rt.StringValue(name))
+		if orig.IsNil() {
+			continue
+		}
+		r.SetEnv(saved, name, orig)
+		warner := rt.NewGoFunction(coercionWarner(orig, name[2:]), name, 0, true)
+		warner.SolemnlyDeclareCompliance(complianceFlags(orig))
+		r.SetEnv(meta, name, rt.FunctionValue(warner))
+	}
+	r.SetRegistry(coercionKey, rt.TableValue(saved))
+}
+
+// complianceFlags returns the compliance flags a wrapper of the metamethod f
+// can declare.  They are the flags of f if it is a Go function; otherwise the
+// wrapper complies with all flags, as the functions f calls are checked when
+// they run.
+func complianceFlags(f rt.Value) rt.ComplianceFlags {
+	if gof, ok := f.Interface().(*rt.GoFunction); ok {
+		return gof.ComplianceFlags()
+	}
+	return rt.ComplyCpuSafe | rt.ComplyMemSafe | rt.ComplyTimeSafe | rt.ComplyIoSafe
+}
+
+// coercionWarner returns a metamethod that warns about the strings in its
+// arguments that can be converted to numbers, then calls orig.
+func coercionWarner(orig rt.Value, op string) rt.GoFunctionFunc {
+	return func(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+		for _, arg := range c.Etc() {
+			s, ok := arg.TryString()
+			if !ok {
+				continue
+			}
+			if _, tp := rt.ToNumberValue(arg); tp != rt.NaN {
+				t.Warn(fmt.Sprintf("string %q converted to number by '%s'", s, op))
+			}
+		}
+		f, ok := orig.TryCallable()
+		if !ok {
+			return nil, errors.New("attempt to perform arithmetic on a string value")
+		}
+		cont := f.Continuation(t, c.Next())
+		t.Push(cont, c.Etc()...)
+		return cont, nil
+	}
+}
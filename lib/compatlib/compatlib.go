@@ -0,0 +1,104 @@
+// Package compatlib implements an optional library that provides functions
+// from Lua 5.1 and 5.2 which were removed from Lua 5.4, to help run legacy
+// scripts.  It is not loaded by lib.LoadAll, load it with
+//
+//	lib.LoadLibs(r, compatlib.LibLoader)
+//
+// after the other libraries, as it adds functions to the table, math, string
+// and package libraries when they are loaded.
+package compatlib
+
+import (
+	"github.com/arnodel/golua/lib/packagelib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// LibLoader can load the compat lib.
+var LibLoader = packagelib.Loader{
+	Load: load,
+	Name: "compat",
+}
+
+func load(r *rt.Runtime) (rt.Value, func()) {
+	env := r.GlobalEnv()
+	pkg := rt.NewTable()
+
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(env, "getfenv", getfenv, 1, false),
+		r.SetEnvGoFunc(env, "setfenv", setfenv, 2, false),
+		r.SetEnvGoFunc(env, "module", module, 1, true),
+		r.SetEnvGoFunc(pkg, "warncoercion", warncoercion, 1, false),
+	)
+
+	// Functions that were renamed are aliases of their new version.
+	setAlias(r, env, "unpack", env.Get(rt.StringValue("table")), "unpack")
+	setAlias(r, env, "loadstring", rt.TableValue(env), "load")
+	if stringPkg, ok := env.Get(rt.StringValue("string")).TryTable(); ok {
+		setAlias(r, stringPkg, "gfind", rt.TableValue(stringPkg), "gmatch")
+	}
+
+	if tablePkg, ok := env.Get(rt.StringValue("table")).TryTable(); ok {
+		rt.SolemnlyDeclareCompliance(
+			rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+			r.SetEnvGoFunc(tablePkg, "getn", getn, 1, false),
+		)
+	}
+	if mathPkg, ok := env.Get(rt.StringValue("math")).TryTable(); ok {
+		rt.SolemnlyDeclareCompliance(
+			rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+			r.SetEnvGoFunc(mathPkg, "pow", pow, 2, false),
+		)
+	}
+	if pkgPkg, ok := env.Get(rt.StringValue("package")).TryTable(); ok {
+		rt.SolemnlyDeclareCompliance(
+			rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+			r.SetEnvGoFunc(pkgPkg, "seeall", seeall, 1, false),
+		)
+	}
+
+	return rt.TableValue(pkg), nil
+}
+
+// setAlias sets dst[name] to src[srcName] if src is a table and that value is
+// not nil.
+func setAlias(r *rt.Runtime, dst *rt.Table, name string, src rt.Value, srcName string) {
+	srcTbl, ok := src.TryTable()
+	if !ok {
+		return
+	}
+	if v := srcTbl.Get(rt.StringValue(srcName)); !v.IsNil() {
+		r.SetEnv(dst, name, v)
+	}
+}
+
+func getn(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	tbl, err := c.TableArg(0)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, rt.IntValue(tbl.Len())), nil
+}
+
+func pow(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.CheckNArgs(2); err != nil {
+		return nil, err
+	}
+	x, err := c.FloatArg(0)
+	if err != nil {
+		return nil, err
+	}
+	y, err := c.FloatArg(1)
+	if err != nil {
+		return nil, err
+	}
+	z, _ := rt.Pow(rt.FloatValue(x), rt.FloatValue(y))
+	return c.PushingNext1(t.Runtime, z), nil
+}
@@ -0,0 +1,202 @@
+package compatlib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// Lua 5.1 function environments are emulated with the _ENV upvalue of Lua
+// functions.  A function that does not use global variables has no _ENV
+// upvalue so its environment is always the global environment.
+
+var errInvalidLevel = errors.New("#1 invalid level")
+
+// envUpvalue returns the index of the _ENV upvalue of clos, or -1 if it has
+// none.
+func envUpvalue(clos *rt.Closure) int {
+	for i, name := range clos.Code.UpNames {
+		if name == "_ENV" {
+			return i
+		}
+	}
+	return -1
+}
+
+// fenvTarget returns the function designated by the first argument of getfenv
+// and setfenv: a function or a level in the call stack, 1 being the function
+// that called getfenv or setfenv (the default).  Level 0 designates the global
+// environment, in which case it returns isGlobal = true.  The closure returned
+// is nil if the function is not a Lua function.
+func fenvTarget(c *rt.GoCont) (clos *rt.Closure, running bool, isGlobal bool, err error) {
+	level := int64(1)
+	if c.NArgs() > 0 {
+		arg := c.Arg(0)
+		if arg.Type() == rt.FunctionType {
+			clos, _ = arg.TryClosure()
+			return clos, false, false, nil
+		}
+		level, err = c.IntArg(0)
+		if err != nil {
+			return nil, false, false, err
+		}
+	}
+	if level < 0 {
+		return nil, false, false, errors.New("#1 level must be non-negative")
+	}
+	if level == 0 {
+		return nil, false, true, nil
+	}
+	var cont rt.Cont = c
+	for ; level > 0; level-- {
+		cont = cont.Parent()
+		if cont == nil {
+			return nil, false, false, errInvalidLevel
+		}
+	}
+	if lc, ok := cont.(*rt.LuaCont); ok {
+		clos = lc.Closure
+	}
+	return clos, true, false, nil
+}
+
+func getfenv(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	clos, _, _, err := fenvTarget(c)
+	if err != nil {
+		return nil, err
+	}
+	env := rt.TableValue(t.GlobalEnv())
+	if clos != nil {
+		if i := envUpvalue(clos); i >= 0 {
+			env = clos.GetUpvalue(i)
+		}
+	}
+	return c.PushingNext1(t.Runtime, env), nil
+}
+
+// setfenv rebinds the _ENV upvalue of a function given as a value, so other
+// functions which share it (e.g. functions defined in the same chunk) are not
+// affected.  A running function cannot be rebound, so when the function is
+// given as a level its _ENV upvalue is set instead, which also changes the
+// environment of the functions which share it.
+func setfenv(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.CheckNArgs(2); err != nil {
+		return nil, err
+	}
+	env, err := c.TableArg(1)
+	if err != nil {
+		return nil, err
+	}
+	clos, running, isGlobal, err := fenvTarget(c)
+	if err != nil {
+		return nil, err
+	}
+	if isGlobal {
+		return nil, errors.New("cannot change the global environment")
+	}
+	if clos == nil {
+		return nil, errors.New("cannot change environment of given object")
+	}
+	setEnv(clos, rt.TableValue(env), running)
+	return c.PushingNext1(t.Runtime, rt.FunctionValue(clos)), nil
+}
+
+func setEnv(clos *rt.Closure, env rt.Value, running bool) {
+	i := envUpvalue(clos)
+	switch {
+	case i < 0:
+		// The function does not use its environment
+	case running:
+		clos.SetUpvalue(i, env)
+	default:
+		clos.RebindUpvalue(i, env)
+	}
+}
+
+// module implements the Lua 5.1 module function: it creates (or reuses) the
+// table for the module, registers it in package.loaded and makes it the
+// environment of the calling function.  Options are functions applied to the
+// module table, e.g. package.seeall.
+func module(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	name, err := c.StringArg(0)
+	if err != nil {
+		return nil, err
+	}
+	pkg, ok := t.Registry(rt.StringValue("package")).TryTable()
+	if !ok {
+		return nil, errors.New("the package library is not loaded")
+	}
+	loaded, ok := pkg.Get(rt.StringValue("loaded")).TryTable()
+	if !ok {
+		return nil, errors.New("package.loaded must be a table")
+	}
+	nameVal := rt.StringValue(name)
+	mod, ok := loaded.Get(nameVal).TryTable()
+	if !ok {
+		mod, ok = findTable(t, t.GlobalEnv(), name)
+		if !ok {
+			return nil, fmt.Errorf("name conflict for module '%s'", name)
+		}
+		t.SetTable(loaded, nameVal, rt.TableValue(mod))
+	}
+	if mod.Get(rt.StringValue("_NAME")).IsNil() {
+		t.SetEnv(mod, "_M", rt.TableValue(mod))
+		t.SetEnv(mod, "_NAME", nameVal)
+		t.SetEnv(mod, "_PACKAGE", rt.StringValue(name[:strings.LastIndex(name, ".")+1]))
+	}
+	if caller, ok := c.Parent().(*rt.LuaCont); ok {
+		setEnv(caller.Closure, rt.TableValue(mod), true)
+	}
+	for _, opt := range c.Etc() {
+		if err := rt.Call(t, opt, []rt.Value{rt.TableValue(mod)}, rt.NewTerminationWith(c, 0, false)); err != nil {
+			return nil, err
+		}
+	}
+	return c.Next(), nil
+}
+
+// findTable returns the table at the dotted path name in tbl (e.g. "a.b" is
+// tbl.a.b), creating missing tables.  It fails if a value on the path is not a
+// table.
+func findTable(t *rt.Thread, tbl *rt.Table, name string) (*rt.Table, bool) {
+	for _, part := range strings.Split(name, ".") {
+		key := rt.StringValue(part)
+		v := tbl.Get(key)
+		if v.IsNil() {
+			next := rt.NewTable()
+			t.SetTable(tbl, key, rt.TableValue(next))
+			tbl = next
+			continue
+		}
+		next, ok := v.TryTable()
+		if !ok {
+			return nil, false
+		}
+		tbl = next
+	}
+	return tbl, true
+}
+
+// seeall implements package.seeall: it makes the global environment visible
+// from a module table.
+func seeall(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	mod, err := c.TableArg(0)
+	if err != nil {
+		return nil, err
+	}
+	meta := mod.Metatable()
+	if meta == nil {
+		meta = rt.NewTable()
+		mod.SetMetatable(meta)
+	}
+	t.SetEnv(meta, "__index", rt.TableValue(t.GlobalEnv()))
+	return c.Next(), nil
+}
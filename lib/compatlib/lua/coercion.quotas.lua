@@ -0,0 +1,9 @@
+-- The wrapped string metamethods keep the compliance flags of the original
+-- ones.
+
+warn("@on")
+compat.warncoercion(true)
+print(runtime.callcontext({flags="cpusafe"}, function() return "10" + 1 end))
+--> ~Test warning: string "10" converted to number by 'add'
+--> =done	11
+compat.warncoercion(false)
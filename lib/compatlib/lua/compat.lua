@@ -0,0 +1,103 @@
+-- Renamed functions
+
+print(unpack({1, 2, 3}))
+--> =1	2	3
+
+print(loadstring("return 1 + 1")())
+--> =2
+
+print(table.getn({1, 2, 3, nil, 5}) >= 3)
+--> =true
+
+print(math.pow(2, 10), math.type(math.pow(2, 10)))
+--> =1024	float
+
+print(pcall(math.pow, "x", 2))
+--> ~false\t.*
+
+for w in string.gfind("one two", "%a+") do print(w) end
+--> =one
+--> =two
+
+-- getfenv / setfenv
+
+print(getfenv() == _G, getfenv(0) == _G, getfenv(1) == _G)
+--> =true	true	true
+
+print(getfenv(print) == _G)
+--> =true
+
+local function getx() return x end
+x = "global"
+local env = {x = "sandboxed"}
+print(setfenv(getx, env) == getx)
+--> =true
+
+-- Only getx is affected, not the other functions of the chunk.
+print(getx(), x, getfenv(getx) == env)
+--> =sandboxed	global	true
+
+-- A loaded chunk gets its own environment.
+local f = loadstring("y = 42; return y")
+setfenv(f, env)
+print(f(), env.y, y)
+--> =42	42	nil
+
+-- Setting the environment of the running function.
+local g = loadstring("local e = ... setfenv(1, e) z = 'set' return getfenv(1) == e")
+local genv = {setfenv = setfenv, getfenv = getfenv}
+print(g(genv), genv.z, z)
+--> =true	set	nil
+
+print(pcall(setfenv, print, {}))
+--> ~false\t.*cannot change environment of given object
+
+print(pcall(setfenv, 0, {}))
+--> ~false\t.*cannot change the global environment
+
+print(pcall(getfenv, 100))
+--> ~false\t.*invalid level
+
+-- module
+
+package.preload["compat.mod"] = loadstring([[
+module("compat.mod", package.seeall)
+function hello() return "hello from " .. _NAME end
+local x = 1
+]])
+local m = require("compat.mod")
+print(m.hello(), m._NAME, m._PACKAGE, m._M == m)
+--> =hello from compat.mod	compat.mod	compat.	true
+
+print(compat.mod == m, package.loaded["compat.mod"] == m)
+--> =true	true
+
+-- Without package.seeall, globals are not visible from the module.
+package.preload.isolated = loadstring([[
+module("isolated")
+value = print
+]])
+print(require("isolated").value)
+--> =nil
+
+y = 1
+package.preload["y.z"] = loadstring([[module("y.z")]])
+print(pcall(require, "y.z"))
+--> ~false\t.*name conflict for module 'y.z'
+
+-- String to number coercion warnings
+
+warn("@on")
+compat.warncoercion(true)
+print("10" + 1, 2 * "3", -"4")
+--> ~Test warning: string "10" converted to number by 'add'
+--> ~Test warning: string "3" converted to number by 'mul'
+--> ~Test warning: string "4" converted to number by 'unm'
+--> =11	6	-4
+
+print(pcall(function() return "a" + 1 end))
+--> ~false\t.*
+
+compat.warncoercion(false)
+print("10" + 1)
+--> =11
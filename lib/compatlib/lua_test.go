@@ -0,0 +1,19 @@
+package compatlib_test
+
+import (
+	"testing"
+
+	"github.com/arnodel/golua/lib"
+	"github.com/arnodel/golua/lib/compatlib"
+	"github.com/arnodel/golua/luatesting"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func TestCompatLib(t *testing.T) {
+	setup := func(r *rt.Runtime) func() {
+		cleanup := lib.LoadAll(r)
+		lib.LoadLibs(r, compatlib.LibLoader)
+		return cleanup
+	}
+	luatesting.RunLuaTestsInDir(t, "lua", setup)
+}
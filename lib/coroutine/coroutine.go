@@ -47,7 +47,7 @@ func close(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	next := c.Next()
 	t.Push1(next, rt.BoolValue(err == nil))
 	if err != nil {
-		t.Push1(next, rt.ErrorValue(err))
+		t.Push1(next, t.CatchError(err))
 	}
 	return next, nil
 }
@@ -82,7 +82,7 @@ func resume(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 		t.Push(next, res...)
 	} else {
 		t.Push1(next, rt.BoolValue(false))
-		t.Push1(next, rt.ErrorValue(err))
+		t.Push1(next, t.CatchError(err))
 	}
 	return next, nil
 }
@@ -0,0 +1,38 @@
+package golib
+
+import (
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// A Func wraps a Go function to declare its cost and compliance (see
+// quotas.md), so that Lua code can call it via golib in runtime contexts with
+// quotas or compliance requirements.  A Go function which is not wrapped in a
+// Func can only be called in contexts which do not require any compliance
+// flags.
+//
+// In addition to the declared cost, the memory needed to convert arguments and
+// results between Lua and Go is accounted for.  E.g.
+//
+//	golib.NewGoValue(r, &golib.Func{
+//		Fn:    strings.ToUpper,
+//		Flags: rt.ComplyCpuSafe | rt.ComplyMemSafe | rt.ComplyTimeSafe | rt.ComplyIoSafe,
+//		Cpu:   10,
+//	})
+//
+// Funcs can also be used as values in the Exports map of a package registered
+// with RegisterPackage.
+type Func struct {
+	Fn    interface{}        // The Go function
+	Flags rt.ComplianceFlags // The compliance flags the function satisfies
+	Cpu   uint64             // CPU charged for each call
+	Mem   uint64             // Memory charged for each call
+}
+
+// funcOf returns the Func for x, which is either a *Func or a plain Go
+// function, with no compliance flags and no cost.
+func funcOf(x interface{}) Func {
+	if fn, ok := x.(*Func); ok {
+		return *fn
+	}
+	return Func{Fn: x}
+}
@@ -0,0 +1,152 @@
+package goimports
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// The exported functions and types of a Go package.
+type libModel struct {
+	Package     string
+	PackageName string
+	Alias       string // Name the package is imported as in generated code
+	Funcs       []string
+	Types       []string
+	dir         string
+	files       []string
+}
+
+// getLibModel uses the go toolchain to find the source files of pkg (taking
+// build constraints into account) and parses them to find what they export.
+func getLibModel(pkg string) (*libModel, error) {
+	res, err := exec.Command("go", "list", "-f", "{{.Dir}}\n{{.Name}}\n{{join .GoFiles \" \"}} {{join .CgoFiles \" \"}}", pkg).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("go list %s: %s", pkg, bytes.TrimSpace(exitErr.Stderr))
+		}
+		return nil, err
+	}
+	lines := strings.SplitN(string(res), "\n", 3)
+	if len(lines) < 3 {
+		return nil, fmt.Errorf("go list %s: unexpected output", pkg)
+	}
+	model := &libModel{
+		Package:     pkg,
+		PackageName: lines[1],
+		Alias:       lines[1],
+		dir:         lines[0],
+		files:       strings.Fields(lines[2]),
+	}
+	fset := token.NewFileSet()
+	for _, name := range model.files {
+		f, err := parser.ParseFile(fset, filepath.Join(model.dir, name), nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing package: %s", err)
+		}
+		fillModel(model, f)
+	}
+	sort.Strings(model.Funcs)
+	sort.Strings(model.Types)
+	return model, nil
+}
+
+// fillModel adds the exported functions and types declared in f to model.
+// Generic functions and types are left out as they cannot be used without
+// being instantiated.
+func fillModel(model *libModel, f *ast.File) {
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil && d.Name.IsExported() && !isGenericFunc(d) {
+				model.Funcs = append(model.Funcs, d.Name.Name)
+			}
+		case *ast.GenDecl:
+			if d.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range d.Specs {
+				tspec := spec.(*ast.TypeSpec)
+				if tspec.Name.IsExported() && !isGenericType(tspec) {
+					model.Types = append(model.Types, tspec.Name.Name)
+				}
+			}
+		}
+	}
+}
+
+// GenerateBindings writes to out the source of a Go file in package outPkg
+// which registers static bindings for the given Go packages with
+// golib.RegisterPackage.  Linking this file into a program allows Lua code to
+// import those packages with golib.import without building plugins at runtime.
+//
+// The go toolchain is required to generate the bindings, but not to use them.
+func GenerateBindings(out io.Writer, outPkg string, pkgs ...string) error {
+	aliases := map[string]bool{"golib": true}
+	models := make([]*libModel, len(pkgs))
+	for i, pkg := range pkgs {
+		model, err := getLibModel(pkg)
+		if err != nil {
+			return err
+		}
+		for n := 2; aliases[model.Alias]; n++ {
+			model.Alias = model.PackageName + strconv.Itoa(n)
+		}
+		aliases[model.Alias] = true
+		models[i] = model
+	}
+	var buf bytes.Buffer
+	err := bindingsTemplate.Execute(&buf, struct {
+		Package string
+		Libs    []*libModel
+	}{outPkg, models})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(src)
+	return err
+}
+
+var bindingsTemplate = template.Must(template.New("bindings").Parse(`// Code generated by golua-bindgen. DO NOT EDIT.
+
+package {{ .Package }}
+
+import (
+	"github.com/arnodel/golua/lib/golib"
+{{ range .Libs }}
+	{{ .Alias }} "{{ .Package }}"
+{{- end }}
+)
+
+func init() {
+{{- range .Libs }}
+{{- $alias := .Alias }}
+	golib.RegisterPackage("{{ .Package }}", map[string]interface{}{
+		// Functions
+{{- range .Funcs }}
+		"{{ . }}": {{ $alias }}.{{ . }},
+{{- end }}
+
+		// Types
+{{- range .Types }}
+		"{{ . }}":    func(x {{ $alias }}.{{ . }}) {{ $alias }}.{{ . }} { return x },
+		"new{{ . }}": func() *{{ $alias }}.{{ . }} { return new({{ $alias }}.{{ . }}) },
+{{- end }}
+	})
+{{- end }}
+}
+`))
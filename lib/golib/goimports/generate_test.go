@@ -0,0 +1,56 @@
+package goimports
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateBindings(t *testing.T) {
+	var buf bytes.Buffer
+	err := GenerateBindings(&buf, "bindings", "strings", "math/rand", "crypto/rand")
+	if err != nil {
+		t.Fatalf("error generating bindings: %s", err)
+	}
+	src := buf.String()
+	for _, want := range []string{
+		`package bindings`,
+		`rand "math/rand"`,
+		`rand2 "crypto/rand"`,
+		`golib.RegisterPackage("strings", map[string]interface{}{`,
+		`"ToUpper":`,
+		`strings.ToUpper,`,
+		`"newBuilder":`,
+		`rand2.Read,`,
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("expected generated source to contain %q", want)
+		}
+	}
+
+	// Check that the generated code compiles.  It is built in a temporary
+	// directory inside the module, so that it can import golib (the leading
+	// "_" stops the go tool from considering it part of "./...").
+	dir, err := os.MkdirTemp(".", "_bindings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "bindings.go"), buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "build", "./"+filepath.ToSlash(dir))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("generated bindings do not compile: %s\n%s", err, out)
+	}
+}
+
+func TestGenerateBindingsUnknownPackage(t *testing.T) {
+	err := GenerateBindings(new(bytes.Buffer), "main", "this/package/does/not/exist")
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
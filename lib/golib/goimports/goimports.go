@@ -6,17 +6,11 @@ package goimports
 import (
 	"bytes"
 	"errors"
-	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
-	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path"
 	"plugin"
-	"strings"
 	"text/template"
 )
 
@@ -55,24 +49,6 @@ func LoadGoPackage(pkg string, pluginRoot string, forceBuild bool) (map[string]i
 	return *exports, nil
 }
 
-type libModel struct {
-	Package     string
-	PackageName string
-	Funcs       []string
-	Types       []string
-	vars        []string
-	consts      []string
-}
-
-func getPackagePath(pkg string) (string, string, error) {
-	res, err := exec.Command("go", "list", "-f", "{{.Dir}} {{.Name}}", pkg).Output()
-	if err != nil {
-		return "", "", err
-	}
-	bits := strings.Split(strings.TrimSpace(string(res)), " ")
-	return bits[0], bits[1], nil
-}
-
 func buildPlugin(pkg string, pluginPath string) error {
 	pluginDir := path.Dir(pluginPath)
 	pluginFile := path.Base(pluginPath)
@@ -81,7 +57,12 @@ func buildPlugin(pkg string, pluginPath string) error {
 	if err != nil {
 		return err
 	}
-	if err := buildLib(pkg, f); err != nil {
+	model, err := getLibModel(pkg)
+	if err != nil {
+		return err
+	}
+	log.Printf("Creating lib for package %s at %s", model.PackageName, model.dir)
+	if err := pluginTemplate.Execute(f, model); err != nil {
 		return err
 	}
 	runner := cmdRunner{dir: pluginDir}
@@ -125,67 +106,7 @@ func (r *cmdRunner) errMsg() string {
 	return string(r.errBuf.Bytes())
 }
 
-func buildLib(pkg string, out io.Writer) error {
-	pkgDir, pkgName, err := getPackagePath(pkg)
-	if err != nil {
-		return err
-	}
-	log.Printf("Creating lib for package %s at %s", pkgName, pkgDir)
-	fset := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fset, pkgDir, nil, 0)
-	if err != nil {
-		return fmt.Errorf("Error parsing package: %s", err)
-	}
-	model := &libModel{
-		Package:     pkg,
-		PackageName: pkgName,
-	}
-	fillModel(model, pkgs[pkgName])
-	getTemplate().Execute(out, model)
-	return nil
-}
-
-func fillModel(model *libModel, pkg *ast.Package) {
-	fset := token.NewFileSet()
-	files := make(map[string]*ast.File)
-	for fName, f := range pkg.Files {
-		if !strings.HasSuffix(fName, "_test.go") {
-			files[fName] = f
-		}
-	}
-	pkg, _ = ast.NewPackage(fset, files, nil, nil)
-	for _, obj := range pkg.Scope.Objects {
-		switch obj.Kind {
-		case ast.Fun:
-			fdecl := obj.Decl.(*ast.FuncDecl)
-			if !fdecl.Name.IsExported() {
-				continue
-			}
-			name := fdecl.Name.String()
-			model.Funcs = append(model.Funcs, name)
-		case ast.Var:
-			// fmt.Printf("Var: %s %+v\n", obj.Name, obj.Decl)
-		// case ast.Con:
-		case ast.Typ:
-			tdecl := obj.Decl.(*ast.TypeSpec)
-			if !tdecl.Name.IsExported() {
-				continue
-			}
-			model.Types = append(model.Types, tdecl.Name.String())
-		default:
-		}
-	}
-}
-
-func getTemplate() *template.Template {
-	tpl, err := template.New("lib").Parse(templateStr)
-	if err != nil {
-		panic(err)
-	}
-	return tpl
-}
-
-const templateStr = `
+var pluginTemplate = template.Must(template.New("plugin").Parse(`
 package main
 {{ $pkgName := .PackageName }}
 import "{{ .Package }}"
@@ -203,4 +124,4 @@ var Exports = map[string]interface{}{
 	"new{{ . }}": func() *{{ $pkgName }}.{{ . }} { return new({{ $pkgName }}.{{ . }}) },
 {{- end }}
 }
-`
+`))
@@ -0,0 +1,17 @@
+//go:build !go1.18
+// +build !go1.18
+
+package goimports
+
+import "go/ast"
+
+// Before Go 1.18 there are no generic declarations (and go/ast has no fields
+// for type parameters).
+
+func isGenericFunc(d *ast.FuncDecl) bool {
+	return false
+}
+
+func isGenericType(s *ast.TypeSpec) bool {
+	return false
+}
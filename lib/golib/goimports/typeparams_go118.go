@@ -0,0 +1,16 @@
+//go:build go1.18
+// +build go1.18
+
+package goimports
+
+import "go/ast"
+
+// isGenericFunc returns true if d declares a generic function.
+func isGenericFunc(d *ast.FuncDecl) bool {
+	return d.Type.TypeParams != nil
+}
+
+// isGenericType returns true if s declares a generic type.
+func isGenericType(s *ast.TypeSpec) bool {
+	return s.TypeParams != nil
+}
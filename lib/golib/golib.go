@@ -25,15 +25,27 @@ var govalueKey = rt.AsValue(govalueKeyType{})
 func load(r *rt.Runtime) (rt.Value, func()) {
 	pkg := rt.NewTable()
 
-	if goimports.Supported {
-		r.SetEnvGoFunc(pkg, "import", goimport, 1, false)
-	}
+	// Those functions check compliance themselves when necessary (e.g. when
+	// calling a Go function or building a plugin).
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(pkg, "import", goimport, 1, false),
+	)
 
 	meta := rt.NewTable()
-	r.SetEnvGoFunc(meta, "__index", goValueIndex, 2, false)
-	r.SetEnvGoFunc(meta, "__newindex", goValueSetIndex, 3, false)
-	r.SetEnvGoFunc(meta, "__call", goValueCall, 1, true)
-	r.SetEnvGoFunc(meta, "__tostring", goValueToString, 1, false)
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(meta, "__index", goValueIndex, 2, false),
+		r.SetEnvGoFunc(meta, "__newindex", goValueSetIndex, 3, false),
+		r.SetEnvGoFunc(meta, "__call", goValueCall, 1, true),
+	)
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(meta, "__tostring", goValueToString, 1, false),
+	)
 
 	r.SetRegistry(govalueKey, rt.TableValue(meta))
 
@@ -57,7 +69,11 @@ func goValueToString(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	if err != nil {
 		return nil, err
 	}
-	return c.PushingNext1(t.Runtime, rt.StringValue(fmt.Sprintf("%#v", u.Value()))), nil
+	x := u.Value()
+	if fn, ok := x.(*Func); ok {
+		x = fn.Fn
+	}
+	return c.PushingNext1(t.Runtime, rt.StringValue(fmt.Sprintf("%#v", x))), nil
 }
 
 func goValueIndex(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
@@ -105,10 +121,9 @@ func goValueCall(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	return c.PushingNext(t.Runtime, res...), nil
 }
 
+// goimport looks for statically linked bindings for the package first (see
+// RegisterPackage), then falls back to building a plugin if allowed.
 func goimport(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
-	if pluginsRoot == "" {
-		return nil, rt.NewError(rt.StringValue("cannot import go packages: plugins root not set"))
-	}
 	if err := c.Check1Arg(); err != nil {
 		return nil, err
 	}
@@ -116,6 +131,21 @@ func goimport(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	if err != nil {
 		return nil, err
 	}
+	if exports, ok := lookupStaticPackage(string(path)); ok {
+		return c.PushingNext1(t.Runtime, NewGoValue(t.Runtime, exports)), nil
+	}
+	// Building and loading a plugin does IO and runs arbitrary code.
+	if err := t.CheckRequiredFlags(0); err != nil {
+		return nil, fmt.Errorf("cannot import go package %s: no static bindings and %s", path, err)
+	}
+	switch {
+	case !goimports.Supported:
+		return nil, fmt.Errorf("cannot import go package %s: no static bindings and plugins not supported", path)
+	case !pluginsAllowed(t.Runtime):
+		return nil, fmt.Errorf("cannot import go package %s: no static bindings and plugins not allowed", path)
+	case pluginsRoot == "":
+		return nil, rt.NewError(rt.StringValue("cannot import go packages: plugins root not set"))
+	}
 	forceBuild := c.NArgs() >= 2 && rt.Truth(c.Arg(1))
 	exports, loadErr := goimports.LoadGoPackage(string(path), pluginsRoot, forceBuild)
 	if loadErr != nil {
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"unsafe"
 
 	rt "github.com/arnodel/golua/runtime"
 )
@@ -18,13 +19,13 @@ func goIndex(t *rt.Thread, u *rt.UserData, key rt.Value) (rt.Value, error) {
 		// First try a method
 		m := gv.MethodByName(string(field))
 		if m != (reflect.Value{}) {
-			return reflectToValue(m, meta), nil
+			return reflectToValue(t, m, meta), nil
 		}
 		if gv.CanAddr() {
 			// Is that even possible?
 			m = gv.Addr().MethodByName(string(field))
 			if m != (reflect.Value{}) {
-				return reflectToValue(m, meta), nil
+				return reflectToValue(t, m, meta), nil
 			}
 		}
 	}
@@ -41,7 +42,7 @@ func goIndex(t *rt.Thread, u *rt.UserData, key rt.Value) (rt.Value, error) {
 		}
 		f := gv.FieldByName(string(field))
 		if f != (reflect.Value{}) {
-			return reflectToValue(f, meta), nil
+			return reflectToValue(t, f, meta), nil
 		}
 		return rt.NilValue, fmt.Errorf("no field or method with name %q", field)
 	case reflect.Map:
@@ -49,7 +50,7 @@ func goIndex(t *rt.Thread, u *rt.UserData, key rt.Value) (rt.Value, error) {
 		if err != nil {
 			return rt.NilValue, fmt.Errorf("map index or incorrect type: %s", err)
 		}
-		return reflectToValue(gv.MapIndex(goV), meta), nil
+		return reflectToValue(t, gv.MapIndex(goV), meta), nil
 	case reflect.Slice:
 		i, ok := rt.ToInt(key)
 		if !ok {
@@ -58,7 +59,7 @@ func goIndex(t *rt.Thread, u *rt.UserData, key rt.Value) (rt.Value, error) {
 		if i < 0 || int(i) >= gv.Len() {
 			return rt.NilValue, errors.New("index out of slice bounds")
 		}
-		return reflectToValue(gv.Index(int(i)), meta), nil
+		return reflectToValue(t, gv.Index(int(i)), meta), nil
 	}
 	return rt.NilValue, errors.New("unable to index")
 }
@@ -122,14 +123,26 @@ func goSetIndex(t *rt.Thread, u *rt.UserData, key rt.Value, val rt.Value) error
 }
 
 // Call tries to call the goValue if it is a function with the given arguments.
+//
+// Unless the function is wrapped in a Func declaring its compliance, it can
+// only be called in runtime contexts that do not require any compliance flags.
 func goCall(t *rt.Thread, u *rt.UserData, args []rt.Value) (res []rt.Value, err error) {
-	gv := reflect.ValueOf(u.Value())
-	meta := u.Metatable()
+	var (
+		fn   = funcOf(u.Value())
+		gv   = reflect.ValueOf(fn.Fn)
+		meta = u.Metatable()
+	)
 	if gv.Kind() != reflect.Func {
 		return nil, fmt.Errorf("%s is not a function", gv.Kind())
 	}
+	if err := t.CheckRequiredFlags(fn.Flags); err != nil {
+		return nil, err
+	}
+	t.RequireCPU(fn.Cpu)
+	t.RequireMem(fn.Mem)
 	f := gv.Type()
 	numParams := f.NumIn()
+	t.RequireArrSize(reflectValueSize, numParams)
 	goArgs := make([]reflect.Value, numParams)
 	isVariadic := f.IsVariadic()
 	if isVariadic {
@@ -150,6 +163,11 @@ func goCall(t *rt.Thread, u *rt.UserData, args []rt.Value) (res []rt.Value, err
 	var goRes []reflect.Value
 	defer func() {
 		if r := recover(); r != nil {
+			switch r.(type) {
+			case rt.ContextTerminationError, *rt.ExitError:
+				// Those must unwind the Lua stack
+				panic(r)
+			}
 			err = fmt.Errorf("panic in go call: %v", r)
 		}
 	}()
@@ -157,6 +175,10 @@ func goCall(t *rt.Thread, u *rt.UserData, args []rt.Value) (res []rt.Value, err
 		etcSliceType := f.In(numParams)
 		etcType := etcSliceType.Elem()
 		etcLen := len(args) - numParams
+		if etcLen < 0 {
+			etcLen = 0
+		}
+		t.RequireArrSize(etcType.Size(), etcLen)
 		etc := reflect.MakeSlice(etcSliceType, etcLen, etcLen)
 		for i := 0; i < etcLen; i++ {
 			goArg, err = valueToType(t, args[i+numParams], etcType)
@@ -172,7 +194,10 @@ func goCall(t *rt.Thread, u *rt.UserData, args []rt.Value) (res []rt.Value, err
 	}
 	res = make([]rt.Value, len(goRes))
 	for i, x := range goRes {
-		res[i] = reflectToValue(x, meta)
+		// The memory used by values returned by the function is accounted
+		// for as it was presumably allocated by it.
+		t.RequireMem(valueMem(x))
+		res[i] = reflectToValue(t, x, meta)
 	}
 	return
 }
@@ -211,7 +236,7 @@ func valueToFunc(t *rt.Thread, v rt.Value, tp reflect.Type) (reflect.Value, erro
 	fn := func(in []reflect.Value) []reflect.Value {
 		args := make([]rt.Value, len(in))
 		for i, x := range in {
-			args[i] = reflectToValue(x, meta)
+			args[i] = reflectToValue(t, x, meta)
 		}
 		res := make([]rt.Value, tp.NumOut())
 		out := make([]reflect.Value, len(res))
@@ -231,7 +256,11 @@ func valueToFunc(t *rt.Thread, v rt.Value, tp reflect.Type) (reflect.Value, erro
 	return reflect.MakeFunc(tp, fn), nil
 }
 
-var runtimeValueType = reflect.TypeOf(rt.Value{})
+var (
+	runtimeValueType = reflect.TypeOf(rt.Value{})
+	reflectValueSize = unsafe.Sizeof(reflect.Value{})
+	userDataSize     = unsafe.Sizeof(rt.UserData{})
+)
 
 func valueToType(t *rt.Thread, v rt.Value, tp reflect.Type) (reflect.Value, error) {
 	if tp == runtimeValueType {
@@ -240,6 +269,9 @@ func valueToType(t *rt.Thread, v rt.Value, tp reflect.Type) (reflect.Value, erro
 	// Fist we deal with UserData
 	if u, ok := v.TryUserData(); ok {
 		gv := reflect.ValueOf(u.Value())
+		if fn, ok := u.Value().(*Func); ok && tp.Kind() == reflect.Func {
+			gv = reflect.ValueOf(fn.Fn)
+		}
 		if gv.Type().AssignableTo(tp) {
 			return gv, nil
 		}
@@ -253,13 +285,15 @@ func valueToType(t *rt.Thread, v rt.Value, tp reflect.Type) (reflect.Value, erro
 		if tp.Elem().Kind() != reflect.Struct {
 			return reflect.Value{}, fmt.Errorf("lua value cannot be converted to %s", tp.Name())
 		}
+		t.RequireSize(tp.Elem().Size())
 		p := reflect.New(tp.Elem())
 		if err := fillStruct(t, p.Elem(), v); err != nil {
 			return reflect.Value{}, err
 		}
 		return p, nil
 	case reflect.Struct:
-		s := reflect.Zero(tp)
+		t.RequireSize(tp.Size())
+		s := reflect.New(tp).Elem()
 		if err := fillStruct(t, s, v); err != nil {
 			return reflect.Value{}, err
 		}
@@ -279,6 +313,10 @@ func valueToType(t *rt.Thread, v rt.Value, tp reflect.Type) (reflect.Value, erro
 	case reflect.String:
 		x, ok := v.ToString()
 		if ok {
+			if v.Type() != rt.StringType {
+				// A new string was created from a number
+				t.RequireBytes(len(x))
+			}
 			return reflect.ValueOf(string(x)), nil
 		}
 	case reflect.Bool:
@@ -287,9 +325,17 @@ func valueToType(t *rt.Thread, v rt.Value, tp reflect.Type) (reflect.Value, erro
 		if tp.Elem().Kind() == reflect.Uint8 {
 			s, ok := v.TryString()
 			if ok {
+				t.RequireBytes(len(s))
 				return reflect.ValueOf([]byte(s)), nil
 			}
 		}
+		if tbl, ok := v.TryTable(); ok {
+			return tableToSlice(t, tbl, tp)
+		}
+	case reflect.Map:
+		if tbl, ok := v.TryTable(); ok {
+			return tableToMap(t, tbl, tp)
+		}
 	case reflect.Interface:
 		iface := v.Interface()
 		if reflect.TypeOf(iface).Implements(tp) {
@@ -299,7 +345,9 @@ func valueToType(t *rt.Thread, v rt.Value, tp reflect.Type) (reflect.Value, erro
 	return reflect.Value{}, fmt.Errorf("%+v cannot be converted to %s", v, tp.Name())
 }
 
-func reflectToValue(v reflect.Value, meta *rt.Table) rt.Value {
+// reflectToValue turns a Go value into a Lua value.  The memory required to
+// represent it in Lua is accounted for in t.
+func reflectToValue(t *rt.Thread, v reflect.Value, meta *rt.Table) rt.Value {
 	if v == (reflect.Value{}) {
 		return rt.NilValue
 	}
@@ -319,7 +367,8 @@ func reflectToValue(v reflect.Value, meta *rt.Table) rt.Value {
 			return rt.NilValue
 		}
 		if v.Type().Elem().Kind() == reflect.Uint8 {
-			return rt.StringValue(string(v.Interface().([]byte)))
+			t.RequireBytes(v.Len())
+			return rt.StringValue(string(v.Bytes()))
 		}
 	case reflect.Ptr:
 		if v.IsNil() {
@@ -336,5 +385,71 @@ func reflectToValue(v reflect.Value, meta *rt.Table) rt.Value {
 			return rt.NilValue
 		}
 	}
+	t.RequireSize(userDataSize)
+	if k := v.Kind(); k == reflect.Struct || k == reflect.Array {
+		// The value is copied into the userdata
+		t.RequireSize(v.Type().Size())
+	}
 	return rt.UserDataValue(rt.NewUserData(v.Interface(), meta))
 }
+
+// tableToSlice converts a Lua sequence to a Go slice of type tp.
+func tableToSlice(t *rt.Thread, tbl *rt.Table, tp reflect.Type) (reflect.Value, error) {
+	n := int(tbl.Len())
+	t.RequireArrSize(tp.Elem().Size(), n)
+	t.RequireCPU(uint64(n))
+	s := reflect.MakeSlice(tp, n, n)
+	for i := 0; i < n; i++ {
+		x, err := valueToType(t, tbl.Get(rt.IntValue(int64(i+1))), tp.Elem())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("slice item %d: %s", i+1, err)
+		}
+		s.Index(i).Set(x)
+	}
+	return s, nil
+}
+
+// tableToMap converts a Lua table to a Go map of type tp.
+func tableToMap(t *rt.Thread, tbl *rt.Table, tp reflect.Type) (reflect.Value, error) {
+	m := reflect.MakeMap(tp)
+	itemSize := tp.Key().Size() + tp.Elem().Size()
+	var k, v rt.Value
+	for {
+		var ok bool
+		k, v, ok = tbl.Next(k)
+		if !ok || k.IsNil() {
+			break
+		}
+		t.RequireSize(itemSize)
+		t.RequireCPU(1)
+		goK, err := valueToType(t, k, tp.Key())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("map key: %s", err)
+		}
+		goV, err := valueToType(t, v, tp.Elem())
+		if err != nil {
+			return reflect.Value{}, fmt.Errorf("map value: %s", err)
+		}
+		m.SetMapIndex(goK, goV)
+	}
+	return m, nil
+}
+
+// valueMem returns an estimate of the memory taken by v, not following
+// pointers.
+func valueMem(v reflect.Value) uint64 {
+	if v == (reflect.Value{}) {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return uint64(v.Len())
+	case reflect.Slice:
+		return uint64(v.Len()) * uint64(v.Type().Elem().Size())
+	case reflect.Map:
+		return uint64(v.Len()) * uint64(v.Type().Key().Size()+v.Type().Elem().Size())
+	case reflect.Struct, reflect.Array:
+		return uint64(v.Type().Size())
+	}
+	return 0
+}
@@ -100,25 +100,27 @@ func Test_reflectToValue(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := reflectToValue(reflect.ValueOf(tt.arg), meta); !reflect.DeepEqual(got, tt.want) {
+			if got := reflectToValue(testThread, reflect.ValueOf(tt.arg), meta); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("reflectToValue() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
+var testThread = rt.New(nil).MainThread()
+
 type tabledef map[interface{}]interface{}
 
 func (t tabledef) table() *rt.Table {
 	tbl := rt.NewTable()
 	for k, v := range t {
-		tbl.Set(reflectToValue(reflect.ValueOf(k), nil), reflectToValue(reflect.ValueOf(v), nil))
+		tbl.Set(reflectToValue(testThread, reflect.ValueOf(k), nil), reflectToValue(testThread, reflect.ValueOf(v), nil))
 	}
 	return tbl
 }
 
 func Test_valueToType(t *testing.T) {
-	var thread *rt.Thread
+	thread := testThread
 	meta := rt.NewTable()
 	tests := []struct {
 		name    string
@@ -262,7 +264,7 @@ func Test_fillStruct(t *testing.T) {
 	type testStruct struct {
 		Foo int
 	}
-	thread := new(rt.Thread)
+	thread := testThread
 	tests := []struct {
 		name    string
 		before  reflect.Value
@@ -315,7 +317,7 @@ func Test_fillStruct(t *testing.T) {
 }
 
 func Test_goIndex(t *testing.T) {
-	thread := new(rt.Thread)
+	thread := testThread
 	meta := rt.NewTable()
 	testErr := errors.New("hello")
 	testInt := int(12)
@@ -416,7 +418,7 @@ func Test_goIndex(t *testing.T) {
 }
 
 func Test_goSetIndex(t *testing.T) {
-	thread := new(rt.Thread)
+	thread := testThread
 	meta := rt.NewTable()
 	testInt := int(12)
 	tests := []struct {
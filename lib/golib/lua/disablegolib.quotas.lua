@@ -9,44 +9,80 @@ local function checkflag(flag, f, ...)
     print("ok")
 end
 
--- golib not cpu safe
+-- Go functions not declared compliant cannot be called, but Go values can be
+-- indexed.
 runtime.callcontext({kill={cpu=10000}}, function()
-    local ctx = runtime.context()
-
     checkflag("cpusafe", double, 2)
     --> =ok
 
-    checkflag("cpusafe", function() return polly.Age end)
-    --> =ok
+    print(polly.Age)
+    --> =10
 
     checkflag("cpusafe", golib.import, "fmt")
     --> =ok
+
+    print(safeupper("hello"))
+    --> =HELLO
+
+    print(cpusafeupper("hello"))
+    --> =HELLO
 end)
 
--- golib not memory safe
 runtime.callcontext({kill={memory=10000}}, function()
-    local ctx = runtime.context()
-
     checkflag("memsafe", double, 2)
     --> =ok
 
-    checkflag("memsafe", function() return polly.Age end)
-    --> =ok
+    print(polly.Age)
+    --> =10
 
     checkflag("memsafe", golib.import, "fmt")
     --> =ok
+
+    print(safeupper("hello"))
+    --> =HELLO
+
+    checkflag("memsafe", cpusafeupper, "hello")
+    --> =ok
 end)
 
--- golib not io safe
 runtime.callcontext({flags="iosafe"}, function()
-    local ctx = runtime.context()
-
     checkflag("iosafe", double, 2)
     --> =ok
 
-    checkflag("iosafe", function() return polly.Age end)
-    --> =ok
+    print(polly.Age)
+    --> =10
 
     checkflag("iosafe", golib.import, "fmt")
     --> =ok
+
+    print(safeupper("hello"))
+    --> =HELLO
 end)
+
+-- The declared cost of Go functions is accounted for
+print(runtime.callcontext({kill={cpu=5000}}, function()
+    for i = 1, 10 do
+        safeupper("x")
+    end
+end))
+--> =killed
+
+-- Memory used by results of Go functions is accounted for
+print(runtime.callcontext({kill={memory=100000}}, function() saferepeat("x", 1000) end))
+--> =done
+
+print(runtime.callcontext({kill={memory=100000}}, function() saferepeat("x", 1000000) end))
+--> =killed
+
+local big = string.rep("x", 200000)
+print(runtime.callcontext({kill={memory=100000}}, function() safeupper(big) end))
+--> =killed
+
+-- Memory used to convert Lua values to Go values is accounted for
+print(runtime.callcontext({kill={memory=100000}}, function() return safejoin({"a", "b", "c"}, "-") end))
+--> =done	a-b-c
+
+local bigt = {}
+for i = 1, 20000 do bigt[i] = "x" end
+print(runtime.callcontext({kill={memory=100000}}, function() safejoin(bigt, "") end))
+--> =killed
@@ -85,3 +85,10 @@ print(pcall(double, {}))
 -- No argument defaults to the zero value
 print(double())
 --> =0
+
+-- Lua tables can be converted to Go slices and maps
+print(sum({1, 2, 3}), lookup({x=1, y=2}, "y"))
+--> =6	2
+
+print(pcall(sum, {1, "x"}))
+--> ~false	.*slice item 2:
@@ -2,6 +2,7 @@ package golib_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/arnodel/golua/lib"
@@ -44,6 +45,30 @@ func setup(r *rt.Runtime) func() {
 	r.SetEnv(g, "sprintf", golib.NewGoValue(r, fmt.Sprintf))
 	r.SetEnv(g, "twice", golib.NewGoValue(r, twice))
 	r.SetEnv(g, "panic", golib.NewGoValue(r, func() { panic("OMG") }))
+	r.SetEnv(g, "sum", golib.NewGoValue(r, func(xs []int) (s int) {
+		for _, x := range xs {
+			s += x
+		}
+		return
+	}))
+	r.SetEnv(g, "lookup", golib.NewGoValue(r, func(m map[string]int, k string) int { return m[k] }))
+	r.SetEnv(g, "safeupper", golib.NewGoValue(r, &golib.Func{
+		Fn:    strings.ToUpper,
+		Flags: rt.ComplyCpuSafe | rt.ComplyMemSafe | rt.ComplyTimeSafe | rt.ComplyIoSafe,
+		Cpu:   1000,
+	}))
+	r.SetEnv(g, "saferepeat", golib.NewGoValue(r, &golib.Func{
+		Fn:    strings.Repeat,
+		Flags: rt.ComplyCpuSafe | rt.ComplyMemSafe | rt.ComplyTimeSafe | rt.ComplyIoSafe,
+	}))
+	r.SetEnv(g, "safejoin", golib.NewGoValue(r, &golib.Func{
+		Fn:    strings.Join,
+		Flags: rt.ComplyCpuSafe | rt.ComplyMemSafe | rt.ComplyTimeSafe | rt.ComplyIoSafe,
+	}))
+	r.SetEnv(g, "cpusafeupper", golib.NewGoValue(r, &golib.Func{
+		Fn:    strings.ToUpper,
+		Flags: rt.ComplyCpuSafe,
+	}))
 	return cleanup
 }
 
@@ -0,0 +1,49 @@
+package golib
+
+import (
+	"sync"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+var (
+	staticPackagesMux sync.RWMutex
+	staticPackages    = map[string]map[string]interface{}{}
+)
+
+// RegisterPackage makes the exports of a Go package available to Lua code via
+// golib.import(path), without building a plugin at runtime.  It is typically
+// called from init functions generated by the golua-bindgen tool, e.g.
+//
+//	//go:generate go run github.com/arnodel/golua/cmd/golua-bindgen -o bindings.go strings fmt
+//
+// Registering the same path again replaces the previous exports.
+func RegisterPackage(path string, exports map[string]interface{}) {
+	staticPackagesMux.Lock()
+	defer staticPackagesMux.Unlock()
+	staticPackages[path] = exports
+}
+
+func lookupStaticPackage(path string) (map[string]interface{}, bool) {
+	staticPackagesMux.RLock()
+	defer staticPackagesMux.RUnlock()
+	exports, ok := staticPackages[path]
+	return exports, ok
+}
+
+type pluginsAllowedKeyType struct{}
+
+var pluginsAllowedKey = rt.AsValue(pluginsAllowedKeyType{})
+
+// SetPluginsAllowed determines whether golib.import may build and load plugins
+// in runtime r for packages which have not been registered with
+// RegisterPackage.  Plugins are allowed by default (on platforms where they are
+// supported).
+func SetPluginsAllowed(r *rt.Runtime, allowed bool) {
+	r.SetRegistry(pluginsAllowedKey, rt.BoolValue(allowed))
+}
+
+func pluginsAllowed(r *rt.Runtime) bool {
+	allowed := r.Registry(pluginsAllowedKey)
+	return allowed.IsNil() || rt.Truth(allowed)
+}
@@ -0,0 +1,42 @@
+package golib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/arnodel/golua/lib"
+	"github.com/arnodel/golua/lib/golib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func init() {
+	golib.RegisterPackage("example.com/static", map[string]interface{}{
+		"ToUpper": strings.ToUpper,
+		"Builder": func(x strings.Builder) strings.Builder { return x },
+	})
+}
+
+func TestStaticImport(t *testing.T) {
+	out := new(bytes.Buffer)
+	r := rt.New(out)
+	defer lib.LoadAll(r)()
+	golib.SetPluginsAllowed(r, false)
+
+	source := `
+local static = golib.import("example.com/static")
+print(static.ToUpper("hello"))
+print(pcall(golib.import, "example.com/not/registered"))`
+	clos, err := r.CompileAndLoadLuaChunk("test", []byte(source), rt.TableValue(r.GlobalEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rt.Call1(r.MainThread(), rt.FunctionValue(clos))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "HELLO\nfalse\ttest:4: cannot import go package example.com/not/registered: no static bindings and plugins not allowed\n"
+	if got := out.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -93,3 +93,16 @@ func (u linebufWriter) Write(p []byte) (n int, err error) {
 	}
 	return n, err
 }
+
+// errStream is an io.Reader and io.Writer that always fails.
+type errStream struct {
+	err error
+}
+
+func (s errStream) Read(p []byte) (int, error) {
+	return 0, s.err
+}
+
+func (s errStream) Write(p []byte) (int, error) {
+	return 0, s.err
+}
@@ -23,16 +23,26 @@ const (
 	tempFile
 )
 
+// Options that can be passed to NewFile.
+const (
+	BufferedRead  = bufferedRead  // Buffer reads from the file
+	BufferedWrite = bufferedWrite // Buffer writes to the file
+	NotClosable   = notClosable   // The file cannot be closed from Lua
+)
+
 var (
 	errCloseStandardFile = errors.New("cannot close standard file")
 	errFileAlreadyClosed = errors.New("file already closed")
 	errInvalidBufferMode = errors.New("invalid buffer mode")
 	errInvalidBufferSize = errors.New("invalid buffer size")
+	errFileNotReadable   = errors.New("file not readable")
+	errFileNotWritable   = errors.New("file not writable")
 )
 
 // A File wraps an os.File for manipulation by iolib.
 type File struct {
 	file   *os.File
+	out    io.Writer // Where the writer writes to if file is nil
 	name   string
 	close func(*rt.Thread, *rt.GoCont) (rt.Cont, error)
 	status fileStatus
@@ -73,6 +83,34 @@ func NewFile(file *os.File, options int) *File {
 	return f
 }
 
+// newStdFile returns a *File for a standard stream.  If the stream is a process
+// standard file it is handled like any other file, otherwise in is read from
+// (if non-nil), out is written to (if non-nil) and the file is not buffered.
+func newStdFile(name string, in io.Reader, out io.Writer, options int) *File {
+	if f, ok := in.(*os.File); ok {
+		return NewFile(f, options)
+	}
+	if f, ok := out.(*os.File); ok {
+		return NewFile(f, options)
+	}
+	if in == nil {
+		in = errStream{errFileNotReadable}
+	}
+	if out == nil {
+		out = errStream{errFileNotWritable}
+	}
+	f := &File{
+		name:   name,
+		out:    out,
+		reader: bufio.NewReader(in),
+		writer: &nobufWriter{out},
+	}
+	if options&notClosable != 0 {
+		f.status |= statusNotClosable
+	}
+	return f
+}
+
 // OpenFile opens a file with the given name in the given lua mode.
 func OpenFile(r *rt.Runtime, name, mode string) (*File, error) {
 	var flag, options int
@@ -128,10 +166,11 @@ func FileArg(c *rt.GoCont, n int) (*File, error) {
 // ValueToFile turns a lua value to a *File if possible.
 func ValueToFile(v rt.Value) (*File, bool) {
 	u, ok := v.TryUserData()
-	if ok {
-		return u.Value().(*File), true
+	if !ok {
+		return nil, false
 	}
-	return nil, false
+	f, ok := u.Value().(*File)
+	return f, ok
 }
 
 // IsClosed returns true if the file is closed.
@@ -154,7 +193,7 @@ func (f *File) Close() error {
 		// Lua doesn't return a Lua error, so wrap this in a PathError
 		return &fs.PathError{
 			Op:   "close",
-			Path: f.file.Name(),
+			Path: f.name,
 			Err:  errCloseStandardFile,
 		}
 	}
@@ -309,19 +348,23 @@ func (f *File) SetWriteBuffer(mode string, size int) error {
 		return errInvalidBufferSize
 	}
 	f.Flush()
+	var out io.Writer = f.file
+	if f.file == nil {
+		out = f.out
+	}
 	switch mode {
 	case "no":
-		f.writer = &nobufWriter{f.file}
+		f.writer = &nobufWriter{out}
 	case "full":
 		if size == 0 {
 			size = 65536
 		}
-		f.writer = bufio.NewWriterSize(f.file, size)
+		f.writer = bufio.NewWriterSize(out, size)
 	case "line":
 		if size == 0 {
 			size = 65536
 		}
-		f.writer = linebufWriter{bufio.NewWriterSize(f.file, size)}
+		f.writer = linebufWriter{bufio.NewWriterSize(out, size)}
 		// TODO
 	default:
 		return errInvalidBufferMode
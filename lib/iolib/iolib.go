@@ -6,17 +6,12 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"runtime"
-	"syscall"
 
 	"github.com/arnodel/golua/lib/packagelib"
 	rt "github.com/arnodel/golua/runtime"
+	"github.com/arnodel/golua/safeio"
 )
 
-// BufferedStdFiles sets wether std files should be buffered
-var BufferedStdFiles bool = true
-
 type ioKeyType struct{}
 
 var ioKey = rt.AsValue(ioKeyType{})
@@ -61,17 +56,20 @@ func load(r *rt.Runtime) (rt.Value, func()) {
 		stderrOpts = statusNotClosable
 		stdinOpts  = statusNotClosable
 	)
-	if BufferedStdFiles {
+	if r.BufferedStdFiles() {
 		stdoutOpts |= bufferedWrite
 		stdinOpts |= bufferedRead
 	}
 
-	stdinFile := NewFile(os.Stdin, stdinOpts)
-	stdoutFile := NewFile(os.Stdout, stdoutOpts)
-	stderrFile := NewFile(os.Stderr, stderrOpts)
+	stdinFile := newStdFile("stdin", r.Stdin(), nil, stdinOpts)
+	stderrFile := newStdFile("stderr", nil, r.Stderr(), stderrOpts)
+	var stdoutFile *File
 	// This is not a good pattern - it has to do for now.
 	if r.Stdout == nil {
+		stdoutFile = NewFile(os.Stdout, stdoutOpts)
 		r.Stdout = stdoutFile.writer
+	} else {
+		stdoutFile = newStdFile("stdout", nil, r.Stdout, stdoutOpts)
 	}
 	stdin := r.NewUserDataValue(stdinFile, meta)
 	stdout := r.NewUserDataValue(stdoutFile, meta)
@@ -128,6 +126,13 @@ func getIoData(r *rt.Runtime) *ioData {
 	return r.Registry(ioKey).Interface().(*ioData)
 }
 
+// NewFileValue returns a Lua value for f with the file metatable of the io
+// library, so that it can be manipulated from Lua like any other file.  The io
+// library must have been loaded into r.
+func NewFileValue(r *rt.Runtime, f *File) rt.Value {
+	return r.NewUserDataValue(f, getIoData(r).metatable)
+}
+
 func (d *ioData) defaultOutputFile() *File {
 	return d.defaultOutput.Value().(*File)
 }
@@ -159,7 +164,7 @@ func ioclose(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 
 	var cont rt.Cont
 	var err error
-	if f.file == nil {
+	if f.close != nil {
 		cont, err = f.close(t, c)
 	} else {
 		cont, err = pushingNextIoResult(t.Runtime, c, f.Close())
@@ -390,17 +395,7 @@ func popen(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 		}
 	}
 
-	var cmdArgs []string
-	if runtime.GOOS == "windows" {
-		cmdArgs = []string{"C:\\Windows\\system32\\cmd.exe", "/c", cmdStr}
-	} else {
-		cmdArgs = []string{"/bin/sh", "-c", cmdStr}
-	}
-
-	cmd := exec.Cmd{
-		Path: cmdArgs[0],
-		Args: cmdArgs,
-	}
+	cmd := safeio.ShellCommand(cmdStr)
 
 	outDummy, inDummy, err := os.Pipe()
 	if err != nil {
@@ -448,27 +443,13 @@ func popen(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 		cont := c.Next()
 
 		cmd.Wait()
-		ps := cmd.ProcessState
-		if ps.Success() {
+		ok, how, code := safeio.ExitStatus(cmd.ProcessState)
+		if ok {
 			t.Runtime.Push(cont, rt.BoolValue(true))
 		} else {
 			t.Runtime.Push(cont, rt.NilValue)
 		}
-
-		exit := rt.StringValue("exit")
-		code := rt.IntValue(int64(ps.ExitCode()))
-		if !ps.Exited() {
-			// received signal instead of normal exit
-			exit = rt.StringValue("signal")
-			if runtime.GOOS != "windows" {
-				// i can't find out what Sys() is on windows ...
-				ws := ps.Sys().(syscall.WaitStatus)
-				sig := ws.Signal()
-				code = rt.IntValue(int64(sig)) // syscall.Signal
-			}
-		}
-
-		t.Runtime.Push(cont, exit, code)
+		t.Runtime.Push(cont, rt.StringValue(how), rt.IntValue(code))
 
 		return c.Next(), nil
 	}
@@ -477,7 +458,7 @@ func popen(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 		return pushingNextIoResult(t.Runtime, c, err)
 	}
 
-	err = cmd.Start()
+	err = safeio.StartCommand(t.Runtime, cmd)
 	if err != nil {
 		return nil, err
 	}
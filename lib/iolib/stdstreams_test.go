@@ -0,0 +1,58 @@
+package iolib_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arnodel/golua/lib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func TestRuntimeStdStreams(t *testing.T) {
+	var (
+		stdout = new(bytes.Buffer)
+		stderr = new(bytes.Buffer)
+		dir    = t.TempDir()
+	)
+	if err := os.WriteFile(filepath.Join(dir, "data.txt"), []byte("in the dir\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	r := rt.New(
+		stdout,
+		rt.WithStdin(strings.NewReader("line 1\nline 2\n")),
+		rt.WithStderr(stderr),
+		rt.WithEnv([]string{"GREETING=hello"}),
+		rt.WithWorkingDir(dir),
+	)
+	cleanup := lib.LoadAll(r)
+	defer cleanup()
+
+	source := `
+print(io.read())
+io.write(io.read(), "\n")
+print(io.read())
+io.stderr:write("oops\n")
+print(os.getenv("GREETING"), os.getenv("HOME"))
+print(io.open("data.txt"):read("l"))
+print(pcall(io.stdout.read, io.stdout))
+os.exit(false)
+`
+	clos, err := r.CompileAndLoadLuaChunk("test", []byte(source), rt.TableValue(r.GlobalEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rt.Call(r.MainThread(), rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false))
+	if exitErr, ok := err.(*rt.ExitError); !ok || exitErr.Code != 1 {
+		t.Errorf("expected exit with code 1, got %v", err)
+	}
+	wantOut := "line 1\nline 2\n\nhello\tnil\nin the dir\nfalse\ttest:8: file not readable\n"
+	if got := stdout.String(); got != wantOut {
+		t.Errorf("stdout: expected %q, got %q", wantOut, got)
+	}
+	if got := stderr.String(); got != "oops\n" {
+		t.Errorf("stderr: expected %q, got %q", "oops\n", got)
+	}
+}
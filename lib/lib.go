@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"github.com/arnodel/golua/lib/asynclib"
 	"github.com/arnodel/golua/lib/base"
 	"github.com/arnodel/golua/lib/coroutine"
 	"github.com/arnodel/golua/lib/debuglib"
@@ -9,6 +10,7 @@ import (
 	"github.com/arnodel/golua/lib/mathlib"
 	"github.com/arnodel/golua/lib/oslib"
 	"github.com/arnodel/golua/lib/packagelib"
+	"github.com/arnodel/golua/lib/processlib"
 	"github.com/arnodel/golua/lib/runtimelib"
 	"github.com/arnodel/golua/lib/stringlib"
 	"github.com/arnodel/golua/lib/tablelib"
@@ -43,8 +45,10 @@ func LoadAll(r *rt.Runtime) func() {
 		iolib.LibLoader,
 		utf8lib.LibLoader,
 		oslib.LibLoader,
+		processlib.LibLoader,
 		debuglib.LibLoader,
 		golib.LibLoader,
 		runtimelib.LibLoader,
+		asynclib.LibLoader,
 	)
 }
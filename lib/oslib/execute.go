@@ -0,0 +1,48 @@
+package oslib
+
+import (
+	"os/exec"
+
+	rt "github.com/arnodel/golua/runtime"
+	"github.com/arnodel/golua/safeio"
+)
+
+func execute(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if c.NArgs() == 0 || c.Arg(0).IsNil() {
+		return c.PushingNext1(t.Runtime, rt.BoolValue(safeio.ShellAvailable(t.Runtime))), nil
+	}
+	cmdStr, err := c.StringArg(0)
+	if err != nil {
+		return nil, err
+	}
+	cmd := safeio.ShellCommand(cmdStr)
+	cmd.Stdin = t.Stdin()
+	cmd.Stdout = t.Stdout
+	cmd.Stderr = t.Stderr()
+	next := c.Next()
+	if err := safeio.StartCommand(t.Runtime, cmd); err != nil {
+		return pushCommandError(t.Runtime, next, err)
+	}
+	if err := cmd.Wait(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return pushCommandError(t.Runtime, next, err)
+		}
+	}
+	ok, how, code := safeio.ExitStatus(cmd.ProcessState)
+	if ok {
+		t.Push1(next, rt.BoolValue(true))
+	} else {
+		t.Push1(next, rt.NilValue)
+	}
+	t.Push(next, rt.StringValue(how), rt.IntValue(code))
+	return next, nil
+}
+
+// Like the C implementation, report failure to run the command as a normal
+// return value rather than an error.
+func pushCommandError(r *rt.Runtime, next rt.Cont, err error) (rt.Cont, error) {
+	msg := err.Error()
+	r.RequireBytes(len(msg))
+	r.Push(next, rt.NilValue, rt.StringValue(msg))
+	return next, nil
+}
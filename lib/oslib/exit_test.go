@@ -0,0 +1,161 @@
+package oslib_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/arnodel/golua/lib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		name         string
+		source       string
+		wantCode     int
+		wantOut      string
+		wantCloseErr string
+	}{
+		{
+			name:     "default",
+			source:   `os.exit() print("not reached")`,
+			wantCode: 0,
+		},
+		{
+			name:     "false",
+			source:   `os.exit(false)`,
+			wantCode: 1,
+		},
+		{
+			name:     "integer",
+			source:   `os.exit(42)`,
+			wantCode: 42,
+		},
+		{
+			name:     "float with an integer value",
+			source:   `os.exit(3.0)`,
+			wantCode: 3,
+		},
+		{
+			name:     "string with an integer value",
+			source:   `os.exit("4")`,
+			wantCode: 4,
+		},
+		{
+			name: "not caught by pcall",
+			source: `
+print(pcall(os.exit, 3))
+print("not reached")`,
+			wantCode: 3,
+		},
+		{
+			name: "to-be-closed variables not closed by default",
+			source: `
+local x <close> = setmetatable({}, {__close=function() print("closed") end})
+os.exit(2)`,
+			wantCode: 2,
+		},
+		{
+			name: "to-be-closed variables closed",
+			source: `
+local x <close> = setmetatable({}, {__close=function() print("closed x") end})
+pcall(function()
+	local y <close> = setmetatable({}, {__close=function() print("closed y") end})
+	os.exit(5, true)
+end)`,
+			wantCode: 5,
+			wantOut:  "closed y\nclosed x\n",
+		},
+		{
+			name: "finalizers run when closing",
+			source: `
+local t = setmetatable({}, {__gc=function() print("finalized") end})
+os.exit(0, true)`,
+			wantOut: "finalized\n",
+		},
+		{
+			name: "error when closing",
+			source: `
+local x <close> = setmetatable({}, {__close=function() error("oops") end})
+os.exit(6, true)`,
+			wantCode:     6,
+			wantCloseErr: "oops",
+		},
+		{
+			name: "exit from coroutine",
+			source: `
+local co = coroutine.wrap(function()
+	local x <close> = setmetatable({}, {__close=function() print("closed in co") end})
+	coroutine.yield(1)
+	os.exit(7, true)
+end)
+co()
+print(coroutine.resume(coroutine.create(function() co() end)))
+print("not reached")`,
+			wantCode: 7,
+			wantOut:  "closed in co\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			r := rt.New(out)
+			defer lib.LoadAll(r)()
+			clos, err := r.CompileAndLoadLuaChunk("test", []byte(tt.source), rt.TableValue(r.GlobalEnv()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = rt.Call(r.MainThread(), rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false))
+			var exitErr *rt.ExitError
+			if !errors.As(err, &exitErr) {
+				t.Fatalf("expected an *rt.ExitError, got %v", err)
+			}
+			if exitErr.Code != tt.wantCode {
+				t.Errorf("expected exit code %d, got %d", tt.wantCode, exitErr.Code)
+			}
+			if tt.wantCloseErr == "" && exitErr.CloseErr != nil {
+				t.Errorf("unexpected close error: %s", exitErr.CloseErr)
+			} else if tt.wantCloseErr != "" && (exitErr.CloseErr == nil || !strings.Contains(exitErr.CloseErr.Error(), tt.wantCloseErr)) {
+				t.Errorf("expected close error %q, got %v", tt.wantCloseErr, exitErr.CloseErr)
+			}
+			if got := out.String(); got != tt.wantOut {
+				t.Errorf("expected output %q, got %q", tt.wantOut, got)
+			}
+		})
+	}
+}
+
+func TestExitRejectsNonIntegers(t *testing.T) {
+	r := rt.New(nil)
+	defer lib.LoadAll(r)()
+	for _, src := range []string{`os.exit(3.5)`, `os.exit({})`} {
+		clos, err := r.CompileAndLoadLuaChunk("test", []byte(src), rt.TableValue(r.GlobalEnv()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = rt.Call(r.MainThread(), rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false))
+		var exitErr *rt.ExitError
+		if err == nil || errors.As(err, &exitErr) {
+			t.Errorf("%s: expected an error, got %v", src, err)
+		}
+	}
+}
+
+func TestExitThenCall(t *testing.T) {
+	// After an exit, the runtime can still be used
+	out := new(bytes.Buffer)
+	r := rt.New(out)
+	defer lib.LoadAll(r)()
+	for _, src := range []string{`os.exit(1)`, `print("still alive")`} {
+		clos, err := r.CompileAndLoadLuaChunk("test", []byte(src), rt.TableValue(r.GlobalEnv()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = rt.Call(r.MainThread(), rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false))
+	}
+	if got := out.String(); got != "still alive\n" {
+		t.Errorf("unexpected output %q", got)
+	}
+}
@@ -0,0 +1,28 @@
+-- tags: !windows
+
+print(os.execute())
+--> =true
+
+print(os.execute("exit 0"))
+--> =true	exit	0
+
+print(os.execute("exit 12"))
+--> =nil	exit	12
+
+print(os.execute("kill -TERM $$"))
+--> =nil	signal	15
+
+os.execute("echo hello from the shell")
+--> =hello from the shell
+
+print(pcall(os.execute, {}))
+--> ~^false\t.*must be a string
+
+print(runtime.callcontext({flags="iosafe"}, os.execute))
+--> =done	false
+
+print(runtime.callcontext({flags="iosafe"}, os.execute, "true"))
+--> ~^done\tnil\t.*operation not allowed
+
+print(runtime.callcontext({flags="timesafe"}, os.execute, "true"))
+--> ~^error\t.*missing flags: timesafe
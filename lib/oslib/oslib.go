@@ -1,8 +1,8 @@
 package oslib
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/arnodel/golua/lib/packagelib"
@@ -32,6 +32,14 @@ func load(r *rt.Runtime) (rt.Value, func()) {
 		r.SetEnvGoFunc(pkg, "remove", remove, 1, false),
 		r.SetEnvGoFunc(pkg, "rename", rename, 2, false),
 	)
+
+	// Running a command blocks until it terminates so it is not time safe.
+	// Starting the command is subject to the restrictions enforced by safeio.
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(pkg, "execute", execute, 1, false),
+	)
 	// These functions are not safe - I don't know what compliance category to
 	// put them in.
 	r.SetEnvGoFunc(pkg, "setlocale", setlocale, 2, false)
@@ -110,24 +118,30 @@ func difftime(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	return c.PushingNext1(t.Runtime, rt.IntValue(t2-t1)), nil
 }
 
+// exit does not terminate the process but unwinds the runtime, so that the Go
+// code that called into it gets an *rt.ExitError.
 func exit(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	var (
 		code  = 0 // 0 for success, 1 for failure
 		close = false
 	)
 	if c.NArgs() > 0 {
-		if !rt.Truth(c.Arg(0)) {
-			code = 1
+		arg := c.Arg(0)
+		if b, ok := arg.TryBool(); ok {
+			if !b {
+				code = 1
+			}
+		} else if n, ok := rt.ToInt(arg); ok {
+			// Like C Lua, accept floats and strings with an integer value
+			code = int(n)
+		} else if !arg.IsNil() {
+			return nil, errors.New("#1 must be a boolean or an integer")
 		}
 	}
 	if c.NArgs() > 1 {
 		close = rt.Truth(c.Arg(1))
 	}
-	if close {
-		// TODO: "close" the runtime, i.e. cleanup.
-		_ = close
-	}
-	os.Exit(code)
+	t.Exit(code, close)
 	return nil, nil
 }
 
@@ -208,7 +222,7 @@ func getenv(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	if err != nil {
 		return nil, err
 	}
-	val, ok := os.LookupEnv(name)
+	val, ok := t.LookupEnv(name)
 	valV := rt.NilValue
 	if ok {
 		t.RequireBytes(len(val))
@@ -0,0 +1,49 @@
+print(pcall(package.reload))
+--> ~^false\t.*value needed
+
+print(pcall(package.reload, "notloaded"))
+--> ~^false\t.*package 'notloaded' is not loaded
+
+local version = 0
+package.preload.counter = function(name)
+    version = version + 1
+    local M = {version = version, ["v" .. version] = true}
+    if version == 1 then
+        M.count = 0
+        M.removed = true
+    end
+    function M.__reload(old, new)
+        print("reloading", old.version, new.version)
+        new.count = old.count
+    end
+    return setmetatable(M, {__tostring = function() return "counter v" .. version end})
+end
+
+local c = require "counter"
+c.count = c.count + 10
+print(c.version, c.v1, c.removed, c.count)
+--> =1	true	true	10
+
+-- The module table is updated in place.
+print(package.reload("counter") == c)
+--> =reloading	1	2
+--> =true
+
+print(c.version, c.v1, c.v2, c.removed, c.count, tostring(c))
+--> =2	nil	true	nil	10	counter v2
+
+print(require "counter" == c)
+--> =true
+
+-- Modules which are not tables are replaced.
+local n = 0
+package.preload.num = function() n = n + 1 return n end
+print(require "num", package.reload "num", require "num")
+--> =1	2	2
+
+-- Errors leave the old module in place.
+package.preload.counter = function() error("broken") end
+print(pcall(package.reload, "counter"))
+--> ~^false\t.*broken
+print(require "counter" == c, c.version)
+--> =true	2
@@ -17,3 +17,18 @@ print(package.loaded["testlib.foo"])
 
 print(require "testlib.bar") -- points at testlib/bar/init.lua
 --> =42
+
+-- Modules receive their name and file path
+require "testlib.args"
+--> =testlib.args	./testlib/args.lua
+
+-- A loader that returns nothing can set package.loaded itself
+package.preload.selfloaded = function(name)
+    package.loaded[name] = "self loaded"
+end
+print(require "selfloaded")
+--> =self loaded
+
+package.preload.noresult = function() end
+print(require "noresult")
+--> =true
@@ -62,13 +62,14 @@ func load(r *rt.Runtime) (rt.Value, func()) {
 	r.SetTable(pkg, loadedKey, rt.TableValue(rt.NewTable()))
 	r.SetTable(pkg, preloadKey, rt.TableValue(rt.NewTable()))
 	searchers := rt.NewTable()
-	r.SetTable(searchers, rt.IntValue(1), rt.FunctionValue(searchPreloadGoFunc))
-	r.SetTable(searchers, rt.IntValue(2), rt.FunctionValue(searchLuaGoFunc))
+	r.SetTable(searchers, rt.IntValue(1), PreloadSearcher)
+	r.SetTable(searchers, rt.IntValue(2), LuaSearcher)
 	r.SetTable(pkg, searchersKey, rt.TableValue(searchers))
 	r.SetTable(pkg, pathKey, rt.StringValue(defaultPath))
 	r.SetTable(pkg, configKey, rt.StringValue(defaultConfig.String()))
 
 	r.SetEnvGoFunc(pkg, "searchpath", searchpath, 4, false)
+	r.SetEnvGoFunc(pkg, "reload", reload, 1, false)
 	r.SetEnvGoFunc(env, "require", require, 1, false)
 
 	return pkgVal, nil
@@ -124,7 +125,7 @@ func require(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	if err != nil {
 		return nil, err
 	}
-	nameVal := c.Arg(0)
+	nameVal := rt.StringValue(name)
 	pkg := pkgTable(t.Runtime)
 
 	// First check is the module is already loaded
@@ -138,40 +139,54 @@ func require(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 		return next, nil
 	}
 
-	// If not, then go through the searchers
-	searchers, ok := pkg.Get(searchersKey).TryTable()
+	mod, err := loadModule(t, c, name)
+	if err != nil {
+		return nil, err
+	}
+	t.SetTable(loaded, nameVal, mod)
+	t.Push1(next, mod)
+	return next, nil
+}
+
+// loadModule goes through package.searchers to find a loader for the module
+// nameVal, then calls the loader and returns the value of the module.  If the
+// loader returned nil, that is the value of package.loaded[name] if the loader
+// set it (e.g. via the "module" function of Lua 5.1), else true.
+func loadModule(t *rt.Thread, c rt.Cont, name string) (rt.Value, error) {
+	nameVal := rt.StringValue(name)
+	searchers, ok := pkgTable(t.Runtime).Get(searchersKey).TryTable()
 	if !ok {
-		return nil, errors.New("package.searchers must be a table")
+		return rt.NilValue, errors.New("package.searchers must be a table")
 	}
 
 	for i := int64(1); ; i++ {
 		searcher := searchers.Get(rt.IntValue(i))
 		if searcher.IsNil() {
-			err = fmt.Errorf("could not find package '%s'", name)
-			break
+			return rt.NilValue, fmt.Errorf("could not find package '%s'", name)
 		}
 		res := rt.NewTerminationWith(c, 2, false)
-		if err = rt.Call(t, searcher, []rt.Value{nameVal}, res); err != nil {
-			break
+		if err := rt.Call(t, searcher, []rt.Value{nameVal}, res); err != nil {
+			return rt.NilValue, err
 		}
 		loader := res.Get(0)
 		// We got a loader, so call it
 		if _, ok := loader.TryCallable(); ok {
 			val := res.Get(1)
 			res = rt.NewTerminationWith(c, 2, false)
-			if err = rt.Call(t, loader, []rt.Value{nameVal, val}, res); err != nil {
-				break
+			if err := rt.Call(t, loader, []rt.Value{nameVal, val}, res); err != nil {
+				return rt.NilValue, err
 			}
-			mod := rt.BoolValue(true)
 			if r0 := res.Get(0); !r0.IsNil() {
-				mod = r0
+				return r0, nil
 			}
-			t.SetTable(loaded, nameVal, mod)
-			t.Push1(next, mod)
-			return next, nil
+			if loaded, ok := pkgTable(t.Runtime).Get(loadedKey).TryTable(); ok {
+				if mod := loaded.Get(nameVal); !mod.IsNil() {
+					return mod, nil
+				}
+			}
+			return rt.BoolValue(true), nil
 		}
 	}
-	return nil, err
 }
 
 func searchpath(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
@@ -199,7 +214,7 @@ func searchpath(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 		return nil, err
 	}
 	conf.dirSep = string(rep)
-	found, templates := searchPath(string(name), string(path), string(sep), &conf)
+	found, templates := searchPath(t.Runtime, string(name), string(path), string(sep), &conf)
 	next := c.Next()
 	if found != "" {
 		t.Push1(next, rt.StringValue(found))
@@ -209,12 +224,12 @@ func searchpath(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	return next, nil
 }
 
-func searchPath(name, path, dot string, conf *config) (string, []string) {
+func searchPath(r *rt.Runtime, name, path, dot string, conf *config) (string, []string) {
 	namePath := strings.Replace(name, dot, conf.dirSep, -1)
 	templates := strings.Split(path, conf.pathSep)
 	for i, template := range templates {
 		searchpath := strings.Replace(template, conf.placeholder, namePath, -1)
-		f, err := os.Open(searchpath)
+		f, err := os.Open(r.ResolvePath(searchpath))
 		f.Close()
 		if err == nil {
 			return searchpath, nil
@@ -250,7 +265,7 @@ func searchLua(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 		return nil, errors.New("package.path must be a string")
 	}
 	conf := getConfig(pkg)
-	found, templates := searchPath(string(s), string(path), ".", conf)
+	found, templates := searchPath(t.Runtime, string(s), string(path), ".", conf)
 	next := c.Next()
 	if found == "" {
 		t.Push1(next, rt.StringValue(strings.Join(templates, "\n")))
@@ -271,12 +286,15 @@ func loadLua(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	if err := c.CheckNArgs(2); err != nil {
 		return nil, err
 	}
-	// Arg 0 is the module name - dunno what to do with it.
+	name, err := c.StringArg(0)
+	if err != nil {
+		return nil, err
+	}
 	filePath, err := c.StringArg(1)
 	if err != nil {
 		return nil, err
 	}
-	src, readErr := ioutil.ReadFile(string(filePath))
+	src, readErr := ioutil.ReadFile(t.ResolvePath(string(filePath)))
 	if readErr != nil {
 		return nil, fmt.Errorf("error reading file: %s", readErr)
 	}
@@ -284,7 +302,11 @@ func loadLua(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	if compErr != nil {
 		return nil, fmt.Errorf("error compiling file: %s", compErr)
 	}
-	return rt.Continue(t, rt.FunctionValue(clos), c.Next())
+	recordModuleFile(t.Runtime, name, filePath)
+	// Like in Lua 5.4, the module receives its name and file path.
+	cont := clos.Continuation(t, c.Next())
+	t.Push(cont, c.Args()...)
+	return cont, nil
 }
 
 func pkgTable(r *rt.Runtime) *rt.Table {
@@ -0,0 +1,186 @@
+package packagelib
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+var (
+	filesKey  = rt.AsValue(filesKeyType{})
+	reloadKey = rt.StringValue("__reload")
+)
+
+type filesKeyType struct{}
+
+// A moduleFile records the file a module was loaded from with package.path, so
+// that it can be reloaded when the file changes.
+type moduleFile struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func moduleFiles(r *rt.Runtime) map[string]moduleFile {
+	files, ok := r.Registry(filesKey).Interface().(map[string]moduleFile)
+	if !ok {
+		files = map[string]moduleFile{}
+		r.SetRegistry(filesKey, rt.AsValue(files))
+	}
+	return files
+}
+
+// recordModuleFile remembers that the module name was loaded from the file at
+// path.
+func recordModuleFile(r *rt.Runtime, name, path string) {
+	info, err := os.Stat(r.ResolvePath(path))
+	if err != nil {
+		return
+	}
+	moduleFiles(r)[name] = moduleFile{path: path, modTime: info.ModTime(), size: info.Size()}
+}
+
+func reload(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	name, err := c.StringArg(0)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := reloadModule(t, c, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, mod), nil
+}
+
+// Reload loads the module name again, like package.reload(name) does in Lua
+// code, and returns its new value.
+//
+// The module must have been loaded already.  It is found again with
+// package.searchers and its loader is called.  Then, if the new value of the
+// module is a table with a __reload field, it is called with the old and new
+// values of the module so that state can be migrated from the old one to the
+// new one, e.g.
+//
+//	function M.__reload(old, new)
+//		new.players = old.players
+//	end
+//
+// Finally if both old and new values are tables, the old table is updated in
+// place to have the same contents and metatable as the new one, so that Lua
+// code holding a reference to the module sees the changes.  Otherwise the new
+// value replaces the old one in package.loaded.
+func Reload(t *rt.Thread, name string) (rt.Value, error) {
+	return reloadModule(t, t.CurrentCont(), name)
+}
+
+func reloadModule(t *rt.Thread, c rt.Cont, name string) (rt.Value, error) {
+	loaded, ok := pkgTable(t.Runtime).Get(loadedKey).TryTable()
+	if !ok {
+		return rt.NilValue, errors.New("package.loaded must be a table")
+	}
+	nameVal := rt.StringValue(name)
+	oldMod := loaded.Get(nameVal)
+	if oldMod.IsNil() {
+		return rt.NilValue, fmt.Errorf("package '%s' is not loaded", name)
+	}
+	newMod, err := loadModule(t, c, name)
+	if err != nil {
+		return rt.NilValue, err
+	}
+	newTbl, newIsTable := newMod.TryTable()
+	if newIsTable {
+		if hook := newTbl.Get(reloadKey); !hook.IsNil() {
+			if err := rt.Call(t, hook, []rt.Value{oldMod, newMod}, rt.NewTerminationWith(c, 0, false)); err != nil {
+				return rt.NilValue, err
+			}
+		}
+	}
+	if oldTbl, ok := oldMod.TryTable(); ok && newIsTable && oldTbl != newTbl {
+		updateTable(t, oldTbl, newTbl)
+		newMod = oldMod
+	}
+	t.SetTable(loaded, nameVal, newMod)
+	return newMod, nil
+}
+
+// updateTable makes the contents and metatable of dst the same as those of
+// src.
+func updateTable(t *rt.Thread, dst, src *rt.Table) {
+	var stale []rt.Value
+	for k, _, _ := dst.Next(rt.NilValue); !k.IsNil(); k, _, _ = dst.Next(k) {
+		t.RequireCPU(1)
+		if src.Get(k).IsNil() {
+			stale = append(stale, k)
+		}
+	}
+	for _, k := range stale {
+		t.SetTable(dst, k, rt.NilValue)
+	}
+	for k, v, _ := src.Next(rt.NilValue); !k.IsNil(); k, v, _ = src.Next(k) {
+		t.SetTable(dst, k, v)
+	}
+	dst.SetMetatable(src.Metatable())
+}
+
+// ChangedModules returns the sorted names of the loaded modules whose file (in
+// package.path) has changed since they were loaded.  Only modules loaded with
+// require or Reload are taken into account.
+func ChangedModules(r *rt.Runtime) []string {
+	var names []string
+	loaded, _ := pkgTable(r).Get(loadedKey).TryTable()
+	for name, file := range moduleFiles(r) {
+		if loaded == nil || loaded.Get(rt.StringValue(name)).IsNil() {
+			continue
+		}
+		info, err := os.Stat(r.ResolvePath(file.path))
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Equal(file.modTime) || info.Size() != file.size {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReloadChanged reloads the modules returned by ChangedModules.  It returns the
+// names of the modules that were reloaded successfully and the first error
+// that occurred, if any (modules that failed to reload will be tried again on
+// the next call).  A runtime must only be used from one goroutine, so a
+// program can watch modules by calling ReloadChanged periodically from the
+// goroutine which uses the runtime, e.g.
+//
+//	ticker := time.NewTicker(time.Second)
+//	for {
+//		select {
+//		case <-ticker.C:
+//			if _, err := packagelib.ReloadChanged(r.MainThread()); err != nil {
+//				log.Print(err)
+//			}
+//		case ...
+//		}
+//	}
+func ReloadChanged(t *rt.Thread) ([]string, error) {
+	var (
+		reloaded []string
+		firstErr error
+	)
+	for _, name := range ChangedModules(t.Runtime) {
+		if _, err := Reload(t, name); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error reloading '%s': %w", name, err)
+			}
+			continue
+		}
+		reloaded = append(reloaded, name)
+	}
+	return reloaded, firstErr
+}
@@ -0,0 +1,76 @@
+package packagelib_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arnodel/golua/lib"
+	"github.com/arnodel/golua/lib/packagelib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func TestReloadChanged(t *testing.T) {
+	dir := t.TempDir()
+	writeModule := func(name, src string, age time.Duration) {
+		t.Helper()
+		path := filepath.Join(dir, name+".lua")
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeModule("game", `return {greet = function() return "hello" end}`, time.Hour)
+	writeModule("other", `return {}`, time.Hour)
+
+	var out bytes.Buffer
+	r := rt.New(&out)
+	defer lib.LoadAll(r)()
+	pkg := r.GlobalEnv().Get(rt.StringValue("package")).AsTable()
+	r.SetTable(pkg, rt.StringValue("path"), rt.StringValue(filepath.Join(dir, "?.lua")))
+
+	if err := runLua(t, r, `game = require "game" require "other" print(game.greet())`); err != nil {
+		t.Fatal(err)
+	}
+	if changed := packagelib.ChangedModules(r); len(changed) != 0 {
+		t.Errorf("unexpected changed modules: %v", changed)
+	}
+
+	writeModule("game", `return {greet = function() return "bonjour" end}`, 0)
+	if changed := packagelib.ChangedModules(r); !reflect.DeepEqual(changed, []string{"game"}) {
+		t.Errorf("unexpected changed modules: %v", changed)
+	}
+	reloaded, err := packagelib.ReloadChanged(r.MainThread())
+	if err != nil || !reflect.DeepEqual(reloaded, []string{"game"}) {
+		t.Errorf("got %v, %v", reloaded, err)
+	}
+	if changed := packagelib.ChangedModules(r); len(changed) != 0 {
+		t.Errorf("unexpected changed modules: %v", changed)
+	}
+	out.Reset()
+	if err := runLua(t, r, `print(game.greet())`); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "bonjour\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	// A module that fails to reload is tried again.
+	writeModule("other", `return +`, 0)
+	reloaded, err = packagelib.ReloadChanged(r.MainThread())
+	if len(reloaded) != 0 || err == nil || !strings.Contains(err.Error(), "error reloading 'other'") {
+		t.Errorf("got %v, %v", reloaded, err)
+	}
+	writeModule("other", `return {fixed = true}`, time.Minute)
+	reloaded, err = packagelib.ReloadChanged(r.MainThread())
+	if err != nil || !reflect.DeepEqual(reloaded, []string{"other"}) {
+		t.Errorf("got %v, %v", reloaded, err)
+	}
+}
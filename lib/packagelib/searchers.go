@@ -0,0 +1,190 @@
+package packagelib
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/arnodel/golua/code"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// A Module is Lua code found by a Searcher.
+type Module struct {
+	// Name of the chunk, used in error messages and tracebacks (e.g. the path
+	// of the file the module was read from).  Like the file name of modules
+	// found with package.path, it is passed to the module as second argument
+	// (the first one being the module name).
+	Name string
+
+	// Lua source code or binary chunk of the module, used if Unit is nil.
+	Source []byte
+
+	// Compiled code of the module.
+	Unit *code.Unit
+}
+
+// A Searcher looks for modules on behalf of require.  Searchers can be added to
+// package.searchers with AddSearcher or SetSearchers.
+type Searcher interface {
+	// Search returns the module with the given name.  If the module is not
+	// found, it returns nil and a message describing where it looked for it.
+	Search(t *rt.Thread, name string) (mod *Module, notFound string, err error)
+}
+
+// SearcherFunc turns a function into a Searcher.
+type SearcherFunc func(t *rt.Thread, name string) (*Module, string, error)
+
+var _ Searcher = SearcherFunc(nil)
+
+// Search calls f.
+func (f SearcherFunc) Search(t *rt.Thread, name string) (*Module, string, error) {
+	return f(t, name)
+}
+
+// The default searchers, which package.searchers contains in this order when
+// the package library is loaded.
+var (
+	// PreloadSearcher looks for a loader in package.preload.
+	PreloadSearcher = rt.FunctionValue(searchPreloadGoFunc)
+
+	// LuaSearcher looks for a Lua file using package.path.
+	LuaSearcher = rt.FunctionValue(searchLuaGoFunc)
+)
+
+// NewSearcher returns a Lua function which can be added to package.searchers.
+// It uses s to find modules.
+func NewSearcher(s Searcher) rt.Value {
+	search := func(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+		if err := c.Check1Arg(); err != nil {
+			return nil, err
+		}
+		name, err := c.StringArg(0)
+		if err != nil {
+			return nil, err
+		}
+		mod, notFound, err := s.Search(t, name)
+		if err != nil {
+			return nil, err
+		}
+		if mod == nil {
+			return c.PushingNext1(t.Runtime, rt.StringValue(notFound)), nil
+		}
+		return c.PushingNext(t.Runtime, rt.FunctionValue(moduleLoader(mod)), rt.StringValue(mod.Name)), nil
+	}
+	return rt.FunctionValue(rt.NewGoFunction(search, "searcher", 1, false))
+}
+
+// moduleLoader returns the loader function for mod that require calls.
+func moduleLoader(mod *Module) *rt.GoFunction {
+	load := func(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+		var clos *rt.Closure
+		env := rt.TableValue(t.GlobalEnv())
+		if mod.Unit != nil {
+			clos = t.LoadLuaUnit(mod.Unit, env)
+		} else {
+			var err error
+			clos, err = t.LoadFromSourceOrCode(mod.Name, mod.Source, "bt", env, true)
+			if err != nil {
+				return nil, fmt.Errorf("error loading module: %s", err)
+			}
+		}
+		cont := clos.Continuation(t, c.Next())
+		t.Push(cont, c.Args()...)
+		return cont, nil
+	}
+	return rt.NewGoFunction(load, "loader", 2, false)
+}
+
+// AddSearcher adds s to the end of package.searchers, so that it is used by
+// require when the other searchers did not find a module.
+func AddSearcher(r *rt.Runtime, s Searcher) error {
+	searchers, err := searchersTable(r)
+	if err != nil {
+		return err
+	}
+	r.SetTable(searchers, rt.IntValue(searchers.Len()+1), NewSearcher(s))
+	return nil
+}
+
+// SetSearchers replaces the contents of package.searchers with the given
+// searchers, in that order.  They can be PreloadSearcher, LuaSearcher, values
+// returned by NewSearcher or any Lua function implementing a searcher.
+func SetSearchers(r *rt.Runtime, searchers ...rt.Value) error {
+	tbl, err := searchersTable(r)
+	if err != nil {
+		return err
+	}
+	n := tbl.Len()
+	for i, s := range searchers {
+		r.SetTable(tbl, rt.IntValue(int64(i+1)), s)
+	}
+	for i := int64(len(searchers)) + 1; i <= n; i++ {
+		r.SetTable(tbl, rt.IntValue(i), rt.NilValue)
+	}
+	return nil
+}
+
+func searchersTable(r *rt.Runtime) (*rt.Table, error) {
+	pkg, ok := r.Registry(pkgKey).TryTable()
+	if !ok {
+		return nil, errors.New("package library not loaded")
+	}
+	searchers, ok := pkg.Get(searchersKey).TryTable()
+	if !ok {
+		return nil, errors.New("package.searchers must be a table")
+	}
+	return searchers, nil
+}
+
+// FSSearcher returns a Searcher which finds modules in fsys (e.g. an embed.FS).
+// The path is a list of templates separated by semicolons, where "?" stands for
+// the module name with dots replaced by slashes (like package.path), e.g.
+// "lua/?.lua;lua/?/init.lua".  The name of the chunk of a module is its path in
+// fsys, prefixed with prefix (which could be e.g. "embed:").
+func FSSearcher(fsys fs.FS, path string, prefix string) Searcher {
+	return SearcherFunc(func(t *rt.Thread, name string) (*Module, string, error) {
+		namePath := strings.Replace(name, ".", "/", -1)
+		var tried []string
+		for _, template := range strings.Split(path, ";") {
+			filePath := strings.Replace(template, "?", namePath, -1)
+			src, err := fs.ReadFile(fsys, filePath)
+			if err == nil {
+				t.RequireBytes(len(src))
+				return &Module{Name: prefix + filePath, Source: src}, "", nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrInvalid) {
+				return nil, "", fmt.Errorf("error reading %s%s: %s", prefix, filePath, err)
+			}
+			tried = append(tried, "no file '"+prefix+filePath+"'")
+		}
+		return nil, strings.Join(tried, "\n"), nil
+	})
+}
+
+// MapSearcher returns a Searcher which finds the Lua source code of modules in
+// a map from module names to source code.  The name of the chunk of a module is
+// its name.
+func MapSearcher(sources map[string]string) Searcher {
+	return SearcherFunc(func(t *rt.Thread, name string) (*Module, string, error) {
+		src, ok := sources[name]
+		if !ok {
+			return nil, fmt.Sprintf("no source for module '%s'", name), nil
+		}
+		return &Module{Name: name, Source: []byte(src)}, "", nil
+	})
+}
+
+// UnitSearcher returns a Searcher which finds the compiled code of modules in a
+// map from module names to units (e.g. obtained with Runtime.CompileLuaChunk).
+// The name of the chunk of a module is the source of its unit.
+func UnitSearcher(units map[string]*code.Unit) Searcher {
+	return SearcherFunc(func(t *rt.Thread, name string) (*Module, string, error) {
+		unit, ok := units[name]
+		if !ok {
+			return nil, fmt.Sprintf("no compiled unit for module '%s'", name), nil
+		}
+		return &Module{Name: unit.Source, Unit: unit}, "", nil
+	})
+}
@@ -0,0 +1,111 @@
+package packagelib_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/arnodel/golua/code"
+	"github.com/arnodel/golua/lib"
+	"github.com/arnodel/golua/lib/packagelib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func runLua(t *testing.T, r *rt.Runtime, source string) error {
+	t.Helper()
+	clos, err := r.CompileAndLoadLuaChunk("test", []byte(source), rt.TableValue(r.GlobalEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt.Call(r.MainThread(), rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false))
+}
+
+func TestSearchers(t *testing.T) {
+	var out bytes.Buffer
+	r := rt.New(&out)
+	defer lib.LoadAll(r)()
+
+	fsys := fstest.MapFS{
+		"lua/foo.lua":         {Data: []byte(`print("foo", ...) return {name = "foo"}`)},
+		"lua/bar/init.lua":    {Data: []byte(`return {fail = function() error("bar failed") end}`)},
+		"lua/baz/qux.lua":     {Data: []byte(`return "qux"`)},
+		"lua/broken.lua":      {Data: []byte(`return +`)},
+		"other/shadowed.lua":  {Data: []byte(`return "from fs"`)},
+		"lua/tracebacked.lua": {Data: []byte("return function()\n  local tb = debug.traceback('tb')\n  return tb\nend")},
+	}
+	unit, _, err := r.CompileLuaChunk("units/compiled.lua", []byte(`return "compiled"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	searchers := []packagelib.Searcher{
+		packagelib.FSSearcher(fsys, "lua/?.lua;lua/?/init.lua", "embed:"),
+		packagelib.MapSearcher(map[string]string{"shadowed": `return "from map"`, "mapped": `error("in map")`}),
+		packagelib.UnitSearcher(map[string]*code.Unit{"compiled": unit}),
+	}
+	for _, s := range searchers {
+		if err := packagelib.AddSearcher(r, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		src string
+		out string
+		err string
+	}{
+		{src: `print(require("foo").name, require("foo").name)`, out: "foo\tfoo\tembed:lua/foo.lua\nfoo\tfoo\n"},
+		{src: `print(pcall(require("bar").fail))`, out: "false\tembed:lua/bar/init.lua:1: bar failed\n"},
+		{src: `print(require("baz.qux"))`, out: "qux\n"},
+		{src: `print(require("shadowed"))`, out: "from map\n"},
+		{src: `print(require("compiled"))`, out: "compiled\n"},
+		{src: `print(require("tracebacked")())`, out: "tb\nin function <lua function> (file embed:lua/tracebacked.lua:2)\nin function <main chunk> (file test:1)\n"},
+		{src: `require("mapped")`, err: "mapped:1:1: in map"},
+		{src: `require("broken")`, err: "embed:lua/broken.lua:1"},
+		{src: `require("missing")`, err: "could not find package 'missing'"},
+	}
+	for _, test := range tests {
+		out.Reset()
+		err := runLua(t, r, test.src)
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.src, test.err, err)
+			}
+		case err != nil:
+			t.Errorf("%s: unexpected error %s", test.src, err)
+		case out.String() != test.out:
+			t.Errorf("%s: got output %q, want %q", test.src, out.String(), test.out)
+		}
+	}
+
+	// The order of searchers can be changed.
+	err = packagelib.SetSearchers(r,
+		packagelib.NewSearcher(packagelib.FSSearcher(fsys, "other/?.lua", "")),
+		packagelib.NewSearcher(searchers[1]),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := runLua(t, r, `print(require("shadowed"), #package.searchers)`); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "from map\t2\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	out.Reset()
+	if err := runLua(t, r, `package.loaded.shadowed = nil print(require("shadowed"))`); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "from fs\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestSearchersWithoutPackageLib(t *testing.T) {
+	r := rt.New(nil)
+	if err := packagelib.AddSearcher(r, packagelib.MapSearcher(nil)); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package processlib_test
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/arnodel/golua/lib"
+	rt "github.com/arnodel/golua/runtime"
+	"github.com/arnodel/golua/safeio"
+)
+
+func TestCommandFilter(t *testing.T) {
+	out := new(bytes.Buffer)
+	r := rt.New(out)
+	defer lib.LoadAll(r)()
+
+	safeio.SetCommandFilter(r, func(r *rt.Runtime, cmd *exec.Cmd) error {
+		switch filepath.Base(cmd.Args[0]) {
+		case "rm":
+			return errors.New("rm is not allowed")
+		case "echo":
+			cmd.Args = append(cmd.Args, "(filtered)")
+		}
+		return nil
+	})
+
+	source := `
+print(process.spawn({"rm", "-rf", "/tmp/nothing"}))
+local p = process.spawn({"echo", "hello"}, {stdout="pipe"})
+p:wait()
+print(p.stdout:read("l"))
+`
+	clos, err := r.CompileAndLoadLuaChunk("test", []byte(source), rt.TableValue(r.GlobalEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rt.Call(r.MainThread(), rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false)); err != nil {
+		t.Fatal(err)
+	}
+	want := "nil\trm is not allowed\nhello (filtered)\n"
+	if got := out.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
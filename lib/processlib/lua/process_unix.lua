@@ -0,0 +1,98 @@
+-- tags: !windows
+
+do
+    print(pcall(process.spawn))
+    --> ~^false\t.*value needed
+
+    print(pcall(process.spawn, {}))
+    --> ~^false\t.*must contain at least one string
+
+    print(pcall(process.spawn, {"echo"}, {stdout="foo"}))
+    --> ~^false\t.*stdout must be "inherit", "null" or "pipe"
+
+    print(process.spawn({"this-command-does-not-exist"}))
+    --> ~^nil\t.*not found
+end
+
+do
+    local p = process.spawn({"echo", "hello", "world"}, {stdout="pipe"})
+    print(io.type(p.stdout), p.stdin, p.stderr)
+    --> =file	nil	nil
+
+    print(p.stdout:read("a"))
+    --> =hello world
+    --> =
+
+    print(p:wait())
+    --> =true	exit	0
+
+    -- Waiting again returns the same status
+    print(p:wait())
+    --> =true	exit	0
+end
+
+do
+    local p = process.spawn({"sh", "-c", "exit 3"})
+    print(p:wait())
+    --> =nil	exit	3
+end
+
+do
+    local p = process.spawn({"cat"}, {stdin="pipe", stdout="pipe"})
+    p.stdin:write("foo\n", 42)
+    -- wait closes stdin so cat terminates
+    print(p:wait())
+    --> =true	exit	0
+
+    print(p.stdout:read("a"))
+    --> =foo
+    --> =42
+end
+
+do
+    local p = process.spawn({"sh", "-c", "pwd; echo $FOO"}, {
+        cwd="/",
+        env={FOO="bar"},
+        stdout="pipe",
+    })
+    print(p:wait())
+    --> =true	exit	0
+
+    print(p.stdout:read("a"))
+    --> =/
+    --> =bar
+    --> =
+end
+
+do
+    local p = process.spawn({"sleep", "10"})
+    print(type(p.pid), tostring(p):match("^process %(%d+%)$") ~= nil)
+    --> =number	true
+
+    print(pcall(p.kill, p, "WAT"))
+    --> ~^false\t.*unknown signal
+
+    print(p:kill("TERM"))
+    --> =true
+
+    print(p:wait())
+    --> =nil	signal	15
+
+    print(p:kill())
+    --> ~^nil\t.*process already finished
+end
+
+do
+    local p = process.spawn({"sleep", "10"}, {timeout=0.05})
+    print(p:wait())
+    --> =nil	signal	9
+end
+
+do
+    print(runtime.callcontext({flags="iosafe"}, process.spawn, {"echo"}))
+    --> ~^done\tnil\t.*operation not allowed
+
+    local p = process.spawn({"true"})
+    print(runtime.callcontext({flags="timesafe"}, p.wait, p))
+    --> ~^error\t.*missing flags: timesafe
+end
@@ -0,0 +1,436 @@
+// Package processlib implements the "process" library, which allows Lua code
+// to spawn and control subprocesses without going through a shell.
+//
+// All subprocesses are started via safeio.StartCommand, so they are subject to
+// the runtime's command filter (see safeio.SetCommandFilter) and cannot be
+// started in a context that requires IO safety.
+package processlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/arnodel/golua/lib/iolib"
+	"github.com/arnodel/golua/lib/packagelib"
+	rt "github.com/arnodel/golua/runtime"
+	"github.com/arnodel/golua/safeio"
+)
+
+// LibLoader can load the process lib.  It requires the io lib to be loaded.
+var LibLoader = packagelib.Loader{
+	Load: load,
+	Name: "process",
+}
+
+type processKeyType struct{}
+
+var processKey = rt.AsValue(processKeyType{})
+
+func load(r *rt.Runtime) (rt.Value, func()) {
+	meta := rt.NewTable()
+	r.SetEnv(meta, "__name", rt.StringValue("process"))
+
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(meta, "__index", process__index, 2, false),
+		r.SetEnvGoFunc(meta, "__tostring", process__tostring, 1, false),
+	)
+	r.SetRegistry(processKey, rt.TableValue(meta))
+
+	pkg := rt.NewTable()
+	rt.SolemnlyDeclareCompliance(
+		rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+		r.SetEnvGoFunc(pkg, "spawn", spawn, 2, false),
+	)
+	return rt.TableValue(pkg), nil
+}
+
+// A Process is a subprocess started from Lua.
+type Process struct {
+	cmd    *exec.Cmd
+	cancel context.CancelFunc
+	stdin  rt.Value
+	stdout rt.Value
+	stderr rt.Value
+	waited bool
+}
+
+var _ rt.UserDataResourceReleaser = (*Process)(nil)
+
+// ReleaseResources makes sure the process is reaped and its timeout context
+// released when the process is no longer reachable from Lua.
+func (p *Process) ReleaseResources(d *rt.UserData) {
+	if !p.waited {
+		go p.cmd.Wait()
+	}
+	p.cancel()
+}
+
+func processArg(c *rt.GoCont, n int) (*Process, error) {
+	u, ok := c.Arg(n).TryUserData()
+	if ok {
+		if p, ok := u.Value().(*Process); ok {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("#%d must be a process", n+1)
+}
+
+// Values accepted for the stdin, stdout and stderr options of spawn.
+const (
+	streamInherit = "inherit"
+	streamNull    = "null"
+	streamPipe    = "pipe"
+)
+
+type spawnOptions struct {
+	dir     string
+	env     []string
+	timeout time.Duration
+	stdin   string
+	stdout  string
+	stderr  string
+}
+
+func spawn(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	argv, err := c.TableArg(0)
+	if err != nil {
+		return nil, err
+	}
+	args, err := stringSequence(t.Runtime, argv)
+	if err != nil {
+		return nil, fmt.Errorf("#1 %s", err)
+	}
+	if len(args) == 0 {
+		return nil, errors.New("#1 must contain at least one string")
+	}
+	opts := spawnOptions{
+		stdin:  streamNull,
+		stdout: streamInherit,
+		stderr: streamInherit,
+	}
+	if c.NArgs() >= 2 && !c.Arg(1).IsNil() {
+		optsTbl, err := c.TableArg(1)
+		if err != nil {
+			return nil, err
+		}
+		if err := getSpawnOptions(t.Runtime, optsTbl, &opts); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = opts.dir
+	cmd.Env = opts.env
+
+	p := &Process{cmd: cmd, cancel: cancel}
+
+	// Child ends of the pipes, which must be closed in the parent once the
+	// process has started.
+	var childFiles []*os.File
+	defer func() {
+		for _, f := range childFiles {
+			f.Close()
+		}
+	}()
+	var stdinFile, stdoutFile, stderrFile *iolib.File
+	switch opts.stdin {
+	case streamInherit:
+		cmd.Stdin = t.Stdin()
+	case streamPipe:
+		r, w, err := os.Pipe()
+		if err != nil {
+			cancel()
+			return t.ProcessIoError(c.Next(), err)
+		}
+		childFiles = append(childFiles, r)
+		cmd.Stdin = r
+		stdinFile = iolib.NewFile(w, iolib.BufferedWrite)
+	}
+	var pipeErr error
+	cmd.Stdout, stdoutFile, childFiles, pipeErr = outputStream(opts.stdout, t.Stdout, childFiles)
+	if pipeErr == nil {
+		cmd.Stderr, stderrFile, childFiles, pipeErr = outputStream(opts.stderr, t.Stderr(), childFiles)
+	}
+	if pipeErr != nil {
+		cancel()
+		return t.ProcessIoError(c.Next(), pipeErr)
+	}
+
+	if err := safeio.StartCommand(t.Runtime, cmd); err != nil {
+		cancel()
+		for _, f := range [...]*iolib.File{stdinFile, stdoutFile, stderrFile} {
+			if f != nil {
+				f.Close()
+			}
+		}
+		next := c.Next()
+		msg := err.Error()
+		t.RequireBytes(len(msg))
+		t.Push(next, rt.NilValue, rt.StringValue(msg))
+		return next, nil
+	}
+
+	p.stdin = fileValue(t.Runtime, stdinFile)
+	p.stdout = fileValue(t.Runtime, stdoutFile)
+	p.stderr = fileValue(t.Runtime, stderrFile)
+	meta := t.Registry(processKey).AsTable()
+	return c.PushingNext1(t.Runtime, t.NewUserDataValue(p, meta)), nil
+}
+
+// outputStream sets up the destination of the stdout or stderr of a process.
+// If a pipe is needed, its child end is appended to childFiles and its parent
+// end is returned as a *iolib.File.
+func outputStream(mode string, std io.Writer, childFiles []*os.File) (io.Writer, *iolib.File, []*os.File, error) {
+	switch mode {
+	case streamInherit:
+		return std, nil, childFiles, nil
+	case streamPipe:
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, nil, childFiles, err
+		}
+		return w, iolib.NewFile(r, iolib.BufferedRead), append(childFiles, w), nil
+	default:
+		return nil, nil, childFiles, nil
+	}
+}
+
+func fileValue(r *rt.Runtime, f *iolib.File) rt.Value {
+	if f == nil {
+		return rt.NilValue
+	}
+	return iolib.NewFileValue(r, f)
+}
+
+func getSpawnOptions(r *rt.Runtime, tbl *rt.Table, opts *spawnOptions) error {
+	if v := tbl.Get(rt.StringValue("cwd")); !v.IsNil() {
+		dir, ok := v.TryString()
+		if !ok {
+			return errors.New("cwd must be a string")
+		}
+		opts.dir = dir
+	}
+	if v := tbl.Get(rt.StringValue("env")); !v.IsNil() {
+		envTbl, ok := v.TryTable()
+		if !ok {
+			return errors.New("env must be a table")
+		}
+		env, err := environment(r, envTbl)
+		if err != nil {
+			return err
+		}
+		opts.env = env
+	}
+	if v := tbl.Get(rt.StringValue("timeout")); !v.IsNil() {
+		secs, ok := rt.ToFloat(v)
+		if !ok || secs <= 0 {
+			return errors.New("timeout must be a positive number")
+		}
+		opts.timeout = time.Duration(secs * float64(time.Second))
+	}
+	for _, s := range [...]struct {
+		name string
+		dest *string
+	}{
+		{"stdin", &opts.stdin},
+		{"stdout", &opts.stdout},
+		{"stderr", &opts.stderr},
+	} {
+		v := tbl.Get(rt.StringValue(s.name))
+		if v.IsNil() {
+			continue
+		}
+		mode, ok := v.TryString()
+		switch {
+		case !ok:
+			return fmt.Errorf("%s must be a string", s.name)
+		case mode != streamInherit && mode != streamNull && mode != streamPipe:
+			return fmt.Errorf(`%s must be "inherit", "null" or "pipe"`, s.name)
+		}
+		*s.dest = mode
+	}
+	return nil
+}
+
+// environment turns a table mapping names to values into a list of
+// "name=value" strings, sorted for predictability.
+func environment(r *rt.Runtime, tbl *rt.Table) ([]string, error) {
+	env := []string{}
+	var k, v rt.Value
+	for {
+		k, v, _ = tbl.Next(k)
+		if k.IsNil() {
+			break
+		}
+		name, ok := k.TryString()
+		if !ok {
+			return nil, errors.New("env keys must be strings")
+		}
+		val, ok := v.ToString()
+		if !ok {
+			return nil, fmt.Errorf("env value for %q must be a string", name)
+		}
+		r.RequireBytes(len(name) + len(val) + 1)
+		env = append(env, name+"="+val)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+// stringSequence returns the strings in the sequence part of tbl.
+func stringSequence(r *rt.Runtime, tbl *rt.Table) ([]string, error) {
+	n := tbl.Len()
+	strs := make([]string, 0, n)
+	for i := int64(1); i <= n; i++ {
+		s, ok := tbl.Get(rt.IntValue(i)).ToString()
+		if !ok {
+			return nil, fmt.Errorf("item %d must be a string", i)
+		}
+		r.RequireBytes(len(s))
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+func process__index(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	p, err := processArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.StringArg(1)
+	if err != nil {
+		return nil, err
+	}
+	val := rt.NilValue
+	switch key {
+	case "pid":
+		val = rt.IntValue(int64(p.cmd.Process.Pid))
+	case "stdin":
+		val = p.stdin
+	case "stdout":
+		val = p.stdout
+	case "stderr":
+		val = p.stderr
+	case "wait":
+		val = rt.FunctionValue(waitGoF)
+	case "kill":
+		val = rt.FunctionValue(killGoF)
+	}
+	return c.PushingNext1(t.Runtime, val), nil
+}
+
+func process__tostring(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	p, err := processArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	s := fmt.Sprintf("process (%d)", p.cmd.Process.Pid)
+	t.RequireBytes(len(s))
+	return c.PushingNext1(t.Runtime, rt.StringValue(s)), nil
+}
+
+// wait waits for the process to terminate and returns the same values as
+// os.execute.  The process stdin pipe, if any, is closed first so that the
+// process does not wait forever for more input.
+func wait(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	p, err := processArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	if f, ok := iolib.ValueToFile(p.stdin); ok && !f.IsClosed() {
+		f.Close()
+	}
+	if !p.waited {
+		p.waited = true
+		waitErr := p.cmd.Wait()
+		p.cancel()
+		if _, ok := waitErr.(*exec.ExitError); waitErr != nil && !ok {
+			return t.ProcessIoError(c.Next(), waitErr)
+		}
+	}
+	next := c.Next()
+	ok, how, code := safeio.ExitStatus(p.cmd.ProcessState)
+	if ok {
+		t.Push1(next, rt.BoolValue(true))
+	} else {
+		t.Push1(next, rt.NilValue)
+	}
+	t.Push(next, rt.StringValue(how), rt.IntValue(code))
+	return next, nil
+}
+
+var signalsByName = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
+// kill sends a signal to the process (by default KILL).  The signal can be
+// given by name (e.g. "TERM") or number.
+func kill(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	p, err := processArg(c, 0)
+	if err != nil {
+		return nil, err
+	}
+	sig := syscall.SIGKILL
+	if c.NArgs() >= 2 {
+		arg := c.Arg(1)
+		if n, ok := arg.TryInt(); ok {
+			sig = syscall.Signal(n)
+		} else if name, ok := arg.TryString(); ok {
+			sig, ok = signalsByName[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+			if !ok {
+				return nil, fmt.Errorf("#2 unknown signal %q", name)
+			}
+		} else {
+			return nil, errors.New("#2 must be a signal name or number")
+		}
+	}
+	var sigErr error
+	if p.waited {
+		sigErr = os.ErrProcessDone
+	} else if sig == syscall.SIGKILL {
+		sigErr = p.cmd.Process.Kill()
+	} else {
+		sigErr = p.cmd.Process.Signal(sig)
+	}
+	next := c.Next()
+	if sigErr != nil {
+		msg := sigErr.Error()
+		t.RequireBytes(len(msg))
+		t.Push(next, rt.NilValue, rt.StringValue(msg))
+	} else {
+		t.Push1(next, rt.BoolValue(true))
+	}
+	return next, nil
+}
+
+var (
+	waitGoF = rt.NewGoFunction(wait, "wait", 1, false)
+	killGoF = rt.NewGoFunction(kill, "kill", 2, false)
+)
+
+func init() {
+	// Waiting for a process blocks so it is not time safe.
+	waitGoF.SolemnlyDeclareCompliance(rt.ComplyCpuSafe | rt.ComplyMemSafe | rt.ComplyIoSafe)
+	killGoF.SolemnlyDeclareCompliance(rt.ComplyCpuSafe | rt.ComplyMemSafe | rt.ComplyTimeSafe | rt.ComplyIoSafe)
+}
@@ -97,7 +97,7 @@ func callcontext(t *rt.Thread, c *rt.GoCont) (next rt.Cont, retErr error) {
 	case rt.StatusDone:
 		t.Push(next, res.Etc()...)
 	case rt.StatusError:
-		t.Push1(next, rt.ErrorValue(err))
+		t.Push1(next, t.CatchError(err))
 	}
 	return next, nil
 }
@@ -0,0 +1,39 @@
+-- table.create is only available in Lua 5.5.
+
+local t = table.create(10)
+print(#t, next(t))
+--> =0	nil
+
+t = table.create(4, 3)
+for i = 1, 4 do t[i] = i * i end
+t.x, t.y, t.z = "x", "y", "z"
+t.w = "w"
+print(#t, t[4], t.x, t.w)
+--> =4	16	x	w
+
+t = table.create(0, 0)
+t[1] = 1
+print(#t)
+--> =1
+
+print(pcall(table.create))
+--> ~false\t.*
+
+print(pcall(table.create, -1))
+--> ~false\t.*out of range
+
+print(pcall(table.create, 1, -1))
+--> ~false\t.*out of range
+
+print(pcall(table.create, 1 << 40))
+--> ~false\t.*table overflow
+
+print(pcall(table.create, 1e9))
+--> ~false\t.*not enough memory
+
+print(pcall(table.create, 0, 1e9))
+--> ~false\t.*not enough memory
+
+-- The hash part has a power of 2 number of slots
+print(pcall(table.create, 0, (1 << 24) + 1))
+--> ~false\t.*not enough memory
@@ -287,3 +287,5 @@ do
     print(pcall(table.unpack, tt))
     --> ~false\t.* g
 end
+print(table.create)
+--> =nil
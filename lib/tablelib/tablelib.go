@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/arnodel/golua/lib/packagelib"
+	"github.com/arnodel/golua/luaversion"
 
 	rt "github.com/arnodel/golua/runtime"
 )
@@ -32,6 +33,13 @@ func load(r *rt.Runtime) (rt.Value, func()) {
 		r.SetEnvGoFunc(pkg, "sort", sortf, 2, false),
 		r.SetEnvGoFunc(pkg, "unpack", unpack, 3, false),
 	)
+	if r.LanguageVersion() >= luaversion.Lua55 {
+		rt.SolemnlyDeclareCompliance(
+			rt.ComplyCpuSafe|rt.ComplyMemSafe|rt.ComplyTimeSafe|rt.ComplyIoSafe,
+
+			r.SetEnvGoFunc(pkg, "create", create, 2, false),
+		)
+	}
 
 	return rt.TableValue(pkg), nil
 }
@@ -256,6 +264,46 @@ func move(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	return c.PushingNext1(t.Runtime, dstVal), nil
 }
 
+// Tables created by table.create cannot be bigger than that.
+const maxCreateSize = 1 << 30
+
+// The memory preallocated by table.create cannot be bigger than that, even
+// without a memory quota, so that a big size raises an error rather than
+// making the Go runtime run out of memory (which cannot be recovered from).
+const maxCreateMem = 1 << 30
+
+func create(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.Check1Arg(); err != nil {
+		return nil, err
+	}
+	nseq, err := c.IntArg(0)
+	if err != nil {
+		return nil, err
+	}
+	var nrec int64
+	if c.NArgs() >= 2 {
+		nrec, err = c.IntArg(1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case nseq < 0:
+		return nil, errors.New("#1 out of range")
+	case nrec < 0:
+		return nil, errors.New("#2 out of range")
+	case nseq > maxCreateSize || nrec > maxCreateSize:
+		return nil, errors.New("table overflow")
+	}
+	mem := rt.TableSizeMem(int(nseq), int(nrec))
+	if mem > maxCreateMem {
+		return nil, errors.New("not enough memory")
+	}
+	t.RequireMem(mem)
+	tbl := rt.NewTableSize(int(nseq), int(nrec))
+	return c.PushingNext1(t.Runtime, rt.TableValue(tbl)), nil
+}
+
 func pack(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
 	tbl := rt.NewTable()
 	// We can use t.SetTable() because tbl has no metatable
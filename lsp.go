@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/arnodel/golua/lsp"
+)
+
+// runLSP runs a Language Server Protocol server for Lua over stdin and stdout,
+// for "golua lsp".
+func runLSP() int {
+	if err := lsp.NewServer().Serve(os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "golua lsp: %s\n", err)
+		return 1
+	}
+	return 0
+}
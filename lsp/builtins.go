@@ -0,0 +1,80 @@
+package lsp
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/arnodel/golua/lib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// A builtin is a value in the global environment set up by the golua standard
+// library (e.g. print, string, string.format, runtime.callcontext, golib), or
+// one of its fields.
+type builtin struct {
+	name     string              // Qualified name, e.g. "string.format"
+	typeName string              // As returned by the Lua type() function
+	fields   map[string]*builtin // Only for tables
+}
+
+// Tables nested deeper than this are not explored (e.g. _G._G._G).
+const maxBuiltinDepth = 2
+
+var (
+	builtinsOnce sync.Once
+	builtins     map[string]*builtin
+)
+
+// getBuiltins returns the global values defined by the golua standard library,
+// by name.  They are found by loading the library in a runtime and looking at
+// the global environment, so they are always in sync with what golua
+// registers.
+func getBuiltins() map[string]*builtin {
+	builtinsOnce.Do(func() {
+		r := rt.New(nil)
+		cleanup := lib.LoadAll(r)
+		defer cleanup()
+		defer r.Close(nil)
+		builtins = tableBuiltins(r.GlobalEnv(), "", 0)
+	})
+	return builtins
+}
+
+func tableBuiltins(t *rt.Table, prefix string, depth int) map[string]*builtin {
+	fields := map[string]*builtin{}
+	var k, v rt.Value
+	for {
+		k, v, _ = t.Next(k)
+		if k.IsNil() {
+			break
+		}
+		name, ok := k.TryString()
+		if !ok {
+			continue
+		}
+		b := &builtin{name: prefix + name, typeName: v.TypeName()}
+		if ft, ok := v.TryTable(); ok && depth < maxBuiltinDepth {
+			b.fields = tableBuiltins(ft, b.name+".", depth+1)
+		}
+		fields[name] = b
+	}
+	return fields
+}
+
+// description returns a short description of the builtin, e.g. "builtin
+// function".
+func (b *builtin) description() string {
+	return "builtin " + b.typeName
+}
+
+// sortedFields returns the fields of the builtin sorted by name.
+func (b *builtin) sortedFields() []*builtin {
+	fields := make([]*builtin, 0, len(b.fields))
+	for _, f := range b.fields {
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].name < fields[j].name
+	})
+	return fields
+}
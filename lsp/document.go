@@ -0,0 +1,213 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/arnodel/golua/ast"
+	"github.com/arnodel/golua/astcomp"
+	"github.com/arnodel/golua/parsing"
+	"github.com/arnodel/golua/scanner"
+	"github.com/arnodel/golua/token"
+)
+
+// A document is a Lua file open in the client, with the results of analysing
+// its current text.
+type document struct {
+	uri        string
+	version    int
+	text       []byte
+	lineStarts []int // Byte offset of the start of each line
+
+	chunk       ast.BlockStat
+	diagnostics []Diagnostic
+	analysis    *analysis
+}
+
+func newDocument(uri string, version int, text string) *document {
+	d := &document{
+		uri:     uri,
+		version: version,
+		text:    []byte(text),
+	}
+	d.lineStarts = append(d.lineStarts, 0)
+	for i, b := range d.text {
+		if b == '\n' {
+			d.lineStarts = append(d.lineStarts, i+1)
+		}
+	}
+	d.analyse()
+	return d
+}
+
+// analyse parses the document, collecting syntax and compilation errors, and
+// resolves the names in it.
+func (d *document) analyse() {
+	d.diagnostics = []Diagnostic{}
+	defer func() {
+		if r := recover(); r != nil {
+			// Report a bug in the parser or the analysis as a diagnostic
+			// rather than crashing the server.
+			d.chunk = ast.BlockStat{}
+			d.analysis = analyse(d.chunk)
+			d.diagnostics = append(d.diagnostics, Diagnostic{
+				Severity: SeverityError,
+				Source:   "golua",
+				Message:  fmt.Sprintf("internal error: %v", r),
+			})
+		}
+	}()
+	src := blankFirstLineComment(d.text)
+	chunk, errs := parsing.ParseChunkWithRecovery(scanner.New(d.chunkName(), src))
+	d.chunk = chunk
+	for _, err := range errs {
+		d.diagnostics = append(d.diagnostics, Diagnostic{
+			Range:    d.tokenRange(err.Got),
+			Severity: SeverityError,
+			Source:   "golua",
+			Message:  syntaxErrorMessage(err),
+		})
+	}
+	if len(errs) == 0 {
+		// The compiler finds more errors, e.g. goto without a visible label.
+		_, _, err := astcomp.CompileLuaChunk(d.chunkName(), chunk)
+		var compErr astcomp.Error
+		if errors.As(err, &compErr) {
+			d.diagnostics = append(d.diagnostics, Diagnostic{
+				Range:    d.locationRange(compErr.Where.Locate()),
+				Severity: SeverityError,
+				Source:   "golua",
+				Message:  compErr.Message,
+			})
+		}
+	}
+	d.analysis = analyse(chunk)
+}
+
+// chunkName returns the name of the chunk for error messages, i.e. the file
+// path if the URI is a file URI.
+func (d *document) chunkName() string {
+	u, err := url.Parse(d.uri)
+	if err != nil || u.Scheme != "file" {
+		return d.uri
+	}
+	return u.Path
+}
+
+// blankFirstLineComment replaces the first line of src with spaces if it is a
+// comment starting with '#' (e.g. "#!/usr/bin/env golua"), as it would be
+// skipped when loading the chunk.  Offsets in the source are not changed.
+func blankFirstLineComment(src []byte) []byte {
+	if len(src) == 0 || src[0] != '#' {
+		return src
+	}
+	blanked := append([]byte(nil), src...)
+	for i, b := range blanked {
+		if b == '\n' || b == '\r' {
+			break
+		}
+		blanked[i] = ' '
+	}
+	return blanked
+}
+
+// syntaxErrorMessage returns the message of err without the line and column,
+// which are conveyed by the range of the diagnostic.
+func syntaxErrorMessage(err parsing.Error) string {
+	parts := strings.SplitN(err.Error(), ": ", 2)
+	return parts[len(parts)-1]
+}
+
+// position converts a byte offset in the text to an LSP position.
+func (d *document) position(offset int) Position {
+	if offset > len(d.text) {
+		offset = len(d.text)
+	}
+	line := sort.Search(len(d.lineStarts), func(i int) bool {
+		return d.lineStarts[i] > offset
+	}) - 1
+	char := 0
+	for _, r := range string(d.text[d.lineStarts[line]:offset]) {
+		char += utf16.RuneLen(r)
+	}
+	return Position{Line: line, Character: char}
+}
+
+// offset converts an LSP position to a byte offset in the text.
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+	offset := d.lineStarts[pos.Line]
+	for char := 0; char < pos.Character && offset < len(d.text); {
+		r, sz := utf8.DecodeRune(d.text[offset:])
+		if r == '\n' {
+			break
+		}
+		char += utf16.RuneLen(r)
+		offset += sz
+	}
+	return offset
+}
+
+// tokenEnd returns the byte offset of the end of the token starting at
+// offset.
+func (d *document) tokenEnd(offset int) int {
+	if offset >= len(d.text) {
+		return offset
+	}
+	tok := scanner.New("", d.text[offset:]).Scan()
+	if tok == nil || tok.Type == token.EOF || len(tok.Lit) == 0 {
+		return offset + 1
+	}
+	return offset + len(tok.Lit)
+}
+
+// tokenRange returns the range of a token.
+func (d *document) tokenRange(tok *token.Token) Range {
+	if tok.Type == token.EOF {
+		pos := d.position(len(d.text))
+		return Range{Start: pos, End: pos}
+	}
+	return Range{
+		Start: d.position(tok.Offset),
+		End:   d.position(tok.Offset + len(tok.Lit)),
+	}
+}
+
+// locationRange returns the range of an AST location.  The location ends at
+// the start of its last token, so the range is extended to the end of that
+// token.
+func (d *document) locationRange(loc ast.Location) Range {
+	start, end := loc.StartPos(), loc.EndPos()
+	if start == nil {
+		return Range{}
+	}
+	if end == nil {
+		end = start
+	}
+	return Range{
+		Start: d.position(start.Offset),
+		End:   d.position(d.tokenEnd(end.Offset)),
+	}
+}
+
+// nameRange returns the range of a name.
+func (d *document) nameRange(name ast.Name) Range {
+	start := name.StartPos()
+	if start == nil {
+		return Range{}
+	}
+	return Range{
+		Start: d.position(start.Offset),
+		End:   d.position(start.Offset + len(name.Val)),
+	}
+}
@@ -0,0 +1,645 @@
+package lsp
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/arnodel/golua/ast"
+)
+
+type symbolKind uint8
+
+const (
+	globalSymbol symbolKind = iota
+	localSymbol
+	paramSymbol
+)
+
+// A symbol is a variable: a local variable, a function parameter or a global
+// variable.
+type symbol struct {
+	name   string
+	kind   symbolKind
+	decl   ast.Name // Where the variable is declared (for globals, first assigned)
+	attrib ast.LocalAttrib
+
+	function *ast.Function // If the variable is declared as a function
+	module   *builtin      // If the variable is known to hold a builtin table
+	builtin  *builtin      // For globals defined by the standard library
+
+	funcDepth int // Nesting depth of the function declaring a local
+	refs      []*reference
+
+	// Range of byte offsets where a local is visible, for completion.
+	visibleFrom, visibleTo int
+}
+
+// A reference is an occurrence of the name of a symbol in the source.
+type reference struct {
+	name    ast.Name
+	sym     *symbol
+	decl    bool // The reference declares the symbol
+	upvalue bool // The reference is to a local of an enclosing function
+}
+
+// A fieldReference is an occurrence of a field of a builtin table in the
+// source, e.g. "format" in "string.format".
+type fieldReference struct {
+	name  ast.Name
+	field *builtin
+}
+
+// A declaration is a function or top level variable declaration, shown in the
+// outline of the document.
+type declaration struct {
+	name     string
+	kind     int // Symbol kind
+	loc      ast.Location
+	nameLoc  ast.Name
+	children []*declaration
+}
+
+// An analysis contains the results of resolving all the names in a chunk.
+type analysis struct {
+	refs         []*reference
+	fieldRefs    []*fieldReference
+	locals       []*symbol
+	globals      map[string]*symbol
+	declarations []*declaration
+}
+
+// referenceAt returns the reference whose name contains the given offset, or
+// nil.
+func (a *analysis) referenceAt(offset int) *reference {
+	for _, ref := range a.refs {
+		if nameContains(ref.name, offset) {
+			return ref
+		}
+	}
+	return nil
+}
+
+// fieldReferenceAt returns the field reference whose name contains the given
+// offset, or nil.
+func (a *analysis) fieldReferenceAt(offset int) *fieldReference {
+	for _, ref := range a.fieldRefs {
+		if nameContains(ref.name, offset) {
+			return ref
+		}
+	}
+	return nil
+}
+
+// visibleLocals returns the locals visible at the given offset, by name.  Where
+// a local shadows another, only the innermost one is returned.
+func (a *analysis) visibleLocals(offset int) map[string]*symbol {
+	locals := map[string]*symbol{}
+	for _, sym := range a.locals {
+		if sym.visibleFrom > offset || sym.visibleTo < offset {
+			continue
+		}
+		if prev, ok := locals[sym.name]; !ok || prev.visibleFrom < sym.visibleFrom {
+			locals[sym.name] = sym
+		}
+	}
+	return locals
+}
+
+func nameContains(name ast.Name, offset int) bool {
+	start := name.StartPos()
+	return start != nil && start.Offset <= offset && offset <= start.Offset+len(name.Val)
+}
+
+// A scope maps names to the locals declared in a block.
+type scope struct {
+	parent *scope
+	names  map[string]*symbol
+	end    int // Byte offset where the scope ends
+}
+
+// A resolver walks the AST of a chunk to resolve all names to symbols.  It
+// implements ast.StatProcessor, ast.ExpProcessor and ast.VarProcessor.
+type resolver struct {
+	*analysis
+	scope     *scope
+	funcDepth int
+	decls     *[]*declaration // Where to add declarations found
+}
+
+var _ ast.StatProcessor = (*resolver)(nil)
+var _ ast.ExpProcessor = (*resolver)(nil)
+var _ ast.VarProcessor = (*resolver)(nil)
+
+// analyse resolves all the names in chunk.
+func analyse(chunk ast.BlockStat) *analysis {
+	r := &resolver{analysis: &analysis{globals: map[string]*symbol{}}}
+	r.decls = &r.declarations
+	r.pushScope(endOffset(chunk, math.MaxInt32))
+	r.processBlockBody(chunk)
+	sort.SliceStable(r.refs, func(i, j int) bool {
+		return r.refs[i].name.StartPos().Offset < r.refs[j].name.StartPos().Offset
+	})
+	// Make the references of each symbol sorted too.
+	for _, ref := range r.refs {
+		ref.sym.refs = ref.sym.refs[:0]
+	}
+	for _, ref := range r.refs {
+		ref.sym.refs = append(ref.sym.refs, ref)
+	}
+	sortDecls(r.declarations)
+	return r.analysis
+}
+
+// sortDecls sorts declarations in the order they appear in the source.
+func sortDecls(decls []*declaration) {
+	sort.SliceStable(decls, func(i, j int) bool {
+		return startOffset(decls[i].loc, 0) < startOffset(decls[j].loc, 0)
+	})
+	for _, decl := range decls {
+		sortDecls(decl.children)
+	}
+}
+
+// endOffset returns the offset of the end of the location of l, or def if
+// unknown.
+func endOffset(l ast.Locator, def int) int {
+	if end := l.Locate().EndPos(); end != nil {
+		return end.Offset
+	}
+	return def
+}
+
+// startOffset returns the offset of the start of the location of l, or def if
+// unknown.
+func startOffset(l ast.Locator, def int) int {
+	if start := l.Locate().StartPos(); start != nil {
+		return start.Offset
+	}
+	return def
+}
+
+func (r *resolver) pushScope(end int) {
+	r.scope = &scope{parent: r.scope, names: map[string]*symbol{}, end: end}
+}
+
+func (r *resolver) popScope() {
+	r.scope = r.scope.parent
+}
+
+// declareLocal adds a local symbol to the current scope, visible from the
+// given offset.
+func (r *resolver) declareLocal(name ast.Name, kind symbolKind, visibleFrom int) *symbol {
+	sym := &symbol{
+		name:        name.Val,
+		kind:        kind,
+		decl:        name,
+		funcDepth:   r.funcDepth,
+		visibleFrom: visibleFrom,
+		visibleTo:   r.scope.end,
+	}
+	r.scope.names[name.Val] = sym
+	r.locals = append(r.locals, sym)
+	r.addRef(name, sym, true)
+	return sym
+}
+
+func (r *resolver) addRef(name ast.Name, sym *symbol, decl bool) {
+	if name.StartPos() == nil {
+		// E.g. the implicit self parameter of methods
+		return
+	}
+	ref := &reference{
+		name:    name,
+		sym:     sym,
+		decl:    decl,
+		upvalue: sym.kind != globalSymbol && sym.funcDepth != r.funcDepth,
+	}
+	sym.refs = append(sym.refs, ref)
+	r.refs = append(r.refs, ref)
+}
+
+// lookup returns the symbol that a name refers to in the current scope.
+func (r *resolver) lookup(name string) *symbol {
+	for s := r.scope; s != nil; s = s.parent {
+		if sym, ok := s.names[name]; ok {
+			return sym
+		}
+	}
+	sym, ok := r.globals[name]
+	if !ok {
+		sym = &symbol{name: name, kind: globalSymbol, builtin: getBuiltins()[name]}
+		r.globals[name] = sym
+	}
+	return sym
+}
+
+// builtinTable returns the builtin table that the expression evaluates to, if
+// it can tell (e.g. string, runtime or require("golib")).
+func (r *resolver) builtinTable(e ast.ExpNode) *builtin {
+	var b *builtin
+	switch x := e.(type) {
+	case ast.Name:
+		sym := r.lookup(x.Val)
+		if sym.module != nil {
+			return sym.module
+		}
+		b = sym.builtin
+	case ast.IndexExp:
+		key, ok := x.Idx.(ast.String)
+		if !ok {
+			return nil
+		}
+		if t := r.builtinTable(x.Coll); t != nil {
+			b = t.fields[string(key.Val)]
+		}
+	case ast.FunctionCall:
+		name, ok := x.Target.(ast.Name)
+		if !ok || name.Val != "require" || r.lookup("require").builtin == nil || len(x.Args) != 1 {
+			return nil
+		}
+		if mod, ok := x.Args[0].(ast.String); ok {
+			b = getBuiltins()[string(mod.Val)]
+		}
+	}
+	if b == nil || b.fields == nil {
+		return nil
+	}
+	return b
+}
+
+// addDecl adds a declaration to the outline and returns it.
+func (r *resolver) addDecl(name string, kind int, loc ast.Locator, nameLoc ast.Name) *declaration {
+	decl := &declaration{name: name, kind: kind, loc: loc.Locate(), nameLoc: nameLoc}
+	*r.decls = append(*r.decls, decl)
+	return decl
+}
+
+// atTopLevel is true when processing statements of the chunk outside any
+// block.
+func (r *resolver) atTopLevel() bool {
+	return r.funcDepth == 0 && r.scope.parent == nil
+}
+
+//
+// Statements
+//
+
+func (r *resolver) processBlockBody(s ast.BlockStat) {
+	for _, stat := range s.Stats {
+		stat.ProcessStat(r)
+	}
+	r.processExps(s.Return)
+}
+
+func (r *resolver) processExps(exps []ast.ExpNode) {
+	for _, e := range exps {
+		e.ProcessExp(r)
+	}
+}
+
+// ProcessAssignStat resolves names in an AssignStat.
+func (r *resolver) ProcessAssignStat(s ast.AssignStat) {
+	for i, src := range s.Src {
+		if fx, ok := src.(ast.Function); ok && i < len(s.Dest) {
+			if decl := r.functionDecl(s.Dest[i], fx, s); decl != nil {
+				r.processFunction(fx, &decl.children)
+				continue
+			}
+		}
+		src.ProcessExp(r)
+	}
+	for i, dest := range s.Dest {
+		dest.ProcessVar(r)
+		name, ok := dest.(ast.Name)
+		if !ok {
+			continue
+		}
+		sym := r.lookup(name.Val)
+		if sym.kind != globalSymbol || sym.decl.StartPos() != nil {
+			continue
+		}
+		// The first assignment to a global is considered its declaration.
+		sym.decl = name
+		if i >= len(s.Src) {
+			continue
+		}
+		if fx, ok := s.Src[i].(ast.Function); ok {
+			sym.function = &fx
+			continue
+		}
+		sym.module = r.builtinTable(s.Src[i])
+		if r.atTopLevel() {
+			r.addDecl(name.Val, SymbolKindVariable, s, name)
+		}
+	}
+}
+
+// functionDecl adds a declaration for a function assigned to dest (as in
+// "function a.b:c() end"), if dest is a name or a dotted name.
+func (r *resolver) functionDecl(dest ast.Var, fx ast.Function, loc ast.Locator) *declaration {
+	name, nameLoc, ok := varName(dest)
+	if !ok {
+		return nil
+	}
+	kind := SymbolKindFunction
+	if len(fx.Params) > 0 && fx.Params[0].Val == "self" && fx.Params[0].StartPos() == nil {
+		// This is the implicit self parameter of a method
+		kind = SymbolKindMethod
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[:i] + ":" + name[i+1:]
+		}
+	}
+	return r.addDecl(name, kind, loc, nameLoc)
+}
+
+// varName returns the dotted name of a variable like "a.b.c" and the Name of
+// its last component, if it has this form.
+func varName(v ast.ExpNode) (string, ast.Name, bool) {
+	switch x := v.(type) {
+	case ast.Name:
+		return x.Val, x, true
+	case ast.IndexExp:
+		key, ok := x.Idx.(ast.String)
+		if !ok {
+			return "", ast.Name{}, false
+		}
+		prefix, _, ok := varName(x.Coll)
+		if !ok {
+			return "", ast.Name{}, false
+		}
+		return prefix + "." + string(key.Val), ast.Name{Location: key.Location, Val: string(key.Val)}, true
+	default:
+		return "", ast.Name{}, false
+	}
+}
+
+// ProcessBlockStat resolves names in a BlockStat.
+func (r *resolver) ProcessBlockStat(s ast.BlockStat) {
+	r.pushScope(endOffset(s, r.scope.end))
+	r.processBlockBody(s)
+	r.popScope()
+}
+
+// ProcessBreakStat does nothing.
+func (r *resolver) ProcessBreakStat(s ast.BreakStat) {}
+
+// ProcessCompoundAssignStat resolves names in a CompoundAssignStat.
+func (r *resolver) ProcessCompoundAssignStat(s ast.CompoundAssignStat) {
+	s.Value.ProcessExp(r)
+	s.Dest.ProcessVar(r)
+}
+
+// ProcessContinueStat does nothing.
+func (r *resolver) ProcessContinueStat(s ast.ContinueStat) {}
+
+// ProcessEmptyStat does nothing.
+func (r *resolver) ProcessEmptyStat(s ast.EmptyStat) {}
+
+// ProcessErrorStat does nothing.
+func (r *resolver) ProcessErrorStat(s ast.ErrorStat) {}
+
+// ProcessForInStat resolves names in a ForInStat.
+func (r *resolver) ProcessForInStat(s ast.ForInStat) {
+	r.processExps(s.Params)
+	r.pushScope(endOffset(s.Body, r.scope.end))
+	for _, v := range s.Vars {
+		r.declareLocal(v, localSymbol, startOffset(s.Body, 0))
+	}
+	r.processBlockBody(s.Body)
+	r.popScope()
+}
+
+// ProcessForStat resolves names in a ForStat.
+func (r *resolver) ProcessForStat(s ast.ForStat) {
+	r.processExps([]ast.ExpNode{s.Start, s.Stop, s.Step})
+	r.pushScope(endOffset(s.Body, r.scope.end))
+	r.declareLocal(s.Var, localSymbol, startOffset(s.Body, 0))
+	r.processBlockBody(s.Body)
+	r.popScope()
+}
+
+// ProcessFunctionCallStat resolves names in a function call statement.
+func (r *resolver) ProcessFunctionCallStat(s ast.FunctionCall) {
+	r.ProcessBFunctionCallExp(*s.BFunctionCall)
+}
+
+// ProcessGlobalFunctionStat resolves names in a GlobalFunctionStat (Lua 5.5).
+// It is treated as an assignment of the function to the global variable.
+func (r *resolver) ProcessGlobalFunctionStat(s ast.GlobalFunctionStat) {
+	r.ProcessAssignStat(ast.AssignStat{
+		Location: s.Location,
+		Dest:     []ast.Var{s.Name},
+		Src:      []ast.ExpNode{s.Function},
+	})
+}
+
+// ProcessGlobalStat resolves names in a GlobalStat (Lua 5.5).  If it has
+// values, it is treated as an assignment to the global variables.
+func (r *resolver) ProcessGlobalStat(s ast.GlobalStat) {
+	if len(s.Values) == 0 {
+		return
+	}
+	dest := make([]ast.Var, len(s.NameAttribs))
+	for i, na := range s.NameAttribs {
+		dest[i] = na.Name
+	}
+	r.ProcessAssignStat(ast.AssignStat{Location: s.Location, Dest: dest, Src: s.Values})
+}
+
+// ProcessGotoStat does nothing (labels are not resolved).
+func (r *resolver) ProcessGotoStat(s ast.GotoStat) {}
+
+// ProcessIfStat resolves names in an IfStat.
+func (r *resolver) ProcessIfStat(s ast.IfStat) {
+	s.If.Cond.ProcessExp(r)
+	r.ProcessBlockStat(s.If.Body)
+	for _, cond := range s.ElseIfs {
+		cond.Cond.ProcessExp(r)
+		r.ProcessBlockStat(cond.Body)
+	}
+	if s.Else != nil {
+		r.ProcessBlockStat(*s.Else)
+	}
+}
+
+// ProcessLabelStat does nothing (labels are not resolved).
+func (r *resolver) ProcessLabelStat(s ast.LabelStat) {}
+
+// ProcessLocalFunctionStat resolves names in a LocalFunctionStat.
+func (r *resolver) ProcessLocalFunctionStat(s ast.LocalFunctionStat) {
+	// The function can refer to itself, so declare it first.
+	sym := r.declareLocal(s.Name, localSymbol, startOffset(s.Name, 0))
+	sym.function = &s.Function
+	decl := r.addDecl(s.Name.Val, SymbolKindFunction, s, s.Name)
+	r.processFunction(s.Function, &decl.children)
+}
+
+// ProcessLocalStat resolves names in a LocalStat.
+func (r *resolver) ProcessLocalStat(s ast.LocalStat) {
+	funcDecls := make([]*declaration, len(s.Values))
+	for i, value := range s.Values {
+		if fx, ok := value.(ast.Function); ok && i < len(s.NameAttribs) {
+			name := s.NameAttribs[i].Name
+			funcDecls[i] = r.addDecl(name.Val, SymbolKindFunction, s, name)
+			r.processFunction(fx, &funcDecls[i].children)
+		} else {
+			value.ProcessExp(r)
+		}
+	}
+	visibleFrom := endOffset(s, 0) + 1
+	topLevel := r.atTopLevel()
+	for i, nameAttrib := range s.NameAttribs {
+		sym := r.declareLocal(nameAttrib.Name, localSymbol, visibleFrom)
+		sym.attrib = nameAttrib.Attrib
+		kind := SymbolKindVariable
+		if nameAttrib.Attrib == ast.ConstAttrib {
+			kind = SymbolKindConstant
+		}
+		if i < len(s.Values) {
+			if funcDecls[i] != nil {
+				fx := s.Values[i].(ast.Function)
+				sym.function = &fx
+				continue
+			}
+			sym.module = r.builtinTable(s.Values[i])
+			if sym.module != nil {
+				kind = SymbolKindModule
+			}
+		}
+		if topLevel {
+			r.addDecl(nameAttrib.Name.Val, kind, s, nameAttrib.Name)
+		}
+	}
+}
+
+// ProcessRepeatStat resolves names in a RepeatStat.
+func (r *resolver) ProcessRepeatStat(s ast.RepeatStat) {
+	// The condition is in the scope of the body.
+	r.pushScope(endOffset(s, r.scope.end) + 1)
+	r.processBlockBody(s.Body)
+	s.Cond.ProcessExp(r)
+	r.popScope()
+}
+
+// ProcessWhileStat resolves names in a WhileStat.
+func (r *resolver) ProcessWhileStat(s ast.WhileStat) {
+	s.Cond.ProcessExp(r)
+	r.ProcessBlockStat(s.Body)
+}
+
+//
+// Expressions
+//
+
+// ProcessBFunctionCallExp resolves names in a function call.
+func (r *resolver) ProcessBFunctionCallExp(f ast.BFunctionCall) {
+	f.Target.ProcessExp(r)
+	r.processExps(f.Args)
+}
+
+// ProcessBinOpExp resolves names in a BinOp.
+func (r *resolver) ProcessBinOpExp(b ast.BinOp) {
+	b.Left.ProcessExp(r)
+	for _, op := range b.Right {
+		op.Operand.ProcessExp(r)
+	}
+}
+
+// ProcesBoolExp does nothing.
+func (r *resolver) ProcesBoolExp(b ast.Bool) {}
+
+// ProcessEtcExp does nothing.
+func (r *resolver) ProcessEtcExp(e ast.Etc) {}
+
+// ProcessFunctionExp resolves names in a function.
+func (r *resolver) ProcessFunctionExp(f ast.Function) {
+	// Declarations in anonymous functions are not shown in the outline.
+	r.processFunction(f, nil)
+}
+
+// processFunction resolves names in a function and adds the declarations
+// found in it to decls (which may be nil).
+func (r *resolver) processFunction(f ast.Function, decls *[]*declaration) {
+	if decls == nil {
+		decls = new([]*declaration)
+	}
+	saveDecls := r.decls
+	r.decls = decls
+	r.funcDepth++
+	r.pushScope(endOffset(f.Body, endOffset(f, r.scope.end)))
+	for _, p := range f.Params {
+		r.declareLocal(p, paramSymbol, startOffset(f, 0))
+	}
+	r.processBlockBody(f.Body)
+	r.popScope()
+	r.funcDepth--
+	r.decls = saveDecls
+}
+
+// ProcessFunctionCallExp resolves names in a function call.
+func (r *resolver) ProcessFunctionCallExp(f ast.FunctionCall) {
+	r.ProcessBFunctionCallExp(*f.BFunctionCall)
+}
+
+// ProcessIndexExp resolves names in an IndexExp.
+func (r *resolver) ProcessIndexExp(e ast.IndexExp) {
+	e.Coll.ProcessExp(r)
+	e.Idx.ProcessExp(r)
+	if key, ok := e.Idx.(ast.String); ok && key.StartPos() != nil {
+		if t := r.builtinTable(e.Coll); t != nil {
+			if field, ok := t.fields[string(key.Val)]; ok {
+				r.fieldRefs = append(r.fieldRefs, &fieldReference{
+					name:  ast.Name{Location: key.Location, Val: string(key.Val)},
+					field: field,
+				})
+			}
+		}
+	}
+}
+
+// ProcessNameExp resolves a name.
+func (r *resolver) ProcessNameExp(n ast.Name) {
+	r.addRef(n, r.lookup(n.Val), false)
+}
+
+// ProcessNilExp does nothing.
+func (r *resolver) ProcessNilExp(n ast.Nil) {}
+
+// ProcessIntExp does nothing.
+func (r *resolver) ProcessIntExp(n ast.Int) {}
+
+// ProcessFloatExp does nothing.
+func (r *resolver) ProcessFloatExp(f ast.Float) {}
+
+// ProcessStringExp does nothing.
+func (r *resolver) ProcessStringExp(s ast.String) {}
+
+// ProcessTableConstructorExp resolves names in a table constructor.
+func (r *resolver) ProcessTableConstructorExp(t ast.TableConstructor) {
+	for _, field := range t.Fields {
+		if _, ok := field.Key.(ast.NoTableKey); !ok {
+			field.Key.ProcessExp(r)
+		}
+		field.Value.ProcessExp(r)
+	}
+}
+
+// ProcessUnOpExp resolves names in a UnOp.
+func (r *resolver) ProcessUnOpExp(u ast.UnOp) {
+	u.Operand.ProcessExp(r)
+}
+
+//
+// Variables
+//
+
+// ProcessIndexExpVar resolves names in an IndexExp being assigned to.
+func (r *resolver) ProcessIndexExpVar(e ast.IndexExp) {
+	r.ProcessIndexExp(e)
+}
+
+// ProcessNameVar resolves a name being assigned to.
+func (r *resolver) ProcessNameVar(n ast.Name) {
+	r.addRef(n, r.lookup(n.Val), false)
+}
@@ -0,0 +1,563 @@
+// Package lsp implements a Language Server Protocol server for Lua, built on
+// the golua scanner, parser and AST.  It provides diagnostics (syntax and
+// compilation errors), hover, go to definition, find references, document
+// symbols and completion.  Names are resolved to locals, upvalues and globals,
+// and the server knows about the functions and tables registered by the golua
+// standard library (including runtime and golib).
+//
+// The golua command runs the server over stdio with "golua lsp".  It can also
+// be embedded, e.g.
+//
+//	err := lsp.NewServer().Serve(os.Stdin, os.Stdout)
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/arnodel/golua/ast"
+)
+
+// ErrExitWithoutShutdown is returned by Server.Serve when the client sends
+// the exit notification without a shutdown request first.
+var ErrExitWithoutShutdown = errors.New("exit without shutdown")
+
+// A Server is a Language Server Protocol server for Lua.  Only full document
+// synchronisation is supported.
+type Server struct {
+	out         io.Writer
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+	exited      bool
+}
+
+// NewServer returns a new server.
+func NewServer() *Server {
+	return &Server{docs: map[string]*document{}}
+}
+
+// Serve reads messages from r and writes messages to w until the exit
+// notification is received or r is closed.  It returns nil if the client
+// requested a shutdown before exiting.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.out = w
+	in := bufio.NewReader(r)
+	for !s.exited {
+		body, err := readMessage(in)
+		if err == io.EOF {
+			if s.shutdown {
+				return nil
+			}
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.handleMessage(body); err != nil {
+			return err
+		}
+	}
+	if !s.shutdown {
+		return ErrExitWithoutShutdown
+	}
+	return nil
+}
+
+type requestHandler func(s *Server, params json.RawMessage) (interface{}, error)
+
+type notificationHandler func(s *Server, params json.RawMessage) error
+
+var requestHandlers = map[string]requestHandler{
+	"initialize":                  (*Server).initialize,
+	"shutdown":                    (*Server).shutdownRequest,
+	"textDocument/hover":          (*Server).hover,
+	"textDocument/definition":     (*Server).definition,
+	"textDocument/references":     (*Server).references,
+	"textDocument/documentSymbol": (*Server).documentSymbol,
+	"textDocument/completion":     (*Server).completion,
+}
+
+var notificationHandlers = map[string]notificationHandler{
+	"initialized":            func(*Server, json.RawMessage) error { return nil },
+	"exit":                   (*Server).exit,
+	"textDocument/didOpen":   (*Server).didOpen,
+	"textDocument/didChange": (*Server).didChange,
+	"textDocument/didClose":  (*Server).didClose,
+}
+
+// handleMessage handles one message from the client.  It only returns an error
+// if a message could not be sent.
+func (s *Server) handleMessage(body []byte) error {
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return s.replyError(nil, &ResponseError{Code: codeParseError, Message: err.Error()})
+	}
+	if msg.Method == "" {
+		// A response from the client, which we do not expect.
+		return nil
+	}
+	if msg.ID == nil {
+		handler, ok := notificationHandlers[msg.Method]
+		if !ok || !s.initialized && msg.Method != "exit" {
+			// Unknown notifications are ignored, e.g. "$/cancelRequest".
+			return nil
+		}
+		return s.callNotificationHandler(handler, msg.Params)
+	}
+	handler, ok := requestHandlers[msg.Method]
+	switch {
+	case !ok:
+		return s.replyError(msg.ID, &ResponseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method})
+	case !s.initialized && msg.Method != "initialize":
+		return s.replyError(msg.ID, &ResponseError{Code: codeServerNotInitialized, Message: "server not initialized"})
+	case s.shutdown:
+		return s.replyError(msg.ID, &ResponseError{Code: codeInvalidRequest, Message: "server is shut down"})
+	}
+	result, err := callRequestHandler(s, handler, msg.Params)
+	if err != nil {
+		var respErr *ResponseError
+		if !errors.As(err, &respErr) {
+			respErr = &ResponseError{Code: codeInternalError, Message: err.Error()}
+		}
+		return s.replyError(msg.ID, respErr)
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+// callRequestHandler calls handler, turning a panic into an internal error so
+// that a bug in one request does not take the server down.
+func callRequestHandler(s *Server, handler requestHandler, params json.RawMessage) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = &ResponseError{Code: codeInternalError, Message: fmt.Sprintf("internal error: %v", r)}
+		}
+	}()
+	return handler(s, params)
+}
+
+// callNotificationHandler calls handler.  As there is no response to a
+// notification, a panic is reported to the client with a window/logMessage
+// notification.
+func (s *Server) callNotificationHandler(handler notificationHandler, params json.RawMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = s.notify("window/logMessage", LogMessageParams{
+				Type:    MessageTypeError,
+				Message: fmt.Sprintf("internal error: %v", r),
+			})
+		}
+	}()
+	return handler(s, params)
+}
+
+func (s *Server) replyError(id *json.RawMessage, err *ResponseError) error {
+	return writeMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: err})
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// decodeParams decodes the parameters of a message into v.
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+//
+// Lifecycle
+//
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	if s.initialized {
+		return nil, &ResponseError{Code: codeInvalidRequest, Message: "server already initialized"}
+	}
+	s.initialized = true
+	var res InitializeResult
+	res.ServerInfo.Name = "golua"
+	res.Capabilities = ServerCapabilities{
+		TextDocumentSync:       textDocumentSyncFull,
+		HoverProvider:          true,
+		DefinitionProvider:     true,
+		ReferencesProvider:     true,
+		DocumentSymbolProvider: true,
+		CompletionProvider:     &CompletionOptions{TriggerCharacters: []string{".", ":"}},
+	}
+	return res, nil
+}
+
+func (s *Server) shutdownRequest(json.RawMessage) (interface{}, error) {
+	s.shutdown = true
+	return nil, nil
+}
+
+func (s *Server) exit(json.RawMessage) error {
+	s.exited = true
+	return nil
+}
+
+//
+// Document synchronisation
+//
+
+func (s *Server) didOpen(params json.RawMessage) error {
+	var p DidOpenTextDocumentParams
+	if decodeParams(params, &p) != nil {
+		return nil
+	}
+	return s.setDocument(newDocument(p.TextDocument.URI, p.TextDocument.Version, p.TextDocument.Text))
+}
+
+func (s *Server) didChange(params json.RawMessage) error {
+	var p DidChangeTextDocumentParams
+	if decodeParams(params, &p) != nil || len(p.ContentChanges) == 0 {
+		return nil
+	}
+	text := p.ContentChanges[len(p.ContentChanges)-1].Text
+	return s.setDocument(newDocument(p.TextDocument.URI, p.TextDocument.Version, text))
+}
+
+func (s *Server) didClose(params json.RawMessage) error {
+	var p DidCloseTextDocumentParams
+	if decodeParams(params, &p) != nil {
+		return nil
+	}
+	delete(s.docs, p.TextDocument.URI)
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         p.TextDocument.URI,
+		Diagnostics: []Diagnostic{},
+	})
+}
+
+func (s *Server) setDocument(d *document) error {
+	s.docs[d.uri] = d
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         d.uri,
+		Version:     d.version,
+		Diagnostics: d.diagnostics,
+	})
+}
+
+// documentAt returns the document and the byte offset for the position in
+// params, or a nil document if the document is not open.
+func (s *Server) documentAt(params json.RawMessage, p *TextDocumentPositionParams) (*document, int, error) {
+	if err := decodeParams(params, p); err != nil {
+		return nil, 0, err
+	}
+	d := s.docs[p.TextDocument.URI]
+	if d == nil {
+		return nil, 0, nil
+	}
+	return d, d.offset(p.Position), nil
+}
+
+//
+// Language features
+//
+
+func (s *Server) hover(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	d, offset, err := s.documentAt(params, &p)
+	if d == nil {
+		return nil, err
+	}
+	var (
+		code, desc string
+		rng        Range
+	)
+	if ref := d.analysis.referenceAt(offset); ref != nil {
+		code, desc = describeSymbol(ref)
+		rng = d.nameRange(ref.name)
+	} else if ref := d.analysis.fieldReferenceAt(offset); ref != nil {
+		code = ref.field.name
+		desc = describeBuiltin(ref.field)
+		rng = d.nameRange(ref.name)
+	} else {
+		return nil, nil
+	}
+	return Hover{
+		Contents: MarkupContent{
+			Kind:  "markdown",
+			Value: fmt.Sprintf("```lua\n%s\n```\n%s", code, desc),
+		},
+		Range: &rng,
+	}, nil
+}
+
+// describeSymbol returns a line of code declaring the symbol referred to and a
+// sentence describing it, for hover.
+func describeSymbol(ref *reference) (code, desc string) {
+	sym := ref.sym
+	line := 0
+	if start := sym.decl.StartPos(); start != nil {
+		line = start.Line
+	}
+	switch sym.kind {
+	case localSymbol:
+		if sym.function != nil {
+			code = "local function " + sym.name + signature(sym.function.Params, sym.function.HasDots)
+		} else {
+			code = "local " + sym.name
+			switch sym.attrib {
+			case ast.ConstAttrib:
+				code += " <const>"
+			case ast.CloseAttrib:
+				code += " <close>"
+			}
+		}
+		if ref.upvalue {
+			desc = fmt.Sprintf("Upvalue declared on line %d.", line)
+		} else {
+			desc = fmt.Sprintf("Local variable declared on line %d.", line)
+		}
+	case paramSymbol:
+		code = "(parameter) " + sym.name
+		if line == 0 {
+			desc = "Implicit parameter of a method."
+		} else if ref.upvalue {
+			desc = fmt.Sprintf("Upvalue: parameter declared on line %d.", line)
+		} else {
+			desc = fmt.Sprintf("Parameter declared on line %d.", line)
+		}
+	default:
+		if sym.function != nil {
+			code = "function " + sym.name + signature(sym.function.Params, sym.function.HasDots)
+		} else {
+			code = "(global) " + sym.name
+		}
+		switch {
+		case line > 0:
+			desc = fmt.Sprintf("Global variable first assigned on line %d.", line)
+			if sym.builtin != nil {
+				desc += " It overrides a " + sym.builtin.description() + "."
+			}
+		case sym.builtin != nil:
+			desc = describeBuiltin(sym.builtin)
+		default:
+			desc = "Global variable not assigned in this file."
+		}
+	}
+	if sym.module != nil {
+		desc += fmt.Sprintf(" It holds the %s table.", sym.module.name)
+	}
+	return
+}
+
+func describeBuiltin(b *builtin) string {
+	desc := fmt.Sprintf("A %s of the golua standard library.", strings.TrimPrefix(b.description(), "builtin "))
+	if len(b.fields) > 0 {
+		names := make([]string, 0, len(b.fields))
+		for _, f := range b.sortedFields() {
+			names = append(names, f.name[strings.LastIndexByte(f.name, '.')+1:])
+		}
+		desc += "\n\nFields: " + strings.Join(names, ", ")
+	}
+	return desc
+}
+
+func signature(params []ast.Name, hasDots bool) string {
+	names := make([]string, 0, len(params)+1)
+	for _, p := range params {
+		if p.Val == "self" && p.StartPos() == nil {
+			continue
+		}
+		names = append(names, p.Val)
+	}
+	if hasDots {
+		names = append(names, "...")
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func (s *Server) definition(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	d, offset, err := s.documentAt(params, &p)
+	if d == nil {
+		return nil, err
+	}
+	ref := d.analysis.referenceAt(offset)
+	if ref == nil || ref.sym.decl.StartPos() == nil {
+		return nil, nil
+	}
+	return Location{URI: d.uri, Range: d.nameRange(ref.sym.decl)}, nil
+}
+
+func (s *Server) references(params json.RawMessage) (interface{}, error) {
+	var p ReferenceParams
+	d, offset, err := s.documentAt(params, &p.TextDocumentPositionParams)
+	if d == nil {
+		return nil, err
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	ref := d.analysis.referenceAt(offset)
+	if ref == nil {
+		return nil, nil
+	}
+	locs := []Location{}
+	for _, r := range ref.sym.refs {
+		if r.decl && !p.Context.IncludeDeclaration {
+			continue
+		}
+		locs = append(locs, Location{URI: d.uri, Range: d.nameRange(r.name)})
+	}
+	return locs, nil
+}
+
+func (s *Server) documentSymbol(params json.RawMessage) (interface{}, error) {
+	var p DocumentSymbolParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	d := s.docs[p.TextDocument.URI]
+	if d == nil {
+		return nil, nil
+	}
+	return d.documentSymbols(d.analysis.declarations), nil
+}
+
+func (d *document) documentSymbols(decls []*declaration) []DocumentSymbol {
+	syms := []DocumentSymbol{}
+	for _, decl := range decls {
+		sym := DocumentSymbol{
+			Name:           decl.name,
+			Kind:           decl.kind,
+			Range:          d.locationRange(decl.loc),
+			SelectionRange: d.nameRange(decl.nameLoc),
+		}
+		if len(decl.children) > 0 {
+			sym.Children = d.documentSymbols(decl.children)
+		}
+		syms = append(syms, sym)
+	}
+	return syms
+}
+
+var keywords = []string{
+	"and", "break", "do", "else", "elseif", "end", "false", "for",
+	"function", "goto", "if", "in", "local", "nil", "not", "or", "repeat",
+	"return", "then", "true", "until", "while",
+}
+
+func (s *Server) completion(params json.RawMessage) (interface{}, error) {
+	var p TextDocumentPositionParams
+	d, offset, err := s.documentAt(params, &p)
+	if d == nil {
+		return nil, err
+	}
+	lineStart := d.lineStarts[d.position(offset).Line]
+	path, prefix := completionContext(d.text[lineStart:offset])
+	items := map[string]CompletionItem{}
+	add := func(item CompletionItem) {
+		if _, ok := items[item.Label]; !ok && strings.HasPrefix(item.Label, prefix) {
+			items[item.Label] = item
+		}
+	}
+	locals := d.analysis.visibleLocals(offset)
+	if path != nil {
+		// Complete a field of a builtin table
+		var t *builtin
+		if sym, ok := locals[path[0]]; ok {
+			t = sym.module
+		} else if sym, ok := d.analysis.globals[path[0]]; ok && sym.module != nil {
+			t = sym.module
+		} else {
+			t = getBuiltins()[path[0]]
+		}
+		for _, name := range path[1:] {
+			if t == nil {
+				break
+			}
+			t = t.fields[name]
+		}
+		if t != nil {
+			for name, f := range t.fields {
+				add(CompletionItem{Label: name, Kind: builtinCompletionKind(f), Detail: f.description()})
+			}
+		}
+	} else {
+		for name, sym := range locals {
+			kind := CompletionItemKindVariable
+			if sym.function != nil {
+				kind = CompletionItemKindFunction
+			}
+			add(CompletionItem{Label: name, Kind: kind, Detail: "local"})
+		}
+		for name, sym := range d.analysis.globals {
+			if sym.decl.StartPos() == nil {
+				continue
+			}
+			kind := CompletionItemKindVariable
+			if sym.function != nil {
+				kind = CompletionItemKindFunction
+			}
+			add(CompletionItem{Label: name, Kind: kind, Detail: "global"})
+		}
+		for name, b := range getBuiltins() {
+			add(CompletionItem{Label: name, Kind: builtinCompletionKind(b), Detail: b.description()})
+		}
+		for _, kw := range keywords {
+			add(CompletionItem{Label: kw, Kind: CompletionItemKindKeyword})
+		}
+	}
+	list := CompletionList{Items: make([]CompletionItem, 0, len(items))}
+	for _, item := range items {
+		list.Items = append(list.Items, item)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		return list.Items[i].Label < list.Items[j].Label
+	})
+	return list, nil
+}
+
+func builtinCompletionKind(b *builtin) int {
+	switch b.typeName {
+	case "function":
+		return CompletionItemKindFunction
+	case "table":
+		return CompletionItemKindModule
+	default:
+		return CompletionItemKindField
+	}
+}
+
+// completionContext looks at the text of the line before the cursor and
+// returns the name being typed and, if it is a field (as in "string.fo"), the
+// names of the table containing it (e.g. ["string"]).
+func completionContext(line []byte) (path []string, prefix string) {
+	i := len(line)
+	for i > 0 && isNameByte(line[i-1]) {
+		i--
+	}
+	prefix = string(line[i:])
+	for i > 0 && (line[i-1] == '.' || line[i-1] == ':') {
+		if line[i-1] == ':' && path != nil {
+			// Only the last separator can be a colon
+			return nil, prefix
+		}
+		j := i - 1
+		for j > 0 && isNameByte(line[j-1]) {
+			j--
+		}
+		if j == i-1 {
+			return nil, prefix
+		}
+		path = append([]string{string(line[j : i-1])}, path...)
+		i = j
+	}
+	return path, prefix
+}
+
+func isNameByte(b byte) bool {
+	return b == '_' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
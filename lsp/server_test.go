@@ -0,0 +1,494 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// A testClient talks to a Server running in-process, like an editor would.
+type testClient struct {
+	t        *testing.T
+	toServer *io.PipeWriter
+	messages chan *message
+	served   chan error
+	nextID   int
+
+	// Diagnostics published by the server, by URI.
+	diagnostics map[string][]Diagnostic
+}
+
+func newTestClient(t *testing.T) *testClient {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &testClient{
+		t:           t,
+		toServer:    inW,
+		messages:    make(chan *message, 100),
+		served:      make(chan error, 1),
+		diagnostics: map[string][]Diagnostic{},
+	}
+	go func() {
+		err := NewServer().Serve(inR, outW)
+		outW.Close()
+		c.served <- err
+	}()
+	go func() {
+		r := bufio.NewReader(outR)
+		for {
+			body, err := readMessage(r)
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			msg := new(message)
+			if err := json.Unmarshal(body, msg); err != nil {
+				t.Errorf("invalid message from server: %s", body)
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *testClient) send(msg interface{}) {
+	if err := writeMessage(c.toServer, msg); err != nil {
+		c.t.Fatalf("error sending message: %s", err)
+	}
+}
+
+// call sends a request and waits for the response, decoding its result into
+// result.  It returns the response error if there is one.
+func (c *testClient) call(method string, params interface{}, result interface{}) *ResponseError {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(strings.TrimSpace(string(mustMarshal(c.nextID))))
+	c.send(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Method  string          `json:"method"`
+		Params  interface{}     `json:"params"`
+	}{"2.0", id, method, params})
+	for msg := range c.messages {
+		if msg.Method != "" {
+			c.handleNotification(msg)
+			continue
+		}
+		if msg.ID == nil || string(*msg.ID) != string(id) {
+			c.t.Fatalf("unexpected response id: %v", msg.ID)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("cannot decode result %s: %s", msg.Result, err)
+			}
+		}
+		return nil
+	}
+	c.t.Fatal("connection closed")
+	return nil
+}
+
+// mustCall is like call but fails the test if the server returns an error.
+func (c *testClient) mustCall(method string, params interface{}, result interface{}) {
+	c.t.Helper()
+	if err := c.call(method, params, result); err != nil {
+		c.t.Fatalf("%s: %s", method, err)
+	}
+}
+
+// notify sends a notification.  If it is about a document, it waits for the
+// diagnostics to be published.
+func (c *testClient) notify(method string, params interface{}) {
+	c.t.Helper()
+	c.send(notification{JSONRPC: "2.0", Method: method, Params: params})
+	if !strings.HasPrefix(method, "textDocument/") {
+		return
+	}
+	for msg := range c.messages {
+		c.handleNotification(msg)
+		if msg.Method == "textDocument/publishDiagnostics" {
+			return
+		}
+	}
+}
+
+func (c *testClient) handleNotification(msg *message) {
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("unexpected message: %s", msg.Method)
+	}
+	var p PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		c.t.Fatal(err)
+	}
+	c.diagnostics[p.URI] = p.Diagnostics
+}
+
+func (c *testClient) initialize() {
+	c.t.Helper()
+	var res InitializeResult
+	c.mustCall("initialize", map[string]interface{}{"capabilities": struct{}{}}, &res)
+	c.notify("initialized", struct{}{})
+}
+
+func (c *testClient) open(uri, text string) {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "lua", Version: 1, Text: text},
+	})
+}
+
+func (c *testClient) change(uri string, version int, text string) {
+	c.t.Helper()
+	var p DidChangeTextDocumentParams
+	p.TextDocument.URI = uri
+	p.TextDocument.Version = version
+	p.ContentChanges = append(p.ContentChanges, struct {
+		Text string `json:"text"`
+	}{text})
+	c.notify("textDocument/didChange", p)
+}
+
+// stop shuts down the server and returns the error returned by Serve.
+func (c *testClient) stop(shutdown bool) error {
+	c.t.Helper()
+	if shutdown {
+		c.mustCall("shutdown", nil, nil)
+	}
+	c.send(notification{JSONRPC: "2.0", Method: "exit"})
+	return <-c.served
+}
+
+func mustMarshal(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func at(uri string, line, char int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: char},
+	}
+}
+
+func rng(line1, char1, line2, char2 int) Range {
+	return Range{Start: Position{line1, char1}, End: Position{line2, char2}}
+}
+
+func TestLifecycle(t *testing.T) {
+	c := newTestClient(t)
+	err := c.call("textDocument/hover", at("file:///a.lua", 0, 0), nil)
+	if err == nil || err.Code != codeServerNotInitialized {
+		t.Errorf("expected server not initialized error, got %v", err)
+	}
+	var res InitializeResult
+	c.mustCall("initialize", struct{}{}, &res)
+	if !res.Capabilities.HoverProvider || res.Capabilities.TextDocumentSync != textDocumentSyncFull {
+		t.Errorf("unexpected capabilities: %+v", res.Capabilities)
+	}
+	err = c.call("textDocument/foo", struct{}{}, nil)
+	if err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("expected method not found error, got %v", err)
+	}
+	if err := c.stop(true); err != nil {
+		t.Errorf("Serve returned %v", err)
+	}
+
+	c = newTestClient(t)
+	c.initialize()
+	if err := c.stop(false); err != ErrExitWithoutShutdown {
+		t.Errorf("expected ErrExitWithoutShutdown, got %v", err)
+	}
+}
+
+func TestHandlerPanics(t *testing.T) {
+	requestHandlers["test/panic"] = func(*Server, json.RawMessage) (interface{}, error) { panic("oops") }
+	notificationHandlers["test/panic"] = func(*Server, json.RawMessage) error { panic("oops") }
+	defer delete(requestHandlers, "test/panic")
+	defer delete(notificationHandlers, "test/panic")
+
+	c := newTestClient(t)
+	defer c.stop(true)
+	c.initialize()
+
+	err := c.call("test/panic", struct{}{}, nil)
+	if err == nil || err.Code != codeInternalError || err.Message != "internal error: oops" {
+		t.Errorf("expected internal error, got %v", err)
+	}
+
+	c.send(notification{JSONRPC: "2.0", Method: "test/panic"})
+	msg := <-c.messages
+	var p LogMessageParams
+	if msg == nil || msg.Method != "window/logMessage" {
+		t.Fatalf("expected window/logMessage, got %+v", msg)
+	}
+	if err := json.Unmarshal(msg.Params, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != MessageTypeError || p.Message != "internal error: oops" {
+		t.Errorf("unexpected log message %+v", p)
+	}
+
+	// The server is still running.
+	c.open("file:///a.lua", "x = 1")
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newTestClient(t)
+	defer c.stop(true)
+	c.initialize()
+
+	const uri = "file:///tmp/test.lua"
+	c.open(uri, "local x = = 1\nprint(x)\nif x then\n  y z\nend\n")
+	want := []Diagnostic{
+		{Range: rng(0, 10, 0, 11), Severity: SeverityError, Source: "golua", Message: "unexpected symbol near '='"},
+		{Range: rng(3, 4, 3, 5), Severity: SeverityError, Source: "golua", Message: "expected '=' near 'z'"},
+	}
+	if got := c.diagnostics[uri]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diagnostics %+v, want %+v", got, want)
+	}
+
+	c.change(uri, 2, "do\n  goto nowhere\nend\n")
+	want = []Diagnostic{
+		{Range: rng(1, 2, 1, 14), Severity: SeverityError, Source: "golua", Message: "no visible label 'nowhere'"},
+	}
+	if got := c.diagnostics[uri]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got diagnostics %+v, want %+v", got, want)
+	}
+
+	c.change(uri, 3, "#!/usr/bin/env golua\nprint('ok')\n")
+	if got := c.diagnostics[uri]; len(got) != 0 {
+		t.Errorf("expected no diagnostics, got %+v", got)
+	}
+}
+
+const testSource = `local count = 0
+local function incr(step)
+  count = count + step
+  return count
+end
+function report()
+  print(string.format("%d", incr(1)))
+end
+local go = require("golib")
+local t = {}
+function t:method(x) return self, x end
+`
+
+func TestHover(t *testing.T) {
+	c := newTestClient(t)
+	defer c.stop(true)
+	c.initialize()
+	const uri = "file:///test.lua"
+	c.open(uri, testSource)
+
+	tests := []struct {
+		line, char int
+		want       string
+		wantRange  Range
+	}{
+		{2, 3, "```lua\nlocal count\n```\nUpvalue declared on line 1.", rng(2, 2, 2, 7)},
+		{2, 18, "```lua\n(parameter) step\n```\nParameter declared on line 2.", rng(2, 18, 2, 22)},
+		{1, 17, "```lua\nlocal function incr(step)\n```\nLocal variable declared on line 2.", rng(1, 15, 1, 19)},
+		{6, 6, "```lua\n(global) print\n```\nA function of the golua standard library.", rng(6, 2, 6, 7)},
+		{6, 16, "```lua\nstring.format\n```\nA function of the golua standard library.", rng(6, 15, 6, 21)},
+		{5, 10, "```lua\nfunction report()\n```\nGlobal variable first assigned on line 6.", rng(5, 9, 5, 15)},
+		{10, 30, "```lua\n(parameter) self\n```\nImplicit parameter of a method.", rng(10, 28, 10, 32)},
+	}
+	for _, test := range tests {
+		var h *Hover
+		c.mustCall("textDocument/hover", at(uri, test.line, test.char), &h)
+		if h == nil {
+			t.Errorf("%d:%d: no hover", test.line, test.char)
+			continue
+		}
+		if h.Contents.Value != test.want {
+			t.Errorf("%d:%d: got %q, want %q", test.line, test.char, h.Contents.Value, test.want)
+		}
+		if h.Range == nil || *h.Range != test.wantRange {
+			t.Errorf("%d:%d: got range %v, want %v", test.line, test.char, h.Range, test.wantRange)
+		}
+	}
+
+	var h *Hover
+	c.mustCall("textDocument/hover", at(uri, 8, 3), &h)
+	if h != nil {
+		t.Errorf("expected no hover on keyword, got %+v", h)
+	}
+
+	c.mustCall("textDocument/hover", at(uri, 8, 7), &h)
+	if h == nil || !strings.Contains(h.Contents.Value, "It holds the golib table.") {
+		t.Errorf("expected hover for golib module, got %+v", h)
+	}
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	c := newTestClient(t)
+	defer c.stop(true)
+	c.initialize()
+	const uri = "file:///test.lua"
+	c.open(uri, testSource)
+
+	var loc *Location
+	c.mustCall("textDocument/definition", at(uri, 6, 31), &loc)
+	if want := (Location{URI: uri, Range: rng(1, 15, 1, 19)}); loc == nil || *loc != want {
+		t.Errorf("got definition %v, want %v", loc, want)
+	}
+	c.mustCall("textDocument/definition", at(uri, 6, 3), &loc)
+	if loc != nil {
+		t.Errorf("expected no definition for builtin, got %v", loc)
+	}
+
+	var p ReferenceParams
+	p.TextDocumentPositionParams = at(uri, 0, 7)
+	p.Context.IncludeDeclaration = true
+	var locs []Location
+	c.mustCall("textDocument/references", p, &locs)
+	want := []Location{
+		{URI: uri, Range: rng(0, 6, 0, 11)},
+		{URI: uri, Range: rng(2, 2, 2, 7)},
+		{URI: uri, Range: rng(2, 10, 2, 15)},
+		{URI: uri, Range: rng(3, 9, 3, 14)},
+	}
+	if !reflect.DeepEqual(locs, want) {
+		t.Errorf("got references %v, want %v", locs, want)
+	}
+	p.Context.IncludeDeclaration = false
+	c.mustCall("textDocument/references", p, &locs)
+	if !reflect.DeepEqual(locs, want[1:]) {
+		t.Errorf("got references %v, want %v", locs, want[1:])
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := newTestClient(t)
+	defer c.stop(true)
+	c.initialize()
+	const uri = "file:///test.lua"
+	c.open(uri, testSource+"local function outer()\n  local function inner() end\nend\n")
+
+	var syms []DocumentSymbol
+	c.mustCall("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &syms)
+	type sym struct {
+		name     string
+		kind     int
+		children []sym
+	}
+	var simplify func([]DocumentSymbol) []sym
+	simplify = func(docSyms []DocumentSymbol) []sym {
+		var s []sym
+		for _, d := range docSyms {
+			s = append(s, sym{d.Name, d.Kind, simplify(d.Children)})
+		}
+		return s
+	}
+	want := []sym{
+		{"count", SymbolKindVariable, nil},
+		{"incr", SymbolKindFunction, nil},
+		{"report", SymbolKindFunction, nil},
+		{"go", SymbolKindModule, nil},
+		{"t", SymbolKindVariable, nil},
+		{"t:method", SymbolKindMethod, nil},
+		{"outer", SymbolKindFunction, []sym{{"inner", SymbolKindFunction, nil}}},
+	}
+	if got := simplify(syms); !reflect.DeepEqual(got, want) {
+		t.Errorf("got symbols %v, want %v", got, want)
+	}
+	if len(syms) > 1 {
+		if want := rng(1, 15, 4, 3); syms[1].Range != want {
+			t.Errorf("got range %v for incr, want %v", syms[1].Range, want)
+		}
+		if want := rng(1, 15, 1, 19); syms[1].SelectionRange != want {
+			t.Errorf("got selection range %v for incr, want %v", syms[1].SelectionRange, want)
+		}
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	c := newTestClient(t)
+	defer c.stop(true)
+	c.initialize()
+	const uri = "file:///test.lua"
+
+	labels := func(line, char int) []string {
+		var list CompletionList
+		c.mustCall("textDocument/completion", at(uri, line, char), &list)
+		var l []string
+		for _, item := range list.Items {
+			l = append(l, item.Label)
+		}
+		return l
+	}
+	check := func(got []string, want ...string) {
+		t.Helper()
+		for _, w := range want {
+			found := false
+			for _, g := range got {
+				found = found || g == w
+			}
+			if !found {
+				t.Errorf("%q not in %q", w, got)
+			}
+		}
+	}
+
+	c.open(uri, testSource+"string.fo")
+	if got := labels(11, 9); !reflect.DeepEqual(got, []string{"format"}) {
+		t.Errorf("got %q, want [format]", got)
+	}
+	c.change(uri, 2, testSource+"go.")
+	check(labels(11, 3), "import")
+	if rt.QuotasAvailable {
+		// The runtime library is only available with quotas.
+		c.change(uri, 3, testSource+"runtime.")
+		check(labels(11, 8), "callcontext", "context", "killcontext")
+	}
+	c.change(uri, 4, "local alpha = 1\nlocal function f(arg)\n  local inner\n  \nend\n")
+	got := labels(3, 2)
+	check(got, "alpha", "arg", "f", "inner", "print", "string", "while")
+	c.change(uri, 5, "local alpha = 1\nlocal function f(arg)\n  local inner\n  a\nend\n")
+	got = labels(3, 3)
+	check(got, "alpha", "arg", "assert", "and")
+	for _, l := range got {
+		if !strings.HasPrefix(l, "a") {
+			t.Errorf("unexpected completion %q", l)
+		}
+	}
+	c.change(uri, 6, "do local hidden end\n")
+	for _, l := range labels(1, 0) {
+		if l == "hidden" {
+			t.Errorf("local out of scope proposed")
+		}
+	}
+}
+
+func TestCompletionContext(t *testing.T) {
+	tests := []struct {
+		line   string
+		path   []string
+		prefix string
+	}{
+		{"  pri", nil, "pri"},
+		{"x = string.fo", []string{"string"}, "fo"},
+		{"a.b.", []string{"a", "b"}, ""},
+		{"s:up", []string{"s"}, "up"},
+		{"a:b.c", nil, "c"},
+		{"(x).y", nil, "y"},
+	}
+	for _, test := range tests {
+		path, prefix := completionContext([]byte(test.line))
+		if !reflect.DeepEqual(path, test.path) || prefix != test.prefix {
+			t.Errorf("%q: got %q %q, want %q %q", test.line, path, prefix, test.path, test.prefix)
+		}
+	}
+}
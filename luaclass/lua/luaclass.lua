@@ -0,0 +1,84 @@
+local p = geom.new(3, 4)
+print(p)
+--> =point(3, 4)
+
+print(p:norm(), p.x, p.y, p.kind)
+--> =5	3	4	*luaclass_test.point
+
+-- Properties can be set
+p.x = 6
+p.y = 8
+print(p, p:norm())
+--> =point(6, 8)	10
+
+print(pcall(function() p.x = "hello" end))
+--> ~false\t.*x must be a number
+
+print(pcall(function() p.kind = "other" end))
+--> ~false\t.*point.kind is read-only
+
+print(pcall(function() p.foo = 1 end))
+--> ~false\t.*point has no property "foo"
+
+-- Unknown fields are nil
+print(p.foo, p[1])
+--> =nil	nil
+
+-- Methods check their arguments
+print(pcall(p.norm, {}))
+--> ~false\t.*#1 must be a point
+
+print(pcall(p.scale, p))
+--> ~false\t.*2 arguments needed
+
+print(p:scale(0.5))
+--> =point(3, 4)
+
+-- Metamethods
+print(p == geom.new(3, 4), p == geom.new(4, 3), p ~= geom.new(1, 1))
+--> =true	false	true
+
+print(geom.new(1, 1) < p, p < geom.new(1, 1))
+--> =true	false
+
+print(#p, p + geom.new(1, 1))
+--> =2	point(4, 5)
+
+print(getmetatable(p).__name)
+--> =point
+
+do
+    local q <close> = geom.new(1, 2)
+end
+--> =closing point(1, 2)
+
+-- Inheritance
+local p3 = geom.new3(1, 2, 2)
+print(p3, p3.kind, #p3)
+--> =point3(1, 2, 2)	*luaclass_test.point3	3
+
+print(p3:norm(), p3.x, p3.z)
+--> =3	1	2
+
+p3.z = 4
+p3:scale(2)
+print(p3)
+--> =point3(2, 4, 4)
+
+print(p3 + p)
+--> =point(5, 8)
+
+-- Parent methods accept child values but not the reverse
+print(p.norm(p3))
+--> ~^4\.47
+
+print(pcall(p3.norm, p))
+--> ~false\t.*#1 must be a point3
+
+print(pcall(function() return p.z end))
+--> =true	nil
+
+do
+    local q <close> = p3
+end
+--> =closing point3(2, 4, 4)
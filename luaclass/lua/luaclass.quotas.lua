@@ -0,0 +1,18 @@
+local p = geom.new(3, 4)
+
+-- Methods and properties are only available in contexts with matching
+-- compliance flags.
+print(runtime.callcontext({flags="cpusafe memsafe"}, function()
+    print(p:norm(), p.x)
+    --> =5	3
+
+    print(pcall(p.unsafe, p))
+    --> ~false\t.*missing flags: .*cpusafe
+
+    print(pcall(function() return p.secret end))
+    --> ~false\t.*point.secret: missing flags: .*cpusafe
+end))
+--> =done
+
+print(p.secret, p:unsafe())
+--> =shh	5
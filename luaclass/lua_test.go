@@ -0,0 +1,270 @@
+package luaclass_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/arnodel/golua/lib"
+	"github.com/arnodel/golua/luaclass"
+	"github.com/arnodel/golua/luatesting"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+type point struct {
+	x, y float64
+}
+
+type point3 struct {
+	point
+	z float64
+}
+
+func (p *point) String() string {
+	return fmt.Sprintf("point(%g, %g)", p.x, p.y)
+}
+
+func (p *point3) String() string {
+	return fmt.Sprintf("point3(%g, %g, %g)", p.x, p.y, p.z)
+}
+
+// coords returns the 2D coordinates of a point or point3.
+func coords(x interface{}) *point {
+	switch p := x.(type) {
+	case *point:
+		return p
+	case *point3:
+		return &p.point
+	}
+	panic("not a point")
+}
+
+func pointArg(t *rt.Thread, c *rt.GoCont, n int) (*point, error) {
+	x, err := pointClass.Arg(t, c, n)
+	if err != nil {
+		return nil, err
+	}
+	return coords(x), nil
+}
+
+func floatProperty(name string, get func(x interface{}) *float64) luaclass.Property {
+	return luaclass.Property{
+		Name: name,
+		Get: func(t *rt.Thread, x interface{}) (rt.Value, error) {
+			return rt.FloatValue(*get(x)), nil
+		},
+		Set: func(t *rt.Thread, x interface{}, v rt.Value) error {
+			f, ok := rt.ToFloat(v)
+			if !ok {
+				return fmt.Errorf("%s must be a number", name)
+			}
+			*get(x) = f
+			return nil
+		},
+		Flags: luaclass.AllFlags,
+	}
+}
+
+// The classes refer to functions which refer to the classes, so they are filled
+// in init to avoid an initialization cycle.
+var (
+	pointClass  = &luaclass.Class{Name: "point"}
+	point3Class = &luaclass.Class{Name: "point3", Parent: pointClass}
+)
+
+func init() {
+	pointClass.Constructors = []luaclass.Method{
+		{Name: "new", Fn: newPoint, NArgs: 2, Flags: luaclass.AllFlags},
+	}
+	pointClass.Methods = []luaclass.Method{
+		{Name: "norm", Fn: pointNorm, NArgs: 1, Flags: luaclass.AllFlags},
+		{Name: "scale", Fn: pointScale, NArgs: 2, Flags: luaclass.AllFlags},
+		{Name: "unsafe", Fn: pointNorm, NArgs: 1},
+	}
+	pointClass.Properties = []luaclass.Property{
+		floatProperty("x", func(x interface{}) *float64 { return &coords(x).x }),
+		floatProperty("y", func(x interface{}) *float64 { return &coords(x).y }),
+		{
+			Name: "kind",
+			Get: func(t *rt.Thread, x interface{}) (rt.Value, error) {
+				return rt.StringValue(fmt.Sprintf("%T", x)), nil
+			},
+			Flags: luaclass.AllFlags,
+		},
+		{
+			Name: "secret",
+			Get: func(t *rt.Thread, x interface{}) (rt.Value, error) {
+				return rt.StringValue("shh"), nil
+			},
+		},
+	}
+	pointClass.Metamethods = []luaclass.Method{
+		{Name: "__tostring", Fn: pointToString, NArgs: 1, Flags: luaclass.AllFlags},
+		{Name: "__eq", Fn: pointEq, NArgs: 2, Flags: luaclass.AllFlags},
+		{Name: "__lt", Fn: pointLt, NArgs: 2, Flags: luaclass.AllFlags},
+		{Name: "__len", Fn: pointLen, NArgs: 1, Flags: luaclass.AllFlags},
+		{Name: "__add", Fn: pointAdd, NArgs: 2, Flags: luaclass.AllFlags},
+		{Name: "__close", Fn: pointClose, NArgs: 1, Flags: luaclass.AllFlags},
+	}
+
+	point3Class.Constructors = []luaclass.Method{
+		{Name: "new3", Fn: newPoint3, NArgs: 3, Flags: luaclass.AllFlags},
+	}
+	point3Class.Methods = []luaclass.Method{
+		{Name: "norm", Fn: point3Norm, NArgs: 1, Flags: luaclass.AllFlags},
+	}
+	point3Class.Properties = []luaclass.Property{
+		floatProperty("z", func(x interface{}) *float64 { return &x.(*point3).z }),
+	}
+	point3Class.Metamethods = []luaclass.Method{
+		{Name: "__tostring", Fn: pointToString, NArgs: 1, Flags: luaclass.AllFlags},
+	}
+}
+
+func newPoint(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	var x, y float64
+	err := c.CheckNArgs(2)
+	if err == nil {
+		x, err = c.FloatArg(0)
+	}
+	if err == nil {
+		y, err = c.FloatArg(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, pointClass.New(t.Runtime, &point{x: x, y: y})), nil
+}
+
+func newPoint3(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	var x, y, z float64
+	err := c.CheckNArgs(3)
+	if err == nil {
+		x, err = c.FloatArg(0)
+	}
+	if err == nil {
+		y, err = c.FloatArg(1)
+	}
+	if err == nil {
+		z, err = c.FloatArg(2)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, point3Class.New(t.Runtime, &point3{point{x, y}, z})), nil
+}
+
+func pointNorm(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	p, err := pointArg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, rt.FloatValue(math.Hypot(p.x, p.y))), nil
+}
+
+func point3Norm(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	x, err := point3Class.Arg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	p := x.(*point3)
+	return c.PushingNext1(t.Runtime, rt.FloatValue(math.Sqrt(p.x*p.x+p.y*p.y+p.z*p.z))), nil
+}
+
+func pointScale(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	var (
+		p *point
+		k float64
+	)
+	err := c.CheckNArgs(2)
+	if err == nil {
+		p, err = pointArg(t, c, 0)
+	}
+	if err == nil {
+		k, err = c.FloatArg(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.x *= k
+	p.y *= k
+	return c.PushingNext1(t.Runtime, c.Arg(0)), nil
+}
+
+func pointToString(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	x, err := pointClass.Arg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, rt.StringValue(x.(fmt.Stringer).String())), nil
+}
+
+func pointEq(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	p, err := pointArg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	q, err := pointArg(t, c, 1)
+	if err != nil {
+		return c.PushingNext1(t.Runtime, rt.BoolValue(false)), nil
+	}
+	return c.PushingNext1(t.Runtime, rt.BoolValue(*p == *q)), nil
+}
+
+func pointLt(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	p, err := pointArg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	q, err := pointArg(t, c, 1)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, rt.BoolValue(math.Hypot(p.x, p.y) < math.Hypot(q.x, q.y))), nil
+}
+
+func pointLen(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	x, err := pointClass.Arg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(2)
+	if _, ok := x.(*point3); ok {
+		n = 3
+	}
+	return c.PushingNext1(t.Runtime, rt.IntValue(n)), nil
+}
+
+func pointAdd(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	p, err := pointArg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	q, err := pointArg(t, c, 1)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, pointClass.New(t.Runtime, &point{x: p.x + q.x, y: p.y + q.y})), nil
+}
+
+func pointClose(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	x, err := pointClass.Arg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	t.Runtime.Stdout.Write([]byte("closing " + x.(fmt.Stringer).String() + "\n"))
+	return c.Next(), nil
+}
+
+func setup(r *rt.Runtime) func() {
+	cleanup := lib.LoadAll(r)
+	pkg := rt.NewTable()
+	pointClass.Register(r, pkg)
+	point3Class.Register(r, pkg)
+	r.SetEnv(r.GlobalEnv(), "geom", rt.TableValue(pkg))
+	return cleanup
+}
+
+func TestLuaClass(t *testing.T) {
+	luatesting.RunLuaTestsInDir(t, "lua", setup)
+}
@@ -0,0 +1,301 @@
+// Package luaclass makes it easy to expose Go types to Lua as userdata.  A
+// Class declares the methods, properties, metamethods and constructors of a
+// type, and luaclass builds the metatable and the __index / __newindex
+// dispatch, e.g.
+//
+//	var PointClass = &luaclass.Class{Name: "point"}
+//
+//	func init() {
+//		PointClass.Constructors = []luaclass.Method{
+//			{Name: "new", Fn: newPoint, NArgs: 2, Flags: luaclass.AllFlags},
+//		}
+//		PointClass.Methods = []luaclass.Method{
+//			{Name: "norm", Fn: pointNorm, NArgs: 1, Flags: luaclass.AllFlags},
+//		}
+//		PointClass.Properties = []luaclass.Property{
+//			{Name: "x", Get: getX, Set: setX, Flags: luaclass.AllFlags},
+//		}
+//		PointClass.Metamethods = []luaclass.Method{
+//			{Name: "__add", Fn: pointAdd, NArgs: 2, Flags: luaclass.AllFlags},
+//		}
+//	}
+//
+// (Methods usually refer to the class, so filling it in an init function
+// avoids an initialization cycle.)
+//
+// Go functions then use PointClass.New to push values of the class and
+// PointClass.Arg to check their arguments:
+//
+//	func pointNorm(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+//		x, err := PointClass.Arg(t, c, 0)
+//		if err != nil {
+//			return nil, err
+//		}
+//		p := x.(*Point)
+//		return c.PushingNext1(t.Runtime, rt.FloatValue(math.Hypot(p.X, p.Y))), nil
+//	}
+//
+// A class can inherit from a Parent class.  It then has the methods,
+// properties and metamethods of its parent (unless it overrides them), and its
+// values are accepted where values of the parent class are expected.
+//
+// Methods, metamethods and constructors are Go functions with their own
+// compliance flags (see quotas.md).  Properties also have compliance flags,
+// which are checked when they are accessed.
+package luaclass
+
+import (
+	"fmt"
+	"strings"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// AllFlags is a shorthand for declaring that a function or property complies
+// with all the safety requirements.
+const AllFlags = rt.ComplyCpuSafe | rt.ComplyMemSafe | rt.ComplyTimeSafe | rt.ComplyIoSafe
+
+// A Method is a Go function exposed to Lua.  For methods and metamethods, the
+// value the method is called on is argument 0 (and it is included in NArgs).
+type Method struct {
+	Name     string
+	Fn       func(*rt.Thread, *rt.GoCont) (rt.Cont, error)
+	NArgs    int
+	Variadic bool
+	Flags    rt.ComplianceFlags
+}
+
+// A Property is a field of values of a class which Lua code can read (with
+// Get) and write (with Set).  If Set is nil, the property is read-only.  The
+// x argument of Get and Set is the Go value of the userdata.
+type Property struct {
+	Name  string
+	Get   func(t *rt.Thread, x interface{}) (rt.Value, error)
+	Set   func(t *rt.Thread, x interface{}, v rt.Value) error
+	Flags rt.ComplianceFlags
+}
+
+// A Class describes how values of a Go type are exposed to Lua.  It should be
+// declared once (e.g. as a package variable) and not modified after it has
+// been used in a runtime.
+type Class struct {
+	Name         string // Name of the class, the __name of its metatable
+	Parent       *Class // If not nil, the class inherits from Parent
+	Constructors []Method
+	Methods      []Method
+	Properties   []Property
+	Metamethods  []Method // Any metamethod apart from __index, __newindex and __name
+}
+
+// classInfo holds what a class needs in a given runtime.
+type classInfo struct {
+	class   *Class
+	meta    *rt.Table
+	methods map[string]rt.Value
+	props   map[string]*Property
+}
+
+// A registry holds the classes registered in a runtime.
+type registry struct {
+	byClass map[*Class]*classInfo
+	byMeta  map[*rt.Table]*classInfo
+}
+
+type registryKeyType struct{}
+
+var registryKey = rt.AsValue(registryKeyType{})
+
+func getRegistry(r *rt.Runtime) *registry {
+	reg, ok := r.Registry(registryKey).Interface().(*registry)
+	if !ok {
+		reg = &registry{
+			byClass: map[*Class]*classInfo{},
+			byMeta:  map[*rt.Table]*classInfo{},
+		}
+		r.SetRegistry(registryKey, rt.AsValue(reg))
+	}
+	return reg
+}
+
+// Register makes the class available in r and adds its constructors to pkg (if
+// it is not nil).  It returns the metatable of the class.  Registering a class
+// more than once is harmless; classes are also registered automatically the
+// first time they are used in a runtime.
+func (c *Class) Register(r *rt.Runtime, pkg *rt.Table) *rt.Table {
+	info := c.info(r)
+	if pkg != nil {
+		for _, m := range c.Constructors {
+			f := r.SetEnvGoFunc(pkg, m.Name, m.Fn, m.NArgs, m.Variadic)
+			f.SolemnlyDeclareCompliance(m.Flags)
+		}
+	}
+	return info.meta
+}
+
+// Metatable returns the metatable of the class in r.
+func (c *Class) Metatable(r *rt.Runtime) *rt.Table {
+	return c.info(r).meta
+}
+
+// New returns a new userdata of the class whose value is x.
+func (c *Class) New(r *rt.Runtime, x interface{}) rt.Value {
+	return r.NewUserDataValue(x, c.info(r).meta)
+}
+
+// Value returns the Go value of v if v is a userdata of the class (or of a
+// class inheriting from it).
+func (c *Class) Value(r *rt.Runtime, v rt.Value) (interface{}, bool) {
+	u, ok := v.TryUserData()
+	if !ok {
+		return nil, false
+	}
+	info := getRegistry(r).byMeta[u.Metatable()]
+	if info == nil {
+		return nil, false
+	}
+	for cls := info.class; cls != nil; cls = cls.Parent {
+		if cls == c {
+			return u.Value(), true
+		}
+	}
+	return nil, false
+}
+
+// Arg returns the Go value of the argument n of c (starting from 0), or an
+// error if it is not a value of the class.
+func (c *Class) Arg(t *rt.Thread, cont *rt.GoCont, n int) (interface{}, error) {
+	x, ok := c.Value(t.Runtime, cont.Arg(n))
+	if !ok {
+		return nil, fmt.Errorf("#%d must be a %s", n+1, c.Name)
+	}
+	return x, nil
+}
+
+// info returns the class info in r, building it if necessary.
+func (c *Class) info(r *rt.Runtime) *classInfo {
+	reg := getRegistry(r)
+	if info := reg.byClass[c]; info != nil {
+		return info
+	}
+	info := &classInfo{
+		class:   c,
+		meta:    rt.NewTable(),
+		methods: map[string]rt.Value{},
+		props:   map[string]*Property{},
+	}
+	if c.Parent != nil {
+		parent := c.Parent.info(r)
+		for name, m := range parent.methods {
+			info.methods[name] = m
+		}
+		for name, p := range parent.props {
+			info.props[name] = p
+		}
+		// Copy inherited metamethods (i.e. everything apart from the __index,
+		// __newindex and __name which are specific to each class).
+		var k, v rt.Value
+		for {
+			var ok bool
+			k, v, ok = parent.meta.Next(k)
+			if !ok || k.IsNil() {
+				break
+			}
+			switch k.Interface() {
+			case "__index", "__newindex", "__name":
+			default:
+				info.meta.Set(k, v)
+			}
+		}
+	}
+	for _, m := range c.Methods {
+		info.methods[m.Name] = rt.FunctionValue(newGoFunction(m))
+	}
+	for i := range c.Properties {
+		p := &c.Properties[i]
+		info.props[p.Name] = p
+	}
+	for _, m := range c.Metamethods {
+		switch m.Name {
+		case "__index", "__newindex", "__name":
+			panic(fmt.Sprintf("class %s: metamethod %s cannot be overridden", c.Name, m.Name))
+		}
+		if !strings.HasPrefix(m.Name, "__") {
+			panic(fmt.Sprintf("class %s: invalid metamethod name %q", c.Name, m.Name))
+		}
+		r.SetEnv(info.meta, m.Name, rt.FunctionValue(newGoFunction(m)))
+	}
+	index := rt.NewGoFunction(info.index, "__index", 2, false)
+	newindex := rt.NewGoFunction(info.newindex, "__newindex", 3, false)
+	rt.SolemnlyDeclareCompliance(AllFlags, index, newindex)
+	r.SetEnv(info.meta, "__name", rt.StringValue(c.Name))
+	r.SetEnv(info.meta, "__index", rt.FunctionValue(index))
+	r.SetEnv(info.meta, "__newindex", rt.FunctionValue(newindex))
+	reg.byClass[c] = info
+	reg.byMeta[info.meta] = info
+	return info
+}
+
+func newGoFunction(m Method) *rt.GoFunction {
+	f := rt.NewGoFunction(m.Fn, m.Name, m.NArgs, m.Variadic)
+	f.SolemnlyDeclareCompliance(m.Flags)
+	return f
+}
+
+// index implements __index: methods first, then properties.
+func (info *classInfo) index(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.CheckNArgs(2); err != nil {
+		return nil, err
+	}
+	x, err := info.class.Arg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := c.Arg(1).TryString()
+	if !ok {
+		return c.PushingNext1(t.Runtime, rt.NilValue), nil
+	}
+	if m, ok := info.methods[name]; ok {
+		return c.PushingNext1(t.Runtime, m), nil
+	}
+	p := info.props[name]
+	if p == nil || p.Get == nil {
+		return c.PushingNext1(t.Runtime, rt.NilValue), nil
+	}
+	if err := t.CheckRequiredFlags(p.Flags); err != nil {
+		return nil, fmt.Errorf("%s.%s: %w", info.class.Name, name, err)
+	}
+	v, err := p.Get(t, x)
+	if err != nil {
+		return nil, err
+	}
+	return c.PushingNext1(t.Runtime, v), nil
+}
+
+// newindex implements __newindex: only properties with a setter can be set.
+func (info *classInfo) newindex(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+	if err := c.CheckNArgs(3); err != nil {
+		return nil, err
+	}
+	x, err := info.class.Arg(t, c, 0)
+	if err != nil {
+		return nil, err
+	}
+	name, err := c.StringArg(1)
+	if err != nil {
+		return nil, err
+	}
+	p := info.props[name]
+	switch {
+	case p == nil:
+		return nil, fmt.Errorf("%s has no property %q", info.class.Name, name)
+	case p.Set == nil:
+		return nil, fmt.Errorf("%s.%s is read-only", info.class.Name, name)
+	}
+	if err := t.CheckRequiredFlags(p.Flags); err != nil {
+		return nil, fmt.Errorf("%s.%s: %w", info.class.Name, name, err)
+	}
+	if err := p.Set(t, x, c.Arg(2)); err != nil {
+		return nil, err
+	}
+	return c.Next(), nil
+}
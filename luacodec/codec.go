@@ -0,0 +1,757 @@
+// Package luacodec converts between Lua values and Go values, driven by struct
+// tags in the same way as encoding/json.  It is meant for Go programs which
+// embed golua and read configuration or data from Lua scripts, e.g.
+//
+//	type Server struct {
+//		Host    string        `lua:"host"`
+//		Port    int           `lua:"port,omitempty"`
+//		Timeout time.Duration `lua:"timeout"`
+//	}
+//
+//	var servers []Server
+//	err := luacodec.Decode(t.GlobalEnv().Get(rt.StringValue("servers")), &servers)
+//
+// The field tag `lua:"name,omitempty"` gives the name of the table key a field
+// is stored under (the Go field name by default) and whether it is left out by
+// Encode when it has its zero value.  Fields tagged `lua:"-"` are ignored.
+// Fields of embedded structs are treated as fields of the outer struct.
+//
+// The conversions are as follows.
+//
+//   - Booleans, numbers and strings convert to the corresponding Go types.
+//     Integer fields only accept numbers with an integral value which fits in
+//     the field.  Strings are not converted to numbers and vice versa.
+//   - Tables convert to structs, maps, slices and arrays.  Slices and arrays
+//     are sequences, with the first element at index 1.
+//   - Strings convert to []byte.
+//   - time.Duration is a number of seconds, e.g. 1.5 for 1500ms.  Decode also
+//     accepts strings understood by time.ParseDuration, e.g. "1m30s".
+//   - Types implementing encoding.TextMarshaler / encoding.TextUnmarshaler are
+//     strings.
+//   - Types implementing LuaMarshaler / LuaUnmarshaler convert themselves.
+//   - rt.Value fields are stored as they are.
+//   - interface{} values decode as nil, bool, int64, float64, string,
+//     []interface{} (for sequences), map[string]interface{} (for tables with
+//     only string keys) or map[interface{}]interface{}.  Other Lua values
+//     (functions, userdata, coroutines) decode as their rt.Value.
+//
+// A nil Lua value leaves the Go value it is decoded into unchanged, so missing
+// fields in a table keep their default value.  Keys of a table which do not
+// match any field of a struct are ignored.
+//
+// Values which contain themselves (e.g. a table t with t.self = t, or a Go
+// pointer cycle) cannot be converted and cause an error, unless the Go type
+// they are decoded into is not recursive.
+//
+// Errors are returned as *Error, which gives the Lua path of the offending
+// value, e.g. "servers[2].port: expected number, got string".
+package luacodec
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arnodel/golua/luastrings"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// LuaMarshaler is implemented by types which can encode themselves as a Lua
+// value.
+type LuaMarshaler interface {
+	MarshalLua() (rt.Value, error)
+}
+
+// LuaUnmarshaler is implemented by types which can decode themselves from a
+// Lua value.  UnmarshalLua is called even if the value is nil.
+type LuaUnmarshaler interface {
+	UnmarshalLua(rt.Value) error
+}
+
+// Error is the type of errors returned by Encode and Decode.
+type Error struct {
+	Path string // Lua path of the value, e.g. "servers[2].port" (empty for the root value)
+	Err  error
+}
+
+var _ error = (*Error)(nil)
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Decode stores the Go value corresponding to v in the value pointed to by out,
+// which must be a non-nil pointer.
+func Decode(v rt.Value, out interface{}) error {
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return &Error{Err: fmt.Errorf("Decode requires a non-nil pointer, got %T", out)}
+	}
+	return new(decodeState).decode(v, ptr.Elem(), "")
+}
+
+// Encode returns the Lua value corresponding to x.  Nil pointers, interfaces,
+// slices and maps encode as nil.
+func Encode(x interface{}) (rt.Value, error) {
+	return new(encodeState).encode(reflect.ValueOf(x), "")
+}
+
+var (
+	valueType           = reflect.TypeOf(rt.Value{})
+	anyType             = reflect.TypeOf((*interface{})(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	marshalerType       = reflect.TypeOf((*LuaMarshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*LuaUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+//
+// Decoding
+//
+
+// decodeState holds the state of a call to Decode.
+type decodeState struct {
+	// Tables currently being decoded with the Go type they are decoded into.
+	// Decoding the same table into the same type again means that the table
+	// contains itself, which would recurse forever.
+	visiting map[decodeVisit]bool
+}
+
+type decodeVisit struct {
+	tbl *rt.Table
+	tp  reflect.Type
+}
+
+// enter records that tbl is being decoded into a value of type tp.  It returns
+// an error if that is already the case.  If it returns nil, leave must be called
+// when tbl is decoded.
+func (d *decodeState) enter(tbl *rt.Table, tp reflect.Type, path string) error {
+	key := decodeVisit{tbl: tbl, tp: tp}
+	if d.visiting[key] {
+		return pathError(path, "cycle in table")
+	}
+	if d.visiting == nil {
+		d.visiting = map[decodeVisit]bool{}
+	}
+	d.visiting[key] = true
+	return nil
+}
+
+func (d *decodeState) leave(tbl *rt.Table, tp reflect.Type) {
+	delete(d.visiting, decodeVisit{tbl: tbl, tp: tp})
+}
+
+func (d *decodeState) decode(v rt.Value, dst reflect.Value, path string) error {
+	tp := dst.Type()
+	if dst.CanAddr() && reflect.PtrTo(tp).Implements(unmarshalerType) {
+		return wrapError(path, dst.Addr().Interface().(LuaUnmarshaler).UnmarshalLua(v))
+	}
+	if tp == valueType {
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if v.IsNil() {
+		return nil
+	}
+	if tp == durationType {
+		return decodeDuration(v, dst, path)
+	}
+	if dst.CanAddr() && reflect.PtrTo(tp).Implements(textUnmarshalerType) {
+		s, ok := v.TryString()
+		if !ok {
+			return typeError(path, "string", v)
+		}
+		return wrapError(path, dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)))
+	}
+	switch tp.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(tp.Elem()))
+		}
+		return d.decode(v, dst.Elem(), path)
+	case reflect.Interface:
+		if tp.NumMethod() != 0 {
+			return unsupportedError(path, tp)
+		}
+		x, err := d.decodeAny(v, path)
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			dst.Set(reflect.ValueOf(x))
+		}
+		return nil
+	case reflect.Bool:
+		b, ok := v.TryBool()
+		if !ok {
+			return typeError(path, "boolean", v)
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := decodeInt(v, path)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowInt(n) {
+			return pathError(path, "integer %d out of range for %s", n, tp)
+		}
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := decodeInt(v, path)
+		if err != nil {
+			return err
+		}
+		if n < 0 || dst.OverflowUint(uint64(n)) {
+			return pathError(path, "integer %d out of range for %s", n, tp)
+		}
+		dst.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		f, ok := decodeFloat(v)
+		if !ok {
+			return typeError(path, "number", v)
+		}
+		dst.SetFloat(f)
+	case reflect.String:
+		s, ok := v.TryString()
+		if !ok {
+			return typeError(path, "string", v)
+		}
+		dst.SetString(s)
+	case reflect.Slice:
+		if tp.Elem().Kind() == reflect.Uint8 {
+			if s, ok := v.TryString(); ok {
+				dst.SetBytes([]byte(s))
+				return nil
+			}
+		}
+		tbl, ok := v.TryTable()
+		if !ok {
+			return typeError(path, "table", v)
+		}
+		if err := d.enter(tbl, tp, path); err != nil {
+			return err
+		}
+		defer d.leave(tbl, tp)
+		n := tbl.Len()
+		s := reflect.MakeSlice(tp, int(n), int(n))
+		for i := 0; i < int(n); i++ {
+			if err := d.decode(tbl.Get(rt.IntValue(int64(i+1))), s.Index(i), indexPath(path, int64(i+1))); err != nil {
+				return err
+			}
+		}
+		dst.Set(s)
+	case reflect.Array:
+		tbl, ok := v.TryTable()
+		if !ok {
+			return typeError(path, "table", v)
+		}
+		if err := d.enter(tbl, tp, path); err != nil {
+			return err
+		}
+		defer d.leave(tbl, tp)
+		n := tbl.Len()
+		if n > int64(dst.Len()) {
+			return pathError(path, "sequence of length %d too long for %s", n, tp)
+		}
+		for i := 0; i < int(n); i++ {
+			if err := d.decode(tbl.Get(rt.IntValue(int64(i+1))), dst.Index(i), indexPath(path, int64(i+1))); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		tbl, ok := v.TryTable()
+		if !ok {
+			return typeError(path, "table", v)
+		}
+		if err := d.enter(tbl, tp, path); err != nil {
+			return err
+		}
+		defer d.leave(tbl, tp)
+		if dst.IsNil() {
+			dst.Set(reflect.MakeMap(tp))
+		}
+		return forEach(tbl, func(k, v rt.Value) error {
+			kpath := keyPath(path, k)
+			gk := reflect.New(tp.Key()).Elem()
+			if err := d.decode(k, gk, kpath); err != nil {
+				return &Error{Path: kpath, Err: fmt.Errorf("invalid key: %w", errors.Unwrap(err))}
+			}
+			gv := reflect.New(tp.Elem()).Elem()
+			if err := d.decode(v, gv, kpath); err != nil {
+				return err
+			}
+			dst.SetMapIndex(gk, gv)
+			return nil
+		})
+	case reflect.Struct:
+		tbl, ok := v.TryTable()
+		if !ok {
+			return typeError(path, "table", v)
+		}
+		if err := d.enter(tbl, tp, path); err != nil {
+			return err
+		}
+		defer d.leave(tbl, tp)
+		for _, f := range structFields(tp) {
+			fv := tbl.Get(rt.StringValue(f.name))
+			if fv.IsNil() {
+				continue
+			}
+			if err := d.decode(fv, dst.FieldByIndex(f.index), fieldPath(path, f.name)); err != nil {
+				return err
+			}
+		}
+	default:
+		return unsupportedError(path, tp)
+	}
+	return nil
+}
+
+func decodeInt(v rt.Value, path string) (int64, error) {
+	if n, ok := v.TryInt(); ok {
+		return n, nil
+	}
+	if f, ok := v.TryFloat(); ok {
+		n, tp := rt.FloatToInt(f)
+		if tp != rt.IsInt {
+			return 0, pathError(path, "number %g has no integer representation", f)
+		}
+		return n, nil
+	}
+	return 0, typeError(path, "number", v)
+}
+
+func decodeFloat(v rt.Value) (float64, bool) {
+	if n, ok := v.TryInt(); ok {
+		return float64(n), true
+	}
+	return v.TryFloat()
+}
+
+func decodeDuration(v rt.Value, dst reflect.Value, path string) error {
+	if s, ok := v.TryString(); ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return &Error{Path: path, Err: err}
+		}
+		dst.SetInt(int64(d))
+		return nil
+	}
+	secs, ok := decodeFloat(v)
+	if !ok {
+		return typeError(path, "number or string", v)
+	}
+	d := secs * float64(time.Second)
+	if math.IsNaN(d) || d > math.MaxInt64 || d < math.MinInt64 {
+		return pathError(path, "duration out of range")
+	}
+	dst.SetInt(int64(d))
+	return nil
+}
+
+func (d *decodeState) decodeAny(v rt.Value, path string) (interface{}, error) {
+	tbl, ok := v.TryTable()
+	if !ok {
+		switch v.Type() {
+		case rt.NilType, rt.BoolType, rt.IntType, rt.FloatType, rt.StringType:
+			return v.Interface(), nil
+		default:
+			return v, nil
+		}
+	}
+	if err := d.enter(tbl, anyType, path); err != nil {
+		return nil, err
+	}
+	defer d.leave(tbl, anyType)
+	n := tbl.Len()
+	isSeq, isStrMap := true, true
+	count := int64(0)
+	_ = forEach(tbl, func(k, _ rt.Value) error {
+		count++
+		if _, ok := k.TryString(); !ok {
+			isStrMap = false
+		}
+		if i, ok := k.TryInt(); !ok || i < 1 || i > n {
+			isSeq = false
+		}
+		return nil
+	})
+	switch {
+	case isSeq && count == n && n > 0:
+		s := make([]interface{}, n)
+		for i := range s {
+			x, err := d.decodeAny(tbl.Get(rt.IntValue(int64(i+1))), indexPath(path, int64(i+1)))
+			if err != nil {
+				return nil, err
+			}
+			s[i] = x
+		}
+		return s, nil
+	case isStrMap:
+		m := map[string]interface{}{}
+		err := forEach(tbl, func(k, v rt.Value) error {
+			x, err := d.decodeAny(v, keyPath(path, k))
+			m[k.AsString()] = x
+			return err
+		})
+		return m, err
+	default:
+		m := map[interface{}]interface{}{}
+		err := forEach(tbl, func(k, v rt.Value) error {
+			gk, err := d.decodeAny(k, path)
+			if err != nil {
+				return err
+			}
+			if _, ok := gk.(rt.Value); ok || !reflect.TypeOf(gk).Comparable() {
+				return &Error{Path: path, Err: fmt.Errorf("unsupported key of type %s", k.TypeName())}
+			}
+			x, err := d.decodeAny(v, keyPath(path, k))
+			m[gk] = x
+			return err
+		})
+		return m, err
+	}
+}
+
+// forEach calls f for each key-value pair of tbl, stopping at the first error.
+func forEach(tbl *rt.Table, f func(k, v rt.Value) error) error {
+	var k, v rt.Value
+	for {
+		var ok bool
+		k, v, ok = tbl.Next(k)
+		if !ok || k.IsNil() {
+			return nil
+		}
+		if err := f(k, v); err != nil {
+			return err
+		}
+	}
+}
+
+//
+// Encoding
+//
+
+// encodeState holds the state of a call to Encode.
+type encodeState struct {
+	// Pointers, maps and slices currently being encoded.  Encoding one of them
+	// again means that it contains itself, which would recurse forever.
+	visiting map[encodeVisit]bool
+}
+
+type encodeVisit struct {
+	ptr uintptr
+	len int // For slices, which may share the same underlying array
+	tp  reflect.Type
+}
+
+// enter records that x (a non-nil pointer, map or slice) is being encoded.  It
+// returns an error if that is already the case.  If it returns nil, leave must
+// be called when x is encoded.
+func (e *encodeState) enter(x reflect.Value, path string) error {
+	key := encodeVisitOf(x)
+	if e.visiting[key] {
+		return pathError(path, "cycle in %s", x.Type())
+	}
+	if e.visiting == nil {
+		e.visiting = map[encodeVisit]bool{}
+	}
+	e.visiting[key] = true
+	return nil
+}
+
+func (e *encodeState) leave(x reflect.Value) {
+	delete(e.visiting, encodeVisitOf(x))
+}
+
+func encodeVisitOf(x reflect.Value) encodeVisit {
+	key := encodeVisit{ptr: x.Pointer(), tp: x.Type()}
+	if x.Kind() == reflect.Slice {
+		key.len = x.Len()
+	}
+	return key
+}
+
+func (e *encodeState) encode(x reflect.Value, path string) (rt.Value, error) {
+	if !x.IsValid() {
+		return rt.NilValue, nil
+	}
+	tp := x.Type()
+	if tp == valueType {
+		return x.Interface().(rt.Value), nil
+	}
+	switch tp.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if x.IsNil() {
+			return rt.NilValue, nil
+		}
+	}
+	switch tp.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		if err := e.enter(x, path); err != nil {
+			return rt.NilValue, err
+		}
+		defer e.leave(x)
+	}
+	if m, ok := asInterface(x, marshalerType); ok {
+		v, err := m.(LuaMarshaler).MarshalLua()
+		return v, wrapError(path, err)
+	}
+	if tp == durationType {
+		d := time.Duration(x.Int())
+		if d%time.Second == 0 {
+			return rt.IntValue(int64(d / time.Second)), nil
+		}
+		return rt.FloatValue(d.Seconds()), nil
+	}
+	if m, ok := asInterface(x, textMarshalerType); ok {
+		b, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return rt.NilValue, wrapError(path, err)
+		}
+		return rt.StringValue(string(b)), nil
+	}
+	switch tp.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return e.encode(x.Elem(), path)
+	case reflect.Bool:
+		return rt.BoolValue(x.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rt.IntValue(x.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := x.Uint()
+		if n > math.MaxInt64 {
+			return rt.NilValue, pathError(path, "integer %d out of range for Lua", n)
+		}
+		return rt.IntValue(int64(n)), nil
+	case reflect.Float32, reflect.Float64:
+		return rt.FloatValue(x.Float()), nil
+	case reflect.String:
+		return rt.StringValue(x.String()), nil
+	case reflect.Slice, reflect.Array:
+		if tp.Elem().Kind() == reflect.Uint8 && tp.Kind() == reflect.Slice {
+			return rt.StringValue(string(x.Bytes())), nil
+		}
+		tbl := rt.NewTable()
+		for i := 0; i < x.Len(); i++ {
+			v, err := e.encode(x.Index(i), indexPath(path, int64(i+1)))
+			if err != nil {
+				return rt.NilValue, err
+			}
+			tbl.Set(rt.IntValue(int64(i+1)), v)
+		}
+		return rt.TableValue(tbl), nil
+	case reflect.Map:
+		tbl := rt.NewTable()
+		iter := x.MapRange()
+		for iter.Next() {
+			k, err := e.encode(iter.Key(), path)
+			if err != nil {
+				return rt.NilValue, err
+			}
+			kpath := keyPath(path, k)
+			if k.IsNil() || k.IsNaN() {
+				return rt.NilValue, pathError(kpath, "invalid key")
+			}
+			v, err := e.encode(iter.Value(), kpath)
+			if err != nil {
+				return rt.NilValue, err
+			}
+			tbl.Set(k, v)
+		}
+		return rt.TableValue(tbl), nil
+	case reflect.Struct:
+		tbl := rt.NewTable()
+		for _, f := range structFields(tp) {
+			fx := x.FieldByIndex(f.index)
+			if f.omitEmpty && fx.IsZero() {
+				continue
+			}
+			v, err := e.encode(fx, fieldPath(path, f.name))
+			if err != nil {
+				return rt.NilValue, err
+			}
+			tbl.Set(rt.StringValue(f.name), v)
+		}
+		return rt.TableValue(tbl), nil
+	default:
+		return rt.NilValue, unsupportedError(path, tp)
+	}
+}
+
+// asInterface returns x (or its address if it is addressable and only the
+// pointer type implements it) as a value of the interface type iface.
+func asInterface(x reflect.Value, iface reflect.Type) (interface{}, bool) {
+	if x.Type().Implements(iface) {
+		return x.Interface(), true
+	}
+	if x.CanAddr() && reflect.PtrTo(x.Type()).Implements(iface) {
+		return x.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+//
+// Struct fields
+//
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields returns the fields of struct type tp which are encoded and
+// decoded, including the fields of embedded structs.  Fields of the outer
+// struct take precedence over fields of embedded structs with the same name.
+func structFields(tp reflect.Type) []field {
+	if fields, ok := fieldCache.Load(tp); ok {
+		return fields.([]field)
+	}
+	var (
+		fields   []field
+		embedded []reflect.StructField
+		seen     = map[string]bool{}
+	)
+	for i := 0; i < tp.NumField(); i++ {
+		sf := tp.Field(i)
+		tag := sf.Tag.Get("lua")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, sf)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		seen[name] = true
+		fields = append(fields, field{
+			name:      name,
+			index:     sf.Index,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	for _, sf := range embedded {
+		for _, f := range structFields(sf.Type) {
+			if seen[f.name] {
+				continue
+			}
+			seen[f.name] = true
+			f.index = append(append([]int(nil), sf.Index...), f.index...)
+			fields = append(fields, f)
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].index[0] < fields[j].index[0]
+	})
+	fieldCache.Store(tp, fields)
+	return fields
+}
+
+//
+// Paths and errors
+//
+
+func fieldPath(path, name string) string {
+	if !isName(name) {
+		return path + "[" + luastrings.Quote(name, '"') + "]"
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func indexPath(path string, i int64) string {
+	return path + "[" + strconv.FormatInt(i, 10) + "]"
+}
+
+func keyPath(path string, k rt.Value) string {
+	switch k.Type() {
+	case rt.StringType:
+		return fieldPath(path, k.AsString())
+	case rt.IntType:
+		return indexPath(path, k.AsInt())
+	case rt.FloatType:
+		return path + "[" + strconv.FormatFloat(k.AsFloat(), 'g', -1, 64) + "]"
+	case rt.BoolType:
+		return path + "[" + strconv.FormatBool(k.AsBool()) + "]"
+	default:
+		return path + "[<" + k.TypeName() + ">]"
+	}
+}
+
+// isName returns true if s is a valid Lua name (so it can be written after a
+// dot in a path).
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range []byte(s) {
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func pathError(path string, format string, args ...interface{}) error {
+	return &Error{Path: path, Err: fmt.Errorf(format, args...)}
+}
+
+func typeError(path string, expected string, v rt.Value) error {
+	return pathError(path, "expected %s, got %s", expected, v.TypeName())
+}
+
+func unsupportedError(path string, tp reflect.Type) error {
+	return pathError(path, "unsupported Go type %s", tp)
+}
+
+// wrapError adds path to err, which may be returned by a custom marshaler or
+// unmarshaler (possibly itself calling Encode or Decode).
+func wrapError(path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		switch {
+		case path == "":
+			return e
+		case e.Path == "" || strings.HasPrefix(e.Path, "["):
+			return &Error{Path: path + e.Path, Err: e.Err}
+		default:
+			return &Error{Path: path + "." + e.Path, Err: e.Err}
+		}
+	}
+	return &Error{Path: path, Err: err}
+}
@@ -0,0 +1,314 @@
+package luacodec
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+type server struct {
+	Host    string        `lua:"host"`
+	Port    int           `lua:"port,omitempty"`
+	Timeout time.Duration `lua:"timeout,omitempty"`
+	Addr    net.IP        `lua:"addr,omitempty"`
+	Tags    []string      `lua:"tags,omitempty"`
+}
+
+type base struct {
+	Name string `lua:"name"`
+	Kind string `lua:"kind"`
+}
+
+type config struct {
+	base
+	Kind     string            `lua:"kind"`
+	Debug    bool              `lua:"debug"`
+	Servers  []server          `lua:"servers"`
+	Limits   map[string]uint16 `lua:"limits,omitempty"`
+	Primary  *server           `lua:"primary,omitempty"`
+	Weights  [3]float64        `lua:"weights"`
+	Extra    interface{}       `lua:"extra,omitempty"`
+	Callback rt.Value          `lua:"callback"`
+	Secret   string            `lua:"-"`
+	Level    level             `lua:"level"`
+	private  int
+}
+
+// level encodes as a string but is stored as an integer.
+type level int
+
+var levelNames = []string{"low", "medium", "high"}
+
+func (l level) MarshalLua() (rt.Value, error) {
+	if l < 0 || int(l) >= len(levelNames) {
+		return rt.NilValue, errors.New("invalid level")
+	}
+	return rt.StringValue(levelNames[l]), nil
+}
+
+func (l *level) UnmarshalLua(v rt.Value) error {
+	if v.IsNil() {
+		return nil
+	}
+	for i, name := range levelNames {
+		if s, ok := v.TryString(); ok && s == name {
+			*l = level(i)
+			return nil
+		}
+	}
+	return errors.New("unknown level")
+}
+
+// luaValue evaluates a Lua expression.
+func luaValue(t *testing.T, expr string) rt.Value {
+	t.Helper()
+	r := rt.New(nil)
+	clos, err := r.CompileAndLoadLuaChunk("test", []byte("return "+expr), rt.TableValue(r.GlobalEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := rt.Call1(r.MainThread(), rt.FunctionValue(clos))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDecode(t *testing.T) {
+	v := luaValue(t, `{
+		name = "prod",
+		kind = "outer",
+		debug = true,
+		servers = {
+			{host = "a.example.com", port = 80, timeout = 1.5, addr = "10.0.0.1"},
+			{host = "b.example.com", timeout = "1m30s", tags = {"x", "y"}},
+		},
+		limits = {conns = 100, ["max rps"] = 20.0},
+		primary = {host = "p"},
+		weights = {0.5, 2},
+		extra = {1, 2, {a = "b"}},
+		callback = function() end,
+		Secret = "ignored",
+		level = "high",
+		unknown = 42,
+	}`)
+	cfg := config{Debug: false, private: 7}
+	if err := Decode(v, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		base:  base{Name: "prod"},
+		Kind:  "outer",
+		Debug: true,
+		Servers: []server{
+			{Host: "a.example.com", Port: 80, Timeout: 1500 * time.Millisecond, Addr: net.ParseIP("10.0.0.1")},
+			{Host: "b.example.com", Timeout: 90 * time.Second, Tags: []string{"x", "y"}},
+		},
+		Limits:   map[string]uint16{"conns": 100, "max rps": 20},
+		Primary:  &server{Host: "p"},
+		Weights:  [3]float64{0.5, 2, 0},
+		Extra:    []interface{}{int64(1), int64(2), map[string]interface{}{"a": "b"}},
+		Callback: cfg.Callback,
+		Level:    2,
+		private:  7,
+	}
+	if cfg.Callback.Type() != rt.FunctionType {
+		t.Errorf("expected callback to be a function, got %s", cfg.Callback.TypeName())
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v\nwant %+v", cfg, want)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{`"x"`, `expected table, got string`},
+		{`{servers = {{host = "a"}, {port = "80"}}}`, `servers[2].port: expected number, got string`},
+		{`{servers = {{port = 1.5}}}`, `servers[1].port: number 1.5 has no integer representation`},
+		{`{servers = {{timeout = "soon"}}}`, `servers[1].timeout: time: invalid duration "soon"`},
+		{`{servers = {{addr = "nowhere"}}}`, `servers[1].addr: invalid IP address: nowhere`},
+		{`{limits = {conns = -1}}`, `limits.conns: integer -1 out of range for uint16`},
+		{`{limits = {["max rps"] = 1e6}}`, `limits["max rps"]: integer 1000000 out of range for uint16`},
+		{`{limits = {[1] = 1}}`, `limits[1]: invalid key: expected string, got number`},
+		{`{weights = {1, 2, 3, 4}}`, `weights: sequence of length 4 too long for [3]float64`},
+		{`{debug = 1}`, `debug: expected boolean, got number`},
+		{`{level = "extreme"}`, `level: unknown level`},
+		{`{primary = {tags = {"a", {}}}}`, `primary.tags[2]: expected string, got table`},
+		{`{extra = {1, {[{}] = 1}}}`, `extra[2]: unsupported key of type table`},
+		{`{extra = {{[{1, 2}] = true}}}`, `extra[1]: unsupported key of type table`},
+		{`(function() local t = {} t[1] = t return {extra = t} end)()`, `extra[1]: cycle in table`},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			var cfg config
+			err := Decode(luaValue(t, test.expr), &cfg)
+			if err == nil {
+				t.Fatalf("expected error %q", test.err)
+			}
+			if err.Error() != test.err {
+				t.Errorf("got error %q, want %q", err, test.err)
+			}
+			var codecErr *Error
+			if !errors.As(err, &codecErr) {
+				t.Errorf("expected *Error, got %T", err)
+			}
+		})
+	}
+}
+
+func TestDecodeNotPointer(t *testing.T) {
+	var cfg config
+	if err := Decode(rt.NilValue, cfg); err == nil || !strings.Contains(err.Error(), "non-nil pointer") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+type node struct {
+	Name string `lua:"name"`
+	Next *node  `lua:"next"`
+}
+
+func TestDecodeCycles(t *testing.T) {
+	cyclic := `(function() local t = {name = "a"} t.next = t return t end)()`
+
+	// A table which contains itself cannot be decoded into a recursive type
+	var n node
+	err := Decode(luaValue(t, cyclic), &n)
+	if err == nil || err.Error() != "next: cycle in table" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// But it can if the Go type is finite
+	var flat struct {
+		Name string `lua:"name"`
+		Next struct {
+			Name string `lua:"name"`
+		} `lua:"next"`
+	}
+	if err := Decode(luaValue(t, cyclic), &flat); err != nil || flat.Next.Name != "a" {
+		t.Errorf("unexpected result: %+v, %v", flat, err)
+	}
+
+	// A table may appear several times if it does not contain itself
+	var pair []node
+	if err := Decode(luaValue(t, `(function() local t = {name = "x"} return {t, t} end)()`), &pair); err != nil || len(pair) != 2 {
+		t.Errorf("unexpected result: %+v, %v", pair, err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	cfg := config{
+		base:    base{Name: "prod", Kind: "hidden"},
+		Kind:    "outer",
+		Servers: []server{{Host: "a", Port: 80, Timeout: 2 * time.Second}, {Host: "b", Timeout: time.Millisecond}},
+		Primary: &server{Host: "p", Addr: net.ParseIP("10.0.0.1")},
+		Weights: [3]float64{1, 2.5, 0},
+		Secret:  "secret",
+		Level:   1,
+	}
+	v, err := Encode(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := v.AsTable()
+	get := func(path ...interface{}) rt.Value {
+		v := rt.TableValue(tbl)
+		for _, k := range path {
+			v = v.AsTable().Get(rt.AsValue(k))
+		}
+		return v
+	}
+	checks := []struct {
+		path []interface{}
+		want rt.Value
+	}{
+		{[]interface{}{"name"}, rt.StringValue("prod")},
+		{[]interface{}{"kind"}, rt.StringValue("outer")},
+		{[]interface{}{"debug"}, rt.BoolValue(false)},
+		{[]interface{}{"servers", 1, "host"}, rt.StringValue("a")},
+		{[]interface{}{"servers", 1, "port"}, rt.IntValue(80)},
+		{[]interface{}{"servers", 1, "timeout"}, rt.IntValue(2)},
+		{[]interface{}{"servers", 2, "port"}, rt.NilValue},
+		{[]interface{}{"servers", 2, "timeout"}, rt.FloatValue(0.001)},
+		{[]interface{}{"primary", "addr"}, rt.StringValue("10.0.0.1")},
+		{[]interface{}{"weights", 2}, rt.FloatValue(2.5)},
+		{[]interface{}{"limits"}, rt.NilValue},
+		{[]interface{}{"Secret"}, rt.NilValue},
+		{[]interface{}{"private"}, rt.NilValue},
+		{[]interface{}{"level"}, rt.StringValue("medium")},
+	}
+	for _, check := range checks {
+		if got := get(check.path...); got != check.want {
+			t.Errorf("%v: got %v, want %v", check.path, got.Interface(), check.want.Interface())
+		}
+	}
+
+	// Decoding the encoded value gives back the original value, apart from
+	// fields which are not encoded or are shadowed.
+	var decoded config
+	if err := Decode(v, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Secret = ""
+	cfg.base.Kind = ""
+	if !reflect.DeepEqual(decoded, cfg) {
+		t.Errorf("got %+v\nwant %+v", decoded, cfg)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := []struct {
+		x   interface{}
+		err string
+	}{
+		{make(chan int), `unsupported Go type chan int`},
+		{map[string]interface{}{"f": func() {}}, `f: unsupported Go type func()`},
+		{[]interface{}{1, uint64(1) << 63}, `[2]: integer 9223372036854775808 out of range for Lua`},
+		{config{Level: 5}, `level: invalid level`},
+		{map[float64]int{0: 1}, ``},
+		{cyclicNode(), `next.next: cycle in *luacodec.node`},
+		{cyclicMap(), `self: cycle in map[string]interface {}`},
+		{cyclicSlice(), `[1]: cycle in []interface {}`},
+		{sharedNode(), ``},
+	}
+	for _, test := range tests {
+		_, err := Encode(test.x)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%T: unexpected error %q", test.x, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%T: got error %v, want %q", test.x, err, test.err)
+		}
+	}
+}
+
+func cyclicNode() *node {
+	n := &node{Name: "a", Next: &node{Name: "b"}}
+	n.Next.Next = n
+	return n
+}
+
+func cyclicMap() map[string]interface{} {
+	m := map[string]interface{}{}
+	m["self"] = m
+	return m
+}
+
+func cyclicSlice() []interface{} {
+	s := []interface{}{nil}
+	s[0] = s
+	return s
+}
+
+func sharedNode() []*node {
+	n := &node{Name: "shared"}
+	return []*node{n, n}
+}
@@ -0,0 +1,215 @@
+package luatesting
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// The official Lua test suite is a set of Lua files which check their results
+// with assert() and print "OK" at the end.  They are meant to be run by a
+// driver (all.lua) but each of them can also be run on its own.  A file passes
+// if it runs to completion without error.
+//
+// Parts of the suite that golua does not support are disabled with skip
+// directives in the vendored copies of the files (see SkippedSection).
+
+// ConformanceStatus is the outcome of running a file of a conformance suite.
+type ConformanceStatus int
+
+const (
+	ConformancePass ConformanceStatus = iota
+	ConformanceFail
+	ConformanceSkip
+)
+
+func (s ConformanceStatus) String() string {
+	switch s {
+	case ConformancePass:
+		return "PASS"
+	case ConformanceFail:
+		return "FAIL"
+	case ConformanceSkip:
+		return "SKIP"
+	default:
+		return "????"
+	}
+}
+
+// ConformanceResult is the result of running a file of a conformance suite.
+type ConformanceResult struct {
+	File    string            // Name of the file, relative to the suite directory
+	Status  ConformanceStatus // Outcome
+	Message string            // Error for failed files, reason for skipped files
+	Skipped []SkippedSection  // Skipped sections of the file
+	Output  []byte            // What the file printed
+}
+
+// ConformanceReport contains the results of running a conformance suite, in
+// file name order.
+type ConformanceReport []ConformanceResult
+
+// Count returns the number of files with the given status.
+func (r ConformanceReport) Count(status ConformanceStatus) int {
+	n := 0
+	for _, res := range r {
+		if res.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteTo writes a line per file to w, followed by a summary line.
+func (r ConformanceReport) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	for _, res := range r {
+		fmt.Fprintf(&b, "%s %s", res.Status, res.File)
+		if len(res.Skipped) > 0 {
+			fmt.Fprintf(&b, " (%d sections skipped)", len(res.Skipped))
+		}
+		if res.Message != "" {
+			fmt.Fprintf(&b, ": %s", firstLine(res.Message))
+		}
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "%d files: %d passed, %d failed, %d skipped\n",
+		len(r), r.Count(ConformancePass), r.Count(ConformanceFail), r.Count(ConformanceSkip))
+	return b.WriteTo(w)
+}
+
+// ConformanceDriver is the name of the file that runs the whole official Lua
+// test suite.  The conformance runner runs each file on its own instead.
+const ConformanceDriver = "all.lua"
+
+// ConformanceCPULimit is the amount of CPU (see quotas.md) that a file of a
+// conformance suite may use before it fails, so that a file which loops forever
+// does not hang the suite.  It is not enforced when golua is built with the
+// noquotas tag.
+var ConformanceCPULimit uint64 = 10000000000
+
+// conformanceGlobals are set before running a file of the suite: _U enables
+// the tests that the official suite considers "user" tests, _soft and _port
+// disable the tests that are too slow or not portable.
+var conformanceGlobals = []string{"_U", "_soft", "_port"}
+
+// RunConformanceFile runs the file at path as a file of a conformance suite in
+// a fresh runtime, running setup if non-nil beforehand.  The runtime resolves
+// file names relative to the directory that contains the file, so that it can
+// load the other files of the suite.
+func RunConformanceFile(path string, setup func(*rt.Runtime) func()) (res ConformanceResult) {
+	res.File = filepath.Base(path)
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		res.Status, res.Message = ConformanceFail, err.Error()
+		return
+	}
+	if doRun, err := checkTags(src); !doRun {
+		res.Status, res.Message = ConformanceSkip, "tags do not match"
+		if err != nil {
+			res.Status, res.Message = ConformanceFail, err.Error()
+		}
+		return
+	}
+	if reason, ok := skipFileReason(src); ok {
+		res.Status, res.Message = ConformanceSkip, reason
+		return
+	}
+	src, res.Skipped, err = removeSkippedSections(src)
+	if err != nil {
+		res.Status, res.Message = ConformanceFail, err.Error()
+		return
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		res.Status, res.Message = ConformanceFail, err.Error()
+		return
+	}
+
+	var output bytes.Buffer
+	r := rt.New(&output, rt.WithWorkingDir(dir))
+	if setup != nil {
+		cleanup := setup(r)
+		defer cleanup()
+	}
+	defer r.Close(nil)
+	for _, name := range conformanceGlobals {
+		r.SetEnv(r.GlobalEnv(), name, rt.BoolValue(true))
+	}
+	err = runConformanceChunk(r, res.File, src)
+	res.Output = output.Bytes()
+	if err != nil {
+		res.Status, res.Message = ConformanceFail, err.Error()
+	}
+	return
+}
+
+func runConformanceChunk(r *rt.Runtime, name string, src []byte) error {
+	t := r.MainThread()
+	clos, err := t.LoadFromSourceOrCode(name, src, "t", rt.TableValue(r.GlobalEnv()), false)
+	if err != nil {
+		return err
+	}
+	def := rt.RuntimeContextDef{HardLimits: rt.RuntimeResources{Cpu: ConformanceCPULimit}}
+	_, err = t.CallContext(def, func() error {
+		return rt.Call(t, rt.FunctionValue(clos), nil, rt.NewTerminationWith(nil, 0, false))
+	})
+	return err
+}
+
+// RunConformanceSuite runs each .lua file in dir (apart from the driver, see
+// ConformanceDriver) with RunConformanceFile and returns the results.
+func RunConformanceSuite(dir string, setup func(*rt.Runtime) func()) (ConformanceReport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.lua"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	var report ConformanceReport
+	for _, path := range paths {
+		if filepath.Base(path) != ConformanceDriver {
+			report = append(report, RunConformanceFile(path, setup))
+		}
+	}
+	return report, nil
+}
+
+// RunConformanceTests runs the conformance suite in dir with a subtest of t
+// for each file.  A subtest fails if its file fails, and the report is written
+// to the test log.
+func RunConformanceTests(t *testing.T, dir string, setup func(*rt.Runtime) func()) ConformanceReport {
+	report, err := RunConformanceSuite(dir, setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range report {
+		res := res
+		t.Run(res.File, func(t *testing.T) {
+			switch res.Status {
+			case ConformanceFail:
+				t.Errorf("%s\noutput:\n%s", res.Message, res.Output)
+			case ConformanceSkip:
+				t.Skip(res.Message)
+			}
+		})
+	}
+	var b strings.Builder
+	report.WriteTo(&b)
+	t.Logf("conformance report for %s:\n%s", dir, b.String())
+	return report
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package luatesting_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/arnodel/golua/lib"
+	"github.com/arnodel/golua/luatesting"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func TestRunConformanceSuite(t *testing.T) {
+	report, err := luatesting.RunConformanceSuite("testdata/conformance", lib.LoadAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	report.WriteTo(&b)
+	want := `FAIL badskip.lua: line 1: skip without endskip
+FAIL fail.lua: error: fail.lua:3:1: bad arithmetic
+PASS pass.lua
+PASS sections.lua (2 sections skipped)
+SKIP skipped.lua: needs the C API
+5 files: 2 passed, 2 failed, 1 skipped
+`
+	if got := b.String(); got != want {
+		t.Errorf("got report:\n%s\nwant:\n%s", got, want)
+	}
+	if out := string(report[1].Output); out != "testing failures\n" {
+		t.Errorf("unexpected output for fail.lua: %q", out)
+	}
+}
+
+func TestConformanceCPULimit(t *testing.T) {
+	if !rt.QuotasAvailable {
+		t.Skip("quotas are not available")
+	}
+	defer func(limit uint64) { luatesting.ConformanceCPULimit = limit }(luatesting.ConformanceCPULimit)
+	luatesting.ConformanceCPULimit = 1000000
+
+	path := filepath.Join(t.TempDir(), "loop.lua")
+	if err := ioutil.WriteFile(path, []byte("while true do end\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	res := luatesting.RunConformanceFile(path, lib.LoadAll)
+	if res.Status != luatesting.ConformanceFail || !strings.Contains(res.Message, "CPU limit") {
+		t.Errorf("expected CPU limit failure, got %s: %s", res.Status, res.Message)
+	}
+}
+
+// The official Lua test suite, with skip directives for the parts golua does
+// not support.  Set GOLUA_LUA_TESTS to run another copy of the suite.
+const luaTestSuiteDir = "testdata/lua-5.4.3-tests"
+
+func TestLuaTestSuite(t *testing.T) {
+	dir := os.Getenv("GOLUA_LUA_TESTS")
+	if dir == "" {
+		dir = luaTestSuiteDir
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			t.Skipf("the Lua test suite is not available in %s", dir)
+		}
+	} else if _, err := os.Stat(dir); err != nil {
+		// The suite was requested explicitly, so it must be there.
+		t.Fatalf("GOLUA_LUA_TESTS: %s", err)
+	}
+	luatesting.RunConformanceTests(t, dir, lib.LoadAll)
+}
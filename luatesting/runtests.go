@@ -9,6 +9,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/arnodel/golua/luaversion"
 	rt "github.com/arnodel/golua/runtime"
 )
 
@@ -31,8 +32,12 @@ func RunSource(r *rt.Runtime, source []byte) {
 // RunLuaTest runs the lua test code in source, running setup if non-nil
 // beforehand (with the Runtime instance that will be used in the test).
 func RunLuaTest(source []byte, setup func(*rt.Runtime) func()) error {
+	return runLuaTest(source, setup)
+}
+
+func runLuaTest(source []byte, setup func(*rt.Runtime) func(), opts ...rt.RuntimeOption) error {
 	outputBuf := new(bytes.Buffer)
-	r := rt.New(outputBuf)
+	r := rt.New(outputBuf, opts...)
 	r.SetWarner(rt.NewLogWarner(outputBuf, "Test warning: "))
 	if setup != nil {
 		cleanup := setup(r)
@@ -49,6 +54,10 @@ func RunLuaTestFile(t *testing.T, path string, setup func(*rt.Runtime) func()) {
 		return
 	}
 	isQuotasTest := strings.HasSuffix(path, ".quotas.lua")
+	var opts []rt.RuntimeOption
+	if strings.HasSuffix(path, ".lua55.lua") {
+		opts = append(opts, rt.WithLanguageVersion(luaversion.Lua55))
+	}
 	t.Run(path, func(t *testing.T) {
 		if isQuotasTest {
 			if !rt.QuotasAvailable {
@@ -72,7 +81,7 @@ func RunLuaTestFile(t *testing.T, path string, setup func(*rt.Runtime) func()) {
 			return
 		}
 
-		err = RunLuaTest(src, setup)
+		err = runLuaTest(src, setup, opts...)
 		if err != nil {
 			t.Error(err)
 		}
@@ -0,0 +1,2 @@
+-- The driver of the suite, which the conformance runner does not run.
+error("all.lua should not be run")
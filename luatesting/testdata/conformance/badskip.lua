@@ -0,0 +1,2 @@
+-- skip: unterminated section
+print("OK")
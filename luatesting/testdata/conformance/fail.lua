@@ -0,0 +1,4 @@
+-- A file that fails.
+print("testing failures")
+assert(1 + 1 == 3, "bad arithmetic")
+print("OK")
@@ -0,0 +1,5 @@
+-- A file that passes, loading another file of the suite.
+local lib = dofile("lib/helper.lua")
+assert(lib.double(21) == 42)
+assert(_U and _soft and _port)
+print("OK")
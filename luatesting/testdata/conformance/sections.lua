@@ -0,0 +1,19 @@
+-- A file with sections that golua does not support.
+local n = 0
+
+-- skip: unsupported feature
+assert(false, "this section is skipped")
+-- endskip
+
+-- skip(!unix,!windows): not skipped on any known OS
+n = n + 1
+-- endskip
+
+-- skip: another unsupported feature
+error("this section is skipped too")
+-- endskip
+
+assert(n == 1)
+-- Line numbers are preserved.
+assert(debug.getinfo(1, "l").currentline == 18)
+print("OK")
@@ -0,0 +1,2 @@
+-- skipfile: needs the C API
+error("this file is skipped")
@@ -27,6 +27,32 @@ func checkTags(source []byte) (bool, error) {
 	return true, nil
 }
 
+// parseTags parses a comma separated list of tags, e.g. "!windows,linux".
+func parseTags(list []byte) []testTag {
+	var tags []testTag
+	for _, b := range bytes.Split(list, []byte(",")) {
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			continue
+		}
+		if b[0] == '!' {
+			tags = append(tags, testTag{name: string(b[1:]), value: false})
+		} else {
+			tags = append(tags, testTag{name: string(b), value: true})
+		}
+	}
+	return tags
+}
+
+func checkAllTags(tags []testTag) bool {
+	for _, tag := range tags {
+		if !checkTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
 func getTags(source []byte) ([]testTag, error) {
 	if !bytes.HasPrefix(source, []byte("-- tags:")) {
 		return nil, nil
@@ -94,3 +120,88 @@ var knownOS = map[string]bool{
 	"windows":   true,
 	"zos":       true,
 }
+
+//
+// Skip directives, used to disable the parts of a Lua source file that golua
+// does not support (e.g. in the official Lua test suite).
+//
+//   -- skipfile: <reason>
+//
+// on the first line skips the whole file, and
+//
+//   -- skip: <reason>
+//   ...
+//   -- endskip
+//
+// skips the lines in between.  Both accept tags as in the tags line, so that
+// the file or section is skipped only if all the tags match, e.g.
+//
+//   -- skip(windows): <reason>
+//
+
+var (
+	skipFilePtn = regexp.MustCompile(`^-- skipfile(?:\(([!a-z,]*)\))?: *(.*?) *$`)
+	skipPtn     = regexp.MustCompile(`^ *-- skip(?:\(([!a-z,]*)\))?: *(.*?) *$`)
+	endSkipPtn  = regexp.MustCompile(`^ *-- endskip *$`)
+)
+
+// SkippedSection is a section of a Lua source file disabled by a skip
+// directive.
+type SkippedSection struct {
+	Line   int    // Line of the skip directive
+	Reason string // Reason given in the directive
+}
+
+// skipFileReason returns the reason given on the first line of source if it is
+// a skipfile directive whose tags match.
+func skipFileReason(source []byte) (string, bool) {
+	firstLine := source
+	if i := bytes.IndexByte(source, '\n'); i >= 0 {
+		firstLine = source[:i]
+	}
+	match := skipFilePtn.FindSubmatch(bytes.TrimRight(firstLine, "\r"))
+	if match == nil || !checkAllTags(parseTags(match[1])) {
+		return "", false
+	}
+	return string(match[2]), true
+}
+
+// removeSkippedSections returns a copy of source where the lines in skipped
+// sections are blanked, so that line numbers are unchanged.
+func removeSkippedSections(source []byte) ([]byte, []SkippedSection, error) {
+	var (
+		lines    = bytes.SplitAfter(source, []byte("\n"))
+		sections []SkippedSection
+		open     bool // In a section (skipped or not)
+		skipping bool // In a skipped section
+		openLine int
+		out      = make([]byte, 0, len(source))
+	)
+	for i, line := range lines {
+		text := bytes.TrimRight(line, "\r\n")
+		if endSkipPtn.Match(text) {
+			if !open {
+				return nil, nil, fmt.Errorf("line %d: endskip without skip", i+1)
+			}
+			open, skipping = false, false
+		} else if match := skipPtn.FindSubmatch(text); match != nil {
+			if open {
+				return nil, nil, fmt.Errorf("line %d: skip inside the section started line %d", i+1, openLine)
+			}
+			open, openLine = true, i+1
+			skipping = checkAllTags(parseTags(match[1]))
+			if skipping {
+				sections = append(sections, SkippedSection{Line: i + 1, Reason: string(match[2])})
+			}
+		}
+		if skipping {
+			// Blank the line but keep its end of line
+			line = line[len(text):]
+		}
+		out = append(out, line...)
+	}
+	if open {
+		return nil, nil, fmt.Errorf("line %d: skip without endskip", openLine)
+	}
+	return out, sections, nil
+}
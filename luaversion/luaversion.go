@@ -0,0 +1,40 @@
+// Package luaversion defines the versions of the Lua language that golua can
+// compile and run.  The default is Lua 5.4.  Lua 5.5 is opt-in and enables
+// the following changes:
+//
+//   - "global" declarations (global x, global function f, global *), which
+//     make it an error to use undeclared global variables in their scope;
+//   - attributes before a list of local variables, as in "local <const> x, y";
+//   - read-only control variables in "for" loops;
+//   - the table.create function.
+package luaversion
+
+import "fmt"
+
+// Version is a version of the Lua language.  Its value is 10 times the Lua
+// version number, so versions can be compared with < and >.
+type Version uint8
+
+const (
+	Lua54 Version = 54
+	Lua55 Version = 55
+
+	Default = Lua54 // The version used when none is specified
+)
+
+var versions = []Version{Lua54, Lua55}
+
+// Parse returns the version with the given name, e.g. "5.5".
+func Parse(s string) (Version, error) {
+	for _, v := range versions {
+		if v.String() == s {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported Lua version '%s'", s)
+}
+
+// String returns the version number, e.g. "5.4".
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d", v/10, v%10)
+}
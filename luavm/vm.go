@@ -0,0 +1,392 @@
+// Package luavm is a convenience layer for programs embedding golua.  A VM owns
+// a runtime with the standard library loaded and lets Go code exchange plain Go
+// values with Lua code, e.g.
+//
+//	vm := luavm.New(os.Stdout)
+//	defer vm.Close()
+//
+//	if _, err := vm.DoFile("config.lua"); err != nil {
+//		return err
+//	}
+//	port, err := vm.Get("config.server.port")
+//	...
+//	err = vm.Register("log", func(msg string) { log.Print(msg) })
+//	...
+//	res, err := vm.Call("handlers.onEvent", "click", map[string]int{"x": 10})
+//
+// Go values are converted to Lua values and back with the luacodec package,
+// apart from Go functions which are wrapped as Lua functions (see Register).
+//
+// Each call to a VM method runs in its own runtime context, which can be given
+// quotas with WithContext.  Like a runtime, a VM must only be used from one
+// goroutine at a time (see runtime.Actor for sharing a runtime between
+// goroutines).
+package luavm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/arnodel/golua/lib"
+	"github.com/arnodel/golua/luacodec"
+	rt "github.com/arnodel/golua/runtime"
+	"github.com/arnodel/golua/safeio"
+)
+
+// A VM is a Lua runtime with the standard library loaded.
+type VM struct {
+	r       *rt.Runtime
+	def     rt.RuntimeContextDef
+	cleanup func()
+}
+
+// New returns a VM whose runtime is created with rt.New(stdout, opts...) and
+// has all the standard libraries loaded.
+func New(stdout io.Writer, opts ...rt.RuntimeOption) *VM {
+	r := rt.New(stdout, opts...)
+	return &VM{r: r, cleanup: lib.LoadAll(r)}
+}
+
+// Runtime returns the runtime of the VM, for when the convenience methods are
+// not enough.
+func (vm *VM) Runtime() *rt.Runtime {
+	return vm.r
+}
+
+// Close releases the resources of the VM (running pending finalizers).  It
+// must not be called on a VM returned by WithContext.
+func (vm *VM) Close() (err error) {
+	if vm.cleanup != nil {
+		vm.cleanup()
+	}
+	vm.r.Close(&err)
+	return
+}
+
+// WithContext returns a VM sharing the runtime of vm whose methods run in a
+// runtime context defined by def, e.g. to limit the CPU or memory that a
+// script can use.  If the context is killed, the method returns an error.
+func (vm *VM) WithContext(def rt.RuntimeContextDef) *VM {
+	return &VM{r: vm.r, def: def}
+}
+
+// Func wraps a Go function given to Register or Set in order to declare its
+// compliance flags (see quotas.md).  By default Go functions are not declared
+// compliant with anything, so they cannot be called from runtime contexts with
+// required flags.
+type Func struct {
+	Fn    interface{}
+	Flags rt.ComplianceFlags
+}
+
+// DoString runs a chunk of Lua source code and returns the values it returns,
+// converted to Go values.
+func (vm *VM) DoString(source string) ([]interface{}, error) {
+	return vm.doChunk("string", []byte(source))
+}
+
+// DoFile runs the Lua source code in a file and returns the values it returns,
+// converted to Go values.  A relative path is relative to the working directory
+// of the runtime (see rt.WithWorkingDir).
+func (vm *VM) DoFile(path string) ([]interface{}, error) {
+	f, err := safeio.OpenFile(vm.r, path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	source, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return vm.doChunk(path, source)
+}
+
+func (vm *VM) doChunk(name string, source []byte) (res []interface{}, err error) {
+	err = vm.do(func(t *rt.Thread) error {
+		clos, err := vm.r.CompileAndLoadLuaChunk(name, source, rt.TableValue(vm.r.GlobalEnv()))
+		if err != nil {
+			return err
+		}
+		res, err = call(t, rt.FunctionValue(clos), nil)
+		return err
+	})
+	return
+}
+
+// Get returns the Go value of the global variable at path.  A path is a
+// sequence of keys separated by dots, e.g. "config.servers.1.host".  Keys which
+// are integers are used as integers, others as strings.  If one of the
+// intermediate values is nil, the value is nil.
+func (vm *VM) Get(path string) (x interface{}, err error) {
+	err = vm.GetInto(path, &x)
+	return
+}
+
+// GetInto decodes the value of the global variable at path into out (see
+// luacodec.Decode).
+func (vm *VM) GetInto(path string, out interface{}) error {
+	return vm.do(func(t *rt.Thread) error {
+		v, err := vm.get(t, path)
+		if err != nil {
+			return err
+		}
+		return decodePath(path, luacodec.Decode(v, out))
+	})
+}
+
+// GetValue returns the Lua value of the global variable at path.
+func (vm *VM) GetValue(path string) (v rt.Value, err error) {
+	err = vm.do(func(t *rt.Thread) (err error) {
+		v, err = vm.get(t, path)
+		return
+	})
+	return
+}
+
+// Set sets the global variable at path to the Lua value of x.  Intermediate
+// tables are created if they do not exist.
+func (vm *VM) Set(path string, x interface{}) error {
+	return vm.do(func(t *rt.Thread) error {
+		keys := splitPath(path)
+		last := len(keys) - 1
+		v, err := toValue(path, x)
+		if err != nil {
+			return err
+		}
+		coll := rt.TableValue(vm.r.GlobalEnv())
+		for _, k := range keys[:last] {
+			next, err := rt.Index(t, coll, k)
+			if err != nil {
+				return err
+			}
+			if next.IsNil() {
+				next = rt.TableValue(rt.NewTable())
+				if err := rt.SetIndex(t, coll, k, next); err != nil {
+					return err
+				}
+			}
+			coll = next
+		}
+		return rt.SetIndex(t, coll, keys[last], v)
+	})
+}
+
+// Register sets the global variable at path to a Lua function wrapping fn,
+// which must be a Go function (possibly wrapped in a Func).
+//
+// The arguments of the Lua function are converted to the types of the
+// parameters of fn (missing arguments give zero values) and the values
+// returned by fn are converted to Lua values.  If the last value returned by
+// fn is an error, it is not returned to Lua but raised as a Lua error when it
+// is not nil.
+func (vm *VM) Register(path string, fn interface{}) error {
+	f, flags := fn, rt.ComplianceFlags(0)
+	if wrapped, ok := fn.(Func); ok {
+		f, flags = wrapped.Fn, wrapped.Flags
+	}
+	if reflect.ValueOf(f).Kind() != reflect.Func {
+		return fmt.Errorf("%s: cannot register %T, it is not a function", path, f)
+	}
+	return vm.Set(path, Func{Fn: f, Flags: flags})
+}
+
+// Call calls the function which is the value of the global variable at path
+// with the given arguments (converted to Lua values).  It returns the values
+// returned by the function, converted to Go values.
+func (vm *VM) Call(path string, args ...interface{}) (res []interface{}, err error) {
+	err = vm.do(func(t *rt.Thread) error {
+		f, err := vm.get(t, path)
+		if err != nil {
+			return err
+		}
+		if f.IsNil() {
+			return fmt.Errorf("%s is not defined", path)
+		}
+		values := make([]rt.Value, len(args))
+		for i, arg := range args {
+			values[i], err = toValue("#"+strconv.Itoa(i+1), arg)
+			if err != nil {
+				return err
+			}
+		}
+		res, err = call(t, f, values)
+		return err
+	})
+	return
+}
+
+// do runs f in the main thread of the runtime, in the runtime context of vm.
+func (vm *VM) do(f func(t *rt.Thread) error) error {
+	t := vm.r.MainThread()
+	_, err := t.CallContext(vm.def, func() error {
+		return f(t)
+	})
+	return err
+}
+
+func (vm *VM) get(t *rt.Thread, path string) (rt.Value, error) {
+	v := rt.TableValue(vm.r.GlobalEnv())
+	for _, k := range splitPath(path) {
+		if v.IsNil() {
+			break
+		}
+		var err error
+		v, err = rt.Index(t, v, k)
+		if err != nil {
+			return rt.NilValue, err
+		}
+	}
+	return v, nil
+}
+
+func call(t *rt.Thread, f rt.Value, args []rt.Value) ([]interface{}, error) {
+	term := rt.NewTerminationWith(nil, 0, true)
+	if err := rt.Call(t, f, args, term); err != nil {
+		return nil, err
+	}
+	values := term.Etc()
+	res := make([]interface{}, len(values))
+	for i, v := range values {
+		if err := luacodec.Decode(v, &res[i]); err != nil {
+			return nil, decodePath("#"+strconv.Itoa(i+1), err)
+		}
+	}
+	return res, nil
+}
+
+func splitPath(path string) []rt.Value {
+	parts := strings.Split(path, ".")
+	keys := make([]rt.Value, len(parts))
+	for i, part := range parts {
+		if n, err := strconv.ParseInt(part, 10, 64); err == nil {
+			keys[i] = rt.IntValue(n)
+		} else {
+			keys[i] = rt.StringValue(part)
+		}
+	}
+	return keys
+}
+
+// decodePath adds path in front of the path of err, if it is a luacodec error.
+func decodePath(path string, err error) error {
+	var codecErr *luacodec.Error
+	if !errors.As(err, &codecErr) {
+		return err
+	}
+	switch {
+	case codecErr.Path == "":
+	case strings.HasPrefix(codecErr.Path, "["):
+		path += codecErr.Path
+	default:
+		path += "." + codecErr.Path
+	}
+	return &luacodec.Error{Path: path, Err: codecErr.Err}
+}
+
+// toValue converts a Go value to a Lua value.
+func toValue(path string, x interface{}) (rt.Value, error) {
+	switch y := x.(type) {
+	case rt.Value:
+		return y, nil
+	case Func:
+		f, err := newGoFunction(path, reflect.ValueOf(y.Fn))
+		if err != nil {
+			return rt.NilValue, err
+		}
+		f.SolemnlyDeclareCompliance(y.Flags)
+		return rt.FunctionValue(f), nil
+	}
+	if fn := reflect.ValueOf(x); fn.Kind() == reflect.Func && !fn.IsNil() {
+		f, err := newGoFunction(path, fn)
+		if err != nil {
+			return rt.NilValue, err
+		}
+		return rt.FunctionValue(f), nil
+	}
+	v, err := luacodec.Encode(x)
+	return v, decodePath(path, err)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// newGoFunction wraps a Go function into a Lua function using reflection.
+func newGoFunction(name string, fn reflect.Value) (*rt.GoFunction, error) {
+	if fn.Kind() != reflect.Func || fn.IsNil() {
+		return nil, fmt.Errorf("%s: not a function", name)
+	}
+	tp := fn.Type()
+	nFixed, nOut := tp.NumIn(), tp.NumOut()
+	if tp.IsVariadic() {
+		nFixed--
+	}
+	returnsErr := nOut > 0 && tp.Out(nOut-1) == errorType
+	if returnsErr {
+		nOut--
+	}
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	f := func(t *rt.Thread, c *rt.GoCont) (next rt.Cont, err error) {
+		args := c.Etc()
+		n := nFixed
+		if tp.IsVariadic() && len(args) > n {
+			n = len(args)
+		}
+		in := make([]reflect.Value, n)
+		for i := range in {
+			var argType reflect.Type
+			if i < nFixed {
+				argType = tp.In(i)
+			} else {
+				argType = tp.In(nFixed).Elem()
+			}
+			arg := reflect.New(argType)
+			if i < len(args) {
+				if err := luacodec.Decode(args[i], arg.Interface()); err != nil {
+					return nil, decodePath("#"+strconv.Itoa(i+1), err)
+				}
+			}
+			in[i] = arg.Elem()
+		}
+		out, err := callGoFunction(fn, in)
+		if err != nil {
+			return nil, err
+		}
+		if returnsErr {
+			if err, _ := out[nOut].Interface().(error); err != nil {
+				return nil, err
+			}
+		}
+		next = c.Next()
+		for i := 0; i < nOut; i++ {
+			v, err := luacodec.Encode(out[i].Interface())
+			if err != nil {
+				return nil, err
+			}
+			t.Push1(next, v)
+		}
+		return next, nil
+	}
+	return rt.NewGoFunction(f, name, 0, true), nil
+}
+
+// callGoFunction calls fn, turning a panic into an error so that it does not
+// bring down the program embedding the VM.
+func callGoFunction(fn reflect.Value, in []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			switch r.(type) {
+			case rt.ContextTerminationError, *rt.ExitError:
+				// Those must unwind the Lua stack
+				panic(r)
+			}
+			err = fmt.Errorf("panic in go call: %v", r)
+		}
+	}()
+	return fn.Call(in), nil
+}
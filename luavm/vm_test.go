@@ -0,0 +1,223 @@
+package luavm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func TestVM(t *testing.T) {
+	var out bytes.Buffer
+	vm := New(&out)
+	defer vm.Close()
+
+	_, err := vm.DoString(`
+config = {server = {host = "localhost", port = 8080}, tags = {"a", "b"}}
+handlers = {}
+function handlers.onEvent(name, data)
+	log("got " .. name)
+	return name .. "!", data.x * 2, add(data.x, 1)
+end
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := vm.Register("log", func(msg string) { fmt.Fprintln(&out, msg) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Register("add", func(x, y int) int { return x + y }); err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := vm.Get("config.server.port")
+	if err != nil || port != int64(8080) {
+		t.Errorf("got %v, %v", port, err)
+	}
+	tag, err := vm.Get("config.tags.2")
+	if err != nil || tag != "b" {
+		t.Errorf("got %v, %v", tag, err)
+	}
+	missing, err := vm.Get("config.nothing.here")
+	if err != nil || missing != nil {
+		t.Errorf("got %v, %v", missing, err)
+	}
+
+	var server struct {
+		Host string `lua:"host"`
+		Port uint16 `lua:"port"`
+	}
+	if err := vm.GetInto("config.server", &server); err != nil || server.Host != "localhost" || server.Port != 8080 {
+		t.Errorf("got %+v, %v", server, err)
+	}
+	var host int
+	if err := vm.GetInto("config.server.host", &host); err == nil || err.Error() != "config.server.host: expected number, got string" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	res, err := vm.Call("handlers.onEvent", "click", map[string]int{"x": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{"click!", int64(20), int64(11)}; !reflect.DeepEqual(res, want) {
+		t.Errorf("got %v, want %v", res, want)
+	}
+	if out.String() != "got click\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	if _, err := vm.Call("handlers.nothing"); err == nil || err.Error() != "handlers.nothing is not defined" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// Set creates intermediate tables
+	if err := vm.Set("a.b.c", []string{"x", "y"}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = vm.DoString(`return #a.b.c, a.b.c[2]`)
+	if err != nil || !reflect.DeepEqual(res, []interface{}{int64(2), "y"}) {
+		t.Errorf("got %v, %v", res, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	vm := New(nil)
+	defer vm.Close()
+
+	errOdd := errors.New("odd number")
+	funcs := map[string]interface{}{
+		"join": func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+		"half": func(n int) (int, error) {
+			if n%2 != 0 {
+				return 0, errOdd
+			}
+			return n / 2, nil
+		},
+		"swap":   func(x, y interface{}) (interface{}, interface{}) { return y, x },
+		"fields": func(m map[string]float64) int { return len(m) },
+	}
+	for name, f := range funcs {
+		if err := vm.Register(name, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vm.Register("notfunc", 42); err == nil {
+		t.Error("expected error")
+	}
+
+	tests := []struct {
+		src string
+		res []interface{}
+		err string
+	}{
+		{src: `return join(", ", "a", "b", "c")`, res: []interface{}{"a, b, c"}},
+		{src: `return join("-")`, res: []interface{}{""}},
+		{src: `return half(10)`, res: []interface{}{int64(5)}},
+		{src: `return pcall(half, 3)`, res: []interface{}{false, "odd number"}},
+		{src: `return swap(1, "x")`, res: []interface{}{"x", int64(1)}},
+		{src: `return fields({a=1, b=2.5})`, res: []interface{}{int64(2)}},
+		{src: `return half("x")`, err: "#1: expected number, got string"},
+		{src: `return fields({a="x"})`, err: "#1.a: expected number, got string"},
+	}
+	for _, test := range tests {
+		res, err := vm.DoString(test.src)
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.src, test.err, err)
+			}
+		case err != nil:
+			t.Errorf("%s: unexpected error %s", test.src, err)
+		case !reflect.DeepEqual(res, test.res):
+			t.Errorf("%s: got %v, want %v", test.src, res, test.res)
+		}
+	}
+}
+
+func TestDoFile(t *testing.T) {
+	vm := New(nil)
+	defer vm.Close()
+
+	path := filepath.Join(t.TempDir(), "test.lua")
+	if err := os.WriteFile(path, []byte(`return ...`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm.DoFile(path)
+	if err != nil || len(res) != 0 {
+		t.Errorf("got %v, %v", res, err)
+	}
+	if _, err := vm.DoFile(filepath.Join(t.TempDir(), "missing.lua")); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := vm.DoString("return +"); err == nil {
+		t.Error("expected syntax error")
+	}
+}
+
+func TestDoFileWorkingDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test.lua"), []byte(`return 42`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vm := New(nil, rt.WithWorkingDir(dir))
+	defer vm.Close()
+	res, err := vm.DoFile("test.lua")
+	if err != nil || len(res) != 1 || res[0] != int64(42) {
+		t.Errorf("got %v, %v", res, err)
+	}
+}
+
+func TestRegisterPanic(t *testing.T) {
+	vm := New(nil)
+	defer vm.Close()
+	if err := vm.Register("boom", func() { panic("boom!") }); err != nil {
+		t.Fatal(err)
+	}
+	res, err := vm.DoString(`return pcall(boom)`)
+	if err != nil || len(res) != 2 || res[0] != false || !strings.Contains(fmt.Sprint(res[1]), "boom!") {
+		t.Errorf("got %v, %v", res, err)
+	}
+	if _, err := vm.DoString(`boom()`); err == nil || !strings.Contains(err.Error(), "boom!") {
+		t.Errorf("expected an error, got %v", err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	if !rt.QuotasAvailable {
+		t.Skip("quotas not available")
+	}
+	vm := New(nil)
+	defer vm.Close()
+
+	if err := vm.Register("unsafe", func() int { return 1 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Register("safe", Func{Fn: func() int { return 2 }, Flags: rt.ComplyCpuSafe | rt.ComplyMemSafe}); err != nil {
+		t.Fatal(err)
+	}
+
+	limited := vm.WithContext(rt.RuntimeContextDef{
+		HardLimits: rt.RuntimeResources{Cpu: 10000, Memory: 100000},
+	})
+	if _, err := limited.DoString("while true do end"); err == nil {
+		t.Error("expected context to be killed")
+	}
+	if res, err := limited.DoString("return safe()"); err != nil || !reflect.DeepEqual(res, []interface{}{int64(2)}) {
+		t.Errorf("got %v, %v", res, err)
+	}
+	if _, err := limited.DoString("return unsafe()"); err == nil || !strings.Contains(err.Error(), "missing flags") {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	// The VM itself is not limited.
+	if res, err := vm.DoString("for i = 1, 100000 do end return unsafe()"); err != nil || !reflect.DeepEqual(res, []interface{}{int64(1)}) {
+		t.Errorf("got %v, %v", res, err)
+	}
+}
@@ -9,6 +9,12 @@ import (
 )
 
 func main() {
+	if len(os.Args) == 2 && os.Args[1] == "lsp" {
+		os.Exit(runLSP())
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
 	cmd := new(luaCmd)
 	cmd.setFlags()
 	flag.Parse()
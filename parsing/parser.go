@@ -5,7 +5,9 @@ import (
 	"fmt"
 
 	"github.com/arnodel/golua/luastrings"
+	"github.com/arnodel/golua/luaversion"
 	"github.com/arnodel/golua/ops"
+	"github.com/arnodel/golua/scanner"
 	"github.com/arnodel/golua/token"
 
 	"github.com/arnodel/golua/ast"
@@ -14,6 +16,36 @@ import (
 // Parser can parse lua statements or expressions
 type Parser struct {
 	scanner Scanner
+
+	// When recovering is true, a syntax error in a statement does not stop
+	// parsing: it is recorded in errs, the statement is replaced with an
+	// ast.ErrorStat and parsing resumes at the next statement boundary.
+	recovering bool
+	errs       []Error
+	prev, last *token.Token // The last two tokens scanned
+	depth      int          // Number of blocks opened in the tokens scanned so far
+
+	// When types is true, type annotations are accepted (see
+	// scanner.TypeAnnotations).
+	types bool
+
+	// The version of the Lua language being parsed.
+	version luaversion.Version
+}
+
+// newParser returns a parser reading tokens from s.  If s reports the syntax
+// extensions it was created with, the parser accepts the ones made of ordinary
+// tokens.  If s reports the version of the Lua language it scans, the parser
+// accepts the syntax of that version.
+func newParser(s Scanner) *Parser {
+	p := &Parser{scanner: s, version: luaversion.Default}
+	if es, ok := s.(interface{ Extensions() scanner.Extensions }); ok {
+		p.types = es.Extensions()&scanner.TypeAnnotations != 0
+	}
+	if vs, ok := s.(interface{ Version() luaversion.Version }); ok {
+		p.version = vs.Version()
+	}
+	return p
 }
 
 type Scanner interface {
@@ -59,7 +91,7 @@ func ParseExp(scanner Scanner) (exp ast.ExpNode, err error) {
 			}
 		}
 	}()
-	parser := &Parser{scanner}
+	parser := newParser(scanner)
 	var t *token.Token
 	exp, t = parser.Exp(parser.Scan())
 	expectType(t, token.EOF, "<eof>")
@@ -79,18 +111,74 @@ func ParseChunk(scanner Scanner) (stat ast.BlockStat, err error) {
 			}
 		}
 	}()
-	parser := &Parser{scanner}
+	parser := newParser(scanner)
 	var t *token.Token
 	stat, t = parser.Block(parser.Scan())
 	expectType(t, token.EOF, "<eof>")
 	return
 }
 
+// ParseChunkWithRecovery is like ParseChunk but does not stop at the first
+// syntax error.  Statements which cannot be parsed are replaced with
+// ast.ErrorStat nodes and parsing resumes at the next statement boundary (the
+// next 'end', ';', keyword starting a statement such as 'local' or 'function'
+// or name at the start of a line, at the same nesting level).  It
+// returns the best-effort AST and all the errors encountered, in the order
+// they appear in the source.  Invalid tokens are reported as errors too, and
+// scanning resumes after them if the scanner has a Resync method (such as
+// *scanner.Scanner); with other scanners, the rest of the input is ignored.
+// This is useful for tools such as editors.
+func ParseChunkWithRecovery(scanner Scanner) (stat ast.BlockStat, errs []Error) {
+	parser := newParser(scanner)
+	parser.recovering = true
+	var (
+		stats []ast.Stat
+		ret   []ast.ExpNode
+		block ast.BlockStat
+	)
+	t := parser.scanRecovering()
+	startTok := t
+	for {
+		block, t = parser.Block(t)
+		stats = append(stats, block.Stats...)
+		if block.Return != nil {
+			ret = block.Return
+		}
+		if t.Type == token.EOF {
+			break
+		}
+		// The block was closed by a stray 'end', 'until', etc. or there
+		// was something after a return statement.
+		err := Error{Got: t, Expected: "<eof>"}
+		parser.errs = append(parser.errs, err)
+		stats = append(stats, ast.NewErrorStat(t, t, err.Error()))
+		t = parser.scanRecovering()
+	}
+	stat = ast.NewBlockStat(stats, ret)
+	stat.Location = ast.LocFromTokens(startTok, t)
+	return stat, parser.errs
+}
+
 // Scan returns the next token.
 func (p *Parser) Scan() *token.Token {
 	tok := p.scanner.Scan()
+	if tok == nil {
+		// The scanner stops after an invalid token, unless it can be
+		// resynced when recovering from errors.
+		tok = &token.Token{Type: token.EOF, Pos: token.Pos{Offset: -1}}
+		if p.last != nil {
+			tok.Pos = p.last.Pos
+		}
+	}
+	p.prev, p.last = p.last, tok
+	p.depth += depthChange(tok.Type)
 	if tok.Type == token.INVALID {
-		panic(Error{Got: tok, Expected: p.scanner.ErrorMsg()})
+		err := Error{Got: tok, Expected: p.scanner.ErrorMsg()}
+		if rs, ok := p.scanner.(interface{ Resync() }); ok && p.recovering {
+			// Carry on scanning after the invalid token.
+			rs.Resync()
+		}
+		panic(err)
 	}
 	return tok
 }
@@ -102,6 +190,8 @@ func (p *Parser) Stat(t *token.Token) (ast.Stat, *token.Token) {
 		return ast.NewEmptyStat(t), p.Scan()
 	case token.KwBreak:
 		return ast.NewBreakStat(t), p.Scan()
+	case token.KwContinue:
+		return ast.NewContinueStat(t), p.Scan()
 	case token.KwGoto:
 		dest := p.Scan()
 		expectIdent(dest)
@@ -135,18 +225,45 @@ func (p *Parser) Stat(t *token.Token) (ast.Stat, *token.Token) {
 		return ast.NewLabelStat(name), p.Scan()
 	default:
 		var exp ast.ExpNode
-		exp, t = p.PrefixExp(t)
+		switch {
+		case p.types && isName(t, "type"):
+			next := p.Scan()
+			if next.Type == token.IDENT {
+				return p.TypeAlias(t, next)
+			}
+			// Here "type" is just a name, e.g. in "type(x)"
+			exp, t = p.prefixExpTail(ast.NewName(t), next)
+		case p.version >= luaversion.Lua55 && isName(t, "global"):
+			next := p.Scan()
+			switch next.Type {
+			case token.IDENT, token.KwFunction, token.SgLess, token.SgStar:
+				return p.Global(t, next)
+			}
+			// Here "global" is just a name, e.g. in "global = 1"
+			exp, t = p.prefixExpTail(ast.NewName(t), next)
+		default:
+			exp, t = p.PrefixExp(t)
+		}
 		switch e := exp.(type) {
 		case ast.Stat:
 			// This is a function call
 			return e, t
 		case ast.Var:
+			if !isAssignable(e) {
+				tokenError(t, "")
+			}
+			if t.Type == token.SgOpAssign {
+				// This is a compound assignment 'var op= exp'
+				op := opAssignMap[string(t.Lit)]
+				exp, t := p.Exp(p.Scan())
+				return ast.NewCompoundAssignStat(e, op, exp), t
+			}
 			// This should be the start of 'varlist = explist'
 			vars := []ast.Var{e}
 			var pexp ast.ExpNode
 			for t.Type == token.SgComma {
 				pexp, t = p.PrefixExp(p.Scan())
-				if v, ok := pexp.(ast.Var); ok {
+				if v, ok := pexp.(ast.Var); ok && isAssignable(v) {
 					vars = append(vars, v)
 				} else {
 					tokenError(t, "expected variable")
@@ -162,6 +279,30 @@ func (p *Parser) Stat(t *token.Token) (ast.Stat, *token.Token) {
 	return nil, nil
 }
 
+// isName returns true if t is the given name.  It is used for the words that
+// are keywords only in some contexts, such as "global".
+func isName(t *token.Token, name string) bool {
+	return t.Type == token.IDENT && string(t.Lit) == name
+}
+
+// isAssignable returns true if v can be assigned to, i.e. it is not a safe
+// navigation expression.
+func isAssignable(v ast.Var) bool {
+	e, ok := v.(ast.IndexExp)
+	return !ok || !e.Safe
+}
+
+var opAssignMap = map[string]ops.Op{
+	"+=":  ops.OpAdd,
+	"-=":  ops.OpSub,
+	"*=":  ops.OpMul,
+	"/=":  ops.OpDiv,
+	"//=": ops.OpFloorDiv,
+	"%=":  ops.OpMod,
+	"^=":  ops.OpPow,
+	"..=": ops.OpConcat,
+}
+
 // If parses an if / then / else statement.  It assumes that t is the "if"
 // token.
 func (p *Parser) If(t *token.Token) (ast.IfStat, *token.Token) {
@@ -243,13 +384,12 @@ func (p *Parser) Local(*token.Token) (ast.Stat, *token.Token) {
 		fx, t := p.FunctionDef(t)
 		return ast.NewLocalFunctionStat(name, fx), t
 	}
-	// local namelist ['=' explist]
-	nameAttrib, t := p.NameAttrib(t)
-	nameAttribs := []ast.NameAttrib{nameAttrib}
-	for t.Type == token.SgComma {
-		nameAttrib, t = p.NameAttrib(p.Scan())
-		nameAttribs = append(nameAttribs, nameAttrib)
+	// local [attrib] namelist ['=' explist]
+	attrib := ast.NoAttrib
+	if p.version >= luaversion.Lua55 && t.Type == token.SgLess {
+		_, attrib, t = p.Attrib(t, true)
 	}
+	nameAttribs, t := p.nameAttribList(t, attrib, true)
 	var values []ast.ExpNode
 	if t.Type == token.SgAssign {
 		values, t = p.ExpList(p.Scan())
@@ -257,6 +397,48 @@ func (p *Parser) Local(*token.Token) (ast.Stat, *token.Token) {
 	return ast.NewLocalStat(nameAttribs, values), t
 }
 
+// Global parses a global declaration (Lua 5.5).  It assumes that globalTok is
+// the "global" token and t the token following it.
+func (p *Parser) Global(globalTok, t *token.Token) (ast.Stat, *token.Token) {
+	if t.Type == token.KwFunction {
+		name, t := p.Name(p.Scan())
+		fx, t := p.FunctionDef(t)
+		return ast.NewGlobalFunctionStat(globalTok, name, fx), t
+	}
+	// global [attrib] namelist ['=' explist] | global [attrib] '*'
+	attrib := ast.NoAttrib
+	if t.Type == token.SgLess {
+		_, attrib, t = p.Attrib(t, false)
+	}
+	if t.Type == token.SgStar {
+		return ast.NewGlobalAllStat(globalTok, t, attrib), p.Scan()
+	}
+	nameAttribs, t := p.nameAttribList(t, attrib, false)
+	var values []ast.ExpNode
+	if t.Type == token.SgAssign {
+		values, t = p.ExpList(p.Scan())
+	}
+	return ast.NewGlobalStat(globalTok, nameAttribs, values), t
+}
+
+// nameAttribList parses a list of names with optional attributes.  Names with
+// no attribute get defaultAttrib.
+func (p *Parser) nameAttribList(t *token.Token, defaultAttrib ast.LocalAttrib, allowClose bool) ([]ast.NameAttrib, *token.Token) {
+	var nameAttribs []ast.NameAttrib
+	for {
+		var nameAttrib ast.NameAttrib
+		nameAttrib, t = p.nameAttrib(t, allowClose)
+		if nameAttrib.Attrib == ast.NoAttrib {
+			nameAttrib.Attrib = defaultAttrib
+		}
+		nameAttribs = append(nameAttribs, nameAttrib)
+		if t.Type != token.SgComma {
+			return nameAttribs, t
+		}
+		t = p.Scan()
+	}
+}
+
 // FunctionStat parses a function definition statement. It assumes that t is the
 // "function" token.
 func (p *Parser) FunctionStat(*token.Token) (ast.Stat, *token.Token) {
@@ -280,20 +462,163 @@ func (p *Parser) FunctionStat(*token.Token) (ast.Stat, *token.Token) {
 func (p *Parser) Block(t *token.Token) (ast.BlockStat, *token.Token) {
 	var stats []ast.Stat
 	var next ast.Stat
+	startTok := t
 	for {
 		switch t.Type {
 		case token.KwReturn:
-			ret, t := p.Return(t)
-			return ast.NewBlockStat(stats, ret), t
+			var ret []ast.ExpNode
+			if p.recovering {
+				ret, next, t = p.recoverReturn(t)
+				if next != nil {
+					// The return statement was skipped, carry on with what
+					// follows.
+					stats = append(stats, next)
+					continue
+				}
+			} else {
+				ret, t = p.Return(t)
+			}
+			block := ast.NewBlockStat(stats, ret)
+			block.Location = ast.LocFromTokens(startTok, t)
+			return block, t
 		case token.KwEnd, token.KwElse, token.KwElseIf, token.KwUntil, token.EOF:
-			return ast.NewBlockStat(stats, nil), t
+			block := ast.NewBlockStat(stats, nil)
+			block.Location = ast.LocFromTokens(startTok, t)
+			return block, t
 		default:
-			next, t = p.Stat(t)
+			if p.recovering {
+				next, t = p.recoverStat(t)
+			} else {
+				next, t = p.Stat(t)
+			}
 			stats = append(stats, next)
 		}
 	}
 }
 
+// recoverStat parses a statement like Stat, but in case of a syntax error it
+// records the error, skips to the next statement boundary and returns an
+// ErrorStat spanning the skipped code.
+func (p *Parser) recoverStat(t *token.Token) (stat ast.Stat, next *token.Token) {
+	defer p.recoverError(t, p.depth-depthChange(t.Type), &stat, &next)
+	return p.Stat(t)
+}
+
+// recoverReturn parses a return statement like Return, but in case of a
+// syntax error it recovers like recoverStat and returns the ErrorStat instead
+// of the return values.  errStat is nil if there was no error.
+func (p *Parser) recoverReturn(t *token.Token) (ret []ast.ExpNode, errStat ast.Stat, next *token.Token) {
+	defer p.recoverError(t, p.depth, &errStat, &next)
+	ret, next = p.Return(t)
+	return
+}
+
+// recoverError must be deferred by a function parsing a statement starting
+// with token t at the given block depth.  In case of a syntax error, it
+// records the error, skips to the next statement boundary and sets *stat to an
+// ErrorStat spanning the skipped code and *next to the token following it.
+func (p *Parser) recoverError(t *token.Token, depth int, stat *ast.Stat, next **token.Token) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err, ok := r.(Error)
+	if !ok {
+		panic(r)
+	}
+	p.errs = append(p.errs, err)
+	*next = p.skipStat(depth)
+	if *next == t {
+		// Make sure we make progress
+		*next = p.scanRecovering()
+	}
+	*stat = ast.NewErrorStat(t, p.prev, err.Error())
+}
+
+// skipStat skips tokens from the last one scanned until the end of the
+// current statement, which started at the given block depth, and returns the
+// token following it.
+func (p *Parser) skipStat(depth int) *token.Token {
+	tok := p.last
+	for {
+		switch tok.Type {
+		case token.EOF:
+			return tok
+		case token.SgSemicolon:
+			if p.depth == depth {
+				return p.scanRecovering()
+			}
+		case token.KwLocal, token.KwWhile, token.KwFor, token.KwReturn, token.KwBreak, token.KwContinue, token.KwGoto:
+			if p.depth == depth {
+				return tok
+			}
+		case token.KwFunction, token.KwIf, token.KwDo, token.KwRepeat:
+			if p.depth == depth+1 {
+				return tok
+			}
+		case token.KwEnd:
+			if p.depth < depth {
+				// This closes the enclosing block
+				return tok
+			}
+			if p.depth == depth {
+				return p.scanRecovering()
+			}
+		case token.KwUntil, token.KwElse, token.KwElseIf:
+			if p.depth < depth || p.depth == depth && tok.Type != token.KwUntil {
+				// This belongs to the enclosing statement
+				return tok
+			}
+		case token.IDENT:
+			if p.depth == depth && p.prev != nil && p.prev.Line < tok.Line {
+				// A name at the start of a line is likely to start a new
+				// statement (e.g. a function call).
+				return tok
+			}
+		}
+		tok = p.scanRecovering()
+	}
+}
+
+// scanRecovering is like Scan but records invalid tokens as errors instead of
+// panicking.  If the scanner cannot be resynced after an invalid token, what
+// follows is EOF.
+func (p *Parser) scanRecovering() *token.Token {
+	for {
+		if tok := p.tryScan(); tok != nil {
+			return tok
+		}
+	}
+}
+
+// tryScan is like Scan but records an invalid token as an error and returns
+// nil instead of panicking.
+func (p *Parser) tryScan() (tok *token.Token) {
+	defer func() {
+		if r := recover(); r != nil {
+			err, ok := r.(Error)
+			if !ok {
+				panic(r)
+			}
+			p.errs = append(p.errs, err)
+			tok = nil
+		}
+	}()
+	return p.Scan()
+}
+
+// depthChange returns how the token changes the nesting depth of blocks.
+func depthChange(tp token.Type) int {
+	switch tp {
+	case token.KwDo, token.KwIf, token.KwFunction, token.KwRepeat:
+		return 1
+	case token.KwEnd, token.KwUntil:
+		return -1
+	default:
+		return 0
+	}
+}
+
 // Return parses a return statement.
 func (p *Parser) Return(*token.Token) ([]ast.ExpNode, *token.Token) {
 	t := p.Scan()
@@ -443,14 +768,24 @@ var binopMap = map[token.Type]ops.Op{
 func (p *Parser) FunctionDef(startTok *token.Token) (ast.Function, *token.Token) {
 	expectType(startTok, token.SgOpenBkt, "'('")
 	t := p.Scan()
-	var names []ast.Name
-	hasEtc := false
+	var (
+		names     []ast.Name
+		hasEtc    bool
+		sig       ast.FunctionType // Type annotations
+		annotated bool
+	)
 ParamsLoop:
 	for {
 		switch t.Type {
 		case token.IDENT:
 			names = append(names, ast.NewName(t))
 			t = p.Scan()
+			var paramType ast.TypeExp
+			if p.types && t.Type == token.SgColon {
+				paramType, t = p.Type(p.Scan())
+				annotated = true
+			}
+			sig.Params = append(sig.Params, paramType)
 			if t.Type != token.SgComma {
 				break ParamsLoop
 			}
@@ -458,6 +793,10 @@ ParamsLoop:
 		case token.SgEtc:
 			hasEtc = true
 			t = p.Scan()
+			if p.types && t.Type == token.SgColon {
+				sig.Varargs, t = p.Type(p.Scan())
+				annotated = true
+			}
 			break ParamsLoop
 		case token.SgCloseBkt:
 			break ParamsLoop
@@ -466,9 +805,23 @@ ParamsLoop:
 		}
 	}
 	expectType(t, token.SgCloseBkt, "')'")
-	body, endTok := p.Block(p.Scan())
+	sig.Location = ast.LocFromTokens(startTok, t)
+	t = p.Scan()
+	if p.types && t.Type == token.SgColon {
+		sig.Returns, t = p.ReturnTypes(p.Scan())
+		sig.HasReturns = true
+		annotated = true
+		if len(sig.Returns) > 0 {
+			sig.Location = ast.MergeLocations(sig, sig.Returns[len(sig.Returns)-1])
+		}
+	}
+	body, endTok := p.Block(t)
 	expectType(endTok, token.KwEnd, "'end'")
 	def := ast.NewFunction(startTok, endTok, ast.NewParList(names, hasEtc), body)
+	if annotated {
+		sig.HasDots = hasEtc
+		def.Signature = &sig
+	}
 	return def, p.Scan()
 }
 
@@ -488,7 +841,12 @@ func (p *Parser) PrefixExp(t *token.Token) (ast.ExpNode, *token.Token) {
 	default:
 		tokenError(t, "")
 	}
-	t = p.Scan()
+	return p.prefixExpTail(exp, p.Scan())
+}
+
+// prefixExpTail parses the indexing operations and function applications that
+// follow exp in a prefix expression.  The token t is the one following exp.
+func (p *Parser) prefixExpTail(exp ast.ExpNode, t *token.Token) (ast.ExpNode, *token.Token) {
 	for {
 		switch t.Type {
 		case token.SgOpenSquareBkt:
@@ -501,6 +859,16 @@ func (p *Parser) PrefixExp(t *token.Token) (ast.ExpNode, *token.Token) {
 			var name ast.Name
 			name, t = p.Name(p.Scan())
 			exp = ast.NewIndexExp(exp, name.AstString())
+		case token.SgSafeOpenBkt:
+			var idxExp ast.ExpNode
+			idxExp, t = p.Exp(p.Scan())
+			expectType(t, token.SgCloseSquareBkt, "']'")
+			t = p.Scan()
+			exp = ast.NewSafeIndexExp(exp, idxExp)
+		case token.SgSafeDot:
+			var name ast.Name
+			name, t = p.Name(p.Scan())
+			exp = ast.NewSafeIndexExp(exp, name.AstString())
 		case token.SgColon:
 			var name ast.Name
 			var args []ast.ExpNode
@@ -611,25 +979,42 @@ func (p *Parser) Name(t *token.Token) (ast.Name, *token.Token) {
 }
 
 func (p *Parser) NameAttrib(t *token.Token) (ast.NameAttrib, *token.Token) {
+	return p.nameAttrib(t, true)
+}
+
+func (p *Parser) nameAttrib(t *token.Token, allowClose bool) (ast.NameAttrib, *token.Token) {
 	name, t := p.Name(t)
 	attrib := ast.NoAttrib
 	var attribName *ast.Name
 	if t.Type == token.SgLess {
-		attribTok := p.Scan()
-		attribName = new(ast.Name)
-		*attribName, t = p.Name(attribTok)
-		switch attribName.Val {
-		case "const":
-			attrib = ast.ConstAttrib
-		case "close":
-			attrib = ast.CloseAttrib
-		default:
-			tokenError(attribTok, "'const' or 'close'")
-		}
-		expectType(t, token.SgGreater, "'>'")
-		t = p.Scan()
+		attribName, attrib, t = p.Attrib(t, allowClose)
+	}
+	nameAttrib := ast.NewNameAttrib(name, attribName, attrib)
+	if p.types && t.Type == token.SgColon {
+		nameAttrib.Type, t = p.Type(p.Scan())
+		nameAttrib.Location = ast.MergeLocations(nameAttrib, nameAttrib.Type)
+	}
+	return nameAttrib, t
+}
+
+// Attrib parses an attribute "<const>" or "<close>" (the latter only if
+// allowClose is true).  It assumes that t is the "<" token.
+func (p *Parser) Attrib(t *token.Token, allowClose bool) (*ast.Name, ast.LocalAttrib, *token.Token) {
+	attribTok := p.Scan()
+	attribName, t := p.Name(attribTok)
+	var attrib ast.LocalAttrib
+	switch {
+	case attribName.Val == "const":
+		attrib = ast.ConstAttrib
+	case attribName.Val == "close" && allowClose:
+		attrib = ast.CloseAttrib
+	case allowClose:
+		tokenError(attribTok, "'const' or 'close'")
+	default:
+		tokenError(attribTok, "'const'")
 	}
-	return ast.NewNameAttrib(name, attribName, attrib), t
+	expectType(t, token.SgGreater, "'>'")
+	return &attribName, attrib, p.Scan()
 }
 
 func expectIdent(t *token.Token) {
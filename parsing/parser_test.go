@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/arnodel/golua/ast"
+	"github.com/arnodel/golua/luaversion"
 	"github.com/arnodel/golua/ops"
 	"github.com/arnodel/golua/scanner"
 	"github.com/arnodel/golua/token"
@@ -1287,6 +1288,150 @@ func TestParser_Stat(t *testing.T) {
 	}
 }
 
+func TestParser_StatExtensions(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  ast.Stat
+		want1 *token.Token
+	}{
+		{
+			name:  "continue statement",
+			input: "continue",
+			want:  ast.ContinueStat{},
+			want1: tok(token.EOF, ""),
+		},
+		{
+			name:  "compound assignment",
+			input: "x += 1",
+			want:  ast.CompoundAssignStat{Dest: name("x"), Op: ops.OpAdd, Value: ast.NewInt(1)},
+			want1: tok(token.EOF, ""),
+		},
+		{
+			name:  "compound concatenation to index",
+			input: "t[1] ..= 'a' ..'b'",
+			want: ast.CompoundAssignStat{
+				Dest: ast.IndexExp{Coll: name("t"), Idx: ast.NewInt(1)},
+				Op:   ops.OpConcat,
+				Value: &ast.BinOp{
+					Left:   str("a"),
+					OpType: ops.OpConcat,
+					Right:  []ast.Operation{{Op: ops.OpConcat, Operand: str("b")}},
+				},
+			},
+			want1: tok(token.EOF, ""),
+		},
+		{
+			name:  "assignment to safe index",
+			input: "a.b = x?.y?[z]",
+			want: ast.AssignStat{
+				Dest: []ast.Var{ast.IndexExp{Coll: name("a"), Idx: str("b")}},
+				Src: []ast.ExpNode{ast.IndexExp{
+					Coll: ast.IndexExp{Coll: name("x"), Idx: str("y"), Safe: true},
+					Idx:  name("z"),
+					Safe: true,
+				}},
+			},
+			want1: tok(token.EOF, ""),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Parser{scanner: testScanner{scanner.New("test", []byte(tt.input), scanner.WithExtensions(scanner.AllExtensions))}}
+			got, got1 := p.Stat(p.Scan())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parser.Stat() got = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(got1, tt.want1) {
+				t.Errorf("Parser.Stat() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+	for _, input := range []string{"x?.y = 1", "x, y?[1] = 1, 2", "x?.y += 1", "f() += 1"} {
+		_, err := ParseChunk(scanner.New("test", []byte(input), scanner.WithExtensions(scanner.AllExtensions)))
+		if err == nil {
+			t.Errorf("%q: expected a parsing error", input)
+		}
+	}
+}
+
+func TestParser_TypeAnnotations(t *testing.T) {
+	withTypes := scanner.WithExtensions(scanner.TypeAnnotations)
+	valid := []string{
+		"type T = number",
+		"type = 1 type.x = 2 type(x) type 'x' type {}",
+		"local type: string = type(x)",
+		"local x: {[string]: {number}, n: integer?}, y: (A | B)? = f()",
+		"local function f(x: number, ...: string): (boolean, string?) end",
+		"local f: function(x: number, string, ...): function(): nil",
+		"return function(): (A | B)? end",
+	}
+	for _, input := range valid {
+		if _, err := ParseChunk(scanner.New("test", []byte(input), withTypes)); err != nil {
+			t.Errorf("%q: unexpected error %s", input, err)
+		}
+	}
+	invalid := []string{
+		"type T number",
+		"type T = ",
+		"local x: = 1",
+		"local x: {number, string}",
+		"local x: {[string]: number, [number]: string}",
+		"local f: function(x: number",
+		"local function f(): (number, ) end",
+		"local f: function(number, )",
+	}
+	for _, input := range invalid {
+		if _, err := ParseChunk(scanner.New("test", []byte(input), withTypes)); err == nil {
+			t.Errorf("%q: expected a parsing error", input)
+		}
+	}
+	// Without the extension, annotations are syntax errors.
+	if _, err := ParseChunk(scanner.New("test", []byte("local x: number = 1"))); err == nil {
+		t.Errorf("expected a parsing error without the types extension")
+	}
+}
+
+func TestParser_Lua55(t *testing.T) {
+	lua55 := scanner.WithVersion(luaversion.Lua55)
+	valid := []string{
+		"global x",
+		"global x, y <const>, z = 1, 2",
+		"global <const> x, y",
+		"global *",
+		"global <const> *",
+		"global function f() end",
+		"local <const> x, y = 1, 2",
+		"local <close> x, y <const> = f()",
+		"global = 1 global.x = 2 global(x) global 'x' global {}",
+	}
+	for _, input := range valid {
+		if _, err := ParseChunk(scanner.New("test", []byte(input), lua55)); err != nil {
+			t.Errorf("%q: unexpected error %s", input, err)
+		}
+	}
+	invalid := []string{
+		"global x <close>",
+		"global <close> *",
+		"global *, x",
+		"global function a.b() end",
+		"global function a:b() end",
+		"local <foo> x",
+	}
+	for _, input := range invalid {
+		if _, err := ParseChunk(scanner.New("test", []byte(input), lua55)); err == nil {
+			t.Errorf("%q: expected a parsing error", input)
+		}
+	}
+	// In Lua 5.4, global is a plain name.
+	if _, err := ParseChunk(scanner.New("test", []byte("global x"))); err == nil {
+		t.Errorf("expected a parsing error in Lua 5.4")
+	}
+	if _, err := ParseChunk(scanner.New("test", []byte("local <const> x = 1"))); err == nil {
+		t.Errorf("expected a parsing error in Lua 5.4")
+	}
+}
+
 func TestParseChunk(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -1360,6 +1505,176 @@ func TestParseExp(t *testing.T) {
 	}
 }
 
+func TestParseChunkWithRecovery(t *testing.T) {
+	errStat := func(msg string) ast.ErrorStat {
+		return ast.ErrorStat{Message: "0:0: " + msg}
+	}
+	tests := []struct {
+		name     string
+		input    string
+		wantStat ast.BlockStat
+		wantErrs []string
+	}{
+		{
+			name:  "no errors",
+			input: "break return 1",
+			wantStat: ast.NewBlockStat(
+				[]ast.Stat{ast.BreakStat{}},
+				[]ast.ExpNode{ast.NewInt(1)},
+			),
+		},
+		{
+			name:  "resume at local",
+			input: "x = = 1 local y break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				errStat("unexpected symbol near '='"),
+				ast.LocalStat{NameAttribs: []ast.NameAttrib{nameAttrib("y")}},
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{"0:0: unexpected symbol near '='"},
+		},
+		{
+			name:  "resume after semicolon",
+			input: "x y z; break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				errStat("expected '=' near 'y'"),
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{"0:0: expected '=' near 'y'"},
+		},
+		{
+			name:  "error in nested block",
+			input: "if true then x = = 1 end break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				ast.IfStat{
+					If: ast.CondStat{
+						Cond: ast.Bool{Val: true},
+						Body: ast.BlockStat{Stats: []ast.Stat{errStat("unexpected symbol near '='")}},
+					},
+				},
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{"0:0: unexpected symbol near '='"},
+		},
+		{
+			name:  "skip whole statement with nested blocks",
+			input: "if x x then break end break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				errStat("expected 'then' near 'x'"),
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{"0:0: expected 'then' near 'x'"},
+		},
+		{
+			name:  "resume at block",
+			input: "while x x do break end",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				errStat("expected 'do' near 'x'"),
+				ast.NewBlockStat([]ast.Stat{ast.BreakStat{}}, nil),
+			}, nil),
+			wantErrs: []string{"0:0: expected 'do' near 'x'"},
+		},
+		{
+			name:  "stray end",
+			input: "break end break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				ast.BreakStat{},
+				errStat("expected <eof> near 'end'"),
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{"0:0: expected <eof> near 'end'"},
+		},
+		{
+			name:  "several errors",
+			input: "x = = 1 local function 2 end ; break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				errStat("unexpected symbol near '='"),
+				errStat("expected name near '2'"),
+				ast.EmptyStat{},
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{
+				"0:0: unexpected symbol near '='",
+				"0:0: expected name near '2'",
+			},
+		},
+		{
+			name:  "invalid token",
+			input: "break x = 1 @ 2 break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				ast.BreakStat{},
+				errStat("invalid token: illegal character near '@'"),
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{"0:0: invalid token: illegal character near '@'"},
+		},
+		{
+			name:  "consecutive invalid tokens",
+			input: "x = 1 @@ 2 break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				errStat("invalid token: illegal character near '@'"),
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{
+				"0:0: invalid token: illegal character near '@'",
+				"0:0: invalid token: illegal character near '@'",
+			},
+		},
+		{
+			name:  "error in return",
+			input: "if x then return 1 + end break",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				ast.IfStat{
+					If: ast.CondStat{
+						Cond: name("x"),
+						Body: ast.BlockStat{Stats: []ast.Stat{errStat("unexpected symbol near 'end'")}},
+					},
+				},
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{"0:0: unexpected symbol near 'end'"},
+		},
+		{
+			name:  "error in table returned",
+			input: "return {double = fnction(x) return 2 * x end}",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				errStat("expected '}' near 'return'"),
+				errStat("expected <eof> near 'end'"),
+				errStat("unexpected symbol near '}'"),
+			}, []ast.ExpNode{ast.NewBinOp(ast.NewInt(2), ops.OpMul, nil, name("x"))}),
+			wantErrs: []string{
+				"0:0: expected '}' near 'return'",
+				"0:0: expected <eof> near 'end'",
+				"0:0: unexpected symbol near '}'",
+			},
+		},
+		{
+			name:  "unfinished string in return",
+			input: "return \"abc\nbreak",
+			wantStat: ast.NewBlockStat([]ast.Stat{
+				errStat(`invalid token: illegal new line in string literal near '"abc\n'`),
+				ast.BreakStat{},
+			}, nil),
+			wantErrs: []string{`0:0: invalid token: illegal new line in string literal near '"abc\n'`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStat, gotErrs := ParseChunkWithRecovery(newTestScanner(tt.input))
+			if !reflect.DeepEqual(gotStat, tt.wantStat) {
+				t.Errorf("ParseChunkWithRecovery() = %v, want %v", gotStat, tt.wantStat)
+			}
+			var gotMsgs []string
+			for _, err := range gotErrs {
+				gotMsgs = append(gotMsgs, err.Error())
+			}
+			if !reflect.DeepEqual(gotMsgs, tt.wantErrs) {
+				t.Errorf("ParseChunkWithRecovery() errs = %q, want %q", gotMsgs, tt.wantErrs)
+			}
+		})
+	}
+}
+
 func TestError_Error(t *testing.T) {
 	type fields struct {
 		Got      *token.Token
@@ -0,0 +1,210 @@
+package parsing
+
+import (
+	"github.com/arnodel/golua/ast"
+	"github.com/arnodel/golua/token"
+)
+
+// This file contains the parser for type annotations, which are a syntax
+// extension (see scanner.TypeAnnotations).  Their grammar is
+//
+//	type ::= optionaltype {'|' optionaltype}
+//	optionaltype ::= simpletype {'?'}
+//	simpletype ::= Name | nil | function ['(' [paramtypes] ')' [':' returntypes]]
+//	             | '{' [fieldtype {fieldsep fieldtype} [fieldsep]] '}'
+//	             | '(' type ')'
+//	paramtypes ::= [Name ':'] type {',' [Name ':'] type} [',' '...' [':' type]]
+//	             | '...' [':' type]
+//	returntypes ::= type | '(' [type {',' type}] ')'
+//	fieldtype ::= Name ':' type | '[' type ']' ':' type | type
+//
+// A table type can have at most one field of the form '[' type ']' ':' type
+// (the map part) and at most one of the form type (the array part).
+
+// TypeAlias parses a type alias declaration "type Name = type".  It assumes
+// that typeTok is the "type" token and nameTok the following token.
+func (p *Parser) TypeAlias(typeTok, nameTok *token.Token) (ast.TypeAliasStat, *token.Token) {
+	name, t := p.Name(nameTok)
+	expectType(t, token.SgAssign, "'='")
+	typ, t := p.Type(p.Scan())
+	return ast.NewTypeAliasStat(typeTok, name, typ), t
+}
+
+// Type parses a type annotation.
+func (p *Parser) Type(t *token.Token) (ast.TypeExp, *token.Token) {
+	typ, t := p.simpleType(t)
+	return p.typeTail(typ, t)
+}
+
+// typeTail parses the "?" and "| type" that follow typ in a type annotation.
+// The token t is the one following typ.
+func (p *Parser) typeTail(typ ast.TypeExp, t *token.Token) (ast.TypeExp, *token.Token) {
+	typ, t = p.optionalTail(typ, t)
+	if t.Type != token.SgPipe {
+		return typ, t
+	}
+	types := []ast.TypeExp{typ}
+	for t.Type == token.SgPipe {
+		typ, t = p.simpleType(p.Scan())
+		typ, t = p.optionalTail(typ, t)
+		types = append(types, typ)
+	}
+	return ast.UnionType{
+		Location: ast.MergeLocations(types[0], types[len(types)-1]),
+		Types:    types,
+	}, t
+}
+
+func (p *Parser) optionalTail(typ ast.TypeExp, t *token.Token) (ast.TypeExp, *token.Token) {
+	for t.Type == token.SgQuestion {
+		typ = ast.OptionalType{
+			Location: ast.MergeLocations(typ, ast.LocFromToken(t)),
+			Type:     typ,
+		}
+		t = p.Scan()
+	}
+	return typ, t
+}
+
+func (p *Parser) simpleType(t *token.Token) (ast.TypeExp, *token.Token) {
+	switch t.Type {
+	case token.IDENT:
+		return ast.NewNamedType(ast.NewName(t)), p.Scan()
+	case token.KwNil:
+		return ast.NamedType{Location: ast.LocFromToken(t), Name: "nil"}, p.Scan()
+	case token.KwFunction:
+		return p.functionType(t)
+	case token.SgOpenBrace:
+		return p.tableType(t)
+	case token.SgOpenBkt:
+		typ, t := p.Type(p.Scan())
+		expectType(t, token.SgCloseBkt, "')'")
+		return typ, p.Scan()
+	default:
+		tokenError(t, "type")
+	}
+	return nil, nil
+}
+
+// functionType parses a function type.  It assumes that fTok is the
+// "function" token.
+func (p *Parser) functionType(fTok *token.Token) (ast.TypeExp, *token.Token) {
+	t := p.Scan()
+	if t.Type != token.SgOpenBkt {
+		return ast.NamedType{Location: ast.LocFromToken(fTok), Name: "function"}, t
+	}
+	ft := ast.FunctionType{}
+	t = p.Scan()
+	for t.Type != token.SgCloseBkt {
+		if t.Type == token.SgEtc {
+			ft.HasDots = true
+			t = p.Scan()
+			if t.Type == token.SgColon {
+				ft.Varargs, t = p.Type(p.Scan())
+			}
+			break
+		}
+		var typ ast.TypeExp
+		typ, t = p.namedType(t)
+		ft.Params = append(ft.Params, typ)
+		if t.Type != token.SgComma {
+			break
+		}
+		t = p.Scan()
+		if t.Type == token.SgCloseBkt {
+			tokenError(t, "type")
+		}
+	}
+	expectType(t, token.SgCloseBkt, "')'")
+	ft.Location = ast.LocFromTokens(fTok, t)
+	t = p.Scan()
+	if t.Type == token.SgColon {
+		ft.Returns, t = p.ReturnTypes(p.Scan())
+		ft.HasReturns = true
+		if len(ft.Returns) > 0 {
+			ft.Location = ast.MergeLocations(ft, ft.Returns[len(ft.Returns)-1])
+		}
+	}
+	return ft, t
+}
+
+// namedType parses a type which may be preceded with a name, as in "x: number"
+// (the name is discarded).
+func (p *Parser) namedType(t *token.Token) (ast.TypeExp, *token.Token) {
+	startTok := t
+	typ, t := p.Type(t)
+	if _, ok := typ.(ast.NamedType); ok && startTok.Type == token.IDENT && t.Type == token.SgColon {
+		return p.Type(p.Scan())
+	}
+	return typ, t
+}
+
+// ReturnTypes parses the return types of a function, after the ":".  They are
+// either a single type or a list of types in brackets.
+func (p *Parser) ReturnTypes(t *token.Token) ([]ast.TypeExp, *token.Token) {
+	if t.Type != token.SgOpenBkt {
+		typ, t := p.Type(t)
+		return []ast.TypeExp{typ}, t
+	}
+	t = p.Scan()
+	types := []ast.TypeExp{}
+	for t.Type != token.SgCloseBkt {
+		var typ ast.TypeExp
+		typ, t = p.Type(t)
+		types = append(types, typ)
+		if t.Type != token.SgComma {
+			break
+		}
+		t = p.Scan()
+		if t.Type == token.SgCloseBkt {
+			tokenError(t, "type")
+		}
+	}
+	expectType(t, token.SgCloseBkt, "')'")
+	t = p.Scan()
+	if len(types) == 1 && (t.Type == token.SgQuestion || t.Type == token.SgPipe) {
+		// The brackets were around a single type, e.g. ": (A | B)?"
+		typ, t := p.typeTail(types[0], t)
+		return []ast.TypeExp{typ}, t
+	}
+	return types, t
+}
+
+// tableType parses a table type.  It assumes that opTok is the "{" token.
+func (p *Parser) tableType(opTok *token.Token) (ast.TableType, *token.Token) {
+	var tt ast.TableType
+	t := p.Scan()
+	for t.Type != token.SgCloseBrace {
+		startTok := t
+		if t.Type == token.SgOpenSquareBkt {
+			if tt.Key != nil {
+				tokenError(t, "'}'")
+			}
+			tt.Key, t = p.Type(p.Scan())
+			expectType(t, token.SgCloseSquareBkt, "']'")
+			t = p.Scan()
+			expectType(t, token.SgColon, "':'")
+			tt.Value, t = p.Type(p.Scan())
+		} else {
+			var typ ast.TypeExp
+			typ, t = p.Type(t)
+			if _, ok := typ.(ast.NamedType); ok && startTok.Type == token.IDENT && t.Type == token.SgColon {
+				field := ast.FieldType{Name: ast.NewName(startTok)}
+				field.Type, t = p.Type(p.Scan())
+				tt.Fields = append(tt.Fields, field)
+			} else {
+				if tt.Elem != nil {
+					tokenError(startTok, "'}'")
+				}
+				tt.Elem = typ
+			}
+		}
+		if t.Type != token.SgComma && t.Type != token.SgSemicolon {
+			break
+		}
+		t = p.Scan()
+	}
+	expectType(t, token.SgCloseBrace, "'}'")
+	tt.Location = ast.LocFromTokens(opTok, t)
+	return tt, p.Scan()
+}
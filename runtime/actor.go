@@ -0,0 +1,191 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrActorClosed is the error returned for jobs submitted to an Actor after it
+// was closed.
+var ErrActorClosed = errors.New("actor closed")
+
+// An Actor owns a Runtime and runs it on a dedicated goroutine.  A Runtime and
+// its threads must only be used from one goroutine at a time, so an Actor makes
+// it possible to share a runtime between many goroutines: they submit jobs to
+// the Actor, which runs them one after the other in the runtime's main thread.
+//
+// Each job runs in its own runtime context (see RuntimeContextDef), so it can
+// be given its own quotas.  Its results are sent on a channel as a JobResult.
+type Actor struct {
+	r      *Runtime
+	wake   chan struct{} // Signals the actor goroutine that jobs are queued
+	done   chan struct{} // Closed when the actor goroutine is finished
+	mux    sync.Mutex    // Protects the fields below
+	jobs   []actorJob    // Jobs waiting to be run, in order of submission
+	closed bool
+}
+
+// A Job is a function which runs in the main thread of an Actor's runtime.
+type Job func(t *Thread) ([]Value, error)
+
+// JobResult is the outcome of a job run by an Actor.  If the job panicked, Err
+// is an error describing the panic.
+//
+// Values which are not scalars (e.g. tables or userdata) belong to the runtime
+// so they must not be accessed outside of jobs.
+type JobResult struct {
+	Values []Value
+	Err    error
+
+	// Resources used by the job and the status of its runtime context (if
+	// quotas are not available, these are always zero).
+	UsedResources RuntimeResources
+	Status        RuntimeContextStatus
+}
+
+type actorJob struct {
+	def    RuntimeContextDef
+	job    Job
+	result chan<- JobResult
+}
+
+// NewActor starts an Actor which owns r.  From then on r must only be used via
+// jobs submitted to the Actor.
+func NewActor(r *Runtime) *Actor {
+	a := &Actor{
+		r:    r,
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	go a.loop()
+	return a
+}
+
+func (a *Actor) loop() {
+	defer close(a.done)
+	t := a.r.MainThread()
+	for {
+		a.mux.Lock()
+		if len(a.jobs) == 0 {
+			closed := a.closed
+			a.mux.Unlock()
+			if closed {
+				return
+			}
+			<-a.wake
+			continue
+		}
+		j := a.jobs[0]
+		a.jobs[0] = actorJob{}
+		a.jobs = a.jobs[1:]
+		a.mux.Unlock()
+		j.result <- a.run(t, j)
+	}
+}
+
+// run runs a job in t, turning a panic into an error so that the actor can go
+// on running the next jobs.
+func (a *Actor) run(t *Thread, j actorJob) (res JobResult) {
+	h := t.closeStack.size()
+	defer func() {
+		if r := recover(); r != nil {
+			t.closeStack.truncate(h)
+			res = JobResult{Err: fmt.Errorf("panic in actor job: %v", r), Status: StatusError}
+		}
+	}()
+	var values []Value
+	ctx, err := t.CallContext(j.def, func() (err error) {
+		values, err = j.job(t)
+		return
+	})
+	res = JobResult{Values: values, Err: err}
+	if ctx != nil {
+		res.UsedResources = ctx.UsedResources()
+		res.Status = ctx.Status()
+	}
+	return
+}
+
+// Do submits job to run with the runtime context defined by def.  It does not
+// wait for the job to run: the returned channel receives the result of the job
+// when it is done.  Do can be called from any goroutine, including from a job
+// of the same Actor (but waiting for the result in a job would deadlock).
+func (a *Actor) Do(def RuntimeContextDef, job Job) <-chan JobResult {
+	result := make(chan JobResult, 1)
+	a.mux.Lock()
+	if a.closed {
+		a.mux.Unlock()
+		result <- JobResult{Err: ErrActorClosed}
+		return result
+	}
+	a.jobs = append(a.jobs, actorJob{def: def, job: job, result: result})
+	a.mux.Unlock()
+	a.signal()
+	return result
+}
+
+// signal wakes up the actor goroutine if it is waiting for jobs.
+func (a *Actor) signal() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+		// The actor goroutine has already been signalled.
+	}
+}
+
+// Call submits a job calling the global function name with the given arguments.
+// Arguments are converted to Lua values with AsValue, so they may be Go values
+// or Values.
+func (a *Actor) Call(def RuntimeContextDef, name string, args ...interface{}) <-chan JobResult {
+	return a.Do(def, func(t *Thread) ([]Value, error) {
+		f := t.GlobalEnv().Get(StringValue(name))
+		if f.IsNil() {
+			return nil, errors.New("undefined global function " + name)
+		}
+		return callWithGoValues(t, f, args)
+	})
+}
+
+// Eval submits a job compiling and running a Lua chunk with the given
+// arguments (converted with AsValue).  The returned values are the values
+// returned by the chunk.
+func (a *Actor) Eval(def RuntimeContextDef, name string, source []byte, args ...interface{}) <-chan JobResult {
+	return a.Do(def, func(t *Thread) ([]Value, error) {
+		clos, err := t.CompileAndLoadLuaChunk(name, source, TableValue(t.GlobalEnv()))
+		if err != nil {
+			return nil, err
+		}
+		return callWithGoValues(t, FunctionValue(clos), args)
+	})
+}
+
+func callWithGoValues(t *Thread, f Value, args []interface{}) ([]Value, error) {
+	vals := make([]Value, len(args))
+	for i, arg := range args {
+		vals[i] = AsValue(arg)
+	}
+	term := NewTerminationWith(nil, 0, true)
+	if err := Call(t, f, vals, term); err != nil {
+		return nil, err
+	}
+	return term.Etc(), nil
+}
+
+// Close stops the Actor from accepting new jobs, waits for the jobs already
+// submitted to complete and then closes the runtime.  It returns an error if
+// closing the runtime caused one (e.g. an error in a finalizer).
+func (a *Actor) Close() (err error) {
+	a.mux.Lock()
+	if a.closed {
+		a.mux.Unlock()
+		<-a.done
+		return nil
+	}
+	a.closed = true
+	a.mux.Unlock()
+	a.signal()
+	<-a.done
+	a.r.Close(&err)
+	return
+}
@@ -0,0 +1,155 @@
+package runtime_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func TestActor(t *testing.T) {
+	r := rt.New(nil)
+	a := rt.NewActor(r)
+
+	// Define a global function
+	res := <-a.Eval(rt.RuntimeContextDef{}, "def", []byte(`
+local n = 0
+function count(k)
+	n = n + k
+	return n
+end
+return ...`), "hello", 42)
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if len(res.Values) != 2 || res.Values[0].AsString() != "hello" || res.Values[1].AsInt() != 42 {
+		t.Errorf("unexpected values: %v", res.Values)
+	}
+
+	// Call it from many goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := <-a.Call(rt.RuntimeContextDef{}, "count", 1)
+			if res.Err != nil {
+				t.Error(res.Err)
+			}
+		}()
+	}
+	wg.Wait()
+	res = <-a.Call(rt.RuntimeContextDef{}, "count", 0)
+	if res.Err != nil || len(res.Values) != 1 || res.Values[0].AsInt() != 100 {
+		t.Errorf("unexpected result: %+v", res)
+	}
+
+	// Errors are reported
+	res = <-a.Call(rt.RuntimeContextDef{}, "undefined")
+	if res.Err == nil {
+		t.Error("expected an error")
+	}
+	res = <-a.Eval(rt.RuntimeContextDef{}, "err", []byte(`error("boom")`))
+	if res.Err == nil || res.Status == rt.StatusDone {
+		t.Errorf("expected an error, got %+v", res)
+	}
+	wantErr := errors.New("custom")
+	res = <-a.Do(rt.RuntimeContextDef{}, func(*rt.Thread) ([]rt.Value, error) {
+		return nil, wantErr
+	})
+	if res.Err != wantErr {
+		t.Errorf("expected %v, got %v", wantErr, res.Err)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	res = <-a.Call(rt.RuntimeContextDef{}, "count", 1)
+	if res.Err != rt.ErrActorClosed {
+		t.Errorf("expected ErrActorClosed, got %v", res.Err)
+	}
+}
+
+func TestActorQuotas(t *testing.T) {
+	if !rt.QuotasAvailable {
+		t.Skip("quotas not available")
+	}
+	a := rt.NewActor(rt.New(nil))
+	defer a.Close()
+
+	def := rt.RuntimeContextDef{HardLimits: rt.RuntimeResources{Cpu: 10000}}
+	res := <-a.Eval(def, "loop", []byte(`while true do end`))
+	if res.Status != rt.StatusKilled {
+		t.Errorf("expected job to be killed, got %+v", res)
+	}
+	if res.UsedResources.Cpu == 0 {
+		t.Error("expected cpu to be used")
+	}
+
+	// The actor can still run jobs after one was killed.
+	res = <-a.Eval(def, "ok", []byte(`return 1 + 1`))
+	if res.Err != nil || res.Status != rt.StatusDone || res.Values[0].AsInt() != 2 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestActorDoDoesNotWait(t *testing.T) {
+	a := rt.NewActor(rt.New(nil))
+	defer a.Close()
+
+	// Block the actor with a job
+	unblock := make(chan struct{})
+	first := a.Do(rt.RuntimeContextDef{}, func(*rt.Thread) ([]rt.Value, error) {
+		<-unblock
+		return nil, nil
+	})
+
+	// Submitting more jobs does not wait for the actor to be idle
+	submitted := make(chan []<-chan rt.JobResult)
+	go func() {
+		var results []<-chan rt.JobResult
+		for i := 0; i < 10; i++ {
+			n := int64(i)
+			results = append(results, a.Do(rt.RuntimeContextDef{}, func(*rt.Thread) ([]rt.Value, error) {
+				return []rt.Value{rt.IntValue(n)}, nil
+			}))
+		}
+		submitted <- results
+	}()
+	var results []<-chan rt.JobResult
+	select {
+	case results = <-submitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Do blocked while the actor was busy")
+	}
+	close(unblock)
+	<-first
+
+	// Jobs are run in order
+	for i, result := range results {
+		res := <-result
+		if res.Err != nil || len(res.Values) != 1 || res.Values[0].AsInt() != int64(i) {
+			t.Errorf("unexpected result for job %d: %+v", i, res)
+		}
+	}
+}
+
+func TestActorJobPanics(t *testing.T) {
+	a := rt.NewActor(rt.New(nil))
+	defer a.Close()
+	res := <-a.Do(rt.RuntimeContextDef{}, func(*rt.Thread) ([]rt.Value, error) {
+		panic("oh no")
+	})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "oh no") {
+		t.Errorf("expected an error reporting the panic, got %+v", res)
+	}
+
+	// The actor can still run jobs after one panicked.
+	res = <-a.Eval(rt.RuntimeContextDef{}, "ok", []byte(`return 1 + 1`))
+	if res.Err != nil || res.Values[0].AsInt() != 2 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
@@ -57,3 +57,9 @@ func (c *Closure) GetUpvalue(n int) Value {
 func (c *Closure) SetUpvalue(n int, val Value) {
 	c.Upvalues[n].set(val)
 }
+
+// RebindUpvalue gives c a new upvalue at index n, set to val.  Contrary to
+// SetUpvalue, it does not affect other closures that share the upvalue.
+func (c *Closure) RebindUpvalue(n int, val Value) {
+	c.Upvalues[n] = newCell(val)
+}
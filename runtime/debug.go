@@ -1,13 +1,18 @@
 package runtime
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/arnodel/golua/code"
+)
 
 // DebugInfo contains info about a continuation that can be looked at for
 // debugging purposes (and tracebacks).
 type DebugInfo struct {
-	Source      string
-	Name        string
-	CurrentLine int32
+	Source         string
+	Name           string
+	CurrentLine    int32
+	CurrentColumns code.ColumnSpan // Columns of the current expression on CurrentLine, if known
 }
 
 // String formats the data contained in DebugInfo in a human-readable way.
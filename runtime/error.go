@@ -4,17 +4,35 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+
+	"github.com/arnodel/golua/code"
 )
 
 // Error is the error type that can be produced by running continuations.  Each
 // error has a message and a context, which is a slice of continuations.  There
 // is no call stack, but you can imagine you "unwind" the call stack by
 // iterating over this slice.
+//
+// When the error comes from a Go error (e.g. returned by a GoFunction), that
+// error is the cause of the Error, so errors.Is and errors.As can be used to
+// find it.  The frames of the call stack where the error was raised are
+// available from Frames.
+//
+// Lua code can raise structured errors by giving a table to the error function,
+// e.g.
+//
+//	error({code = "not_found", message = "no such user", id = 42})
+//
+// Code returns the code of such an error and its value can be decoded into a Go
+// struct (e.g. with the luacodec package).
 type Error struct {
 	message Value
 	handled bool
 	lineno  int
+	columns code.ColumnSpan
 	source  string
+	cause   error
+	frames  []DebugInfo
 }
 
 // NewError returns a new error with the given message and no context.
@@ -22,6 +40,12 @@ func NewError(message Value) *Error {
 	return &Error{message: message}
 }
 
+// NewErrorWithCause returns a new error with the given message and no context,
+// whose cause is err.
+func NewErrorWithCause(message Value, err error) *Error {
+	return &Error{message: message, cause: err}
+}
+
 func newHandledError(message Value) *Error {
 	return &Error{message: message, handled: true}
 }
@@ -42,7 +66,7 @@ func ToError(err error) *Error {
 	if ok {
 		return rtErr
 	}
-	return NewError(StringValue(err.Error()))
+	return NewErrorWithCause(StringValue(err.Error()), err)
 }
 
 // ErrorValue extracts a Value from err.  If err is an *Error then it returns
@@ -64,10 +88,16 @@ func (e *Error) AddContext(c Cont, depth int) *Error {
 	if e.lineno != 0 || e.handled {
 		return e
 	}
+	frames := e.frames
+	if frames == nil {
+		frames = stackFrames(c)
+	}
 	e = &Error{
 		lineno:  -1,
 		source:  "?",
 		message: e.message,
+		cause:   e.cause,
+		frames:  frames,
 	}
 	if depth == 0 {
 		return e
@@ -94,6 +124,7 @@ func (e *Error) AddContext(c Cont, depth int) *Error {
 	}
 	if info.CurrentLine != 0 {
 		e.lineno = int(info.CurrentLine)
+		e.columns = info.CurrentColumns
 	}
 	e.source = info.Source
 	s, ok := e.message.TryString()
@@ -117,12 +148,168 @@ func (e *Error) Handled() bool {
 	return e.handled
 }
 
+// Location returns the source, line and columns of the code where the error was
+// raised.  The line is 0 if it is unknown (e.g. the error has not been raised
+// yet or was raised from Go code).  The message value seen by Lua code only
+// contains the source and line, like in C Lua, but Error() also reports the
+// starting column when it is known.
+func (e *Error) Location() (source string, line int, cols code.ColumnSpan) {
+	if e.lineno <= 0 {
+		return e.source, 0, code.ColumnSpan{}
+	}
+	return e.source, e.lineno, e.columns
+}
+
+// Unwrap returns the Go error which caused e, if any.
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Frames returns the call stack at the point where the error was raised,
+// innermost call first.  It is nil if the error has not been raised yet.
+func (e *Error) Frames() []DebugInfo {
+	return e.frames
+}
+
+// Code returns the value of the "code" field of the error value if it is a
+// table, converted to a string.  Otherwise it returns the empty string.
+func (e *Error) Code() string {
+	s, ok := e.field(codeKey).ToString()
+	if !ok {
+		return ""
+	}
+	return s
+}
+
 // Error implements the error interface.
 func (e *Error) Error() string {
-	s, _ := e.message.ToString()
+	s, ok := e.field(messageKey).ToString()
+	if !ok {
+		s, _ = e.message.ToString()
+		if e.lineno > 0 && e.columns.Start > 0 {
+			pfx := fmt.Sprintf("%s:%d: ", e.source, e.lineno)
+			if strings.HasPrefix(s, pfx) {
+				s = e.position() + s[len(pfx):]
+			}
+		}
+	} else if e.lineno > 0 {
+		s = e.position() + s
+	}
+	if code := e.Code(); code != "" {
+		return fmt.Sprintf("error: %s (%s)", s, code)
+	}
 	return fmt.Sprintf("error: %s", s)
 }
 
+var (
+	codeKey    = StringValue("code")
+	messageKey = StringValue("message")
+)
+
+// position returns the "source:line[:col]: " prefix reported by Error().
+func (e *Error) position() string {
+	if e.columns.Start > 0 {
+		return fmt.Sprintf("%s:%d:%d: ", e.source, e.lineno, e.columns.Start)
+	}
+	return fmt.Sprintf("%s:%d: ", e.source, e.lineno)
+}
+
+func (e *Error) field(key Value) Value {
+	tbl, ok := e.message.TryTable()
+	if !ok {
+		return NilValue
+	}
+	return tbl.Get(key)
+}
+
+// Maximum number of frames recorded in an error.
+const maxErrorFrames = 100
+
+func stackFrames(c Cont) []DebugInfo {
+	frames := []DebugInfo{}
+	for ; c != nil && len(frames) < maxErrorFrames; c = c.Parent() {
+		if info := c.DebugInfo(); info != nil {
+			frames = append(frames, *info)
+		}
+	}
+	return frames
+}
+
+// Maximum number of errors remembered by CatchError.
+const maxCaughtErrors = 8
+
+// A caughtError is an error remembered by CatchError so that RaiseError can
+// give its cause and frames to an error raised again with the same value.
+type caughtError struct {
+	id  interface{} // Identity of the error value, see errorValueID
+	err *Error
+}
+
+// errorValueID returns a key identifying the value v itself (not values equal
+// to it) and true, or false if v cannot be identified this way.  Only tables
+// and userdata are identified (by their address).  Strings are not, as equal
+// strings may share their bytes (e.g. Lua string constants), so a new error
+// could not be told apart from a caught one.
+func errorValueID(v Value) (interface{}, bool) {
+	switch x := v.iface.(type) {
+	case *Table, *UserData:
+		return x, true
+	default:
+		return nil, false
+	}
+}
+
+// CatchError returns the Lua value of err, like ErrorValue does.  It should be
+// used by functions which turn errors into Lua values, like pcall.  If the value
+// is a table or userdata and Lua code raises that same value again (see
+// RaiseError) before the current call from Go into the runtime returns, the new
+// error keeps the cause and frames of err.
+func (r *Runtime) CatchError(err error) Value {
+	rtErr := ToError(err)
+	if rtErr == nil {
+		return NilValue
+	}
+	if rtErr.cause == nil && rtErr.frames == nil {
+		return rtErr.message
+	}
+	id, ok := errorValueID(rtErr.message)
+	if !ok {
+		return rtErr.message
+	}
+	if len(r.caughtErrors) == maxCaughtErrors {
+		copy(r.caughtErrors, r.caughtErrors[1:])
+		r.caughtErrors[maxCaughtErrors-1] = caughtError{}
+		r.caughtErrors = r.caughtErrors[:maxCaughtErrors-1]
+	}
+	r.caughtErrors = append(r.caughtErrors, caughtError{id: id, err: rtErr})
+	return rtErr.message
+}
+
+// RaiseError returns a new error with the given message, like NewError.  If the
+// message is the table or userdata value of an error caught with CatchError,
+// the new error has the same cause and frames, so
+// re-raising an error caught with pcall preserves them.
+func (r *Runtime) RaiseError(message Value) *Error {
+	if id, ok := errorValueID(message); ok {
+		for i := len(r.caughtErrors) - 1; i >= 0; i-- {
+			caught := r.caughtErrors[i]
+			if caught.id == id {
+				return &Error{message: message, cause: caught.err.cause, frames: caught.err.frames}
+			}
+		}
+	}
+	return NewError(message)
+}
+
+// forgetCaughtErrors is called when a call from Go into the runtime returns, so
+// that caught errors are not kept alive any longer.
+func (r *Runtime) forgetCaughtErrors() {
+	for i := range r.caughtErrors {
+		r.caughtErrors[i] = caughtError{}
+	}
+	r.caughtErrors = r.caughtErrors[:0]
+}
+
 // Traceback produces a traceback string of the continuation, requiring memory
 // for the string.
 func (r *Runtime) Traceback(pfx string, c Cont) string {
@@ -0,0 +1,124 @@
+package runtime_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+func TestErrorCauseAndFrames(t *testing.T) {
+	r, _, f := evalLua(t, `
+local function inner(fail, ...)
+	local res = fail(...)
+	return res
+end
+local function outer(mode, fail)
+	if mode == "direct" then
+		inner(fail)
+	elseif mode == "reraise" then
+		-- The caught table value is raised again
+		local ok, err = pcall(inner, fail, true)
+		error(err, 0)
+	elseif mode == "reraise string" then
+		-- Equal strings cannot be told apart, so this is a new error
+		local ok, err = pcall(inner, fail)
+		error(err, 0)
+	elseif mode == "structured" then
+		error({code = "not_found", message = "no such user", id = 42})
+	end
+end
+return outer`)
+	fail := rt.FunctionValue(rt.NewGoFunction(func(t *rt.Thread, c *rt.GoCont) (rt.Cont, error) {
+		err := &fs.PathError{Op: "open", Path: "users.db", Err: fs.ErrNotExist}
+		if c.NArgs() > 0 && rt.Truth(c.Arg(0)) {
+			// Fail with a table value
+			msg := rt.NewTable()
+			msg.Set(rt.StringValue("message"), rt.StringValue(err.Error()))
+			return nil, rt.NewErrorWithCause(rt.TableValue(msg), err)
+		}
+		return nil, err
+	}, "fail", 1, false))
+	call := func(mode string) *rt.Error {
+		t.Helper()
+		err := rt.Call(r.MainThread(), f, []rt.Value{rt.StringValue(mode), fail}, rt.NewTerminationWith(nil, 0, false))
+		rtErr, ok := rt.AsError(err)
+		if !ok {
+			t.Fatalf("%s: expected *rt.Error, got %v", mode, err)
+		}
+		return rtErr
+	}
+
+	for _, mode := range []string{"direct", "reraise"} {
+		err := call(mode)
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: expected cause to be fs.ErrNotExist, got %v", mode, errors.Unwrap(err))
+		}
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) || pathErr.Path != "users.db" {
+			t.Errorf("%s: expected a *fs.PathError cause", mode)
+		}
+		var trace []string
+		for _, frame := range err.Frames() {
+			trace = append(trace, frame.Name)
+		}
+		want := "fail inner outer"
+		if mode == "reraise" {
+			want = "fail inner pcall outer"
+		}
+		if got := strings.Join(trace, " "); got != want {
+			t.Errorf("%s: unexpected frames %q", mode, got)
+		}
+		if frames := err.Frames(); len(frames) < 2 || frames[1].Source != "test" || frames[1].CurrentLine != 3 {
+			t.Errorf("%s: unexpected frames %+v", mode, frames)
+		}
+	}
+
+	err := call("reraise string")
+	if errors.Unwrap(err) != nil {
+		t.Errorf("reraise string: unexpected cause %v", errors.Unwrap(err))
+	}
+	if frames := err.Frames(); len(frames) == 0 || frames[0].Name != "outer" {
+		t.Errorf("reraise string: unexpected frames %+v", frames)
+	}
+
+	err = call("structured")
+	if err.Code() != "not_found" {
+		t.Errorf("unexpected code %q", err.Code())
+	}
+	if err.Error() != "error: test:18:3: no such user (not_found)" {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+	if id := err.Value().AsTable().Get(rt.StringValue("id")); id != rt.IntValue(42) {
+		t.Errorf("unexpected id %v", id)
+	}
+	if errors.Unwrap(err) != nil {
+		t.Errorf("unexpected cause %v", errors.Unwrap(err))
+	}
+}
+
+// A new error with the same message as a caught one (here a string constant)
+// is not taken for the caught error raised again.
+func TestNewErrorWithCaughtMessage(t *testing.T) {
+	r, _, f := evalLua(t, `
+local function f() error("boom", 0) end
+local function g() error("boom", 0) end
+return function()
+	print(pcall(f))
+	g()
+end`)
+	err := rt.Call(r.MainThread(), f, nil, rt.NewTerminationWith(nil, 0, false))
+	rtErr, ok := rt.AsError(err)
+	if !ok {
+		t.Fatalf("expected *rt.Error, got %v", err)
+	}
+	var trace []string
+	for _, frame := range rtErr.Frames() {
+		trace = append(trace, frame.Name)
+	}
+	if got := strings.Join(trace, " "); !strings.HasPrefix(got, "g ") {
+		t.Errorf("unexpected frames %q", got)
+	}
+}
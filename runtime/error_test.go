@@ -46,6 +46,7 @@ func TestAsError(t *testing.T) {
 }
 
 func TestToError(t *testing.T) {
+	errHello, errHi := errors.New("hello"), errors.New("hi")
 	tests := []struct {
 		name string
 		arg  error
@@ -63,13 +64,13 @@ func TestToError(t *testing.T) {
 		},
 		{
 			name: "non nil *Error",
-			arg:  errors.New("hello"),
-			want: NewError(StringValue("hello")),
+			arg:  errHello,
+			want: NewErrorWithCause(StringValue("hello"), errHello),
 		},
 		{
 			name: "string error",
-			arg:  errors.New("hi"),
-			want: NewError(StringValue("hi")),
+			arg:  errHi,
+			want: NewErrorWithCause(StringValue("hi"), errHi),
 		},
 		// TODO: Add test cases.
 	}
@@ -81,3 +82,32 @@ func TestToError(t *testing.T) {
 		})
 	}
 }
+
+func TestError_Error(t *testing.T) {
+	if got := NewError(StringValue("hello")).Error(); got != "error: hello" {
+		t.Errorf("got %q", got)
+	}
+	tbl := NewTable()
+	tbl.Set(StringValue("message"), StringValue("hello"))
+	tbl.Set(StringValue("code"), StringValue("E1"))
+	if got := NewError(TableValue(tbl)).Error(); got != "error: hello (E1)" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCaughtErrorsForgotten(t *testing.T) {
+	r := New(nil)
+	fail := FunctionValue(NewGoFunction(func(t *Thread, c *GoCont) (Cont, error) {
+		return nil, errors.New("failed")
+	}, "fail", 0, false))
+	pcall := FunctionValue(NewGoFunction(func(t *Thread, c *GoCont) (Cont, error) {
+		err := Call(t, c.Arg(0), nil, NewTerminationWith(nil, 0, false))
+		return c.PushingNext1(t.Runtime, t.CatchError(err)), nil
+	}, "pcall", 1, false))
+	if err := Call(r.MainThread(), pcall, []Value{fail}, NewTerminationWith(nil, 0, false)); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.caughtErrors) != 0 {
+		t.Errorf("caught errors still remembered: %v", r.caughtErrors)
+	}
+}
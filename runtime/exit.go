@@ -0,0 +1,60 @@
+package runtime
+
+import "fmt"
+
+// An ExitError is the error returned to the Go code that called into a Runtime
+// when the Lua code requested to exit (e.g. with os.exit).  The Lua stack is
+// unwound without giving Lua code a chance to intercept the exit (pcall does
+// not catch it).
+type ExitError struct {
+	Code  int  // The exit code requested
+	Close bool // True if closing the runtime was requested (see Runtime.Exit)
+
+	// CloseErr is the error raised when closing pending to-be-closed variables
+	// or the runtime, if any.  It is always nil if Close is false.
+	CloseErr error
+}
+
+var _ error = (*ExitError)(nil)
+
+// Error implements the error interface.
+func (e *ExitError) Error() string {
+	if e.CloseErr != nil {
+		return fmt.Sprintf("exit with code %d (error when closing: %s)", e.Code, e.CloseErr)
+	}
+	return fmt.Sprintf("exit with code %d", e.Code)
+}
+
+// Unwrap returns the error raised when closing the runtime, if any.
+func (e *ExitError) Unwrap() error {
+	return e.CloseErr
+}
+
+// Exit unwinds the Lua stack up to the outermost call made from Go into the
+// runtime, which then returns an *ExitError with the given code.  Coroutines
+// being resumed are unwound too.  If close is true, pending to-be-closed
+// variables are closed and then the runtime is closed with Runtime.Close (which
+// pops all runtime contexts and runs pending finalizers); errors raised while
+// doing so are reported in the CloseErr field of the *ExitError.  Otherwise
+// pending to-be-closed variables are discarded and the runtime is left open.
+//
+// If an exit function was configured with WithExitFunc, it is called first.
+func (r *Runtime) Exit(code int, close bool) {
+	if r.exitFunc != nil {
+		r.exitFunc(code)
+	}
+	panic(&ExitError{Code: code, Close: close})
+}
+
+// This is called when a call from Go into the thread t panics with an
+// *ExitError.  h is the height of the close stack when the call started.
+func (t *Thread) exit(exitErr *ExitError, h int) error {
+	if !exitErr.Close {
+		t.closeStack.truncate(h)
+		return exitErr
+	}
+	err := t.cleanupCloseStack(nil, h, nil)
+	t.Runtime.Close(&err)
+	exitErr.CloseErr = err
+	return exitErr
+}
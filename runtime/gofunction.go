@@ -39,6 +39,11 @@ func (f *GoFunction) SolemnlyDeclareCompliance(flags ComplianceFlags) {
 	f.safetyFlags |= flags
 }
 
+// ComplianceFlags returns the compliance flags declared for f.
+func (f *GoFunction) ComplianceFlags() ComplianceFlags {
+	return f.safetyFlags
+}
+
 // SolemnlyDeclareCompliance is a convenience function that adds the same set of
 // compliance flags to a number of functions.  See quotas.md for details about
 // compliance flags.
@@ -1,6 +1,7 @@
 package runtime
 
 import (
+	"math"
 	"math/bits"
 	"unsafe"
 )
@@ -23,6 +24,32 @@ type mixedTable struct {
 	*array
 }
 
+// Return a table with an array part of size nseq and a hash table part big
+// enough to hold nrec items.
+func newMixedTable(nseq, nrec int) *mixedTable {
+	t := &mixedTable{}
+	if nseq > 0 {
+		t.array = t.array.grow(uintptr(nseq))
+	}
+	if nrec > 0 {
+		t.hashTable = newHashTable(uint8(bits.Len(uint(nrec - 1))))
+	}
+	return t
+}
+
+// mixedTableMem returns the amount of memory allocated by newMixedTable(nseq,
+// nrec) for the array and hash table parts.
+func mixedTableMem(nseq, nrec int) uint64 {
+	var mem uint64
+	if nseq > 0 {
+		mem += uint64(nseq) * uint64(unsafe.Sizeof(Value{}))
+	}
+	if nrec > 0 {
+		mem += uint64(1) << bits.Len(uint(nrec-1)) * uint64(unsafe.Sizeof(hashTableSlot{}))
+	}
+	return mem
+}
+
 // Return v such that k => v, else return nil.
 func (t *mixedTable) get(k Value) Value {
 	i, ok := ToIntNoString(k)
@@ -297,6 +324,31 @@ func (t *hashTable) find(k Value) Value {
 	return it.value
 }
 
+// Return the value in slot i and true if slot i contains the key k.
+func (t *hashTable) slotValue(i uintptr, k Value) (Value, bool) {
+	if t == nil || i >= uintptr(len(t.slots)) {
+		return NilValue, false
+	}
+	it := &t.slots[i]
+	if !it.key.Equals(k) {
+		return NilValue, false
+	}
+	return it.value, true
+}
+
+// Return the index of the slot containing k and true if there is v such that
+// k => v.
+func (t *hashTable) slotIndex(k Value) (uint32, bool) {
+	if t == nil {
+		return 0, false
+	}
+	it, i := findSlot(t.slots, (1<<t.base)-1, k)
+	if it == nil || it.value.IsNil() || i > math.MaxUint32 {
+		return 0, false
+	}
+	return uint32(i), true
+}
+
 func (t *hashTable) removeKey(k Value) (wasSet bool) {
 	if t == nil {
 		return false
@@ -308,6 +360,16 @@ func (t *hashTable) full() bool {
 	return t == nil || t.nextFree == noNextFree
 }
 
+// Return an empty hash table with 2^base slots.
+func newHashTable(base uint8) *hashTable {
+	var sz uintptr = 1 << base
+	return &hashTable{
+		slots:    make([]hashTableSlot, sz),
+		nextFree: sz - 1,
+		base:     base,
+	}
+}
+
 func (t *hashTable) grow() *hashTable {
 	if t == nil {
 		return &hashTable{
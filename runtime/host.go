@@ -0,0 +1,86 @@
+package runtime
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// This file contains the methods giving access to the host environment of the
+// runtime.  Libraries should use them rather than the corresponding process
+// globals so that several isolated runtimes can coexist in the same process.
+// They can be configured with RuntimeOption values when calling New.  See also
+// Runtime.Exit in exit.go.
+
+// Stdin returns the standard input of the runtime.
+func (r *Runtime) Stdin() io.Reader {
+	return r.stdin
+}
+
+// Stderr returns the standard error of the runtime.
+func (r *Runtime) Stderr() io.Writer {
+	return r.stderr
+}
+
+// BufferedStdFiles returns true if the standard input and output of the process
+// should be buffered when the runtime uses them (see WithBufferedStdFiles).
+func (r *Runtime) BufferedStdFiles() bool {
+	return r.bufferedStdFiles
+}
+
+// LookupEnv returns the value of the environment variable with the given name
+// and true if it is set in the runtime's environment, else "" and false.
+func (r *Runtime) LookupEnv(name string) (string, bool) {
+	if r.env == nil {
+		return os.LookupEnv(name)
+	}
+	val, ok := r.env[name]
+	return val, ok
+}
+
+// Environ returns the runtime's environment as a list of "key=value" strings,
+// suitable for passing to a command it runs.
+func (r *Runtime) Environ() []string {
+	if r.env == nil {
+		return os.Environ()
+	}
+	env := make([]string, 0, len(r.env))
+	for k, v := range r.env {
+		env = append(env, k+"="+v)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// WorkingDir returns the working directory of the runtime, or "" if it is the
+// process working directory.
+func (r *Runtime) WorkingDir() string {
+	return r.workingDir
+}
+
+// ResolvePath returns the file name that name refers to for the runtime, i.e.
+// name itself if it is absolute, else name interpreted relative to the
+// runtime's working directory.
+func (r *Runtime) ResolvePath(name string) string {
+	if r.workingDir == "" || filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(r.workingDir, name)
+}
+
+func envMap(env []string) map[string]string {
+	if env == nil {
+		return nil
+	}
+	m := make(map[string]string, len(env))
+	for _, kv := range env {
+		k, v := kv, ""
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			k, v = kv[:i], kv[i+1:]
+		}
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,62 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRuntime_Env(t *testing.T) {
+	r := New(nil, WithEnv([]string{"B=2", "A=1", "EMPTY=", "NOVALUE"}))
+	for _, tt := range []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"A", "1", true},
+		{"B", "2", true},
+		{"EMPTY", "", true},
+		{"NOVALUE", "", true},
+		{"PATH", "", false},
+	} {
+		val, ok := r.LookupEnv(tt.name)
+		if val != tt.value || ok != tt.ok {
+			t.Errorf("LookupEnv(%q) = %q, %t, want %q, %t", tt.name, val, ok, tt.value, tt.ok)
+		}
+	}
+	want := []string{"A=1", "B=2", "EMPTY=", "NOVALUE="}
+	if got := r.Environ(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Environ() = %q, want %q", got, want)
+	}
+	if got := New(nil, WithEnv(nil)).Environ(); len(got) != 0 {
+		t.Errorf("expected empty environment, got %q", got)
+	}
+	if got, want := New(nil).Environ(), os.Environ(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected process environment, got %q", got)
+	}
+}
+
+func TestRuntime_ResolvePath(t *testing.T) {
+	abs, _ := filepath.Abs("foo")
+	r := New(nil)
+	if got := r.ResolvePath("foo"); got != "foo" {
+		t.Errorf("ResolvePath(%q) = %q without working dir", "foo", got)
+	}
+	r = New(nil, WithWorkingDir("/some/dir"))
+	if got, want := r.ResolvePath("foo/bar"), filepath.Join("/some/dir", "foo/bar"); got != want {
+		t.Errorf("ResolvePath(%q) = %q, want %q", "foo/bar", got, want)
+	}
+	if got := r.ResolvePath(abs); got != abs {
+		t.Errorf("ResolvePath(%q) = %q", abs, got)
+	}
+}
+
+func TestRuntime_BufferedStdFiles(t *testing.T) {
+	if !New(nil).BufferedStdFiles() {
+		t.Error("std files should be buffered by default")
+	}
+	if New(nil, WithBufferedStdFiles(false)).BufferedStdFiles() {
+		t.Error("std files should not be buffered")
+	}
+}
@@ -0,0 +1,142 @@
+package runtime
+
+import "unsafe"
+
+// An indexCache is an inline cache for a table lookup / setting opcode
+// (Type2).  It remembers in which slot of the hash table the key was found the
+// last time the opcode was executed, so that if the opcode is executed again
+// with the same key and a table with the same layout, the value can be
+// accessed directly.  For lookups it can also remember that the key was found
+// in the table which is the "__index" metafield of the metatable, which makes
+// method calls such as obj:method() cheaper.
+//
+// Nothing in the cache is trusted: a slot is only used if it currently contains
+// the key, and metatables are always read from the value being indexed.  So the
+// cache never needs to be invalidated.  E.g. when a table is rehashed or its
+// metatable changes, the checks fail and the generic path is taken, which
+// updates the cache.
+type indexCache struct {
+	slot     uint32 // 1 + index of the slot containing the key (0 if empty)
+	metaSlot uint32 // 1 + index of the slot containing "__index" in the metatable (0 if not via __index)
+}
+
+var metaIndexKey = StringValue("__index")
+
+// getIndexCaches returns the inline caches for the opcodes in c, allocating
+// them on first use.
+func (c *Code) getIndexCaches(r *Runtime) []indexCache {
+	if c.indexCaches == nil {
+		r.RequireArrSize(unsafe.Sizeof(indexCache{}), len(c.code))
+		c.indexCaches = make([]indexCache, len(c.code))
+	}
+	return c.indexCaches
+}
+
+// cachedIndex is equivalent to Index(t, coll, k), but uses and updates the
+// inline cache ic.  It consumes the same amount of CPU as Index.
+func cachedIndex(t *Thread, ic *indexCache, coll, k Value) (Value, error) {
+	if ic.slot != 0 {
+		if ic.metaSlot == 0 {
+			if tbl, ok := coll.TryTable(); ok {
+				if v, ok := tbl.slotValue(ic.slot-1, k); ok && !v.IsNil() {
+					t.RequireCPU(1)
+					return v, nil
+				}
+			}
+		} else if v, ok := ic.getViaIndexMeta(t, coll, k); ok {
+			return v, nil
+		}
+	}
+	v, err := Index(t, coll, k)
+	if err == nil && !v.IsNil() {
+		ic.update(t.Runtime, coll, k)
+	}
+	return v, err
+}
+
+// getViaIndexMeta performs the lookup when the key was last found in the
+// "__index" metafield of the metatable.  It returns false if that is no longer
+// the case, without consuming CPU.
+func (ic *indexCache) getViaIndexMeta(t *Thread, coll, k Value) (Value, bool) {
+	tbl, isTable := coll.TryTable()
+	var meta *Table
+	if isTable {
+		meta = tbl.meta
+	} else {
+		meta = t.RawMetatable(coll)
+	}
+	metaIdx, ok := meta.slotValue(ic.metaSlot-1, metaIndexKey)
+	if !ok {
+		return NilValue, false
+	}
+	idxTbl, ok := metaIdx.TryTable()
+	if !ok {
+		return NilValue, false
+	}
+	v, ok := idxTbl.slotValue(ic.slot-1, k)
+	if !ok || v.IsNil() {
+		return NilValue, false
+	}
+	if isTable {
+		// The key must not be in the table itself
+		t.RequireCPU(1)
+		if v := tbl.Get(k); !v.IsNil() {
+			return v, true
+		}
+	} else {
+		t.RequireCPU(1)
+	}
+	t.RequireCPU(1)
+	return v, true
+}
+
+// cachedSetIndex is equivalent to SetIndex(t, coll, k, v), but uses and
+// updates the inline cache ic.  It consumes the same amount of CPU as
+// SetIndex.
+func cachedSetIndex(t *Thread, ic *indexCache, coll, k, v Value) error {
+	if ic.slot != 0 && ic.metaSlot == 0 {
+		if tbl, ok := coll.TryTable(); ok {
+			if old, ok := tbl.slotValue(ic.slot-1, k); ok && !old.IsNil() {
+				t.RequireCPU(1)
+				tbl.setSlotValue(ic.slot-1, v)
+				return nil
+			}
+		}
+	}
+	err := SetIndex(t, coll, k, v)
+	if err == nil && !v.IsNil() {
+		ic.update(t.Runtime, coll, k)
+	}
+	return err
+}
+
+// update records in the cache where the value for k was found in coll.  Only
+// string keys are cached as other keys may be stored in the array part of
+// tables.
+func (ic *indexCache) update(r *Runtime, coll, k Value) {
+	*ic = indexCache{}
+	if _, ok := k.TryString(); !ok {
+		return
+	}
+	tbl, isTable := coll.TryTable()
+	if isTable {
+		if i, ok := tbl.slotIndex(k); ok {
+			ic.slot = i + 1
+			return
+		}
+	}
+	meta := r.RawMetatable(coll)
+	mi, ok := meta.slotIndex(metaIndexKey)
+	if !ok {
+		return
+	}
+	metaIdx, _ := meta.slotValue(mi, metaIndexKey)
+	idxTbl, ok := metaIdx.TryTable()
+	if !ok {
+		return
+	}
+	if i, ok := idxTbl.slotIndex(k); ok {
+		ic.slot = i + 1
+		ic.metaSlot = mi + 1
+	}
+}
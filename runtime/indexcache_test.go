@@ -0,0 +1,52 @@
+package runtime_test
+
+import "testing"
+
+// Lookups of string keys in tables, which use inline caches.
+var indexBenchmarks = []luaBenchmark{
+	{
+		name: "fields",
+		source: `
+local p = {x = 1, y = 2, z = 3, a = 4, b = 5, c = 6, d = 7, e = 8, f = 9, g = 10}
+return function()
+	local s = 0
+	for i = 1, 10000 do
+		s = s + p.x + p.y + p.z
+		p.x = p.y
+	end
+	return s
+end`,
+	},
+	{
+		name: "methods",
+		source: `
+local Point = {}
+Point.__index = Point
+for i = 1, 20 do Point["m" .. i] = function() end end
+function Point:getX() return self.x end
+function Point:move(dx) self.x = self.x + dx end
+local p = setmetatable({x = 0, y = 0}, Point)
+return function()
+	for i = 1, 10000 do
+		p:move(1)
+		p:getX()
+	end
+	return p.x
+end`,
+	},
+	{
+		name: "globals",
+		source: `
+return function()
+	local s = 0
+	for i = 1, 10000 do
+		s = s + math.abs(-i) + string.len("abc")
+	end
+	return s
+end`,
+	},
+}
+
+func BenchmarkIndex(b *testing.B) {
+	runLuaBenchmarks(b, indexBenchmarks)
+}
@@ -0,0 +1,279 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+)
+
+// A CoroutineIterator iterates over the values yielded by a coroutine, so that
+// Go code can consume Lua generators.  Use it as follows.
+//
+//	it := NewCoroutineIterator(t, co, args)
+//	defer it.Close()
+//	for it.Next() {
+//		values := it.Values()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+//
+// Breaking out of the loop early is fine: Close closes the coroutine if it is
+// not dead (running its pending to-be-closed variables).
+type CoroutineIterator struct {
+	t        *Thread
+	co       *Thread
+	args     []Value
+	values   []Value
+	returned []Value
+	err      error
+	done     bool
+}
+
+// NewCoroutineIterator returns an iterator over the values yielded by the
+// suspended coroutine co, resumed from thread t.  The first time co is
+// resumed, it receives args.
+func NewCoroutineIterator(t *Thread, co *Thread, args []Value) *CoroutineIterator {
+	return &CoroutineIterator{t: t, co: co, args: args}
+}
+
+// NewFunctionIterator starts a new coroutine running f and returns an iterator
+// over the values it yields.  The first time the coroutine is resumed, f is
+// called with args.
+func NewFunctionIterator(t *Thread, f Callable, args []Value) *CoroutineIterator {
+	co := NewThread(t.Runtime)
+	co.Start(f)
+	return NewCoroutineIterator(t, co, args)
+}
+
+// Next resumes the coroutine.  It returns true if the coroutine yielded, in
+// which case the yielded values are available from Values.  It returns false if
+// the coroutine finished or failed (see Returned and Err).
+func (it *CoroutineIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	args := it.args
+	it.args = nil
+	values, err := it.co.Resume(it.t, args)
+	switch {
+	case err != nil:
+		it.err = err
+	case it.co.Status() == ThreadDead:
+		it.returned = values
+	default:
+		it.values = values
+		return true
+	}
+	it.done = true
+	it.values = nil
+	return false
+}
+
+// Values returns the values yielded by the coroutine in the last successful
+// call to Next.
+func (it *CoroutineIterator) Values() []Value {
+	return it.values
+}
+
+// Returned returns the values returned by the coroutine when it finished.
+func (it *CoroutineIterator) Returned() []Value {
+	return it.returned
+}
+
+// Err returns the error raised by the coroutine, if any.
+func (it *CoroutineIterator) Err() error {
+	return it.err
+}
+
+// Close ends the iteration.  If the coroutine is suspended, it is closed and
+// the error returned is the error that happened closing it, if any.  Close can
+// be called several times.
+func (it *CoroutineIterator) Close() error {
+	if it.done {
+		return nil
+	}
+	it.done = true
+	it.values = nil
+	_, err := it.co.Close(it.t)
+	return err
+}
+
+// A TableIterator iterates over the key-value pairs of a Lua value, like the
+// pairs or ipairs functions of the Lua standard library.  Use it as follows.
+//
+//	it := Pairs(t, v)
+//	defer it.Close()
+//	for it.Next() {
+//		k, v := it.Key(), it.Value()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type TableIterator struct {
+	t       *Thread
+	next    func() (Value, Value, error)
+	closing Value // To-be-closed value returned by __pairs
+	key     Value
+	value   Value
+	err     error
+	done    bool
+}
+
+// Pairs returns an iterator with the semantics of the Lua code
+//
+//	for k, v in pairs(coll) do ... end
+//
+// So if coll has a __pairs metamethod, the iteration is driven by the values
+// it returns.  Otherwise coll must be a table and its contents are iterated
+// over without using metamethods.
+func Pairs(t *Thread, coll Value) *TableIterator {
+	it := &TableIterator{t: t}
+	res := NewTerminationWith(t.CurrentCont(), 4, false)
+	err, ok := Metacall(t, coll, "__pairs", []Value{coll}, res)
+	switch {
+	case ok && err != nil:
+		it.fail(err)
+	case ok:
+		f, state, control := res.Get(0), res.Get(1), res.Get(2)
+		it.closing = res.Get(3)
+		it.next = func() (Value, Value, error) {
+			kv := NewTerminationWith(t.CurrentCont(), 2, false)
+			if err := Call(t, f, []Value{state, control}, kv); err != nil {
+				return NilValue, NilValue, err
+			}
+			control = kv.Get(0)
+			return control, kv.Get(1), nil
+		}
+	default:
+		tbl, ok := coll.TryTable()
+		if !ok {
+			it.fail(fmt.Errorf("table expected, got %s", coll.CustomTypeName()))
+			break
+		}
+		var k Value
+		it.next = func() (Value, Value, error) {
+			t.RequireCPU(1)
+			nk, nv, ok := tbl.Next(k)
+			if !ok {
+				return NilValue, NilValue, errors.New("invalid key for 'next'")
+			}
+			k = nk
+			return nk, nv, nil
+		}
+	}
+	return it
+}
+
+// IPairs returns an iterator with the semantics of the Lua code
+//
+//	for i, v in ipairs(coll) do ... end
+//
+// So values are read with the __index metamethod if needed and the iteration
+// stops at the first nil value.
+func IPairs(t *Thread, coll Value) *TableIterator {
+	var i int64
+	return &TableIterator{
+		t: t,
+		next: func() (Value, Value, error) {
+			i++
+			v, err := Index(t, coll, IntValue(i))
+			if err != nil || v.IsNil() {
+				return NilValue, NilValue, err
+			}
+			return IntValue(i), v, nil
+		},
+	}
+}
+
+// Sequence returns an iterator over the indices 1 to #coll of coll, so it
+// honours the __len metamethod (as well as __index to read values).  Contrary
+// to IPairs, nil values are iterated over.
+func Sequence(t *Thread, coll Value) *TableIterator {
+	var i int64
+	it := &TableIterator{t: t}
+	n, err := IntLen(t, coll)
+	if err != nil {
+		it.fail(err)
+		return it
+	}
+	it.next = func() (Value, Value, error) {
+		if i >= n {
+			return NilValue, NilValue, nil
+		}
+		i++
+		v, err := Index(t, coll, IntValue(i))
+		if err != nil {
+			return NilValue, NilValue, err
+		}
+		return IntValue(i), v, nil
+	}
+	return it
+}
+
+// Next advances the iterator.  It returns true if there is a new key-value
+// pair, available from Key and Value.  It returns false at the end of the
+// iteration or if there was an error (see Err).  When it returns false, the
+// iterator is closed.
+func (it *TableIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	k, v, err := it.next()
+	if err != nil {
+		it.fail(err)
+		return false
+	}
+	if k.IsNil() {
+		it.fail(it.Close())
+		return false
+	}
+	it.key, it.value = k, v
+	return true
+}
+
+// Key returns the current key.
+func (it *TableIterator) Key() Value {
+	return it.key
+}
+
+// Value returns the current value.
+func (it *TableIterator) Value() Value {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *TableIterator) Err() error {
+	return it.err
+}
+
+// Close ends the iteration.  If a __pairs metamethod returned a to-be-closed
+// value, its __close metamethod is called.  Close can be called several times.
+func (it *TableIterator) Close() error {
+	if it.done {
+		return nil
+	}
+	it.done = true
+	it.key, it.value = NilValue, NilValue
+	if !Truth(it.closing) {
+		return nil
+	}
+	closing := it.closing
+	it.closing = NilValue
+	err, ok := Metacall(it.t, closing, "__close", []Value{closing, NilValue}, NewTerminationWith(it.t.CurrentCont(), 0, false))
+	if !ok {
+		return errors.New("to be closed value missing a __close metamethod")
+	}
+	return err
+}
+
+func (it *TableIterator) fail(err error) {
+	if err == nil {
+		return
+	}
+	if it.err == nil {
+		it.err = err
+	}
+	it.Close()
+}
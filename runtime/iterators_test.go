@@ -0,0 +1,194 @@
+package runtime_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/arnodel/golua/lib"
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// evalLua runs source in a new runtime with the standard library and returns
+// the runtime and the value returned by source.
+func evalLua(t testing.TB, source string) (*rt.Runtime, *bytes.Buffer, rt.Value) {
+	t.Helper()
+	var out bytes.Buffer
+	r := rt.New(&out)
+	lib.LoadAll(r)
+	clos, err := r.CompileAndLoadLuaChunk("test", []byte(source), rt.TableValue(r.GlobalEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := rt.Call1(r.MainThread(), rt.FunctionValue(clos))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, &out, v
+}
+
+func TestFunctionIterator(t *testing.T) {
+	r, out, gen := evalLua(t, `
+return function(n, fail)
+	local x <close> = setmetatable({}, {__close = function() print("closed") end})
+	for i = 1, n do
+		coroutine.yield(i, i * i)
+	end
+	if fail then error("failed") end
+	return "end"
+end`)
+	mainThread := r.MainThread()
+
+	// Full iteration
+	it := rt.NewFunctionIterator(mainThread, gen.AsCallable(), []rt.Value{rt.IntValue(3)})
+	var got []string
+	for it.Next() {
+		vals := it.Values()
+		got = append(got, fmt.Sprintf("%d:%d", vals[0].AsInt(), vals[1].AsInt()))
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(got, " "); s != "1:1 2:4 3:9" {
+		t.Errorf("unexpected values: %s", s)
+	}
+	if ret := it.Returned(); len(ret) != 1 || ret[0].AsString() != "end" {
+		t.Errorf("unexpected returned values: %v", ret)
+	}
+	if err := it.Close(); err != nil {
+		t.Errorf("unexpected error on close: %s", err)
+	}
+	if out.String() != "closed\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	// Early termination closes the coroutine
+	out.Reset()
+	it = rt.NewFunctionIterator(mainThread, gen.AsCallable(), []rt.Value{rt.IntValue(10)})
+	for it.Next() {
+		if it.Values()[0].AsInt() == 2 {
+			break
+		}
+	}
+	if out.Len() != 0 {
+		t.Errorf("coroutine closed too early")
+	}
+	if err := it.Close(); err != nil {
+		t.Errorf("unexpected error on close: %s", err)
+	}
+	if out.String() != "closed\n" {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if it.Next() {
+		t.Errorf("iterator should be done")
+	}
+
+	// Errors are propagated
+	it = rt.NewFunctionIterator(mainThread, gen.AsCallable(), []rt.Value{rt.IntValue(1), rt.BoolValue(true)})
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if n != 1 || it.Err() == nil || !strings.Contains(it.Err().Error(), "failed") {
+		t.Errorf("expected error after 1 value, got %d values and error %v", n, it.Err())
+	}
+}
+
+func TestCoroutineIterator(t *testing.T) {
+	r, _, co := evalLua(t, `
+return coroutine.create(function(a)
+	local b = coroutine.yield(a)
+	coroutine.yield(b)
+end)`)
+	it := rt.NewCoroutineIterator(r.MainThread(), co.AsThread(), []rt.Value{rt.StringValue("a")})
+	var got []string
+	for it.Next() {
+		got = append(got, fmt.Sprint(it.Values()[0].Interface()))
+	}
+	// The coroutine is resumed without values after the first time.
+	if len(got) != 2 || got[0] != "a" || got[1] != "<nil>" {
+		t.Errorf("unexpected values: %q", got)
+	}
+	if co.AsThread().Status() != rt.ThreadDead {
+		t.Errorf("coroutine should be dead")
+	}
+}
+
+func iterate(it *rt.TableIterator) (string, error) {
+	defer it.Close()
+	var items []string
+	for it.Next() {
+		items = append(items, fmt.Sprintf("%v=%v", it.Key().Interface(), it.Value().Interface()))
+	}
+	return strings.Join(items, " "), it.Err()
+}
+
+func TestTableIterators(t *testing.T) {
+	r, out, v := evalLua(t, `
+local proxy = setmetatable({}, {
+	__index = function(t, i) if i <= 3 then return i * 10 end end,
+	__len = function() return 5 end,
+	__pairs = function(t)
+		local closing = setmetatable({}, {__close = function() print("closing pairs") end})
+		return function(_, k)
+			k = (k or 0) + 1
+			if k <= 2 then return k, "v" .. k end
+		end, t, nil, closing
+	end,
+})
+return {
+	plain = {1, 2, 3},
+	proxy = proxy,
+	bad = setmetatable({}, {__pairs = function() error("bad pairs") end}),
+}`)
+	mainThread := r.MainThread()
+	get := func(name string) rt.Value {
+		return v.AsTable().Get(rt.StringValue(name))
+	}
+	tests := []struct {
+		name string
+		it   *rt.TableIterator
+		want string
+		err  string
+		out  string
+	}{
+		{name: "pairs plain", it: rt.Pairs(mainThread, get("plain")), want: "1=1 2=2 3=3"},
+		{name: "pairs proxy", it: rt.Pairs(mainThread, get("proxy")), want: "1=v1 2=v2", out: "closing pairs\n"},
+		{name: "pairs bad", it: rt.Pairs(mainThread, get("bad")), err: "bad pairs"},
+		{name: "pairs number", it: rt.Pairs(mainThread, rt.IntValue(1)), err: "table expected, got number"},
+		{name: "ipairs plain", it: rt.IPairs(mainThread, get("plain")), want: "1=1 2=2 3=3"},
+		{name: "ipairs proxy", it: rt.IPairs(mainThread, get("proxy")), want: "1=10 2=20 3=30"},
+		{name: "sequence proxy", it: rt.Sequence(mainThread, get("proxy")), want: "1=10 2=20 3=30 4=<nil> 5=<nil>"},
+		{name: "sequence number", it: rt.Sequence(mainThread, rt.IntValue(1)), err: "attempt to get length"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out.Reset()
+			got, err := iterate(test.it)
+			switch {
+			case test.err != "":
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error %q, got %v", test.err, err)
+				}
+			case err != nil:
+				t.Errorf("unexpected error: %s", err)
+			case got != test.want:
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+			if out.String() != test.out {
+				t.Errorf("unexpected output %q", out)
+			}
+		})
+	}
+
+	// Breaking early from a __pairs iteration calls __close
+	out.Reset()
+	it := rt.Pairs(mainThread, get("proxy"))
+	if !it.Next() {
+		t.Fatal("expected a value")
+	}
+	if err := it.Close(); err != nil || out.String() != "closing pairs\n" {
+		t.Errorf("unexpected close: %v, %q", err, out)
+	}
+}
@@ -256,7 +256,24 @@ func (r *Runtime) SetEnvGoFunc(t *Table, name string, f GoFunctionFunc, nArgs in
 
 // ParseLuaChunk parses a string as a Lua statement and returns the AST.
 func (r *Runtime) ParseLuaChunk(name string, source []byte, scannerOptions ...scanner.Option) (stat *ast.BlockStat, statSize uint64, err error) {
-	s := scanner.New(name, source, scannerOptions...)
+	return r.ParseLuaChunkWithOptions(name, source, ParseOptions{ScannerOptions: scannerOptions})
+}
+
+// ParseOptions control how ParseLuaChunkWithOptions parses Lua source code.
+type ParseOptions struct {
+	ScannerOptions []scanner.Option
+
+	// If RecoverErrors is true, parsing carries on after syntax errors.  The
+	// AST is returned even if there are errors, with ast.ErrorStat nodes in
+	// place of the statements that could not be parsed, and the error is a
+	// SyntaxErrors value listing all the syntax errors.
+	RecoverErrors bool
+}
+
+// ParseLuaChunkWithOptions parses a string as a Lua statement and returns the
+// AST, according to the given options.
+func (r *Runtime) ParseLuaChunkWithOptions(name string, source []byte, opts ParseOptions) (stat *ast.BlockStat, statSize uint64, err error) {
+	s := scanner.New(name, source, r.scannerOptions(opts.ScannerOptions)...)
 
 	// Account for CPU and memory used to make the AST.  This is an estimate,
 	// but statSize is proportional to the size of the source.
@@ -264,6 +281,18 @@ func (r *Runtime) ParseLuaChunk(name string, source []byte, scannerOptions ...sc
 	r.LinearRequire(4, uint64(len(source))) // 4 is a factor pulled out of thin air
 
 	stat = new(ast.BlockStat)
+	if opts.RecoverErrors {
+		var parseErrs []parsing.Error
+		*stat, parseErrs = parsing.ParseChunkWithRecovery(s)
+		if len(parseErrs) > 0 {
+			errs := make(SyntaxErrors, len(parseErrs))
+			for i, parseErr := range parseErrs {
+				errs[i] = NewSyntaxError(name, parseErr)
+			}
+			err = errs
+		}
+		return
+	}
 	*stat, err = parsing.ParseChunk(s)
 	if err != nil {
 		r.ReleaseMem(statSize)
@@ -278,7 +307,7 @@ func (r *Runtime) ParseLuaChunk(name string, source []byte, scannerOptions ...sc
 
 // ParseLuaExp parses a string as a Lua expression and returns the AST.
 func (r *Runtime) ParseLuaExp(name string, source []byte, scannerOptions ...scanner.Option) (stat *ast.BlockStat, statSize uint64, err error) {
-	s := scanner.New(name, source, scannerOptions...)
+	s := scanner.New(name, source, r.scannerOptions(scannerOptions)...)
 
 	// Account for CPU and memory used to make the AST.  This is an estimate,
 	// but statSize is proportional to the size of the source.
@@ -299,6 +328,12 @@ func (r *Runtime) ParseLuaExp(name string, source []byte, scannerOptions ...scan
 	return
 }
 
+// scannerOptions returns the options for scanning source code in the runtime:
+// the language version of the runtime, followed by opts.
+func (r *Runtime) scannerOptions(opts []scanner.Option) []scanner.Option {
+	return append([]scanner.Option{scanner.WithVersion(r.version)}, opts...)
+}
+
 func (r *Runtime) compileLuaStat(name string, stat *ast.BlockStat, statSize uint64) (*code.Unit, uint64, error) {
 	// In any event the AST goes out of scope when leaving this function
 	defer func() { r.ReleaseMem(statSize) }()
@@ -312,13 +347,13 @@ func (r *Runtime) compileLuaStat(name string, stat *ast.BlockStat, statSize uint
 	defer r.ReleaseMem(constsSize)
 
 	// Compile ast to ir
-	kidx, constants, err := astcomp.CompileLuaChunk(name, *stat)
+	kidx, constants, err := astcomp.CompileLuaChunk(name, *stat, astcomp.WithVersion(r.version))
 
 	// We no longer need the AST (whether that succeeded or not)
 	r.ReleaseMem(statSize)
 
 	if err != nil {
-		return nil, 0, fmt.Errorf("%s:%s", name, err)
+		return nil, 0, fmt.Errorf("%s:%w", name, err)
 	}
 
 	statSize = 0 // So that the deferred function above doesn't release the memory again.
@@ -405,7 +440,21 @@ func (r *Runtime) CompileAndLoadLuaChunk(name string, source []byte, env Value,
 // LoadFromSourceOrCode loads the given source, compiling it if it is source
 // code or unmarshaling it if it is dumped code.  It returns the closure that
 // runs the chunk in the given global environment.
+//
+// The mode is as in the Lua load() function ("b", "t" or "bt"), optionally
+// followed by syntax extensions to enable when compiling source code, each
+// introduced by a "+", e.g. "t+compound+continue" (see
+// scanner.ParseExtensions).
 func (r *Runtime) LoadFromSourceOrCode(name string, source []byte, mode string, env Value, stripComment bool) (*Closure, error) {
+	var extensions scanner.Extensions
+	if i := strings.IndexByte(mode, '+'); i >= 0 {
+		var err error
+		extensions, err = scanner.ParseExtensions(mode[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		mode = mode[:i]
+	}
 	var (
 		canBeBinary      = strings.IndexByte(mode, 'b') >= 0
 		canBeText        = strings.IndexByte(mode, 't') >= 0
@@ -445,6 +494,9 @@ func (r *Runtime) LoadFromSourceOrCode(name string, source []byte, mode string,
 		if firstLineSkipped {
 			opts = append(opts, scanner.WithStartLine(2))
 		}
+		if extensions != 0 {
+			opts = append(opts, scanner.WithExtensions(extensions))
+		}
 		return r.CompileAndLoadLuaChunk(name, source, env, opts...)
 	}
 }
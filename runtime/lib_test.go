@@ -75,3 +75,30 @@ func TestRuntime_CompileAndLoadLuaChunkOrExp(t *testing.T) {
 		})
 	}
 }
+
+func TestRuntime_ParseLuaChunkWithOptions(t *testing.T) {
+	r := New(os.Stdout)
+	src := []byte("local x = = 1\nprint(x)\nif x then\n  y z\nend\n")
+	_, _, err := r.ParseLuaChunkWithOptions("test", src, ParseOptions{})
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Fatalf("expected a syntax error, got %v", err)
+	}
+	stat, statSize, err := r.ParseLuaChunkWithOptions("test", src, ParseOptions{RecoverErrors: true})
+	errs, ok := err.(SyntaxErrors)
+	if !ok {
+		t.Fatalf("expected syntax errors, got %v", err)
+	}
+	want := "test:1:11: unexpected symbol near '='\ntest:4:5: expected '=' near 'z'"
+	if errs.Error() != want {
+		t.Errorf("got errors %q, want %q", errs.Error(), want)
+	}
+	if snErr, ok := AsSyntaxError(err); !ok || snErr != errs[0] {
+		t.Errorf("expected first syntax error to be unwrapped")
+	}
+	if stat == nil || len(stat.Stats) != 3 {
+		t.Fatalf("expected 3 statements, got %v", stat)
+	}
+	if _, _, err := r.compileLuaStat("test", stat, statSize); err == nil {
+		t.Errorf("expected compiling error statements to fail")
+	}
+}
@@ -12,7 +12,9 @@ type Code struct {
 	source, name string
 	code         []code.Opcode
 	lines        []int32
+	columns      []code.ColumnSpan
 	consts       []Value
+	indexCaches  []indexCache // Allocated on first use, see getIndexCaches
 	UpvalueCount int16
 	UpNames      []string
 	RegCount     int16
@@ -25,34 +27,43 @@ type Code struct {
 func (r *Runtime) RefactorCodeConsts(c *Code) *Code {
 	r.RequireArrSize(unsafe.Sizeof(code.Opcode(0)), len(c.code))
 	opcodes := make([]code.Opcode, len(c.code))
+	copy(opcodes, c.code)
 	var consts []Value
 	constMap := map[code.KIndex]code.KIndex{}
+	getConst := func(n code.KIndex, isClosure bool) code.KIndex {
+		m, ok := constMap[n]
+		if !ok {
+			m = code.KIndexFromInt(len(consts))
+			constMap[n] = m
+			newConst := c.consts[n]
+			if isClosure {
+				// It's a closure so we need to refactor its consts
+				newConst = CodeValue(r.RefactorCodeConsts(newConst.AsCode()))
+			}
+			r.RequireSize(unsafe.Sizeof(Value{}))
+			consts = append(consts, newConst)
+		}
+		return m
+	}
 
-	// Require CPU for the loop below
-	r.RequireCPU(uint64(len(c.code)))
+	// Require CPU for the loops below
+	r.RequireCPU(2 * uint64(len(c.code)))
 
-	for i, op := range c.code {
+	// Constants used in Type8 opcodes come first as their index must fit in 8
+	// bits.
+	for i, op := range opcodes {
+		if op.TypePfx() == code.Type8Pfx && op.GetNumOp().HasK() {
+			opcodes[i] = op.SetK8(getConst(op.GetK8(), false))
+		}
+	}
+	for i, op := range opcodes {
 		if op.TypePfx() == code.Type3Pfx {
 			unop := op.GetY()
 			if unop.LoadsK() {
 				// We are loading a constant
-				n := op.GetKIndex()
-				m, ok := constMap[n]
-				if !ok {
-					m = code.KIndexFromInt(len(consts))
-					constMap[n] = m
-					newConst := c.consts[n]
-					if unop == code.OpClosureK {
-						// It's a closure so we need to refactor its consts
-						newConst = CodeValue(r.RefactorCodeConsts(newConst.AsCode()))
-					}
-					r.RequireSize(unsafe.Sizeof(Value{}))
-					consts = append(consts, newConst)
-				}
-				op = op.SetKIndex(m)
+				opcodes[i] = op.SetKIndex(getConst(op.GetKIndex(), unop == code.OpClosureK))
 			}
 		}
-		opcodes[i] = op
 	}
 	cc := *c
 	cc.code = opcodes
@@ -69,6 +80,7 @@ func (r *Runtime) LoadLuaUnit(unit *code.Unit, env Value) *Closure {
 	// code.Code case below
 	r.RequireArrSize(unsafe.Sizeof(code.Opcode(0)), len(unit.Code))
 	r.RequireArrSize(4, len(unit.Lines))
+	r.RequireArrSize(8, len(unit.Columns))
 
 	// Require CPU for the loop below
 	r.RequireCPU(uint64(len(unit.Constants)))
@@ -92,11 +104,16 @@ func (r *Runtime) LoadLuaUnit(unit *code.Unit, env Value) *Closure {
 			if unit.Lines != nil {
 				lines = unit.Lines[k.StartOffset:k.EndOffset]
 			}
+			var columns []code.ColumnSpan
+			if unit.Columns != nil {
+				columns = unit.Columns[k.StartOffset:k.EndOffset]
+			}
 			constants[i] = CodeValue(&Code{
 				source:       unit.Source,
 				name:         k.Name,
 				code:         unit.Code[k.StartOffset:k.EndOffset],
 				lines:        lines,
+				columns:      columns,
 				consts:       constants,
 				UpvalueCount: k.UpvalueCount,
 				UpNames:      k.UpNames,
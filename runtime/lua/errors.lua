@@ -19,4 +19,4 @@ local a
  for i=1,'a' do 
  print(i) 
 end
---> ~!!! runtime: error: luatest:\d+: 'for' limit: expected number, got string
+--> ~!!! runtime: error: luatest:\d+:\d+: 'for' limit: expected number, got string
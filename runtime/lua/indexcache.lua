@@ -0,0 +1,159 @@
+-- Table lookups remember where a key was found (inline caches).  These tests
+-- check that the cached values are not used when they become stale.
+
+local function getx(t) return t.x end
+local function setx(t, v) t.x = v end
+local function callm(t) return t:m() end
+
+-- The same site used with tables of different layouts
+local t1 = {x = 1}
+local t2 = {a = 1, b = 2, c = 3, x = 2}
+print(getx(t1), getx(t2), getx(t1), getx(t2), getx({}))
+--> =1	2	1	2	nil
+
+-- Removing a field
+local t = {x = 1, y = 2}
+print(getx(t))
+t.x = nil
+print(getx(t))
+t.x = 3
+print(getx(t))
+--> =1
+--> =nil
+--> =3
+
+-- Rehashing the table moves the field
+t = {x = "a"}
+print(getx(t))
+for i = 1, 100 do
+    t["k" .. i] = i
+end
+print(getx(t))
+for i = 1, 100 do
+    t["k" .. i] = nil
+end
+t.x = nil
+print(getx(t))
+--> =a
+--> =a
+--> =nil
+
+-- Keys in the array part
+local arr = {10, 20, 30}
+local function geti(t, i) return t[i] end
+print(geti(arr, 2), geti(arr, 2), geti({n = 1}, 2), geti(arr, 2.0))
+--> =20	20	nil	20
+
+-- Setting fields
+t = {x = 1}
+setx(t, 2)
+setx(t, 3)
+print(t.x)
+--> =3
+
+setx(t, nil)
+print(t.x, next(t))
+--> =nil	nil
+
+local log = setmetatable({}, {__newindex = function(t, k, v) print("newindex", k, v) end})
+log.x = 1
+setx(log, 2)
+--> =newindex	x	1
+--> =newindex	x	2
+
+rawset(log, "x", 5)
+setx(log, 6)
+print(rawget(log, "x"))
+--> =6
+
+rawset(log, "x", nil)
+setx(log, 7)
+--> =newindex	x	7
+
+-- Methods found via __index
+local A = {}
+A.__index = A
+function A:m() return "A" end
+local B = {}
+B.__index = B
+function B:m() return "B" end
+
+local obj = setmetatable({}, A)
+print(callm(obj), callm(obj))
+--> =A	A
+
+-- The method is redefined
+function A:m() return "A2" end
+print(callm(obj))
+--> =A2
+
+-- The metatable changes
+setmetatable(obj, B)
+print(callm(obj))
+--> =B
+
+-- An instance field shadows the method
+obj.m = function() return "own" end
+print(callm(obj))
+obj.m = nil
+print(callm(obj))
+--> =own
+--> =B
+
+-- __index is changed in the metatable
+B.__index = {m = function() return "other" end}
+print(callm(obj))
+B.__index = function(t, k) return function() return "func " .. k end end
+print(callm(obj))
+B.__index = nil
+print(pcall(callm, obj))
+--> =other
+--> =func m
+--> ~false\t.*attempt to call a nil value
+
+-- The metatable is rehashed
+B.__index = B
+print(callm(obj))
+for i = 1, 50 do
+    B["f" .. i] = i
+end
+print(callm(obj))
+--> =B
+--> =B
+
+-- Several levels of __index
+local C = setmetatable({}, {__index = A})
+C.__index = C
+local objc = setmetatable({}, C)
+print(callm(objc), callm(objc))
+--> =A2	A2
+
+-- Methods on strings
+local function upper(s) return s:upper() end
+print(upper("abc"), upper("def"))
+--> =ABC	DEF
+
+local strmeta = getmetatable("")
+local saved = strmeta.__index
+strmeta.__index = {upper = function(s) return "fake " .. s end}
+print(upper("abc"))
+strmeta.__index = saved
+print(upper("abc"))
+--> =fake abc
+--> =ABC
+
+-- Userdata and other values
+print(pcall(getx, 1))
+--> ~false\t.*attempt to index a number value
+
+-- Globals are looked up in a table too
+x = 1
+local function getglobal() return x end
+print(getglobal())
+x = nil
+print(getglobal())
+x = 2
+print(getglobal())
+--> =1
+--> =nil
+--> =2
@@ -0,0 +1,32 @@
+-- Table lookups using the inline caches consume the same amount of CPU as
+-- lookups which do not use them.
+
+local A = {}
+A.__index = A
+function A:get() return self.x end
+function A:set(v) self.x = v end
+
+-- Each lookup in this chunk is performed once per call, so the first call of a
+-- freshly loaded chunk does not use the caches (they are empty) and the next
+-- calls do.
+local src = "local obj = ... obj:set(obj:get() + 1)"
+
+local function cpu(f, ...)
+    local ctx = runtime.callcontext({kill={cpu=100000}}, f, ...)
+    return ctx.used.cpu
+end
+
+local f = load(src)
+local cold = cpu(f, setmetatable({x = 0}, A))
+local warm = cpu(f, setmetatable({x = 0}, A))
+print(cold == warm, cold > 0)
+--> =true	true
+
+-- Same with __index in a second level
+local B = setmetatable({}, {__index = A})
+B.__index = B
+f = load(src)
+local cold2 = cpu(f, setmetatable({x = 0}, B))
+local warm2 = cpu(f, setmetatable({x = 0}, B))
+print(cold2 == warm2, cold2 > cold)
+--> =true	true
@@ -0,0 +1,242 @@
+-- Arithmetic and comparisons with a number literal operand are compiled to
+-- specialised opcodes.  They must behave exactly like the generic ones.
+
+local function show(...)
+    local vals, types = {...}, {}
+    for i = 1, select('#', ...) do
+        types[i] = math.type(vals[i])
+        vals[i] = tostring(vals[i])
+    end
+    print(table.concat(vals, "\t"), table.concat(types, " "))
+end
+
+local n, f = 7, 7.5
+show(n + 1, n - 1, n * 2, n / 2, n // 2, n % 3)
+--> =8	6	14	3.5	3	1	integer integer integer float integer integer
+
+show(f + 1, f - 1, f * 2, f / 2, f // 2, f % 3)
+--> =8.5	6.5	15	3.75	3	1.5	float float float float float float
+
+show(n + 2.5, n - 0.5, n * 0.5, n / 0.5)
+--> =9.5	6.5	3.5	14	float float float float
+
+show(n + 1000, n - 1000, n * 1000, n / 1000)
+--> =1007	-993	7000	0.007	integer integer integer float
+
+show(n - -3, n // -2, n % -3, -7 // 2, -7 % 2)
+--> =10	-4	-2	-4	1	integer integer integer integer integer
+
+print(n < 8, n <= 7, n > 7, n >= 8, n == 7, n ~= 7)
+--> =true	true	false	false	true	false
+
+print(8 < n, 7 <= n, 7 > n, 8 >= n, 7 == n, 7 ~= n)
+--> =false	true	false	true	true	false
+
+print(f < 8, f <= 7, f > 7, f >= 8, f == 7.5, f ~= 7.5)
+--> =true	false	true	false	true	false
+
+print(f == 7, 7 == f, n == 7.0, 7.0 == n, n < 7.5, 7.5 < n)
+--> =false	false	true	true	true	false
+
+-- Integer arithmetic wraps around
+local big = math.maxinteger
+print(big + 1 == math.mininteger, big * 2, math.mininteger - 1 == big)
+--> =true	-2	true
+
+-- Strings are converted to numbers
+show("10" + 1, "10" - 1.5, "3" * 2, "9" / 2)
+--> =11	8.5	6	4.5	integer float integer float
+
+-- Errors are the same as for generic opcodes
+print(pcall(function() return n // 0 end))
+--> ~false\t.*attempt to divide by zero
+
+print(pcall(function() return n % 0 end))
+--> ~false\t.*attempt to perform 'n%0'
+
+print(n // 0.0, -n // 0.0, n % 0.0 ~= n % 0.0)
+--> =+Inf	-Inf	true
+
+print(pcall(function() return {} + 1 end))
+--> ~false\t.*attempt to perform arithmetic on a table value
+
+print(pcall(function() local x = nil; return x * 2.5 end))
+--> ~false\t.*attempt to perform arithmetic on a nil value
+
+print(pcall(function() return "x" < 1 end))
+--> ~false\t.*attempt to compare a string value with a number value
+
+print(pcall(function() return 1 >= "x" end))
+--> ~false\t.*attempt to compare a string value with a number value
+
+print({} == 1, 1 == {}, "1" == 1)
+--> =false	false	false
+
+-- Metamethods are called with the operands in the right order
+local mt = {}
+local function meta(name)
+    mt[name] = function(x, y)
+        local function s(v) return type(v) == "table" and "obj" or tostring(v) end
+        print(name, s(x), s(y))
+        return true
+    end
+end
+for _, name in ipairs{"__add", "__sub", "__mul", "__div", "__idiv", "__mod", "__lt", "__le"} do
+    meta(name)
+end
+local obj = setmetatable({}, mt)
+
+local _ = {obj + 1, obj - 1, obj * 2, obj / 2, obj // 2, obj % 2}
+--> =__add	obj	1
+--> =__sub	obj	1
+--> =__mul	obj	2
+--> =__div	obj	2
+--> =__idiv	obj	2
+--> =__mod	obj	2
+
+_ = {obj + 1.5, obj - 1000, 2 * obj, 1 - obj}
+--> =__add	obj	1.5
+--> =__sub	obj	1000
+--> =__mul	2	obj
+--> =__sub	1	obj
+
+print(obj < 1, obj <= 1, obj > 1, obj >= 1)
+--> =__lt	obj	1
+--> =__le	obj	1
+--> =__lt	1	obj
+--> =__le	1	obj
+--> =true	true	true	true
+
+print(1 < obj, 1 <= obj, 1 > obj, 1 >= obj)
+--> =__lt	1	obj
+--> =__le	1	obj
+--> =__lt	obj	1
+--> =__le	obj	1
+--> =true	true	true	true
+
+-- Upvalues are stored in cells, the generic opcodes are used
+local u = 10
+local function inc() u = u + 1; return u > 11 end
+print(inc(), inc(), u)
+--> =false	true	12
+
+-- When there are too many constants, float operands fall back to generic
+-- opcodes
+do
+    local src = {"local x = ... local t = {"}
+    for i = 1, 300 do
+        src[#src + 1] = i + 0.5 .. ","
+    end
+    src[#src + 1] = "} return x + 0.25, x * 1.25, x - 1e5, x / 0.5, #t"
+    print(load(table.concat(src))(2))
+    --> =2.25	2.5	-99998	4	300
+end
+
+-- Integer for loops
+
+local function count(start, stop, step)
+    local c, last = 0
+    for i = start, stop, step do
+        c, last = c + 1, i
+    end
+    return c, last
+end
+
+local s = 0
+for i = 1, 10 do
+    s = s + i
+end
+print(s)
+--> =55
+
+s = 0
+for i = 10, 1, -3 do
+    s = s + i
+end
+print(s)
+--> =22
+
+-- The limit may be a float
+local t = {}
+for i = 1, 3.5 do
+    t[#t + 1] = math.type(i)
+end
+print(#t, table.concat(t, " "))
+--> =3	integer integer integer
+
+for i = 1, -math.huge do print("no") end
+t = {}
+for i = 1, math.huge do
+    if i > 3 then break end
+    t[#t + 1] = i
+end
+print(table.concat(t, " "))
+--> =1 2 3
+
+-- The loop stops on overflow
+t = {}
+for i = 9223372036854775805, math.maxinteger do
+    t[#t + 1] = i - math.maxinteger
+end
+print(table.concat(t, " "))
+--> =-2 -1 0
+
+t = {}
+for i = -9223372036854775806, math.mininteger, -1 do
+    t[#t + 1] = i - math.mininteger
+end
+print(table.concat(t, " "))
+--> =2 1 0
+
+t = {}
+for i = 9223372036854775805, math.maxinteger, 2 do
+    t[#t + 1] = i - math.maxinteger
+end
+print(table.concat(t, " "))
+--> =-2 0
+
+t = {}
+for i = 1, 1e100 do
+    if i > 2 then break end
+    t[#t + 1] = i
+end
+print(table.concat(t, " "))
+--> =1 2
+
+-- Changing the loop variable does not affect the loop
+s = 0
+for i = 1, 3 do
+    s = s + i
+    i = i * 10
+    s = s + i
+end
+print(s)
+--> =66
+
+-- Float loops are not affected
+t = {}
+for i = 1, 2, 0.5 do
+    t[#t + 1] = i
+end
+print(table.concat(t, " "))
+--> =1 1.5 2
+
+local c, last = count(1.0, 3, 1)
+print(c, last, math.type(last))
+--> =3	3	float
+
+-- The limit is a string
+print(pcall(count, 1, "3", 1))
+--> =true	3	3
+
+print(pcall(function() for i = 1, {} do end end))
+--> ~false\t.*'for' limit: expected number, got table
+
+-- Functions using specialised opcodes can be dumped and loaded again
+local function g(x)
+    local s = "a"
+    for i = 1, 3 do s = s .. "b" end
+    return x * 2.5 + 1, x - 1.5, x < 3, s
+end
+print(load(string.dump(g))(2))
+--> =6	0.5	true	abbb
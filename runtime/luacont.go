@@ -114,6 +114,7 @@ func (c *LuaCont) RunInThread(t *Thread) (Cont, error) {
 	opcodes := c.code
 	regs := c.registers
 	cells := c.cells
+	var caches []indexCache
 RunLoop:
 	for {
 		t.RequireCPU(1)
@@ -233,15 +234,18 @@ RunLoop:
 			reg := opcode.GetA()
 			coll := getReg(regs, cells, opcode.GetB())
 			idx := getReg(regs, cells, opcode.GetC())
+			if caches == nil {
+				caches = c.getIndexCaches(t.Runtime)
+			}
 			if !opcode.GetF() {
-				val, err := Index(t, coll, idx)
+				val, err := cachedIndex(t, &caches[pc], coll, idx)
 				if err != nil {
 					c.pc = pc
 					return nil, err
 				}
 				setReg(regs, cells, reg, val)
 			} else {
-				err := SetIndex(t, coll, idx, getReg(regs, cells, reg))
+				err := cachedSetIndex(t, &caches[pc], coll, idx, getReg(regs, cells, reg))
 				if err != nil {
 					c.pc = pc
 					return nil, err
@@ -450,6 +454,82 @@ RunLoop:
 			}
 			pc++
 			continue RunLoop
+		case code.Type8Pfx:
+			op := opcode.GetNumOp()
+			dst := opcode.GetValueA()
+			x := regs[opcode.GetValueB().Idx()]
+			if op == code.OpAdvForInt {
+				// Advance an integer for loop.  The start and step values are
+				// known to be integers, only the stop value needs checking.
+				stop := regs[opcode.GetValueB().Idx()]
+				step := regs[opcode.GetValueC().Idx()]
+				start := regs[dst.Idx()]
+				n, okn := start.TryInt()
+				lim, oklim := stop.TryInt()
+				if okn && oklim {
+					d := step.AsInt()
+					next := n + d
+					var done bool
+					if d > 0 {
+						done = next > lim || next < n
+					} else {
+						done = next < lim || next > n
+					}
+					if done {
+						regs[dst.Idx()] = NilValue
+					} else {
+						regs[dst.Idx()] = IntValue(next)
+					}
+				} else {
+					regs[dst.Idx()] = advForLoop(start, stop, step)
+				}
+				pc++
+				continue RunLoop
+			}
+			// These opcodes replace loading a constant followed by a Type1
+			// opcode, so they are charged the same to keep quotas stable.
+			t.RequireCPU(1)
+			var res Value
+			var err error
+			if op.HasImmediate() {
+				n := int64(opcode.GetInt8())
+				if ix, ok := x.TryInt(); ok {
+					// Fast path for integers
+					switch op {
+					case code.OpAddI:
+						res = IntValue(ix + n)
+					case code.OpSubI:
+						res = IntValue(ix - n)
+					case code.OpMulI:
+						res = IntValue(ix * n)
+					case code.OpDivI:
+						res = FloatValue(float64(ix) / float64(n))
+					case code.OpEqI:
+						res = BoolValue(ix == n)
+					case code.OpLtI:
+						res = BoolValue(ix < n)
+					case code.OpLeqI:
+						res = BoolValue(ix <= n)
+					case code.OpGtI:
+						res = BoolValue(n < ix)
+					case code.OpGeqI:
+						res = BoolValue(n <= ix)
+					default:
+						res, err = numOp(t, op, x, IntValue(n))
+					}
+				} else {
+					res, err = numOp(t, op, x, IntValue(n))
+				}
+			} else {
+				res, err = numOp(t, op, x, consts[opcode.GetK8()])
+			}
+			if err != nil {
+				c.pc = pc
+				return nil, err
+			}
+			regs[dst.Idx()] = res
+			pc++
+			continue RunLoop
 		case code.Type7Pfx:
 			startReg, stopReg, stepReg := opcode.GetA(), opcode.GetB(), opcode.GetC()
 			start := getReg(regs, cells, startReg)
@@ -458,21 +538,7 @@ RunLoop:
 			if opcode.GetF() {
 				// Advance for loop.  All registers are assumed to contain
 				// numeric values because they have been prepared previously.
-				nextStart, _ := Add(start, step)
-
-				// Check if the loop is done.  It can be done if we have gone
-				// over the stop value or if there has been overflow /
-				// underflow.
-				var done bool
-				if isPositive(step) {
-					done = numIsLessThan(stop, nextStart) || numIsLessThan(nextStart, start)
-				} else {
-					done = numIsLessThan(nextStart, stop) || numIsLessThan(start, nextStart)
-				}
-				if done {
-					nextStart = NilValue
-				}
-				setReg(regs, cells, startReg, nextStart)
+				setReg(regs, cells, startReg, advForLoop(start, stop, step))
 			} else {
 				// Prepare for loop
 				start, tstart := ToNumberValue(start)
@@ -540,14 +606,19 @@ func (c *LuaCont) DebugInfo() *DebugInfo {
 	if pc >= 0 && int(pc) < len(c.lines) {
 		currentLine = c.lines[pc]
 	}
+	var currentColumns code.ColumnSpan
+	if pc >= 0 && int(pc) < len(c.columns) {
+		currentColumns = c.columns[pc]
+	}
 	name := c.name
 	if name == "" {
 		name = "<lua function>"
 	}
 	return &DebugInfo{
-		Source:      c.source,
-		Name:        name,
-		CurrentLine: currentLine,
+		Source:         c.source,
+		Name:           name,
+		CurrentLine:    currentLine,
+		CurrentColumns: currentColumns,
 	}
 }
 
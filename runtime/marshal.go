@@ -9,7 +9,7 @@ import (
 	"github.com/arnodel/golua/code"
 )
 
-var marshalPrefix = []byte{6, 0, 4}
+var marshalPrefix = []byte{6, 0, 5}
 var ErrInvalidMarshalPrefix = errors.New("Invalid marshal prefix")
 
 // HasMarshalPrefix returns true if the byte slice passed starts witht the magic
@@ -91,13 +91,14 @@ func (w *bwriter) writeConst(c Value) {
 }
 
 func (w *bwriter) writeCode(c *Code) {
-	w.consumeBudget(1 + 0 + 0 + 8 + 8 + 8)
+	w.consumeBudget(1 + 0 + 0 + 8 + 8 + 8 + 8)
 	w.write(
 		CodeType,
 		c.source,
 		c.name,
 		int64(len(c.code)), c.code,
 		int64(len(c.lines)), c.lines,
+		int64(len(c.columns)), c.columns,
 		int64(len(c.consts)),
 	)
 	for _, k := range c.consts {
@@ -223,6 +224,12 @@ func (r *breader) readCode(c *Code) {
 		c.lines,
 		&sz,
 	)
+	c.columns = make([]code.ColumnSpan, sz)
+	r.read(
+		8*uint64(sz)+8,
+		c.columns,
+		&sz,
+	)
 	c.consts = make([]Value, sz)
 	for i := range c.consts {
 		c.consts[i] = r.readConst()
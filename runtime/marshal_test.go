@@ -76,7 +76,7 @@ func TestUnmarshalConst(t *testing.T) {
 		{
 			name: "consume the budget",
 			args: args{
-				r:      bytes.NewBuffer([]byte{6, 0, 4, byte(StringType), 1, 1, 1, 1, 1, 1, 1, 1}), // would be very long
+				r:      bytes.NewBuffer([]byte{6, 0, 5, byte(StringType), 1, 1, 1, 1, 1, 1, 1, 1}), // would be very long
 				budget: 1000,
 			},
 			wantUsed: 1000,
@@ -93,7 +93,7 @@ func TestUnmarshalConst(t *testing.T) {
 		{
 			name: "read wrong type",
 			args: args{
-				r: bytes.NewBuffer([]byte{6, 0, 4, byte(FunctionType)}),
+				r: bytes.NewBuffer([]byte{6, 0, 5, byte(FunctionType)}),
 			},
 			wantErr: true,
 		},
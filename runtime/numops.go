@@ -0,0 +1,85 @@
+package runtime
+
+import "github.com/arnodel/golua/code"
+
+// numOp computes x op y for a Type8 opcode, where y is the right operand
+// encoded in the opcode.  It uses the same generic implementation as the Type1
+// opcode for the operator, so the result (or error) is exactly the same.
+func numOp(t *Thread, op code.NumOp, x, y Value) (res Value, err error) {
+	var ok bool
+	switch op {
+	case code.OpAddI, code.OpAddK:
+		res, ok = Add(x, y)
+		if !ok {
+			res, err = binaryArithFallback(t, "__add", x, y)
+		}
+	case code.OpSubI, code.OpSubK:
+		res, ok = Sub(x, y)
+		if !ok {
+			res, err = binaryArithFallback(t, "__sub", x, y)
+		}
+	case code.OpMulI, code.OpMulK:
+		res, ok = Mul(x, y)
+		if !ok {
+			res, err = binaryArithFallback(t, "__mul", x, y)
+		}
+	case code.OpDivI, code.OpDivK:
+		res, ok = Div(x, y)
+		if !ok {
+			res, err = binaryArithFallback(t, "__div", x, y)
+		}
+	case code.OpFloorDivI:
+		res, ok, err = Idiv(x, y)
+		if !ok {
+			res, err = binaryArithFallback(t, "__idiv", x, y)
+		}
+	case code.OpModI:
+		res, ok, err = Mod(x, y)
+		if !ok {
+			res, err = binaryArithFallback(t, "__mod", x, y)
+		}
+	case code.OpEqI:
+		var r bool
+		r, err = eq(t, x, y)
+		res = BoolValue(r)
+	case code.OpLtI:
+		var r bool
+		r, err = Lt(t, x, y)
+		res = BoolValue(r)
+	case code.OpLeqI:
+		var r bool
+		r, err = le(t, x, y)
+		res = BoolValue(r)
+	case code.OpGtI:
+		var r bool
+		r, err = Lt(t, y, x)
+		res = BoolValue(r)
+	case code.OpGeqI:
+		var r bool
+		r, err = le(t, y, x)
+		res = BoolValue(r)
+	default:
+		panic("unsupported")
+	}
+	return
+}
+
+// advForLoop returns the next value of the control variable of a numeric for
+// loop, or nil if the loop is done.  All values are assumed to be numbers
+// because they have been prepared previously.
+func advForLoop(start, stop, step Value) Value {
+	nextStart, _ := Add(start, step)
+
+	// Check if the loop is done.  It can be done if we have gone over the stop
+	// value or if there has been overflow / underflow.
+	var done bool
+	if isPositive(step) {
+		done = numIsLessThan(stop, nextStart) || numIsLessThan(nextStart, start)
+	} else {
+		done = numIsLessThan(nextStart, stop) || numIsLessThan(start, nextStart)
+	}
+	if done {
+		return NilValue
+	}
+	return nextStart
+}
@@ -0,0 +1,67 @@
+package runtime_test
+
+import (
+	"testing"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// A luaBenchmark is Lua source code which returns a function to be called
+// repeatedly (see runLuaBenchmarks).
+type luaBenchmark struct {
+	name, source string
+}
+
+var numericBenchmarks = []luaBenchmark{
+	{
+		name: "fib",
+		source: `
+local function fib(n)
+	if n < 2 then return n end
+	return fib(n - 1) + fib(n - 2)
+end
+return function() return fib(20) end`,
+	},
+	{
+		name: "intloop",
+		source: `
+return function()
+	local s = 0
+	for i = 1, 100000 do
+		if i % 3 == 0 then s = s + i * 2 end
+	end
+	return s
+end`,
+	},
+	{
+		name: "floatloop",
+		source: `
+return function()
+	local x = 0.0
+	for i = 1, 100000 do
+		x = x * 0.5 + 1.5
+	end
+	return x
+end`,
+	},
+}
+
+func BenchmarkNumeric(b *testing.B) {
+	runLuaBenchmarks(b, numericBenchmarks)
+}
+
+// runLuaBenchmarks runs a sub-benchmark for each item in benchmarks, which
+// measures calls to the function returned by its source.
+func runLuaBenchmarks(b *testing.B, benchmarks []luaBenchmark) {
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			r, _, f := evalLua(b, bench.source)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := rt.Call1(r.MainThread(), f); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"runtime"
 
+	"github.com/arnodel/golua/luaversion"
 	"github.com/arnodel/golua/runtime/internal/luagc"
 )
 
@@ -25,8 +26,20 @@ type Runtime struct {
 	gcThread   *Thread   // Thread for running Lua finalizers
 	registry   *Table    // The registry table can store data global to the runtime
 
+	// Host environment seen by the standard library, see host.go.
+	stdin            io.Reader
+	stderr           io.Writer
+	bufferedStdFiles bool
+	env              map[string]string // nil means use the process environment
+	workingDir       string            // empty means use the process working directory
+	exitFunc         func(int)
+
 	warner Warner // Lua 5.4 introduces a warning system, implemented by this
 
+	version luaversion.Version // Version of the Lua language compiled
+
+	caughtErrors []caughtError // Recently caught errors, see CatchError
+
 	// This has an almost empty implementation when the noquotas build tag is
 	// set.  It should allow the compiler to compile away almost all runtime
 	// context manager methods.
@@ -48,11 +61,22 @@ type runtimeOptions struct {
 	regPoolSize       uint
 	regSetMaxAge      uint
 	runtimeContextDef *RuntimeContextDef
+	stdin             io.Reader
+	stderr            io.Writer
+	bufferedStdFiles  bool
+	env               []string
+	workingDir        string
+	exitFunc          func(int)
+	version           luaversion.Version
 }
 
 var defaultRuntimeOptions = runtimeOptions{
-	regPoolSize:  10,
-	regSetMaxAge: 10,
+	regPoolSize:      10,
+	regSetMaxAge:     10,
+	stdin:            os.Stdin,
+	stderr:           os.Stderr,
+	bufferedStdFiles: true,
+	version:          luaversion.Default,
 }
 
 // A RuntimeOption configures the Runtime.
@@ -80,6 +104,72 @@ func WithRuntimeContext(def RuntimeContextDef) RuntimeOption {
 	}
 }
 
+// WithStdin sets the standard input of the runtime (used e.g. by io.read).  The
+// default is the process standard input.
+func WithStdin(stdin io.Reader) RuntimeOption {
+	return func(rtOpts *runtimeOptions) {
+		rtOpts.stdin = stdin
+	}
+}
+
+// WithStderr sets the standard error of the runtime (used e.g. by io.stderr and
+// the default warner).  The default is the process standard error.
+func WithStderr(stderr io.Writer) RuntimeOption {
+	return func(rtOpts *runtimeOptions) {
+		rtOpts.stderr = stderr
+	}
+}
+
+// WithBufferedStdFiles sets whether the standard input and output of the
+// process should be buffered when the runtime uses them (e.g. in io.write).  It
+// does not apply to custom standard streams (e.g. given with WithStdin).  The
+// default is true.
+func WithBufferedStdFiles(buffered bool) RuntimeOption {
+	return func(rtOpts *runtimeOptions) {
+		rtOpts.bufferedStdFiles = buffered
+	}
+}
+
+// WithEnv sets the environment variables visible to the runtime (e.g. via
+// os.getenv) and to the commands it runs.  Each item has the form "key=value",
+// like the value returned by os.Environ.  By default the runtime sees the
+// process environment.
+func WithEnv(env []string) RuntimeOption {
+	return func(rtOpts *runtimeOptions) {
+		rtOpts.env = env
+		if rtOpts.env == nil {
+			rtOpts.env = []string{}
+		}
+	}
+}
+
+// WithWorkingDir sets the directory relative to which the runtime resolves file
+// names and runs commands.  The default is the process working directory.
+func WithWorkingDir(dir string) RuntimeOption {
+	return func(rtOpts *runtimeOptions) {
+		rtOpts.workingDir = dir
+	}
+}
+
+// WithExitFunc sets a function called by Runtime.Exit (e.g. from os.exit) with
+// the exit code, before the runtime is unwound.  By default there is none.
+// Passing os.Exit makes os.exit terminate the whole process immediately, as in
+// C Lua.
+func WithExitFunc(exit func(code int)) RuntimeOption {
+	return func(rtOpts *runtimeOptions) {
+		rtOpts.exitFunc = exit
+	}
+}
+
+// WithLanguageVersion sets the version of the Lua language that the runtime
+// compiles and the standard library implements.  The default is
+// luaversion.Default (Lua 5.4).
+func WithLanguageVersion(v luaversion.Version) RuntimeOption {
+	return func(rtOpts *runtimeOptions) {
+		rtOpts.version = v
+	}
+}
+
 // New returns a new pointer to a Runtime with the given stdout.
 func New(stdout io.Writer, opts ...RuntimeOption) *Runtime {
 	rtOpts := defaultRuntimeOptions
@@ -87,13 +177,20 @@ func New(stdout io.Writer, opts ...RuntimeOption) *Runtime {
 		opt(&rtOpts)
 	}
 	r := &Runtime{
-		globalEnv: NewTable(),
-		Stdout:    stdout,
-		registry:  NewTable(),
-		warner:    NewLogWarner(os.Stderr, "Lua warning: "),
-		regPool:   mkValuePool(rtOpts.regPoolSize, rtOpts.regSetMaxAge),
-		argsPool:  mkValuePool(rtOpts.regPoolSize, rtOpts.regSetMaxAge),
-		cellPool:  mkCellPool(rtOpts.regPoolSize, rtOpts.regSetMaxAge),
+		globalEnv:        NewTable(),
+		Stdout:           stdout,
+		registry:         NewTable(),
+		stdin:            rtOpts.stdin,
+		stderr:           rtOpts.stderr,
+		bufferedStdFiles: rtOpts.bufferedStdFiles,
+		env:              envMap(rtOpts.env),
+		workingDir:       rtOpts.workingDir,
+		exitFunc:         rtOpts.exitFunc,
+		warner:           NewLogWarner(rtOpts.stderr, "Lua warning: "),
+		version:          rtOpts.version,
+		regPool:          mkValuePool(rtOpts.regPoolSize, rtOpts.regSetMaxAge),
+		argsPool:         mkValuePool(rtOpts.regPoolSize, rtOpts.regSetMaxAge),
+		cellPool:         mkCellPool(rtOpts.regPoolSize, rtOpts.regSetMaxAge),
 	}
 
 	mainThread := NewThread(r)
@@ -129,6 +226,12 @@ func (r *Runtime) SetRegistry(k, v Value) {
 	r.SetTable(r.registry, k, v)
 }
 
+// LanguageVersion returns the version of the Lua language of the runtime (see
+// WithLanguageVersion).
+func (r *Runtime) LanguageVersion() luaversion.Version {
+	return r.version
+}
+
 // MainThread returns the runtime's main thread.
 func (r *Runtime) MainThread() *Thread {
 	return r.mainThread
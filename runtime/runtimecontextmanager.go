@@ -263,6 +263,22 @@ func (m *runtimeContextManager) updateTimeUsed() {
 	}
 }
 
+// TimeLeft returns the time left before the hard time limit of the current
+// context is reached.  The boolean is false if the context has no time limit.
+// Code that blocks while waiting for something (e.g. an event loop) can use it
+// to avoid blocking past the time limit.  If the time limit has already been
+// reached or the context has been stopped, the context is terminated.
+func (m *runtimeContextManager) TimeLeft() (time.Duration, bool) {
+	if m.stopLevel&HardStop != 0 {
+		m.KillContext()
+	}
+	if m.hardLimits.Millis == 0 {
+		return 0, false
+	}
+	m.updateTimeUsed()
+	return time.Duration(m.hardLimits.Millis-m.usedResources.Millis) * time.Millisecond, true
+}
+
 // LinearUnused returns an amount of resource combining memory and cpu.  It is
 // useful when calling functions whose time complexity is a linear function of
 // the size of their output.  As cpu ticks are "smaller" than memory ticks, the
@@ -5,6 +5,7 @@ package runtime
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/arnodel/golua/runtime/internal/luagc"
 )
@@ -128,6 +129,10 @@ func (m *runtimeContextManager) UnusedMem() uint64 {
 	return 0
 }
 
+func (m *runtimeContextManager) TimeLeft() (time.Duration, bool) {
+	return 0, false
+}
+
 func (m *runtimeContextManager) LinearUnused(cpuFactor uint64) uint64 {
 	return 0
 }
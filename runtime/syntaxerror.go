@@ -3,6 +3,7 @@ package runtime
 import (
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/arnodel/golua/parsing"
 	"github.com/arnodel/golua/token"
@@ -38,6 +39,24 @@ func (e *SyntaxError) IsUnexpectedEOF() bool {
 	}
 }
 
+// SyntaxErrors is a list of syntax errors in the same chunk, as returned when
+// parsing with error recovery.  It is never empty.
+type SyntaxErrors []*SyntaxError
+
+// Error implements the error interface, listing all the errors one per line.
+func (e SyntaxErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the first syntax error.
+func (e SyntaxErrors) Unwrap() error {
+	return e[0]
+}
+
 func ErrorIsUnexpectedEOF(err error) bool {
 	snErr, ok := AsSyntaxError(err)
 	return ok && snErr.IsUnexpectedEOF()
@@ -19,6 +19,18 @@ func NewTable() *Table {
 	return &Table{mixedTable: &mixedTable{}}
 }
 
+// NewTableSize returns a new Table with space preallocated for nseq values
+// with keys 1 to nseq and nrec other values.  Negative sizes are treated as 0.
+func NewTableSize(nseq, nrec int) *Table {
+	return &Table{mixedTable: newMixedTable(nseq, nrec)}
+}
+
+// TableSizeMem returns the amount of memory that NewTableSize(nseq, nrec)
+// preallocates, so that it can be required before creating the table.
+func TableSizeMem(nseq, nrec int) uint64 {
+	return mixedTableMem(nseq, nrec)
+}
+
 // Metatable returns the table's metatable.
 func (t *Table) Metatable() *Table {
 	return t.meta
@@ -73,3 +85,27 @@ func (t *Table) Len() int64 {
 func (t *Table) Next(k Value) (next Value, val Value, ok bool) {
 	return t.mixedTable.next(k)
 }
+
+// slotValue returns the value in the i-th slot of the hash table part of t and
+// true if this slot contains the key k.  It is safe to call with a nil t.
+func (t *Table) slotValue(i uint32, k Value) (Value, bool) {
+	if t == nil {
+		return NilValue, false
+	}
+	return t.hashTable.slotValue(uintptr(i), k)
+}
+
+// setSlotValue sets the value in the i-th slot of the hash table part of t.
+// It must only be called if slotValue(i, k) returned true.
+func (t *Table) setSlotValue(i uint32, v Value) {
+	t.hashTable.slots[i].value = v
+}
+
+// slotIndex returns the index of the slot of the hash table part of t which
+// contains the key k and true if k => v for some v.
+func (t *Table) slotIndex(k Value) (uint32, bool) {
+	if t == nil {
+		return 0, false
+	}
+	return t.hashTable.slotIndex(k)
+}
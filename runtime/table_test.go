@@ -1,6 +1,9 @@
 package runtime
 
-import "testing"
+import (
+	"testing"
+	"unsafe"
+)
 
 func TestTable_Remove(t *testing.T) {
 	tbl := NewTable()
@@ -53,3 +56,19 @@ func TestTable_Next(t *testing.T) {
 		t.Errorf("Expected (1, x) and (2, y) to be the items, got (%v, %v) and (%v, %v)", k1, v1, k2, v2)
 	}
 }
+
+func TestTableSizeMem(t *testing.T) {
+	for _, sz := range [][2]int{{0, 0}, {-1, -1}, {10, 0}, {0, 1}, {0, 5}, {3, 8}, {0, 1<<10 + 1}} {
+		tbl := NewTableSize(sz[0], sz[1])
+		var want uint64
+		if tbl.array != nil {
+			want += uint64(len(tbl.array.values)) * uint64(unsafe.Sizeof(Value{}))
+		}
+		if tbl.hashTable != nil {
+			want += uint64(len(tbl.hashTable.slots)) * uint64(unsafe.Sizeof(hashTableSlot{}))
+		}
+		if got := TableSizeMem(sz[0], sz[1]); got != want {
+			t.Errorf("TableSizeMem(%d, %d) = %d, want %d", sz[0], sz[1], got, want)
+		}
+	}
+}
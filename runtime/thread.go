@@ -23,9 +23,10 @@ const maxGoFunctionCallDepth = 1000
 // Data passed between Threads via their resume channel (Thread.resumeCh).
 //
 // Supported types for exception are ContextTerminationError (which means
-// execution has run out of resources) and threadClose (which means the thread
-// should be closed without resuming execution, new in Lua 5.4 via the
-// coroutine.close() function).  Other types will cause a panic.
+// execution has run out of resources), *ExitError (which means the runtime is
+// exiting) and threadClose (which means the thread should be closed without
+// resuming execution, new in Lua 5.4 via the coroutine.close() function).
+// Other types will cause a panic.
 type valuesError struct {
 	args      []Value     // arguments ot yield or resume
 	err       error       // execution error
@@ -55,6 +56,8 @@ type Thread struct {
 	DebugHooks
 
 	closeStack // Stack of pending to-be-closed values
+
+	inCall bool // True when running a call made from Go (see Thread.call)
 }
 
 // NewThread creates a new thread out of a Runtime.  Its initial
@@ -107,9 +110,9 @@ func (t *Thread) RunContinuation(c Cont) (err error) {
 				if errContCount > maxErrorsInMessageHandler {
 					return newHandledError(errErrorInMessageHandler)
 				}
-				next = t.messageHandler.Continuation(t, newMessageHandlerCont(c))
+				next = t.messageHandler.Continuation(t, newMessageHandlerCont(c, err))
 			} else {
-				next = newMessageHandlerCont(c)
+				next = newMessageHandlerCont(c, err)
 			}
 			next.Push(t.Runtime, ErrorValue(err))
 		}
@@ -143,7 +146,7 @@ func (t *Thread) Start(c Callable) {
 			r := recover()
 			if r != nil {
 				switch r.(type) {
-				case ContextTerminationError:
+				case ContextTerminationError, *ExitError:
 				case threadClose:
 					// This means we want to close the coroutine, so no panic!
 					r = nil
@@ -264,6 +267,9 @@ func (t *Thread) end(args []Value, err error, exception interface{}) {
 	close(t.resumeCh)
 	t.status = ThreadDead
 	t.caller = nil
+	if exitErr, ok := exception.(*ExitError); ok && !exitErr.Close {
+		t.closeStack.truncate(0)
+	}
 	err = t.cleanupCloseStack(nil, 0, err) // TODO: not nil
 	t.closeErr = err
 	caller.sendResumeValues(args, err, exception)
@@ -271,6 +277,30 @@ func (t *Thread) end(args []Value, err error, exception interface{}) {
 }
 
 func (t *Thread) call(c Callable, args []Value, next Cont) error {
+	if !t.inCall && t.caller == nil {
+		return t.outermostCall(c, args, next)
+	}
+	cont := c.Continuation(t, next)
+	t.Push(cont, args...)
+	return t.RunContinuation(cont)
+}
+
+// The outermost call from Go into a thread which is not running as a coroutine
+// is where a runtime exit stops unwinding (see Runtime.Exit).
+func (t *Thread) outermostCall(c Callable, args []Value, next Cont) (err error) {
+	h := t.closeStack.size()
+	t.inCall = true
+	defer func() {
+		t.inCall = false
+		t.Runtime.forgetCaughtErrors()
+		if r := recover(); r != nil {
+			exitErr, ok := r.(*ExitError)
+			if !ok {
+				panic(r)
+			}
+			err = t.exit(exitErr, h)
+		}
+	}()
 	cont := c.Continuation(t, next)
 	t.Push(cont, args...)
 	return t.RunContinuation(cont)
@@ -307,11 +337,13 @@ func (t *Thread) CallContext(def RuntimeContextDef, f func() error) (ctx Runtime
 	defer func() {
 		ctx = t.PopContext()
 		if r := recover(); r != nil {
-			t.closeStack.truncate(h) // No resources to run that, so just discard it.
 			termErr, ok := r.(ContextTerminationError)
 			if !ok {
+				// This includes *ExitError, in which case the close stack
+				// is dealt with by the outermost call.
 				panic(r)
 			}
+			t.closeStack.truncate(h) // No resources to run that, so just discard it.
 			err = termErr
 		}
 	}()
@@ -383,13 +415,14 @@ func (t *Thread) cleanupCloseStack(c Cont, h int, err error) error {
 // turns it to handled).
 //
 type messageHandlerCont struct {
-	c    Cont
-	err  Value
-	done bool
+	c      Cont
+	origin *Error // The error being handled
+	err    Value
+	done   bool
 }
 
-func newMessageHandlerCont(c Cont) *messageHandlerCont {
-	return &messageHandlerCont{c: c}
+func newMessageHandlerCont(c Cont, origin error) *messageHandlerCont {
+	return &messageHandlerCont{c: c, origin: ToError(origin)}
 }
 
 var _ Cont = (*messageHandlerCont)(nil)
@@ -421,5 +454,13 @@ func (c *messageHandlerCont) PushEtc(r *Runtime, etc []Value) {
 }
 
 func (c *messageHandlerCont) RunInThread(t *Thread) (Cont, error) {
-	return nil, newHandledError(c.err)
+	err := newHandledError(c.err)
+	if c.origin != nil {
+		err.lineno = c.origin.lineno
+		err.columns = c.origin.columns
+		err.source = c.origin.source
+		err.cause = c.origin.cause
+		err.frames = c.origin.frames
+	}
+	return nil, err
 }
@@ -0,0 +1,105 @@
+package safeio
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	rt "github.com/arnodel/golua/runtime"
+)
+
+// A CommandFilter is consulted before a subprocess is started on behalf of
+// Lua code (e.g. by os.execute, io.popen or the process library).  It may
+// inspect cmd and modify it (for example to rewrite its path, arguments,
+// environment or working directory).  Returning a non-nil error prevents the
+// command from being started and the error is reported to the Lua code.
+type CommandFilter func(r *rt.Runtime, cmd *exec.Cmd) error
+
+type commandFilterKeyType struct{}
+
+var commandFilterKey = rt.AsValue(commandFilterKeyType{})
+
+// SetCommandFilter sets the CommandFilter used by StartCommand for runtime r.
+// Passing a nil filter removes the current filter so that all commands are
+// allowed (subject to the runtime context's compliance flags).
+func SetCommandFilter(r *rt.Runtime, filter CommandFilter) {
+	if filter == nil {
+		r.SetRegistry(commandFilterKey, rt.NilValue)
+		return
+	}
+	r.SetRegistry(commandFilterKey, rt.AsValue(filter))
+}
+
+func getCommandFilter(r *rt.Runtime) CommandFilter {
+	filter, _ := r.Registry(commandFilterKey).Interface().(CommandFilter)
+	return filter
+}
+
+// StartCommand starts cmd unless the current runtime context requires IO
+// safety or the runtime's CommandFilter rejects it.  Unless they are already
+// set, the environment and working directory of cmd are those of the runtime.
+func StartCommand(r *rt.Runtime, cmd *exec.Cmd) error {
+	if r.RequiredFlags()&rt.ComplyIoSafe != 0 {
+		return ErrNotAllowed
+	}
+	if cmd.Env == nil {
+		cmd.Env = r.Environ()
+	}
+	if cmd.Dir == "" {
+		cmd.Dir = r.WorkingDir()
+	} else {
+		cmd.Dir = r.ResolvePath(cmd.Dir)
+	}
+	if filter := getCommandFilter(r); filter != nil {
+		if err := filter(r, cmd); err != nil {
+			return err
+		}
+	}
+	return cmd.Start()
+}
+
+// ShellCommand returns a command that runs cmdStr with the system shell.
+func ShellCommand(cmdStr string) *exec.Cmd {
+	shell, flag := shellPath()
+	return &exec.Cmd{
+		Path: shell,
+		Args: []string{shell, flag, cmdStr},
+	}
+}
+
+// ShellAvailable returns true if the system shell can be used in the current
+// context.
+func ShellAvailable(r *rt.Runtime) bool {
+	if r.RequiredFlags()&rt.ComplyIoSafe != 0 {
+		return false
+	}
+	shell, _ := shellPath()
+	_, err := os.Stat(shell)
+	return err == nil
+}
+
+func shellPath() (string, string) {
+	if runtime.GOOS == "windows" {
+		return "C:\\Windows\\system32\\cmd.exe", "/c"
+	}
+	return "/bin/sh", "-c"
+}
+
+// ExitStatus describes how a process terminated in the way Lua's os.execute
+// does.  ok is true if the process exited successfully, how is "exit" if it
+// exited normally or "signal" if it was terminated by a signal, and code is
+// the exit status or the signal number accordingly.
+func ExitStatus(ps *os.ProcessState) (ok bool, how string, code int64) {
+	ok = ps.Success()
+	how = "exit"
+	code = int64(ps.ExitCode())
+	if !ps.Exited() {
+		// received signal instead of normal exit
+		how = "signal"
+		if ws, isWs := ps.Sys().(syscall.WaitStatus); isWs && runtime.GOOS != "windows" {
+			code = int64(ws.Signal())
+		}
+	}
+	return
+}
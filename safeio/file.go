@@ -13,13 +13,16 @@ func OpenFile(r *rt.Runtime, name string, flag int, perm fs.FileMode) (*os.File,
 	if r.RequiredFlags()&rt.ComplyIoSafe != 0 {
 		return nil, ErrNotAllowed
 	}
-	return os.OpenFile(name, flag, perm)
+	return os.OpenFile(r.ResolvePath(name), flag, perm)
 }
 
 func TempFile(r *rt.Runtime, dir string, pattern string) (*os.File, error) {
 	if r.RequiredFlags()&rt.ComplyIoSafe != 0 {
 		return nil, ErrNotAllowed
 	}
+	if dir != "" {
+		dir = r.ResolvePath(dir)
+	}
 	return ioutil.TempFile(dir, pattern)
 }
 
@@ -27,14 +30,14 @@ func RemoveFile(r *rt.Runtime, name string) error {
 	if r.RequiredFlags()&rt.ComplyIoSafe != 0 {
 		return ErrNotAllowed
 	}
-	return os.Remove(name)
+	return os.Remove(r.ResolvePath(name))
 }
 
 func RenameFile(r *rt.Runtime, oldName, newName string) error {
 	if r.RequiredFlags()&rt.ComplyIoSafe != 0 {
 		return ErrNotAllowed
 	}
-	return os.Rename(oldName, newName)
+	return os.Rename(r.ResolvePath(oldName), r.ResolvePath(newName))
 }
 
 var ErrNotAllowed = errors.New("safeio: operation not allowed")
@@ -0,0 +1,101 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Extensions is a set of opt-in extensions to the Lua 5.4 syntax.  They are
+// recognised by the scanner (and then the parser) only when enabled with the
+// WithExtensions option.  They are all compiled to plain Lua operations, so
+// they need no support from the runtime.
+type Extensions uint
+
+const (
+	// CompoundAssignment allows "v op= exp" as a shorthand for "v = v op exp",
+	// where op is one of + - * / // % ^ .. and v is evaluated only once.
+	CompoundAssignment Extensions = 1 << iota
+
+	// Continue makes "continue" a keyword.  The "continue" statement skips
+	// to the next iteration of the innermost enclosing loop.
+	Continue
+
+	// SafeNavigation allows "a?.name" and "a?[exp]", which evaluate to nil
+	// if a is nil and are the same as "a.name" and "a[exp]" otherwise.
+	SafeNavigation
+
+	// NotEqual allows "!=" as an alternative to "~=".
+	NotEqual
+
+	// TypeAnnotations allows optional type annotations on local variables and
+	// function parameters and return values, as well as "type Name = type"
+	// declarations.  They are checked by the typecheck package and erased
+	// before compilation.
+	TypeAnnotations
+
+	// AllExtensions is the set of all syntax extensions.
+	AllExtensions = CompoundAssignment | Continue | SafeNavigation | NotEqual | TypeAnnotations
+)
+
+var extensionNames = []struct {
+	ext  Extensions
+	name string
+}{
+	{CompoundAssignment, "compound"},
+	{Continue, "continue"},
+	{SafeNavigation, "safenav"},
+	{NotEqual, "notequal"},
+	{TypeAnnotations, "types"},
+}
+
+// ParseExtensions returns the set of extensions named in s, separated by "+"
+// or ",", e.g. "compound+continue".  The valid names are "compound",
+// "continue", "safenav", "notequal", "types" and "all".
+func ParseExtensions(s string) (Extensions, error) {
+	var exts Extensions
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == '+' || r == ',' }) {
+		ext, ok := extensionByName(name)
+		if !ok {
+			return 0, fmt.Errorf("unknown syntax extension '%s'", name)
+		}
+		exts |= ext
+	}
+	return exts, nil
+}
+
+func extensionByName(name string) (Extensions, bool) {
+	if name == "all" {
+		return AllExtensions, true
+	}
+	for _, e := range extensionNames {
+		if e.name == name {
+			return e.ext, true
+		}
+	}
+	return 0, false
+}
+
+// String returns the names of the extensions in the set, separated by "+".
+func (e Extensions) String() string {
+	var names []string
+	for _, en := range extensionNames {
+		if e&en.ext != 0 {
+			names = append(names, en.name)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// Extensions returns the syntax extensions enabled in the scanner.  The parser
+// uses it to recognise the parts of the extended syntax that are made of
+// ordinary tokens, such as type annotations.
+func (l *Scanner) Extensions() Extensions {
+	return l.extensions
+}
+
+// acceptOpAssign consumes a "=" following a binary operator if the
+// CompoundAssignment extension is enabled, so that e.g. "+=" is scanned as one
+// token.
+func (l *Scanner) acceptOpAssign() bool {
+	return l.extensions&CompoundAssignment != 0 && l.acceptRune('=')
+}
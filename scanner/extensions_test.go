@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/arnodel/golua/token"
+)
+
+func TestScanner_extensions(t *testing.T) {
+	tests := []struct {
+		ext  Extensions
+		text string
+		toks []tok
+		err  string
+	}{
+		{
+			CompoundAssignment,
+			"x+=1 s..=t y//=2 z/=w",
+			[]tok{
+				{token.IDENT, "x", 0, 1, 1},
+				{token.SgOpAssign, "+=", 1, 1, 2},
+				{token.NUMDEC, "1", 3, 1, 4},
+				{token.IDENT, "s", 5, 1, 6},
+				{token.SgOpAssign, "..=", 6, 1, 7},
+				{token.IDENT, "t", 9, 1, 10},
+				{token.IDENT, "y", 11, 1, 12},
+				{token.SgOpAssign, "//=", 12, 1, 13},
+				{token.NUMDEC, "2", 15, 1, 16},
+				{token.IDENT, "z", 17, 1, 18},
+				{token.SgOpAssign, "/=", 18, 1, 19},
+				{token.IDENT, "w", 20, 1, 21},
+				{token.EOF, "", 21, 1, 22},
+			},
+			"",
+		},
+		{
+			0,
+			"x+=1",
+			[]tok{
+				{token.IDENT, "x", 0, 1, 1},
+				{token.SgPlus, "+", 1, 1, 2},
+				{token.SgAssign, "=", 2, 1, 3},
+			},
+			"",
+		},
+		{
+			Continue,
+			"continue",
+			[]tok{{token.KwContinue, "continue", 0, 1, 1}},
+			"",
+		},
+		{
+			0,
+			"continue",
+			[]tok{{token.IDENT, "continue", 0, 1, 1}},
+			"",
+		},
+		{
+			SafeNavigation,
+			"a?.b?[c]",
+			[]tok{
+				{token.IDENT, "a", 0, 1, 1},
+				{token.SgSafeDot, "?.", 1, 1, 2},
+				{token.IDENT, "b", 3, 1, 4},
+				{token.SgSafeOpenBkt, "?[", 4, 1, 5},
+				{token.IDENT, "c", 6, 1, 7},
+				{token.SgCloseSquareBkt, "]", 7, 1, 8},
+			},
+			"",
+		},
+		{
+			SafeNavigation,
+			"a?b",
+			[]tok{
+				{token.IDENT, "a", 0, 1, 1},
+				{token.INVALID, "?", 1, 1, 2},
+			},
+			"expected '.' or '[' after '?'",
+		},
+		{
+			0,
+			"a?.b",
+			[]tok{
+				{token.IDENT, "a", 0, 1, 1},
+				{token.INVALID, "?", 1, 1, 2},
+			},
+			"illegal character",
+		},
+		{
+			TypeAnnotations,
+			"x: T?",
+			[]tok{
+				{token.IDENT, "x", 0, 1, 1},
+				{token.SgColon, ":", 1, 1, 2},
+				{token.IDENT, "T", 3, 1, 4},
+				{token.SgQuestion, "?", 4, 1, 5},
+			},
+			"",
+		},
+		{
+			TypeAnnotations | SafeNavigation,
+			"a?.b?",
+			[]tok{
+				{token.IDENT, "a", 0, 1, 1},
+				{token.SgSafeDot, "?.", 1, 1, 2},
+				{token.IDENT, "b", 3, 1, 4},
+				{token.SgQuestion, "?", 4, 1, 5},
+			},
+			"",
+		},
+		{
+			NotEqual,
+			"a!=b",
+			[]tok{
+				{token.IDENT, "a", 0, 1, 1},
+				{token.SgNotEqual, "!=", 1, 1, 2},
+				{token.IDENT, "b", 3, 1, 4},
+			},
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.ext.String()+":"+test.text, func(t *testing.T) {
+			scanner := New("test", []byte(test.text), WithExtensions(test.ext))
+			for j, ts := range test.toks {
+				next := scanner.Scan()
+				if next == nil {
+					t.Fatalf("Token %d: scan returns nil", j+1)
+				}
+				if !reflect.DeepEqual(next, ts.Token()) {
+					t.Fatalf("Token %d: expected <%s>, got <%s>", j+1, tokenString(ts.Token()), tokenString(next))
+				}
+			}
+			if scanner.ErrorMsg() != test.err {
+				t.Fatalf("Wrong error message: expected %q, got %q", test.err, scanner.ErrorMsg())
+			}
+		})
+	}
+}
+
+func TestParseExtensions(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Extensions
+		err  string
+	}{
+		{"", 0, ""},
+		{"compound", CompoundAssignment, ""},
+		{"continue+safenav", Continue | SafeNavigation, ""},
+		{"notequal,compound", NotEqual | CompoundAssignment, ""},
+		{"all", AllExtensions, ""},
+		{"compound+foo", 0, "unknown syntax extension 'foo'"},
+	}
+	for _, test := range tests {
+		got, err := ParseExtensions(test.s)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: expected error %q, got %v", test.s, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.s, err)
+		} else if got != test.want {
+			t.Errorf("%q: expected %s, got %s", test.s, test.want, got)
+		}
+	}
+	if s := AllExtensions.String(); s != "compound+continue+safenav+notequal+types" {
+		t.Errorf("got %q", s)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"unicode/utf8"
 
+	"github.com/arnodel/golua/luaversion"
 	"github.com/arnodel/golua/token"
 )
 
@@ -18,6 +19,8 @@ type Scanner struct {
 	items            chan *token.Token // channel of scanned items.
 	state            stateFn
 	errorMsg         string
+	extensions       Extensions         // Opt-in syntax extensions
+	version          luaversion.Version // Version of the Lua language
 }
 
 type Option func(*Scanner)
@@ -37,15 +40,32 @@ func WithStartLine(l int) Option {
 	}
 }
 
+// WithExtensions enables the given syntax extensions (none are enabled by
+// default).
+func WithExtensions(ext Extensions) Option {
+	return func(s *Scanner) {
+		s.extensions |= ext
+	}
+}
+
+// WithVersion sets the version of the Lua language to scan (the default is
+// luaversion.Default).
+func WithVersion(v luaversion.Version) Option {
+	return func(s *Scanner) {
+		s.version = v
+	}
+}
+
 // New creates a new scanner for the input string.
 func New(name string, input []byte, opts ...Option) *Scanner {
 	l := &Scanner{
-		name:  name,
-		input: input,
-		state: scanToken,
-		items: make(chan *token.Token, 2), // Two items sufficient.
-		pos:   token.Pos{Line: 1, Column: 1},
-		start: token.Pos{Line: 1, Column: 1},
+		name:    name,
+		input:   input,
+		state:   scanToken,
+		items:   make(chan *token.Token, 2), // Two items sufficient.
+		pos:     token.Pos{Line: 1, Column: 1},
+		start:   token.Pos{Line: 1, Column: 1},
+		version: luaversion.Default,
 	}
 	for _, opt := range opts {
 		opt(l)
@@ -159,6 +179,20 @@ func (l *Scanner) errorf(tp token.Type, format string, args ...interface{}) stat
 	return nil
 }
 
+// Resync restarts the scan after an error token, from the point where the
+// error was detected.  It is used by the parser to recover from lexical errors.
+func (l *Scanner) Resync() {
+	if l.state != nil {
+		return
+	}
+	if l.pos.Offset == l.start.Offset {
+		// Make sure we make progress
+		l.next()
+	}
+	l.start = l.pos
+	l.state = scanToken
+}
+
 // Scan returns the next item from the input (or nil)
 func (l *Scanner) Scan() *token.Token {
 	for {
@@ -174,6 +208,12 @@ func (l *Scanner) Scan() *token.Token {
 	}
 }
 
+// Version returns the version of the Lua language being scanned.  The parser
+// uses it to recognise the syntax of that version.
+func (l *Scanner) Version() luaversion.Version {
+	return l.version
+}
+
 // ErrorMsg returns the current error message or an empty string if there is none.
 func (l *Scanner) ErrorMsg() string {
 	return l.errorMsg
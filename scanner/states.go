@@ -12,7 +12,11 @@ func scanToken(l *Scanner) stateFn {
 				return scanComment
 			}
 			l.backup()
-			l.emit(token.SgMinus)
+			if l.acceptOpAssign() {
+				l.emit(token.SgOpAssign)
+			} else {
+				l.emit(token.SgMinus)
+			}
 		case c == '"' || c == '\'':
 			return scanShortString(c)
 		case isDec(c):
@@ -32,7 +36,12 @@ func scanToken(l *Scanner) stateFn {
 			l.ignore()
 		default:
 			switch c {
-			case ';', '(', ')', ',', '|', '&', '+', '*', '%', '^', '#', ']', '{', '}':
+			case ';', '(', ')', ',', '|', '&', '#', ']', '{', '}':
+			case '+', '*', '%', '^':
+				if l.acceptOpAssign() {
+					l.emit(token.SgOpAssign)
+					return scanToken
+				}
 			case '=':
 				l.accept("=")
 			case ':':
@@ -41,8 +50,9 @@ func scanToken(l *Scanner) stateFn {
 				if accept(l, isDec, -1) > 0 {
 					return scanExp(l, isDec, "eE", token.NUMDEC)
 				}
-				if l.accept(".") {
-					l.accept(".")
+				if l.accept(".") && !l.accept(".") && l.acceptOpAssign() {
+					l.emit(token.SgOpAssign)
+					return scanToken
 				}
 			case '<':
 				l.accept("=<")
@@ -52,6 +62,31 @@ func scanToken(l *Scanner) stateFn {
 				l.accept("=")
 			case '/':
 				l.accept("/")
+				if l.acceptOpAssign() {
+					l.emit(token.SgOpAssign)
+					return scanToken
+				}
+			case '!':
+				if l.extensions&NotEqual == 0 || !l.acceptRune('=') {
+					return l.errorf(token.INVALID, "illegal character")
+				}
+				l.emit(token.SgNotEqual)
+				return scanToken
+			case '?':
+				safeNav := l.extensions&SafeNavigation != 0
+				switch {
+				case safeNav && l.acceptRune('.'):
+					l.emit(token.SgSafeDot)
+				case safeNav && l.acceptRune('['):
+					l.emit(token.SgSafeOpenBkt)
+				case l.extensions&TypeAnnotations != 0:
+					l.emit(token.SgQuestion)
+				case safeNav:
+					return l.errorf(token.INVALID, "expected '.' or '[' after '?'")
+				default:
+					return l.errorf(token.INVALID, "illegal character")
+				}
+				return scanToken
 			case -1:
 				l.emit(token.EOF)
 				return nil
@@ -303,6 +338,9 @@ func scanIdent(l *Scanner) stateFn {
 	tp, ok := kwType[string(l.lit())]
 	if !ok {
 		tp = token.IDENT
+		if l.extensions&Continue != 0 && string(l.lit()) == "continue" {
+			tp = token.KwContinue
+		}
 	}
 	l.emit(tp)
 	return scanToken
@@ -49,6 +49,7 @@ const (
 	KwTrue
 	KwFalse
 	KwReturn
+	KwContinue // Only with the scanner.Continue extension
 
 	SgEtc
 
@@ -65,6 +66,10 @@ const (
 	SgDoubleColon
 	SgAssign
 	SgHash
+	SgOpAssign    // e.g. "+=", only with the scanner.CompoundAssignment extension
+	SgSafeDot     // "?.", only with the scanner.SafeNavigation extension
+	SgSafeOpenBkt // "?[", only with the scanner.SafeNavigation extension
+	SgQuestion    // "?", only with the scanner.TypeAnnotations extension
 
 	beforeBinOp
 
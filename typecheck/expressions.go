@@ -0,0 +1,404 @@
+package typecheck
+
+import (
+	"fmt"
+
+	"github.com/arnodel/golua/ast"
+	"github.com/arnodel/golua/ops"
+)
+
+// exp checks e and returns its type (the type of its first value if it is a
+// function call).
+func (c *checker) exp(e ast.ExpNode) Type {
+	switch n := e.(type) {
+	case ast.Nil:
+		return nilType
+	case ast.Bool:
+		return booleanType
+	case ast.Int:
+		return integerType
+	case ast.Float:
+		return numberType
+	case ast.String:
+		return stringType
+	case ast.Etc:
+		return c.fn.sig.varargs
+	case ast.Name:
+		t, _ := c.varType(n.Val)
+		return t
+	case ast.Function:
+		return c.function(n)
+	case ast.TableConstructor:
+		return c.tableConstructorType(n)
+	case ast.IndexExp:
+		collType := c.exp(n.Coll)
+		keyType := c.exp(n.Idx)
+		if n.Safe && admitsNil(collType) {
+			if deref(withoutNil(collType)) == anyType {
+				return anyType
+			}
+			t, _ := c.index(withoutNil(collType), n.Idx, keyType, n)
+			return unionOf(t, nilType)
+		}
+		t, _ := c.index(collType, n.Idx, keyType, n)
+		return t
+	case ast.FunctionCall:
+		return firstValue(c.call(*n.BFunctionCall))
+	case ast.BFunctionCall:
+		return firstValue(c.call(n))
+	case *ast.BFunctionCall:
+		return firstValue(c.call(*n))
+	case ast.BinOp:
+		return c.binOp(n)
+	case *ast.BinOp:
+		return c.binOp(*n)
+	case ast.UnOp:
+		return c.unOp(n)
+	case *ast.UnOp:
+		return c.unOp(*n)
+	}
+	return anyType
+}
+
+func firstValue(types []Type, open bool) Type {
+	return valueType(types, open, 0)
+}
+
+// expList checks the expressions in es and returns the types of the values
+// they evaluate to.  If the last expression is a function call or "...", the
+// number of values may not be known, in which case open is true and there may
+// be more values, of type any.
+func (c *checker) expList(es []ast.ExpNode) (types []Type, open bool) {
+	for i, e := range es {
+		if i == len(es)-1 {
+			switch n := e.(type) {
+			case ast.FunctionCall:
+				ts, open := c.call(*n.BFunctionCall)
+				return append(types, ts...), open
+			case ast.Etc:
+				return types, true
+			}
+		}
+		types = append(types, c.exp(e))
+	}
+	return types, false
+}
+
+// call checks a function call and returns the types of the values it returns
+// (see expList for the meaning of open).
+func (c *checker) call(call ast.BFunctionCall) (types []Type, open bool) {
+	fType := c.exp(call.Target)
+	var argTypes []Type
+	selfArgs := 0
+	if call.Method.Val != "" {
+		method := ast.String{Location: call.Method.Location, Val: []byte(call.Method.Val)}
+		argTypes = []Type{fType}
+		selfArgs = 1
+		fType, _ = c.index(fType, method, stringType, call.Method)
+	}
+	ts, open := c.expList(call.Args)
+	argTypes = append(argTypes, ts...)
+	switch f := deref(fType).(type) {
+	case *funcSig:
+		c.checkArgs(f, call, argTypes, open, selfArgs)
+		if f.hasReturns {
+			return f.returns, false
+		}
+	case basicType:
+		switch f {
+		case anyType, functionType, tableType, userdataType:
+		default:
+			c.errorf(call.Target, "attempt to call a %s value", f)
+		}
+	}
+	// Tables may have a __call metamethod and the value may not be nil in a
+	// union, so we cannot say more in other cases.
+	return nil, true
+}
+
+func (c *checker) checkArgs(sig *funcSig, call ast.BFunctionCall, argTypes []Type, open bool, selfArgs int) {
+	name := calleeName(call)
+	for i := 0; i < len(argTypes) || i < len(sig.params); i++ {
+		paramType := sig.param(i)
+		if paramType == nil {
+			if !open {
+				c.errorf(call.Args[i-selfArgs], "too many arguments to %s (expected %d, got %d)",
+					name, len(sig.params)-selfArgs, len(argTypes)-selfArgs)
+			}
+			return
+		}
+		argNum := i + 1 - selfArgs
+		if i >= len(argTypes) {
+			if open {
+				return
+			}
+			if !admitsNil(paramType) {
+				c.errorf(call, "missing argument %d to %s (expected %s)", argNum, name, paramType)
+			}
+			continue
+		}
+		var (
+			arg     ast.ExpNode
+			subject string
+		)
+		if argNum > 0 {
+			arg = call.Args[argNum-1]
+			subject = fmt.Sprintf("argument %d of %s", argNum, name)
+		} else {
+			subject = fmt.Sprintf("self argument of %s", name)
+		}
+		c.checkValue(paramType, argTypes[i], arg, call.Target, subject)
+	}
+}
+
+// calleeName returns the name of the function called, for error messages.
+func calleeName(call ast.BFunctionCall) string {
+	name, ok := varName(call.Target)
+	if !ok {
+		return "function"
+	}
+	if call.Method.Val != "" {
+		name += ":" + call.Method.Val
+	}
+	return "'" + name + "'"
+}
+
+// varName returns the name of a variable made of names and field accesses,
+// e.g. "a.b.c".
+func varName(e ast.ExpNode) (string, bool) {
+	switch n := e.(type) {
+	case ast.Name:
+		return n.Val, true
+	case ast.IndexExp:
+		coll, ok := varName(n.Coll)
+		key, isName := fieldName(n.Idx)
+		if ok && isName && !n.Safe {
+			return coll + "." + key, true
+		}
+	}
+	return "", false
+}
+
+// fieldName returns the name of the field if key is a constant string.
+func fieldName(key ast.ExpNode) (string, bool) {
+	s, ok := key.(ast.String)
+	if !ok {
+		return "", false
+	}
+	return string(s.Val), true
+}
+
+// index returns the type of coll[key] (the key has type keyType) and a
+// description of the field for error messages.
+func (c *checker) index(coll Type, key ast.ExpNode, keyType Type, where ast.Locator) (Type, string) {
+	name, isName := fieldName(key)
+	subject := "index"
+	if isName {
+		subject = fmt.Sprintf("field '%s'", name)
+	}
+	switch t := deref(coll).(type) {
+	case basicType:
+		switch t {
+		case anyType, stringType, tableType, userdataType:
+		default:
+			c.errorf(where, "attempt to index a %s value", t)
+		}
+	case *funcSig:
+		c.errorf(where, "attempt to index a function value")
+	case *tableShape:
+		if isName {
+			if f := t.field(name); f != nil {
+				return f, subject
+			}
+		}
+		switch k := deref(keyType); {
+		case t.elem != nil && (k == integerType || k == numberType):
+			return t.elem, subject
+		case t.key != nil && assignable(t.key, keyType):
+			return t.value, subject
+		case t.open || k == anyType:
+		case isName:
+			c.errorf(where, "no field '%s' in %s", name, coll)
+		case t.key != nil:
+			c.errorf(key, "index: expected %s, got %s", t.key, keyType)
+		}
+	}
+	return anyType, subject
+}
+
+// tableConstructorType returns the shape of the table built by tc.
+func (c *checker) tableConstructorType(tc ast.TableConstructor) *tableShape {
+	shape := &tableShape{open: true}
+	var elemTypes, keyTypes, valueTypes []Type
+	for i, f := range tc.Fields {
+		if _, ok := f.Key.(ast.NoTableKey); ok {
+			if i == len(tc.Fields)-1 {
+				ts, open := c.expList([]ast.ExpNode{f.Value})
+				if open {
+					ts = append(ts, anyType)
+				}
+				elemTypes = append(elemTypes, ts...)
+			} else {
+				elemTypes = append(elemTypes, c.exp(f.Value))
+			}
+			continue
+		}
+		keyType := c.exp(f.Key)
+		valueType := c.exp(f.Value)
+		if name, ok := fieldName(f.Key); ok {
+			shape.fields = append(shape.fields, fieldType{name: name, t: valueType})
+		} else {
+			keyTypes = append(keyTypes, keyType)
+			valueTypes = append(valueTypes, valueType)
+		}
+	}
+	if len(elemTypes) > 0 {
+		shape.elem = unionOf(elemTypes...)
+	}
+	if len(keyTypes) > 0 {
+		shape.key = unionOf(keyTypes...)
+		shape.value = unionOf(valueTypes...)
+	}
+	return shape
+}
+
+//
+// Operators
+//
+
+func (c *checker) binOp(b ast.BinOp) Type {
+	t := c.exp(b.Left)
+	left := ast.Locator(b.Left)
+	for _, r := range b.Right {
+		rt := c.exp(r.Operand)
+		t = c.binary(r.Op, t, rt, left, r.Operand)
+		left = ast.MergeLocations(left, r.Operand)
+	}
+	return t
+}
+
+func (c *checker) binary(op ops.Op, lt, rt Type, left, right ast.Locator) Type {
+	switch op {
+	case ops.OpAnd:
+		if deref(lt) == nilType {
+			return nilType
+		}
+		if admitsNil(lt) {
+			return unionOf(rt, nilType)
+		}
+		return rt
+	case ops.OpOr:
+		return unionOf(withoutNil(lt), rt)
+	case ops.OpEq, ops.OpNeq:
+		return booleanType
+	case ops.OpLt, ops.OpLeq, ops.OpGt, ops.OpGeq:
+		c.checkComparison(lt, rt, left, right)
+		return booleanType
+	case ops.OpConcat:
+		ok := c.checkOperand(lt, left, "concatenate") && c.checkOperand(rt, right, "concatenate")
+		if ok && isStringOrNumber(lt) && isStringOrNumber(rt) {
+			return stringType
+		}
+		return anyType
+	case ops.OpBitAnd, ops.OpBitOr, ops.OpBitXor, ops.OpShiftL, ops.OpShiftR:
+		ok := c.checkOperand(lt, left, "perform bitwise operation on") && c.checkOperand(rt, right, "perform bitwise operation on")
+		if ok && isStringOrNumber(lt) && isStringOrNumber(rt) {
+			return integerType
+		}
+		return anyType
+	default:
+		// Arithmetic
+		ok := c.checkOperand(lt, left, "perform arithmetic on") && c.checkOperand(rt, right, "perform arithmetic on")
+		if !ok || !isStringOrNumber(lt) || !isStringOrNumber(rt) {
+			return anyType
+		}
+		switch op {
+		case ops.OpAdd, ops.OpSub, ops.OpMul, ops.OpFloorDiv, ops.OpMod:
+			if deref(lt) == integerType && deref(rt) == integerType {
+				return integerType
+			}
+		}
+		return numberType
+	}
+}
+
+func (c *checker) unOp(u ast.UnOp) Type {
+	t := c.exp(u.Operand)
+	switch u.Op {
+	case ops.OpNot:
+		return booleanType
+	case ops.OpLen:
+		switch deref(t) {
+		case nilType, booleanType, numberType, integerType, functionType:
+			c.errorf(u.Operand, "attempt to get length of a %s value", t)
+		}
+		if _, ok := deref(t).(*funcSig); ok {
+			c.errorf(u.Operand, "attempt to get length of a function value")
+		}
+		return integerType
+	case ops.OpNeg:
+		if c.checkOperand(t, u.Operand, "perform arithmetic on") && isStringOrNumber(t) {
+			if deref(t) == integerType {
+				return integerType
+			}
+			return numberType
+		}
+	case ops.OpBitNot:
+		if c.checkOperand(t, u.Operand, "perform bitwise operation on") && isStringOrNumber(t) {
+			return integerType
+		}
+	case ops.OpId:
+		return t
+	}
+	return anyType
+}
+
+// checkOperand reports an error if t cannot be an operand of an arithmetic,
+// bitwise or concatenation operator: values of type nil, boolean or function
+// are not allowed (tables and userdata may have metamethods).
+func (c *checker) checkOperand(t Type, where ast.Locator, action string) bool {
+	switch d := deref(t).(type) {
+	case basicType:
+		switch d {
+		case nilType, booleanType, functionType:
+			c.errorf(where, "attempt to %s a %s value", action, d)
+			return false
+		}
+	case *funcSig:
+		c.errorf(where, "attempt to %s a function value", action)
+		return false
+	}
+	return true
+}
+
+func (c *checker) checkComparison(lt, rt Type, left, right ast.Locator) {
+	l, r := deref(lt), deref(rt)
+	isNumber := func(t Type) bool { return t == numberType || t == integerType }
+	switch {
+	case l == anyType || r == anyType:
+	case isNumber(l) && isNumber(r), l == stringType && r == stringType:
+	case isNumber(l) || l == stringType || isNumber(r) || r == stringType:
+		if !isTableLike(l) && !isTableLike(r) {
+			c.errorf(ast.MergeLocations(left, right), "attempt to compare %s with %s", lt, rt)
+		}
+	}
+}
+
+func isStringOrNumber(t Type) bool {
+	switch deref(t) {
+	case stringType, numberType, integerType:
+		return true
+	}
+	return false
+}
+
+// isTableLike returns true if values of type t may have metamethods.
+func isTableLike(t Type) bool {
+	switch d := deref(t).(type) {
+	case basicType:
+		return d == tableType || d == userdataType
+	case *tableShape, *unionType:
+		return true
+	}
+	return false
+}
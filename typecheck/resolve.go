@@ -0,0 +1,122 @@
+package typecheck
+
+import (
+	"github.com/arnodel/golua/ast"
+)
+
+// declareTypeAliases declares the type aliases in b (but not in nested
+// blocks) in the current scope, so that they can be used anywhere in b.
+func (c *checker) declareTypeAliases(b ast.BlockStat) {
+	var stats []ast.TypeAliasStat
+	for _, s := range b.Stats {
+		ta, ok := s.(ast.TypeAliasStat)
+		if !ok {
+			continue
+		}
+		name := ta.Name.Val
+		if _, ok := builtinTypes[name]; ok {
+			c.errorf(ta.Name, "cannot redefine builtin type '%s'", name)
+			continue
+		}
+		if c.scope.types == nil {
+			c.scope.types = map[string]*aliasType{}
+		}
+		if _, ok := c.scope.types[name]; ok {
+			c.errorf(ta.Name, "type alias '%s' already declared", name)
+			continue
+		}
+		c.scope.types[name] = &aliasType{name: name}
+		stats = append(stats, ta)
+	}
+	for _, ta := range stats {
+		c.scope.types[ta.Name.Val].t = c.resolve(ta.Type)
+	}
+	// An alias to itself (directly or via other aliases, e.g. "type A = B"
+	// and "type B = A") would make deref loop forever.
+	var cyclic []*aliasType
+	for _, ta := range stats {
+		a := c.scope.types[ta.Name.Val]
+		seen := map[*aliasType]bool{}
+		for t := a.t; ; {
+			next, ok := t.(*aliasType)
+			if !ok || seen[next] {
+				break
+			}
+			if next == a {
+				c.errorf(ta.Name, "type alias '%s' refers to itself", a.name)
+				cyclic = append(cyclic, a)
+				break
+			}
+			seen[next] = true
+			t = next.t
+		}
+	}
+	for _, a := range cyclic {
+		a.t = anyType
+	}
+}
+
+func (c *checker) lookupAlias(name string) *aliasType {
+	for s := c.scope; s != nil; s = s.parent {
+		if a, ok := s.types[name]; ok {
+			return a
+		}
+	}
+	return nil
+}
+
+// resolve returns the type described by a type annotation.
+func (c *checker) resolve(t ast.TypeExp) Type {
+	switch n := t.(type) {
+	case ast.NamedType:
+		if b, ok := builtinTypes[n.Name]; ok {
+			return b
+		}
+		if a := c.lookupAlias(n.Name); a != nil {
+			return a
+		}
+		c.errorf(n, "unknown type '%s'", n.Name)
+	case ast.OptionalType:
+		return unionOf(c.resolve(n.Type), nilType)
+	case ast.UnionType:
+		types := make([]Type, len(n.Types))
+		for i, m := range n.Types {
+			types[i] = c.resolve(m)
+		}
+		return unionOf(types...)
+	case ast.TableType:
+		shape := &tableShape{}
+		for _, f := range n.Fields {
+			if shape.field(f.Name.Val) != nil {
+				c.errorf(f.Name, "duplicate field '%s'", f.Name.Val)
+				continue
+			}
+			shape.fields = append(shape.fields, fieldType{name: f.Name.Val, t: c.resolve(f.Type)})
+		}
+		if n.Elem != nil {
+			shape.elem = c.resolve(n.Elem)
+		}
+		if n.Key != nil {
+			shape.key = c.resolve(n.Key)
+			shape.value = c.resolve(n.Value)
+		}
+		return shape
+	case ast.FunctionType:
+		sig := &funcSig{hasDots: n.HasDots, varargs: anyType, hasReturns: n.HasReturns}
+		for _, p := range n.Params {
+			var pt Type = anyType
+			if p != nil {
+				pt = c.resolve(p)
+			}
+			sig.params = append(sig.params, pt)
+		}
+		if n.Varargs != nil {
+			sig.varargs = c.resolve(n.Varargs)
+		}
+		for _, r := range n.Returns {
+			sig.returns = append(sig.returns, c.resolve(r))
+		}
+		return sig
+	}
+	return anyType
+}
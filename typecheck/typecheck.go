@@ -0,0 +1,399 @@
+// Package typecheck implements a type checker for Lua code with type
+// annotations (see scanner.TypeAnnotations), e.g.
+//
+//	type Point = {x: number, y: number}
+//
+//	local function dist(p: Point, q: Point): number
+//	    return ((p.x - q.x) ^ 2 + (p.y - q.y) ^ 2) ^ 0.5
+//	end
+//
+// The checker is flow-insensitive: a variable has the same type everywhere in
+// its scope, namely its annotation.  Variables and parameters without an
+// annotation, as well as global variables, have type "any", which is
+// compatible with all types.  So code without annotations type checks without
+// errors.
+//
+// The following types can be used in annotations:
+//
+//   - the basic types any, nil, boolean, number, integer (a subtype of
+//     number), string, table, function, thread and userdata;
+//   - optional types "T?", i.e. T or nil, and unions "T1 | T2";
+//   - table shapes with named fields "{x: number, y: number}", an array part
+//     "{string}" and a map part "{[string]: boolean}", which can be combined;
+//   - function signatures, e.g. "function(number, ...: string): (boolean,
+//     string?)";
+//   - type aliases declared with "type Name = T" in the current block or an
+//     enclosing one (they may be used before their declaration and be
+//     recursive).
+package typecheck
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/arnodel/golua/ast"
+)
+
+// An Error is a type error found by the checker.
+type Error struct {
+	Where   ast.Locator
+	Message string
+}
+
+func (e Error) Error() string {
+	loc := e.Where.Locate().StartPos()
+	if loc == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d: %s", loc.Line, loc.Column, e.Message)
+}
+
+// Check type checks a chunk and returns the errors found, in source order.
+func Check(chunk ast.BlockStat) []Error {
+	c := &checker{fn: &funcContext{sig: &funcSig{hasDots: true, varargs: anyType}}}
+	c.pushScope()
+	c.blockContents(chunk, true)
+	sort.SliceStable(c.errs, func(i, j int) bool {
+		pi, pj := c.errs[i].Where.Locate().StartPos(), c.errs[j].Where.Locate().StartPos()
+		return pi != nil && pj != nil && pi.Offset < pj.Offset
+	})
+	return c.errs
+}
+
+type checker struct {
+	scope *scope
+	fn    *funcContext
+	errs  []Error
+}
+
+// A scope contains the local variables and type aliases declared in a block.
+type scope struct {
+	parent *scope
+	vars   map[string]Type
+	types  map[string]*aliasType
+}
+
+// funcContext is the function whose body is being checked.
+type funcContext struct {
+	sig *funcSig
+}
+
+func (c *checker) errorf(where ast.Locator, format string, args ...interface{}) {
+	c.errs = append(c.errs, Error{Where: where, Message: fmt.Sprintf(format, args...)})
+}
+
+// quietly runs f, dropping the errors it reports.
+func (c *checker) quietly(f func()) {
+	n := len(c.errs)
+	f()
+	c.errs = c.errs[:n]
+}
+
+func (c *checker) pushScope() {
+	c.scope = &scope{parent: c.scope, vars: map[string]Type{}}
+}
+
+func (c *checker) popScope() {
+	c.scope = c.scope.parent
+}
+
+func (c *checker) declareVar(name string, t Type) {
+	c.scope.vars[name] = t
+}
+
+// varType returns the type of the variable with the given name.  Global
+// variables have type any.
+func (c *checker) varType(name string) (Type, bool) {
+	for s := c.scope; s != nil; s = s.parent {
+		if t, ok := s.vars[name]; ok {
+			return t, true
+		}
+	}
+	return anyType, false
+}
+
+//
+// Statements
+//
+
+// block checks the statements in b.  If inScope is true, the block's scope
+// has already been pushed (e.g. it contains the loop variable of a for loop).
+func (c *checker) block(b ast.BlockStat, inScope bool) {
+	if !inScope {
+		c.pushScope()
+		defer c.popScope()
+	}
+	c.blockContents(b, false)
+}
+
+func (c *checker) blockContents(b ast.BlockStat, isFuncBody bool) {
+	c.declareTypeAliases(b)
+	for _, s := range b.Stats {
+		c.stat(s)
+	}
+	if b.Return != nil {
+		c.returnStat(b, isFuncBody)
+	}
+}
+
+func (c *checker) stat(s ast.Stat) {
+	switch n := s.(type) {
+	case ast.AssignStat:
+		c.assignStat(n)
+	case ast.BlockStat:
+		c.block(n, false)
+	case ast.CompoundAssignStat:
+		t := c.exp(n.Operation())
+		c.assignTo(n.Dest, t, n.Value)
+	case ast.FunctionCall:
+		c.call(*n.BFunctionCall)
+	case ast.ForStat:
+		c.forStat(n)
+	case *ast.ForStat:
+		c.forStat(*n)
+	case ast.ForInStat:
+		c.forInStat(n)
+	case *ast.ForInStat:
+		c.forInStat(*n)
+	case ast.IfStat:
+		c.condStat(n.If)
+		for _, s := range n.ElseIfs {
+			c.condStat(s)
+		}
+		if n.Else != nil {
+			c.block(*n.Else, false)
+		}
+	case ast.GlobalFunctionStat:
+		c.function(n.Function)
+	case ast.GlobalStat:
+		c.expList(n.Values)
+	case ast.LocalFunctionStat:
+		c.declareVar(n.Name.Val, c.signature(n.Function))
+		c.function(n.Function)
+	case ast.LocalStat:
+		c.localStat(n)
+	case ast.RepeatStat:
+		// The condition is in the scope of the body
+		c.pushScope()
+		c.block(n.Body, true)
+		c.exp(n.Cond)
+		c.popScope()
+	case ast.WhileStat:
+		c.condStat(n.CondStat)
+	default:
+		// Other statements (e.g. goto, break, type aliases) have nothing to
+		// check.
+	}
+}
+
+func (c *checker) condStat(s ast.CondStat) {
+	c.exp(s.Cond)
+	c.block(s.Body, false)
+}
+
+func (c *checker) localStat(s ast.LocalStat) {
+	types, open := c.expList(s.Values)
+	for i, na := range s.NameAttribs {
+		var t Type = anyType
+		if na.Type != nil {
+			t = c.resolve(na.Type)
+			if len(s.Values) > 0 {
+				var val ast.ExpNode
+				if i < len(s.Values) {
+					val = s.Values[i]
+				}
+				c.checkValue(t, valueType(types, open, i), val, na, fmt.Sprintf("local '%s'", na.Name.Val))
+			}
+		}
+		c.declareVar(na.Name.Val, t)
+	}
+}
+
+func (c *checker) assignStat(s ast.AssignStat) {
+	types, open := c.expList(s.Src)
+	for i, dst := range s.Dest {
+		var val ast.ExpNode
+		if i < len(s.Src) {
+			val = s.Src[i]
+		}
+		c.assignTo(dst, valueType(types, open, i), val)
+	}
+}
+
+// assignTo checks the assignment of a value of type t to dst.  The value is
+// the expression val if it is not nil.
+func (c *checker) assignTo(dst ast.Var, t Type, val ast.ExpNode) {
+	switch v := dst.(type) {
+	case ast.Name:
+		if varType, ok := c.varType(v.Val); ok {
+			c.checkValue(varType, t, val, v, fmt.Sprintf("variable '%s'", v.Val))
+		}
+	case ast.IndexExp:
+		collType := c.exp(v.Coll)
+		keyType := c.exp(v.Idx)
+		fieldType, subject := c.index(collType, v.Idx, keyType, v)
+		c.checkValue(fieldType, t, val, v, subject)
+	}
+}
+
+// valueType returns the type of the i-th value in a list of values whose types
+// are given by types (and the remaining values have type any if open is
+// true).
+func valueType(types []Type, open bool, i int) Type {
+	switch {
+	case i < len(types):
+		return types[i]
+	case open:
+		return anyType
+	default:
+		return nilType
+	}
+}
+
+// checkValue reports an error if a value of type t cannot be assigned to
+// dstType.  If val is the table constructor for the value, its fields are
+// checked individually, which gives more precise errors.
+func (c *checker) checkValue(dstType, t Type, val ast.ExpNode, where ast.Locator, subject string) {
+	if tc, ok := val.(ast.TableConstructor); ok {
+		if shape, ok := deref(withoutNil(dstType)).(*tableShape); ok {
+			c.checkTableConstructor(shape, tc, subject)
+			return
+		}
+	}
+	if val != nil {
+		where = val
+	}
+	if !assignable(dstType, t) {
+		c.errorf(where, "%s: expected %s, got %s", subject, dstType, t)
+	}
+}
+
+func (c *checker) checkTableConstructor(shape *tableShape, tc ast.TableConstructor, subject string) {
+	// The fields have already been checked as expressions, so errors found
+	// when computing their types again are dropped.
+	var lit *tableShape
+	c.quietly(func() { lit = c.tableConstructorType(tc) })
+	for _, f := range tc.Fields {
+		if name, ok := fieldName(f.Key); ok {
+			fieldType := shape.field(name)
+			switch {
+			case fieldType != nil:
+				c.checkValue(fieldType, lit.field(name), f.Value, f.Value, fmt.Sprintf("field '%s'", name))
+			case shape.key != nil:
+				c.checkValue(shape.value, lit.field(name), f.Value, f.Value, fmt.Sprintf("field '%s'", name))
+			}
+		}
+	}
+	for _, f := range shape.fields {
+		if lit.field(f.name) == nil && !admitsNil(f.t) {
+			c.errorf(tc, "%s: missing field '%s' of type %s", subject, f.name, f.t)
+		}
+	}
+	rest := &tableShape{elem: lit.elem, key: lit.key, value: lit.value}
+	restDst := &tableShape{elem: shape.elem, key: shape.key, value: shape.value}
+	if !shapeAssignable(restDst, rest, map[typePair]bool{}) {
+		c.errorf(tc, "%s: expected %s, got %s", subject, shape, lit)
+	}
+}
+
+func (c *checker) returnStat(b ast.BlockStat, isFuncBody bool) {
+	types, open := c.expList(b.Return)
+	sig := c.fn.sig
+	if !sig.hasReturns {
+		return
+	}
+	if len(b.Return) == 0 && isFuncBody {
+		// The implicit return at the end of a function body is not checked
+		// as the checker does not know if it is reachable.
+		return
+	}
+	where := ast.Locator(b)
+	if len(b.Return) > 0 {
+		where = ast.MergeLocations(b.Return[0], b.Return[len(b.Return)-1])
+	}
+	for i, r := range sig.returns {
+		if i >= len(types) && open {
+			break
+		}
+		var val ast.ExpNode
+		if i < len(b.Return) {
+			val = b.Return[i]
+		}
+		t := valueType(types, open, i)
+		if val == nil && !assignable(r, t) {
+			c.errorf(where, "missing return value %d of type %s", i+1, r)
+			continue
+		}
+		c.checkValue(r, t, val, where, fmt.Sprintf("return value %d", i+1))
+	}
+	if len(types) > len(sig.returns) {
+		c.errorf(b.Return[len(sig.returns)], "too many return values (expected %d, got %d)", len(sig.returns), len(types))
+	}
+}
+
+func (c *checker) forStat(s ast.ForStat) {
+	varType := Type(integerType)
+	for i, e := range []ast.ExpNode{s.Start, s.Stop, s.Step} {
+		t := c.exp(e)
+		switch d := deref(t); {
+		case d == integerType:
+		case d == numberType:
+			if i != 1 {
+				varType = numberType
+			}
+		case assignable(numberType, t):
+			varType = anyType
+		default:
+			c.errorf(e, "'for' %s value must be a number, got %s", [...]string{"initial", "limit", "step"}[i], t)
+			varType = anyType
+		}
+	}
+	c.pushScope()
+	c.declareVar(s.Var.Val, varType)
+	c.block(s.Body, true)
+	c.popScope()
+}
+
+func (c *checker) forInStat(s ast.ForInStat) {
+	c.expList(s.Params)
+	c.pushScope()
+	for _, v := range s.Vars {
+		c.declareVar(v.Val, anyType)
+	}
+	c.block(s.Body, true)
+	c.popScope()
+}
+
+//
+// Functions
+//
+
+// signature returns the type of f according to its annotations.
+func (c *checker) signature(f ast.Function) Type {
+	if f.Signature == nil {
+		return functionType
+	}
+	return c.resolve(*f.Signature)
+}
+
+// function checks the body of f and returns its type.
+func (c *checker) function(f ast.Function) Type {
+	t := c.signature(f)
+	sig, ok := t.(*funcSig)
+	if !ok {
+		sig = &funcSig{hasDots: f.HasDots, varargs: anyType}
+		for range f.Params {
+			sig.params = append(sig.params, anyType)
+		}
+	}
+	saved := c.fn
+	c.fn = &funcContext{sig: sig}
+	c.pushScope()
+	for i, param := range f.Params {
+		c.declareVar(param.Val, sig.params[i])
+	}
+	c.blockContents(f.Body, true)
+	c.popScope()
+	c.fn = saved
+	return t
+}
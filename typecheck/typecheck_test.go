@@ -0,0 +1,190 @@
+package typecheck
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/arnodel/golua/parsing"
+	"github.com/arnodel/golua/scanner"
+)
+
+func check(t *testing.T, src string) []string {
+	t.Helper()
+	chunk, err := parsing.ParseChunk(scanner.New("test", []byte(src), scanner.WithExtensions(scanner.TypeAnnotations)))
+	if err != nil {
+		t.Fatalf("error parsing %q: %s", src, err)
+	}
+	var msgs []string
+	for _, err := range Check(chunk) {
+		msgs = append(msgs, err.Error())
+	}
+	return msgs
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "unannotated code",
+			src:  "local x = 1\nx = 'hello'\nprint(x.y, #x)",
+		},
+		{
+			name: "local",
+			src:  "local x: number = 'hi'\nlocal y: string?\nlocal z: integer = 1.5",
+			want: []string{
+				"1:19: local 'x': expected number, got string",
+				"3:20: local 'z': expected integer, got number",
+			},
+		},
+		{
+			name: "assignment",
+			src:  "local x: number = 1\nx = x + 1\nx = nil",
+			want: []string{"3:5: variable 'x': expected number, got nil"},
+		},
+		{
+			name: "table shape",
+			src: `type Point = {x: number, y: number}
+local p: Point = {x = 1, y = 'two'}
+local q: Point = {x = 1}
+p.z = 3
+p.x = 2.5`,
+			want: []string{
+				"2:30: field 'y': expected number, got string",
+				"3:18: local 'q': missing field 'y' of type number",
+				"4:1: no field 'z' in Point",
+			},
+		},
+		{
+			name: "arrays and maps",
+			src: `local a: {string} = {'a', 'b', 3}
+local m: {[string]: boolean} = {x = true, y = 1}
+local s: string = a[1]`,
+			want: []string{
+				"1:21: local 'a': expected {string}, got {string | integer}",
+				"2:47: field 'y': expected boolean, got integer",
+			},
+		},
+		{
+			name: "function calls",
+			src: `local function f(x: number, y: string?): string
+    return y or tostring(x)
+end
+f(1)
+f('a')
+f()
+f(1, 'a', 2)
+local n: number = f(1)`,
+			want: []string{
+				"5:3: argument 1 of 'f': expected number, got string",
+				"6:1: missing argument 1 to 'f' (expected number)",
+				"7:11: too many arguments to 'f' (expected 2, got 3)",
+				"8:19: local 'n': expected number, got string",
+			},
+		},
+		{
+			name: "returns",
+			src: `local function f(): (number, string)
+    if x then return 1 end
+    if y then return 1, 2 end
+    return 1, 'a', true
+end`,
+			want: []string{
+				"2:22: missing return value 2 of type string",
+				"3:25: return value 2: expected string, got integer",
+				"4:20: too many return values (expected 2, got 3)",
+			},
+		},
+		{
+			name: "methods",
+			src: `type Counter = {n: integer, incr: function(Counter, integer)}
+local c: Counter = {n = 0}
+function c:incr(k: integer)
+    self.n = self.n + k
+end
+c:incr('x')`,
+			want: []string{
+				"2:20: local 'c': missing field 'incr' of type function(Counter, integer)",
+				"6:8: argument 1 of 'c:incr': expected integer, got string",
+			},
+		},
+		{
+			name: "operators",
+			src: `local b: boolean = true
+local x = b + 1
+local s = nil .. 'x'
+local l = #3
+local c = 1 < 'a'
+local i: integer = 7 // 2
+local f: integer = 7 / 2`,
+			want: []string{
+				"2:11: attempt to perform arithmetic on a boolean value",
+				"3:11: attempt to concatenate a nil value",
+				"4:12: attempt to get length of a integer value",
+				"5:11: attempt to compare integer with string",
+				"7:22: local 'f': expected integer, got number",
+			},
+		},
+		{
+			name: "calling and indexing",
+			src:  "local n: number = 1\nn()\nlocal y = n.x",
+			want: []string{
+				"2:1: attempt to call a number value",
+				"3:11: attempt to index a number value",
+			},
+		},
+		{
+			name: "optional values",
+			src: `local function find(k: string): number?
+    return nil
+end
+local a: number = find('x')
+local b: number = find('x') or 0`,
+			want: []string{"4:19: local 'a': expected number, got number?"},
+		},
+		{
+			name: "for loops",
+			src: `for i = 1, 10 do
+    local s: string = i
+end
+for i = 1, 'x' do end`,
+			want: []string{
+				"2:23: local 's': expected string, got integer",
+				"4:12: 'for' limit value must be a number, got string",
+			},
+		},
+		{
+			name: "aliases",
+			src: `type List = {value: number, next: List?}
+local l: List = {value = 1, next = {value = 2}}
+local m: List = {value = 1, next = {value = 'x'}}
+type A = B
+type B = A
+type number = string
+local u: Unknown`,
+			want: []string{
+				"3:45: field 'value': expected number, got string",
+				"4:6: type alias 'A' refers to itself",
+				"5:6: type alias 'B' refers to itself",
+				"6:6: cannot redefine builtin type 'number'",
+				"7:10: unknown type 'Unknown'",
+			},
+		},
+		{
+			name: "function values",
+			src: `local f: function(number): string = function(x: number): string return '' end
+local g: function(string) = f`,
+			want: []string{"2:29: local 'g': expected function(string), got function(number): string"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := check(t, tt.src)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("Check() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
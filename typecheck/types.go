@@ -0,0 +1,428 @@
+package typecheck
+
+import (
+	"strings"
+)
+
+// Type is the type of a value as known by the checker.  Its implementations
+// are basicType, *tableShape, *funcSig, *unionType and *aliasType.  They are
+// all comparable with ==.
+type Type interface {
+	String() string
+}
+
+type basicType uint8
+
+const (
+	anyType basicType = iota // Unknown: compatible with all types
+	nilType
+	booleanType
+	numberType
+	integerType // A subtype of numberType
+	stringType
+	tableType    // A table of unknown shape
+	functionType // A function of unknown signature
+	threadType
+	userdataType
+)
+
+var basicTypeNames = [...]string{
+	anyType:      "any",
+	nilType:      "nil",
+	booleanType:  "boolean",
+	numberType:   "number",
+	integerType:  "integer",
+	stringType:   "string",
+	tableType:    "table",
+	functionType: "function",
+	threadType:   "thread",
+	userdataType: "userdata",
+}
+
+// builtinTypes maps the names that can be used in annotations to the basic
+// types.
+var builtinTypes = map[string]Type{}
+
+func init() {
+	for t, name := range basicTypeNames {
+		builtinTypes[name] = basicType(t)
+	}
+}
+
+func (t basicType) String() string {
+	return basicTypeNames[t]
+}
+
+// A tableShape is the type of a table whose fields are known.
+type tableShape struct {
+	fields     []fieldType
+	elem       Type // The type of the items in the array part, or nil
+	key, value Type // The types of the map part, or nil
+
+	// A table shape inferred from a table constructor is open: other fields
+	// may be added to the table later, so indexing it with an unknown field
+	// is not an error.
+	open bool
+}
+
+type fieldType struct {
+	name string
+	t    Type
+}
+
+func (t *tableShape) field(name string) Type {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f.t
+		}
+	}
+	return nil
+}
+
+func (t *tableShape) String() string {
+	var items []string
+	if t.elem != nil {
+		items = append(items, t.elem.String())
+	}
+	if t.key != nil {
+		items = append(items, "["+t.key.String()+"]: "+t.value.String())
+	}
+	for _, f := range t.fields {
+		items = append(items, f.name+": "+f.t.String())
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+// A funcSig is the type of a function whose signature is known.
+type funcSig struct {
+	params     []Type
+	hasDots    bool
+	varargs    Type // The type of "..." if hasDots is true
+	returns    []Type
+	hasReturns bool // If false, the return values are unknown
+}
+
+// param returns the type of the i-th parameter (starting from 0), or nil if
+// the function takes no more than i arguments.
+func (t *funcSig) param(i int) Type {
+	switch {
+	case i < len(t.params):
+		return t.params[i]
+	case t.hasDots:
+		return t.varargs
+	default:
+		return nil
+	}
+}
+
+func (t *funcSig) String() string {
+	var b strings.Builder
+	b.WriteString("function(")
+	for i, p := range t.params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(p.String())
+	}
+	if t.hasDots {
+		if len(t.params) > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("...")
+		if t.varargs != anyType {
+			b.WriteString(": " + t.varargs.String())
+		}
+	}
+	b.WriteString(")")
+	if t.hasReturns {
+		b.WriteString(": ")
+		if len(t.returns) == 1 {
+			b.WriteString(t.returns[0].String())
+		} else {
+			b.WriteString("(" + typeListString(t.returns) + ")")
+		}
+	}
+	return b.String()
+}
+
+// A unionType is the type of values which can be of any of its member types.
+// Unions are built with unionOf, so they have at least two members and no
+// member is a union or any.
+type unionType struct {
+	types []Type
+}
+
+func (t *unionType) String() string {
+	// Write "T?" rather than "T | nil"
+	if len(t.types) == 2 && t.types[1] == nilType {
+		s := t.types[0].String()
+		if _, ok := deref(t.types[0]).(*funcSig); ok {
+			s = "(" + s + ")"
+		}
+		return s + "?"
+	}
+	items := make([]string, len(t.types))
+	for i, m := range t.types {
+		items[i] = m.String()
+		if _, ok := deref(m).(*funcSig); ok {
+			items[i] = "(" + items[i] + ")"
+		}
+	}
+	return strings.Join(items, " | ")
+}
+
+// An aliasType is a type declared with "type Name = T".  Its type is resolved
+// after all the aliases in a block are declared, so that aliases can refer to
+// each other.
+type aliasType struct {
+	name string
+	t    Type
+}
+
+func (t *aliasType) String() string {
+	return t.name
+}
+
+// deref returns the type that t is an alias for, if t is an alias.
+func deref(t Type) Type {
+	for {
+		a, ok := t.(*aliasType)
+		if !ok {
+			return t
+		}
+		t = a.t
+	}
+}
+
+// unionOf returns the union of the given types.  If one of them is any, the
+// result is any.  Nested unions are flattened, duplicates are removed and
+// integer is absorbed by number.
+func unionOf(types ...Type) Type {
+	var members []Type
+	hasNumber := false
+	var add func(t Type)
+	add = func(t Type) {
+		if u, ok := deref(t).(*unionType); ok {
+			for _, m := range u.types {
+				add(m)
+			}
+			return
+		}
+		for _, m := range members {
+			if m == t {
+				return
+			}
+		}
+		if deref(t) == numberType {
+			hasNumber = true
+		}
+		members = append(members, t)
+	}
+	for _, t := range types {
+		if deref(t) == anyType {
+			return anyType
+		}
+		add(t)
+	}
+	if hasNumber {
+		n := 0
+		for _, m := range members {
+			if m != integerType {
+				members[n] = m
+				n++
+			}
+		}
+		members = members[:n]
+	}
+	// Put nil last, so that T | nil is written T?
+	for i, m := range members {
+		if m == nilType && i < len(members)-1 {
+			copy(members[i:], members[i+1:])
+			members[len(members)-1] = nilType
+			break
+		}
+	}
+	if len(members) == 1 {
+		return members[0]
+	}
+	return &unionType{types: members}
+}
+
+// members returns the members of t if it is a union, otherwise t itself.
+func members(t Type) []Type {
+	if u, ok := deref(t).(*unionType); ok {
+		return u.types
+	}
+	return []Type{t}
+}
+
+// withoutNil returns t without nil, e.g. number for number?.
+func withoutNil(t Type) Type {
+	var ts []Type
+	for _, m := range members(t) {
+		if deref(m) != nilType {
+			ts = append(ts, m)
+		}
+	}
+	if len(ts) == 0 {
+		return t
+	}
+	return unionOf(ts...)
+}
+
+// admitsNil returns true if nil can be assigned to t.
+func admitsNil(t Type) bool {
+	for _, m := range members(t) {
+		switch deref(m) {
+		case anyType, nilType:
+			return true
+		}
+	}
+	return false
+}
+
+func typeListString(ts []Type) string {
+	items := make([]string, len(ts))
+	for i, t := range ts {
+		items[i] = t.String()
+	}
+	return strings.Join(items, ", ")
+}
+
+// A typePair is used to avoid infinite recursion when checking whether
+// recursive types are assignable.
+type typePair struct {
+	dst, src Type
+}
+
+// assignable returns true if a value of type src can be assigned to a
+// variable of type dst.
+func assignable(dst, src Type) bool {
+	return assignableRec(dst, src, map[typePair]bool{})
+}
+
+func assignableRec(dst, src Type, seen map[typePair]bool) bool {
+	pair := typePair{dst, src}
+	if seen[pair] {
+		// We are already checking this pair (the types are recursive), so
+		// assume it's fine.
+		return true
+	}
+	seen[pair] = true
+	defer delete(seen, pair)
+	dst, src = deref(dst), deref(src)
+	if dst == anyType || src == anyType || dst == src {
+		return true
+	}
+	if u, ok := src.(*unionType); ok {
+		for _, m := range u.types {
+			if !assignableRec(dst, m, seen) {
+				return false
+			}
+		}
+		return true
+	}
+	switch d := dst.(type) {
+	case *unionType:
+		for _, m := range d.types {
+			if assignableRec(m, src, seen) {
+				return true
+			}
+		}
+		return false
+	case basicType:
+		switch d {
+		case numberType:
+			return src == integerType
+		case tableType:
+			_, ok := src.(*tableShape)
+			return ok
+		case functionType:
+			_, ok := src.(*funcSig)
+			return ok
+		}
+		return false
+	case *tableShape:
+		switch s := src.(type) {
+		case basicType:
+			return s == tableType
+		case *tableShape:
+			return shapeAssignable(d, s, seen)
+		}
+		return false
+	case *funcSig:
+		switch s := src.(type) {
+		case basicType:
+			return s == functionType
+		case *funcSig:
+			return sigAssignable(d, s, seen)
+		}
+		return false
+	}
+	return false
+}
+
+func shapeAssignable(dst, src *tableShape, seen map[typePair]bool) bool {
+	for _, f := range dst.fields {
+		srcType := src.field(f.name)
+		if srcType == nil {
+			if !admitsNil(f.t) {
+				return false
+			}
+		} else if !assignableRec(f.t, srcType, seen) {
+			return false
+		}
+	}
+	if dst.elem != nil && src.elem != nil && !assignableRec(dst.elem, src.elem, seen) {
+		return false
+	}
+	if dst.key != nil {
+		if src.key != nil {
+			if !assignableRec(dst.key, src.key, seen) || !assignableRec(dst.value, src.value, seen) {
+				return false
+			}
+		}
+		if src.elem != nil {
+			if !assignableRec(dst.key, integerType, seen) || !assignableRec(dst.value, src.elem, seen) {
+				return false
+			}
+		}
+		for _, f := range src.fields {
+			if dst.field(f.name) != nil {
+				continue
+			}
+			if !assignableRec(dst.key, stringType, seen) || !assignableRec(dst.value, f.t, seen) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func sigAssignable(dst, src *funcSig, seen map[typePair]bool) bool {
+	// Parameters are contravariant: the arguments the function will be called
+	// with must be accepted by src.
+	for i := 0; i < len(dst.params) || i == len(dst.params) && dst.hasDots; i++ {
+		dstParam := dst.param(i)
+		srcParam := src.param(i)
+		if srcParam == nil {
+			break
+		}
+		if !assignableRec(srcParam, dstParam, seen) {
+			return false
+		}
+	}
+	if !dst.hasReturns || !src.hasReturns {
+		return true
+	}
+	for i, r := range dst.returns {
+		var srcRet Type = nilType
+		if i < len(src.returns) {
+			srcRet = src.returns[i]
+		}
+		if !assignableRec(r, srcRet, seen) {
+			return false
+		}
+	}
+	return true
+}